@@ -11,11 +11,14 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/tinygo-org/tinygo/compileopts"
 	"github.com/tinygo-org/tinygo/compiler"
 	"github.com/tinygo-org/tinygo/goenv"
 	"github.com/tinygo-org/tinygo/interp"
+	"github.com/tinygo-org/tinygo/loader"
+	"github.com/tinygo-org/tinygo/transform"
 )
 
 // Build performs a single package to executable Go build. It takes in a package
@@ -35,6 +38,14 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(stri
 	if len(errs) != 0 {
 		return newMultiError(errs)
 	}
+	if config.Options.CriticalPath {
+		printCriticalPath(c.CriticalPath())
+	}
+	// Remember the package of each symbol, for the size report. This must be
+	// done before optimizations, because the Go SSA is not available anymore
+	// after this point.
+	symbolPackages := c.SymbolPackages()
+
 	if config.Options.PrintIR {
 		fmt.Println("; Generated LLVM IR:")
 		fmt.Println(c.IR())
@@ -43,71 +54,31 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(stri
 		return errors.New("verification error after IR construction")
 	}
 
-	err = interp.Run(c.Module(), config.DumpSSA())
-	if err != nil {
-		return err
-	}
-	if err := c.Verify(); err != nil {
-		return errors.New("verification error after interpreting runtime.initAll")
-	}
-
-	if config.GOOS() != "darwin" {
-		c.ApplyFunctionSections() // -ffunction-sections
-	}
-
-	// Browsers cannot handle external functions that have type i64 because it
-	// cannot be represented exactly in JavaScript (JS only has doubles). To
-	// keep functions interoperable, pass int64 types as pointers to
-	// stack-allocated values.
-	// Use -wasm-abi=generic to disable this behaviour.
-	if config.Options.WasmAbi == "js" && strings.HasPrefix(config.Triple(), "wasm") {
-		err := c.ExternalInt64AsPtr()
+	// Look up the object file of this program in the cache. The cache is only
+	// used when linking: the other output formats need the LLVM module.
+	outext := filepath.Ext(outpath)
+	var cacheKey, cachedObject string
+	if outext != ".o" && outext != ".bc" && outext != ".ll" {
+		cacheKey, err = objectCacheKey(config, c.Packages())
+		if err != nil {
+			return err
+		}
+		cachedObject, err = objectCacheLoad(cacheKey)
 		if err != nil {
 			return err
 		}
 	}
-
-	// Optimization levels here are roughly the same as Clang, but probably not
-	// exactly.
-	errs = nil
-	switch config.Options.Opt {
-	case "none:", "0":
-		errs = c.Optimize(0, 0, 0) // -O0
-	case "1":
-		errs = c.Optimize(1, 0, 0) // -O1
-	case "2":
-		errs = c.Optimize(2, 0, 225) // -O2
-	case "s":
-		errs = c.Optimize(2, 1, 225) // -Os
-	case "z":
-		errs = c.Optimize(2, 2, 5) // -Oz, default
-	default:
-		errs = []error{errors.New("unknown optimization level: -opt=" + config.Options.Opt)}
-	}
-	if len(errs) > 0 {
-		return newMultiError(errs)
-	}
-	if err := c.Verify(); err != nil {
-		return errors.New("verification failure after LLVM optimization passes")
-	}
-
-	// On the AVR, pointers can point either to flash or to RAM, but we don't
-	// know. As a temporary fix, load all global variables in RAM.
-	// In the future, there should be a compiler pass that determines which
-	// pointers are flash and which are in RAM so that pointers can have a
-	// correct address space parameter (address space 1 is for flash).
-	if strings.HasPrefix(config.Triple(), "avr") {
-		c.NonConstGlobals()
-		if err := c.Verify(); err != nil {
-			return errors.New("verification error after making all globals non-constant on AVR")
+	if cachedObject == "" {
+		err := optimizeProgram(c, config)
+		if err != nil {
+			return err
 		}
 	}
 
 	// Generate output.
-	outext := filepath.Ext(outpath)
 	switch outext {
 	case ".o":
-		return c.EmitObject(outpath)
+		return emitRelocatableObject(c, config, outpath)
 	case ".bc":
 		return c.EmitBitcode(outpath)
 	case ".ll":
@@ -122,11 +93,18 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(stri
 		}
 		defer os.RemoveAll(dir)
 
-		// Write the object file.
-		objfile := filepath.Join(dir, "main.o")
-		err = c.EmitObject(objfile)
-		if err != nil {
-			return err
+		// Write the object file, unless it was found in the cache.
+		objfile := cachedObject
+		if objfile == "" {
+			objfile = filepath.Join(dir, "main.o")
+			err = c.EmitObject(objfile)
+			if err != nil {
+				return err
+			}
+			objfile, err = objectCacheStore(objfile, cacheKey)
+			if err != nil {
+				return err
+			}
 		}
 
 		// Load builtins library from the cache, possibly compiling it on the
@@ -160,17 +138,11 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(stri
 		}
 
 		// Compile C files in packages.
-		for i, pkg := range c.Packages() {
-			for _, file := range pkg.CFiles {
-				path := filepath.Join(pkg.Package.Dir, file)
-				outpath := filepath.Join(dir, "pkg"+strconv.Itoa(i)+"-"+file+".o")
-				err := runCCompiler(config.Target.Compiler, append(config.CFlags(), "-c", "-o", outpath, path)...)
-				if err != nil {
-					return &commandError{"failed to build", path, err}
-				}
-				ldflags = append(ldflags, outpath)
-			}
+		cobjs, err := compileCFiles(c, config, dir)
+		if err != nil {
+			return err
 		}
+		ldflags = append(ldflags, cobjs...)
 
 		// Link the object files together.
 		err = link(config.Target.Linker, ldflags...)
@@ -178,22 +150,59 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(stri
 			return &commandError{"failed to link", executable, err}
 		}
 
-		if config.Options.PrintSizes == "short" || config.Options.PrintSizes == "full" {
-			sizes, err := loadProgramSize(executable)
+		// Move the DWARF debug information to a separate file, if requested.
+		// The debug file is named after the output file (if there is one) so
+		// that the debug link in the executable matches the file name.
+		if config.SplitDebug() {
+			if config.GOARCH() == "wasm" {
+				return errors.New("split debug information is not supported for WebAssembly")
+			}
+			var outname string
+			if outpath != "" {
+				outname = strings.TrimSuffix(filepath.Base(outpath), outext)
+			}
+			debugname := outname
+			if debugname == "" {
+				// Temporary output file, for example when flashing.
+				debugname = "main"
+			}
+			debugfile := filepath.Join(dir, debugname+".debug")
+			err := splitDebugInfo(executable, debugfile)
 			if err != nil {
 				return err
 			}
+			if outname != "" {
+				err := copyDebugFile(debugfile, filepath.Dir(outpath))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if config.Options.PrintSizes == "short" || config.Options.PrintSizes == "full" || config.Options.PrintSizes == "summary" || config.Options.SizeReport != "" {
+			sizes, err := loadProgramSize(executable, symbolPackages)
+			if err != nil {
+				return err
+			}
+			if config.Options.SizeReport != "" {
+				err := writeSizeReport(sizes, config.Options.SizeReport)
+				if err != nil {
+					return err
+				}
+			}
 			if config.Options.PrintSizes == "short" {
 				fmt.Printf("   code    data     bss |   flash     ram\n")
-				fmt.Printf("%7d %7d %7d | %7d %7d\n", sizes.Code, sizes.Data, sizes.BSS, sizes.Code+sizes.Data, sizes.Data+sizes.BSS)
-			} else {
+				fmt.Printf("%7d %7d %7d | %7d %7d\n", sizes.Code, sizes.Data, sizes.BSS, sizes.Code+sizes.Data, sizes.RAM())
+			} else if config.Options.PrintSizes == "full" {
 				fmt.Printf("   code  rodata    data     bss |   flash     ram | package\n")
 				for _, name := range sizes.sortedPackageNames() {
 					pkgSize := sizes.Packages[name]
 					fmt.Printf("%7d %7d %7d %7d | %7d %7d | %s\n", pkgSize.Code, pkgSize.ROData, pkgSize.Data, pkgSize.BSS, pkgSize.Flash(), pkgSize.RAM(), name)
 				}
 				fmt.Printf("%7d %7d %7d %7d | %7d %7d | (sum)\n", sizes.Sum.Code, sizes.Sum.ROData, sizes.Sum.Data, sizes.Sum.BSS, sizes.Sum.Flash(), sizes.Sum.RAM())
-				fmt.Printf("%7d       - %7d %7d | %7d %7d | (all)\n", sizes.Code, sizes.Data, sizes.BSS, sizes.Code+sizes.Data, sizes.Data+sizes.BSS)
+				fmt.Printf("%7d       - %7d %7d | %7d %7d | (all)\n", sizes.Code, sizes.Data, sizes.BSS, sizes.Code+sizes.Data, sizes.RAM())
+			} else if config.Options.PrintSizes == "summary" {
+				printSizeSummary(sizes)
 			}
 		}
 
@@ -215,3 +224,169 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(stri
 		return action(tmppath)
 	}
 }
+
+// optimizeProgram runs the interpreter for package initializers and all
+// optimization passes on the compiled program, to get it ready for code
+// generation.
+func optimizeProgram(c *compiler.Compiler, config *compileopts.Config) error {
+	err := interp.Run(c.Module(), config.DumpSSA())
+	if err != nil {
+		return err
+	}
+	if err := c.Verify(); err != nil {
+		return errors.New("verification error after interpreting runtime.initAll")
+	}
+
+	if config.GOOS() != "darwin" {
+		c.ApplyFunctionSections() // -ffunction-sections
+	}
+
+	// Browsers cannot handle external functions that have type i64 because it
+	// cannot be represented exactly in JavaScript (JS only has doubles). To
+	// keep functions interoperable, pass int64 types as pointers to
+	// stack-allocated values.
+	// Use -wasm-abi=generic to disable this behaviour.
+	if config.Options.WasmAbi == "js" && strings.HasPrefix(config.Triple(), "wasm") {
+		err := c.ExternalInt64AsPtr()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Optimization levels here are roughly the same as Clang, but probably not
+	// exactly.
+	var errs []error
+	switch config.Options.Opt {
+	case "none:", "0":
+		errs = c.Optimize(0, 0, 0) // -O0
+	case "1":
+		errs = c.Optimize(1, 0, 0) // -O1
+	case "2":
+		errs = c.Optimize(2, 0, 225) // -O2
+	case "s":
+		errs = c.Optimize(2, 1, 225) // -Os
+	case "z":
+		errs = c.Optimize(2, 2, 5) // -Oz, default
+	default:
+		errs = []error{errors.New("unknown optimization level: -opt=" + config.Options.Opt)}
+	}
+	if len(errs) > 0 {
+		return newMultiError(errs)
+	}
+	if err := c.Verify(); err != nil {
+		return errors.New("verification failure after LLVM optimization passes")
+	}
+
+	// Pack small read-only globals together, if requested. This must happen
+	// after optimization so that unused globals have already been removed.
+	if config.PackGlobals() {
+		transform.PackGlobals(c.Module())
+		if err := c.Verify(); err != nil {
+			return errors.New("verification failure after packing globals")
+		}
+	}
+
+	// Store the initial values of large global variables compressed, if
+	// requested. Like packing, this must happen after optimization.
+	if config.CompressData() {
+		transform.CompressGlobals(c.Module())
+		if err := c.Verify(); err != nil {
+			return errors.New("verification failure after compressing globals")
+		}
+	}
+
+	// On the AVR, pointers can point either to flash or to RAM, but we don't
+	// know. As a temporary fix, load all global variables in RAM.
+	// In the future, there should be a compiler pass that determines which
+	// pointers are flash and which are in RAM so that pointers can have a
+	// correct address space parameter (address space 1 is for flash).
+	if strings.HasPrefix(config.Triple(), "avr") {
+		c.NonConstGlobals()
+		if err := c.Verify(); err != nil {
+			return errors.New("verification error after making all globals non-constant on AVR")
+		}
+	}
+	return nil
+}
+
+// compileCFiles compiles the C files of all packages (for cgo) into object files
+// in the given directory, and returns the paths to these object files.
+func compileCFiles(c *compiler.Compiler, config *compileopts.Config, dir string) ([]string, error) {
+	var objs []string
+	for i, pkg := range c.Packages() {
+		for _, file := range pkg.CFiles {
+			path := filepath.Join(pkg.Package.Dir, file)
+			outpath := filepath.Join(dir, "pkg"+strconv.Itoa(i)+"-"+file+".o")
+			err := runCCompiler(config.Target.Compiler, append(config.CFlags(), "-c", "-o", outpath, path)...)
+			if err != nil {
+				return nil, &commandError{"failed to build", path, err}
+			}
+			objs = append(objs, outpath)
+		}
+	}
+	return objs, nil
+}
+
+// emitRelocatableObject writes the program as a single relocatable object file,
+// to be linked into a larger program by an external linker. Exported functions
+// are regular global symbols with the C calling convention of the target.
+//
+// The C files of packages are compiled and merged into the object file with a
+// relocatable link, so that the external linker doesn't need to know about
+// them. The extra files of the target (like the startup code of a chip) and
+// the compiler runtime library are left out, as the program it is linked into
+// is expected to provide those.
+func emitRelocatableObject(c *compiler.Compiler, config *compileopts.Config, outpath string) error {
+	hasCFiles := false
+	for _, pkg := range c.Packages() {
+		if len(pkg.CFiles) != 0 {
+			hasCFiles = true
+		}
+	}
+	if !hasCFiles {
+		// Nothing to merge, so write the object file directly.
+		return c.EmitObject(outpath)
+	}
+
+	dir, err := ioutil.TempDir("", "tinygo")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	objfile := filepath.Join(dir, "main.o")
+	err = c.EmitObject(objfile)
+	if err != nil {
+		return err
+	}
+	cobjs, err := compileCFiles(c, config, dir)
+	if err != nil {
+		return err
+	}
+
+	ldflags := []string{"-r", "-o", outpath, objfile}
+	if config.Target.Linker != "ld.lld" && config.Target.Linker != "wasm-ld" {
+		// The linker is a compiler driver like gcc, which adds the C library
+		// and startup files by default.
+		ldflags = append([]string{"-nostdlib"}, ldflags...)
+	}
+	ldflags = append(ldflags, cobjs...)
+	err = link(config.Target.Linker, ldflags...)
+	if err != nil {
+		return &commandError{"failed to link", outpath, err}
+	}
+	return nil
+}
+
+// printCriticalPath prints the chain of packages that determines the minimum
+// compile time, with the compile time of each package and the cumulative time
+// up to and including that package.
+func printCriticalPath(chain []*loader.Package, total time.Duration) {
+	fmt.Printf("critical path (%s):\n", total.Round(time.Microsecond))
+	fmt.Printf("      time  cumulative | package\n")
+	var cumulative time.Duration
+	for _, pkg := range chain {
+		cumulative += pkg.Duration
+		fmt.Printf("%10s  %10s | %s\n", pkg.Duration.Round(time.Microsecond), cumulative.Round(time.Microsecond), pkg.ImportPath)
+	}
+}
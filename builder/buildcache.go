@@ -1,12 +1,17 @@
 package builder
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/tinygo-org/tinygo/compileopts"
 	"github.com/tinygo-org/tinygo/goenv"
+	"github.com/tinygo-org/tinygo/loader"
 )
 
 // Return the newest timestamp of all the file paths passed in. Used to check
@@ -81,6 +86,92 @@ func cacheStore(tmppath, name, configKey string, sourceFiles []string) (string,
 	return cachepath, nil
 }
 
+// objectCacheHits counts the number of times an object file was loaded from the
+// cache, for testing.
+var objectCacheHits int
+
+// objectCacheKey returns the cache key of the object file of a program: a hash
+// of everything that may affect it. This is the compiler itself, the
+// configuration (see compileopts.Config) and the name and contents of every
+// source file of every package in the program.
+func objectCacheKey(config *compileopts.Config, pkgs []*loader.Package) (string, error) {
+	h := sha256.New()
+
+	// Use the size and modification time of the compiler executable as a cheap
+	// stand-in for its version.
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	st, err := os.Stat(executable)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "compiler: %s %d %d\n", executable, st.Size(), st.ModTime().UnixNano())
+
+	// Leave out the options that don't change the object file, so that they
+	// don't cause a cache miss.
+	options := *config.Options
+	options.PrintIR = false
+	options.DumpSSA = false
+	options.PrintSizes = ""
+	options.SizeReport = ""
+	options.CriticalPath = false
+	options.Programmer = ""
+	fmt.Fprintf(h, "options: %#v\n", options)
+	fmt.Fprintf(h, "target: %#v\n", *config.Target)
+	fmt.Fprintf(h, "config: %d %q %#v\n", config.GoMinorVersion, config.ClangHeaders, config.TestConfig)
+
+	for _, pkg := range pkgs {
+		fmt.Fprintf(h, "package: %s %s\n", pkg.ImportPath, pkg.Package.Dir)
+		for _, files := range [][]string{pkg.GoFiles, pkg.CgoFiles, pkg.TestGoFiles, pkg.CFiles, pkg.HFiles} {
+			for _, name := range files {
+				f, err := os.Open(filepath.Join(pkg.Package.Dir, name))
+				if err != nil {
+					return "", err
+				}
+				fmt.Fprintf(h, "file: %s\n", name)
+				_, err = io.Copy(h, f)
+				f.Close()
+				if err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// objectCacheLoad returns the path of the object file with the given key in the
+// cache, or "" if it isn't in the cache.
+func objectCacheLoad(key string) (string, error) {
+	cachepath := filepath.Join(goenv.Get("GOCACHE"), "obj-"+key+".o")
+	_, err := os.Stat(cachepath)
+	if os.IsNotExist(err) {
+		return "", nil // does not exist
+	} else if err != nil {
+		return "", err // cannot stat cache file
+	}
+	objectCacheHits++
+	return cachepath, nil
+}
+
+// objectCacheStore moves the object file at tmppath into the cache under the
+// given key, and returns the new path of the object file.
+func objectCacheStore(tmppath, key string) (string, error) {
+	dir := goenv.Get("GOCACHE")
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return "", err
+	}
+	cachepath := filepath.Join(dir, "obj-"+key+".o")
+	err = moveFile(tmppath, cachepath)
+	if err != nil {
+		return "", err
+	}
+	return cachepath, nil
+}
+
 // moveFile renames the file from src to dst. If renaming doesn't work (for
 // example, the rename crosses a filesystem boundary), the file is copied and
 // the old file is removed.
@@ -0,0 +1,80 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+)
+
+func TestObjectCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a host build")
+	}
+
+	// The package directory is part of the cache key, so the first build in a
+	// new temporary directory is never found in the cache.
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	path := filepath.Join(tmpdir, "main.go")
+	err = ioutil.WriteFile(path, []byte("package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n"), 0666)
+	if err != nil {
+		t.Fatal("could not write test program:", err)
+	}
+
+	build := func(options *compileopts.Options) {
+		t.Helper()
+		config, err := NewConfig(options)
+		if err != nil {
+			t.Fatal("could not create config:", err)
+		}
+		err = Build(path, filepath.Join(tmpdir, "main"), config, func(tmppath string) error {
+			output, err := exec.Command(tmppath).Output()
+			if err != nil {
+				return err
+			}
+			if string(output) != "hello\n" {
+				t.Errorf("unexpected output: %q", output)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal("failed to build:", err)
+		}
+	}
+
+	// Build the same program twice: the second build must reuse the object
+	// file of the first build.
+	hits := objectCacheHits
+	build(&compileopts.Options{Opt: "z"})
+	if objectCacheHits != hits {
+		t.Errorf("first build of a new program was loaded from the cache")
+	}
+	build(&compileopts.Options{Opt: "z"})
+	if objectCacheHits != hits+1 {
+		t.Errorf("second build of an unchanged program was not loaded from the cache")
+	}
+
+	// A change in the configuration must not reuse the cached object file.
+	build(&compileopts.Options{Opt: "1"})
+	if objectCacheHits != hits+1 {
+		t.Errorf("build with different options was loaded from the cache")
+	}
+
+	// Neither must a change in the source code.
+	err = ioutil.WriteFile(path, []byte("package main\n\nfunc main() {\n\tprintln(\"hel\" + \"lo\")\n}\n"), 0666)
+	if err != nil {
+		t.Fatal("could not write test program:", err)
+	}
+	build(&compileopts.Options{Opt: "z"})
+	if objectCacheHits != hits+1 {
+		t.Errorf("build of a changed program was loaded from the cache")
+	}
+}
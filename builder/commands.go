@@ -13,9 +13,10 @@ import (
 // distributions or may not even exist in $PATH, in which case absolute paths
 // may be used.
 var commands = map[string][]string{
-	"clang":   {"clang-9"},
-	"ld.lld":  {"ld.lld-9", "ld.lld"},
-	"wasm-ld": {"wasm-ld-9", "wasm-ld"},
+	"clang":        {"clang-9"},
+	"ld.lld":       {"ld.lld-9", "ld.lld"},
+	"llvm-objcopy": {"llvm-objcopy-9", "llvm-objcopy"},
+	"wasm-ld":      {"wasm-ld-9", "wasm-ld"},
 }
 
 func init() {
@@ -24,6 +25,7 @@ func init() {
 	if runtime.GOOS == "darwin" {
 		commands["clang"] = append(commands["clang"], "/usr/local/opt/llvm@9/bin/clang-9")
 		commands["ld.lld"] = append(commands["ld.lld"], "/usr/local/opt/llvm@9/bin/ld.lld")
+		commands["llvm-objcopy"] = append(commands["llvm-objcopy"], "/usr/local/opt/llvm@9/bin/llvm-objcopy")
 		commands["wasm-ld"] = append(commands["wasm-ld"], "/usr/local/opt/llvm@9/bin/wasm-ld")
 	}
 	// Add the path for when LLVM was installed with the installer from
@@ -32,6 +34,7 @@ func init() {
 	if runtime.GOOS == "windows" {
 		commands["clang"] = append(commands["clang"], "clang", "C:\\Program Files\\LLVM\\bin\\clang.exe")
 		commands["ld.lld"] = append(commands["ld.lld"], "lld", "C:\\Program Files\\LLVM\\bin\\lld.exe")
+		commands["llvm-objcopy"] = append(commands["llvm-objcopy"], "C:\\Program Files\\LLVM\\bin\\llvm-objcopy.exe")
 		commands["wasm-ld"] = append(commands["wasm-ld"], "C:\\Program Files\\LLVM\\bin\\wasm-ld.exe")
 	}
 }
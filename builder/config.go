@@ -29,11 +29,61 @@ func NewConfig(options *compileopts.Options) (*compileopts.Config, error) {
 		return nil, fmt.Errorf("requires go version 1.11, 1.12, or 1.13, got go%d.%d", major, minor)
 	}
 	clangHeaderPath := getClangHeaderPath(goenv.Get("TINYGOROOT"))
-	return &compileopts.Config{
+	config := &compileopts.Config{
 		Options:        options,
 		Target:         spec,
 		GoMinorVersion: minor,
 		ClangHeaders:   clangHeaderPath,
 		TestConfig:     options.TestConfig,
-	}, nil
+	}
+	if options.MaxGoroutines != 0 && config.Scheduler() != "tasks" {
+		return nil, errors.New("-max-goroutines is only supported with -scheduler=tasks")
+	}
+	if options.Race {
+		baremetal := false
+		for _, tag := range config.BuildTags() {
+			if tag == "baremetal" {
+				baremetal = true
+			}
+		}
+		if baremetal || (config.GOOS() != "linux" && config.GOOS() != "darwin") {
+			return nil, errors.New("-race is only supported on Linux and macOS hosts")
+		}
+		if config.Scheduler() != "coroutines" {
+			return nil, errors.New("-race is only supported with -scheduler=coroutines")
+		}
+	}
+	if options.CompressData {
+		cortexm := false
+		for _, tag := range config.BuildTags() {
+			if tag == "cortexm" {
+				cortexm = true
+			}
+		}
+		if !cortexm {
+			return nil, errors.New("-compress-data is only supported on Cortex-M")
+		}
+	}
+	if options.GCMetadataSize != 0 {
+		if config.GC() != "conservative" {
+			return nil, errors.New("-gc-metadata-size is only supported with -gc=conservative")
+		}
+		cortexm := false
+		for _, tag := range config.BuildTags() {
+			if tag == "cortexm" {
+				cortexm = true
+			}
+		}
+		if !cortexm {
+			return nil, errors.New("-gc-metadata-size is only supported on Cortex-M")
+		}
+		// An MPU region must have a power of two size of at least 32 bytes,
+		// and must be aligned to its size. The linker script takes care of
+		// the alignment.
+		size := options.GCMetadataSize
+		if size < 32 || size&(size-1) != 0 {
+			return nil, errors.New("-gc-metadata-size must be a power of two of at least 32 bytes")
+		}
+	}
+	return config, nil
 }
@@ -0,0 +1,36 @@
+package builder
+
+// This file splits DWARF debug information off of a linked executable into a
+// separate companion file, much like `objcopy --only-keep-debug` does.
+
+import (
+	"io/ioutil"
+	"path/filepath"
+)
+
+// splitDebugInfo moves all debug sections from the given executable into
+// debugfile. The executable is stripped of its debug information and gets a
+// .gnu_debuglink section pointing to the debug file, so that debuggers like GDB
+// can find the symbols again when the two files are stored in the same
+// directory.
+func splitDebugInfo(executable, debugfile string) error {
+	err := execCommand(commands["llvm-objcopy"], "--only-keep-debug", executable, debugfile)
+	if err != nil {
+		return &commandError{"failed to extract debug info from", executable, err}
+	}
+	err = execCommand(commands["llvm-objcopy"], "--strip-debug", "--add-gnu-debuglink="+debugfile, executable)
+	if err != nil {
+		return &commandError{"failed to strip debug info from", executable, err}
+	}
+	return nil
+}
+
+// copyDebugFile copies the debug file created by splitDebugInfo to the
+// directory of the output file, so that it is stored next to the binary.
+func copyDebugFile(debugfile, outdir string) error {
+	data, err := ioutil.ReadFile(debugfile)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(outdir, filepath.Base(debugfile)), data, 0666)
+}
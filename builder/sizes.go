@@ -2,7 +2,13 @@ package builder
 
 import (
 	"debug/elf"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -11,10 +17,24 @@ type programSize struct {
 	Packages map[string]*packageSize
 	Sum      *packageSize
 	Code     uint64
+	RAMCode  uint64 // code that is copied to RAM to run from there (part of Code)
+	ROData   uint64
 	Data     uint64
 	BSS      uint64
+	Stack    uint64       // reserved stack size, if known (part of BSS)
+	Largest  []symbolSize // largest symbols, largest first
 }
 
+// symbolSize is the size of a single symbol in the linked program.
+type symbolSize struct {
+	Name    string
+	Section string
+	Size    uint64
+}
+
+// Number of symbols to keep in programSize.Largest.
+const numLargestSymbols = 10
+
 // sortedPackageNames returns the list of package names (ProgramSize.Packages)
 // sorted alphabetically.
 func (ps *programSize) sortedPackageNames() []string {
@@ -29,10 +49,11 @@ func (ps *programSize) sortedPackageNames() []string {
 // packageSize contains the size of a package, calculated from the linked object
 // file.
 type packageSize struct {
-	Code   uint64
-	ROData uint64
-	Data   uint64
-	BSS    uint64
+	Code    uint64
+	RAMCode uint64 // part of Code
+	ROData  uint64
+	Data    uint64
+	BSS     uint64
 }
 
 // Flash usage in regular microcontrollers.
@@ -42,7 +63,12 @@ func (ps *packageSize) Flash() uint64 {
 
 // Static RAM usage in regular microcontrollers.
 func (ps *packageSize) RAM() uint64 {
-	return ps.Data + ps.BSS
+	return ps.RAMCode + ps.Data + ps.BSS
+}
+
+// RAM returns the static RAM usage of the whole program.
+func (ps *programSize) RAM() uint64 {
+	return ps.RAMCode + ps.Data + ps.BSS
 }
 
 type symbolList []elf.Symbol
@@ -66,8 +92,10 @@ func (l symbolList) Swap(i, j int) {
 }
 
 // loadProgramSize calculate a program/data size breakdown of each package for a
-// given ELF file.
-func loadProgramSize(path string) (*programSize, error) {
+// given ELF file. The symbolPackages map, if not nil, is used to find the
+// package of a symbol. Symbols not in this map are attributed to a package
+// based on their name.
+func loadProgramSize(path string, symbolPackages map[string]string) (*programSize, error) {
 	file, err := elf.Open(path)
 	if err != nil {
 		return nil, err
@@ -75,6 +103,8 @@ func loadProgramSize(path string) (*programSize, error) {
 	defer file.Close()
 
 	var sumCode uint64
+	var sumRAMCode uint64
+	var sumROData uint64
 	var sumData uint64
 	var sumBSS uint64
 	for _, section := range file.Sections {
@@ -88,8 +118,13 @@ func loadProgramSize(path string) (*programSize, error) {
 			sumBSS += section.Size
 		} else if section.Flags&elf.SHF_EXECINSTR != 0 {
 			sumCode += section.Size
+			if runsFromRAM(file, section) {
+				sumRAMCode += section.Size
+			}
 		} else if section.Flags&elf.SHF_WRITE != 0 {
 			sumData += section.Size
+		} else {
+			sumROData += section.Size
 		}
 	}
 
@@ -97,8 +132,14 @@ func loadProgramSize(path string) (*programSize, error) {
 	if err != nil {
 		return nil, err
 	}
+	var stackSize uint64
 	symbols := make([]elf.Symbol, 0, len(allSymbols))
 	for _, symbol := range allSymbols {
+		if symbol.Name == "_stack_size" && symbol.Section == elf.SHN_ABS {
+			// Defined in the linker script of most microcontrollers.
+			stackSize = symbol.Value
+			continue
+		}
 		symType := elf.ST_TYPE(symbol.Info)
 		if symbol.Size == 0 {
 			continue
@@ -118,16 +159,20 @@ func loadProgramSize(path string) (*programSize, error) {
 	sort.Sort(symbolList(symbols))
 
 	sizes := map[string]*packageSize{}
+	var largest []symbolSize
 	var lastSymbolValue uint64
 	for _, symbol := range symbols {
 		symType := elf.ST_TYPE(symbol.Info)
 		//bind := elf.ST_BIND(symbol.Info)
 		section := file.Sections[symbol.Section]
-		pkgName := "(bootstrap)"
-		symName := strings.TrimLeft(symbol.Name, "(*")
-		dot := strings.IndexByte(symName, '.')
-		if dot > 0 {
-			pkgName = symName[:dot]
+		pkgName, ok := symbolPackages[symbol.Name]
+		if !ok {
+			pkgName = "(bootstrap)"
+			symName := strings.TrimLeft(symbol.Name, "(*")
+			dot := strings.IndexByte(symName, '.')
+			if dot > 0 {
+				pkgName = symName[:dot]
+			}
 		}
 		pkgSize := sizes[pkgName]
 		if pkgSize == nil {
@@ -137,6 +182,9 @@ func loadProgramSize(path string) (*programSize, error) {
 		if lastSymbolValue != symbol.Value || lastSymbolValue == 0 {
 			if symType == elf.STT_FUNC {
 				pkgSize.Code += symbol.Size
+				if runsFromRAM(file, section) {
+					pkgSize.RAMCode += symbol.Size
+				}
 			} else if section.Flags&elf.SHF_WRITE != 0 {
 				if section.Type == elf.SHT_NOBITS {
 					pkgSize.BSS += symbol.Size
@@ -146,17 +194,129 @@ func loadProgramSize(path string) (*programSize, error) {
 			} else {
 				pkgSize.ROData += symbol.Size
 			}
+			largest = append(largest, symbolSize{symbol.Name, section.Name, symbol.Size})
 		}
 		lastSymbolValue = symbol.Value
 	}
+	sort.SliceStable(largest, func(i, j int) bool {
+		return largest[i].Size > largest[j].Size
+	})
+	if len(largest) > numLargestSymbols {
+		largest = largest[:numLargestSymbols]
+	}
 
 	sum := &packageSize{}
 	for _, pkg := range sizes {
 		sum.Code += pkg.Code
+		sum.RAMCode += pkg.RAMCode
 		sum.ROData += pkg.ROData
 		sum.Data += pkg.Data
 		sum.BSS += pkg.BSS
 	}
 
-	return &programSize{Packages: sizes, Code: sumCode, Data: sumData, BSS: sumBSS, Sum: sum}, nil
+	return &programSize{
+		Packages: sizes,
+		Code:     sumCode,
+		RAMCode:  sumRAMCode,
+		ROData:   sumROData,
+		Data:     sumData,
+		BSS:      sumBSS,
+		Stack:    stackSize,
+		Largest:  largest,
+		Sum:      sum,
+	}, nil
+}
+
+// runsFromRAM returns whether the given section is stored in flash but copied
+// to RAM at startup, like the .ramfunc section with functions that must run
+// from RAM. Such a section is in a segment of which the load address differs
+// from the address it is used at.
+func runsFromRAM(file *elf.File, section *elf.Section) bool {
+	for _, prog := range file.Progs {
+		if prog.Type != elf.PT_LOAD {
+			continue
+		}
+		if section.Addr >= prog.Vaddr && section.Addr < prog.Vaddr+prog.Memsz {
+			return prog.Paddr != prog.Vaddr
+		}
+	}
+	return false
+}
+
+// printSizeSummary prints the flash and RAM usage of the program, calculated
+// from the section sizes, followed by the largest symbols. This is similar to
+// the output of the size utility.
+func printSizeSummary(sizes *programSize) {
+	fmt.Printf("flash used: %d bytes (code %d, rodata %d, data %d)\n", sizes.Code+sizes.ROData+sizes.Data, sizes.Code, sizes.ROData, sizes.Data)
+	ram := fmt.Sprintf("ram used:   %d bytes (", sizes.RAM())
+	if sizes.RAMCode != 0 {
+		ram += fmt.Sprintf("code %d, ", sizes.RAMCode)
+	}
+	ram += fmt.Sprintf("data %d, bss %d", sizes.Data, sizes.BSS)
+	if sizes.Stack != 0 {
+		ram += fmt.Sprintf(", including %d bytes of stack", sizes.Stack)
+	}
+	fmt.Println(ram + ")")
+	fmt.Printf("largest symbols:\n")
+	fmt.Printf("    size  section          symbol\n")
+	for _, symbol := range sizes.Largest {
+		fmt.Printf("%8d  %-16s %s\n", symbol.Size, symbol.Section, symbol.Name)
+	}
+}
+
+// writeSizeReport writes the size of each package to the given file, sorted by
+// flash size (largest first). The file is written as JSON if it has a .json
+// extension, and as CSV otherwise.
+func writeSizeReport(sizes *programSize, path string) error {
+	type reportLine struct {
+		Package string `json:"package"`
+		Code    uint64 `json:"code"`
+		ROData  uint64 `json:"rodata"`
+		Data    uint64 `json:"data"`
+		BSS     uint64 `json:"bss"`
+		Flash   uint64 `json:"flash"`
+		RAM     uint64 `json:"ram"`
+	}
+	report := make([]reportLine, 0, len(sizes.Packages))
+	for _, name := range sizes.sortedPackageNames() {
+		pkgSize := sizes.Packages[name]
+		report = append(report, reportLine{name, pkgSize.Code, pkgSize.ROData, pkgSize.Data, pkgSize.BSS, pkgSize.Flash(), pkgSize.RAM()})
+	}
+	sort.SliceStable(report, func(i, j int) bool {
+		return report[i].Flash > report[j].Flash
+	})
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if filepath.Ext(path) == ".json" {
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "\t")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+		return f.Close()
+	}
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"package", "code", "rodata", "data", "bss", "flash", "ram"})
+	for _, line := range report {
+		w.Write([]string{
+			line.Package,
+			strconv.FormatUint(line.Code, 10),
+			strconv.FormatUint(line.ROData, 10),
+			strconv.FormatUint(line.Data, 10),
+			strconv.FormatUint(line.BSS, 10),
+			strconv.FormatUint(line.Flash, 10),
+			strconv.FormatUint(line.RAM, 10),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
 }
@@ -1302,6 +1302,33 @@ func (p *cgoPackage) walker(cursor *astutil.Cursor) bool {
 	return true
 }
 
+// markPacked inserts a zero-length $packed field at the start of the fields of
+// a packed C struct. The compiler lays out a struct that starts with this field
+// without padding and with an alignment of 1, to match the C layout.
+func markPacked(fieldList *ast.FieldList, pos token.Pos) {
+	field := &ast.Field{
+		Names: []*ast.Ident{
+			&ast.Ident{
+				NamePos: pos,
+				Name:    "$packed",
+			},
+		},
+		Type: &ast.ArrayType{
+			Lbrack: pos,
+			Len: &ast.BasicLit{
+				ValuePos: pos,
+				Kind:     token.INT,
+				Value:    "0",
+			},
+			Elt: &ast.Ident{
+				NamePos: pos,
+				Name:    "byte",
+			},
+		},
+	}
+	fieldList.List = append([]*ast.Field{field}, fieldList.List...)
+}
+
 // renameFieldKeywords renames all reserved words in Go to some other field name
 // with a "_" prefix. For example, it renames `type` to `_type`.
 //
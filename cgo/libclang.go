@@ -615,18 +615,35 @@ func (p *cgoPackage) makeASTRecordType(cursor C.GoCXCursor, pos token.Pos) *elab
 	var bitfieldList []bitfieldInfo
 	inBitfield := false
 	bitfieldNum := 0
+	packed := false
+	maxAlign := int64(1)
 	ref := storedRefs.Put(struct {
 		fieldList    *ast.FieldList
 		pkg          *cgoPackage
 		inBitfield   *bool
 		bitfieldNum  *int
 		bitfieldList *[]bitfieldInfo
-	}{fieldList, p, &inBitfield, &bitfieldNum, &bitfieldList})
+		packed       *bool
+		maxAlign     *int64
+	}{fieldList, p, &inBitfield, &bitfieldNum, &bitfieldList, &packed, &maxAlign})
 	defer storedRefs.Remove(ref)
 	C.tinygo_clang_visitChildren(cursor, C.CXCursorVisitor(C.tinygo_clang_struct_visitor), C.CXClientData(ref))
 	renameFieldKeywords(fieldList)
 	switch C.tinygo_clang_getCursorKind(cursor) {
 	case C.CXCursor_StructDecl:
+		// A packed struct (using __attribute__((packed)) or #pragma pack) has
+		// less alignment than its fields, which means there may be fields at
+		// unaligned offsets and there is no padding at the end.
+		align := int64(C.clang_Type_getAlignOf(C.tinygo_clang_getCursorType(cursor)))
+		if packed || align < maxAlign {
+			if align != 1 {
+				p.addError(pos, fmt.Sprintf("packed struct with an alignment of %d is not supported, only an alignment of 1", align))
+			} else if bitfieldList != nil {
+				p.addError(pos, "bitfield in a packed struct is not supported")
+			} else {
+				markPacked(fieldList, pos)
+			}
+		}
 		return &elaboratedTypeInfo{
 			typeExpr: &ast.StructType{
 				Struct: pos,
@@ -682,6 +699,8 @@ func tinygo_clang_struct_visitor(c, parent C.GoCXCursor, client_data C.CXClientD
 		inBitfield   *bool
 		bitfieldNum  *int
 		bitfieldList *[]bitfieldInfo
+		packed       *bool
+		maxAlign     *int64
 	})
 	fieldList := passed.fieldList
 	p := passed.pkg
@@ -712,7 +731,16 @@ func tinygo_clang_struct_visitor(c, parent C.GoCXCursor, client_data C.CXClientD
 	}
 	offsetof := int64(C.clang_Type_getOffsetOf(C.tinygo_clang_getCursorType(parent), C.CString(name)))
 	alignOf := int64(C.clang_Type_getAlignOf(typ) * 8)
+	if alignOf/8 > *passed.maxAlign {
+		*passed.maxAlign = alignOf / 8
+	}
 	bitfieldOffset := offsetof % alignOf
+	if bitfieldOffset != 0 && offsetof%8 == 0 && C.tinygo_clang_Cursor_isBitField(c) != 1 {
+		// A regular field at an unaligned offset, which is only possible in a
+		// packed struct.
+		*passed.packed = true
+		bitfieldOffset = 0
+	}
 	if bitfieldOffset != 0 {
 		if C.tinygo_clang_Cursor_isBitField(c) != 1 {
 			p.addError(pos, "expected a bitfield")
@@ -104,6 +104,13 @@ typedef struct {
 	unsigned char e : 3;
 	// Note that C++ allows bitfields bigger than the underlying type.
 } bitfield_t;
+
+// Packed structs, which have fields at unaligned offsets.
+struct packed {
+	unsigned char a;
+	int           b;
+	short         c;
+} __attribute__((packed));
 */
 import "C"
 
@@ -140,6 +147,9 @@ var (
 
 	// Arrays.
 	_ C.myIntArray
+
+	// Packed structs.
+	_ C.struct_packed
 )
 
 // Test bitfield accesses.
@@ -82,6 +82,12 @@ type C.struct_4 struct {
 	d C.uchar
 	e C.uchar
 }
+type C.struct_packed struct {
+	$packed [0]byte
+	a       C.uchar
+	b       C.int
+	c       C.short
+}
 type C.struct_point3d struct {
 	x C.int
 	y C.int
@@ -36,6 +36,11 @@ func (c *Config) CPU() string {
 // RISC-V processor, that could be ["+a", "+c", "+m"]. For many targets, an
 // empty list will be returned.
 func (c *Config) Features() []string {
+	if c.WasmThreads() {
+		// Shared memory needs atomics, and bulk memory for passive data
+		// segments that are initialized only once.
+		return append(append([]string{}, c.Target.Features...), "+atomics", "+bulk-memory")
+	}
 	return c.Target.Features
 }
 
@@ -59,12 +64,50 @@ func (c *Config) BuildTags() []string {
 	for i := 1; i <= c.GoMinorVersion; i++ {
 		tags = append(tags, fmt.Sprintf("go1.%d", i))
 	}
+	if c.StackProtector() {
+		tags = append(tags, "stackprotector")
+	}
+	if c.CompressData() {
+		tags = append(tags, "compressdata")
+	}
+	if c.PanicStrategy() == "host" {
+		tags = append(tags, "panic.host")
+	}
+	if c.Race() {
+		tags = append(tags, "race")
+	}
+	tags = append(tags, memorySizeTags("flash", c.FlashSize())...)
+	tags = append(tags, memorySizeTags("ram", c.RAMSize())...)
 	if extraTags := strings.Fields(c.Options.Tags); len(extraTags) != 0 {
 		tags = append(tags, extraTags...)
 	}
 	return tags
 }
 
+// memorySizeTags returns build tags like ram_gte_1k, ram_gte_2k, etc. for
+// every power of two (in kilobytes) that is less than or equal to the given
+// memory size. This makes it possible to select source files based on the
+// amount of memory in the chip, for example with "// +build ram_gte_64k".
+func memorySizeTags(prefix string, size int64) []string {
+	var tags []string
+	for kb := int64(1); kb*1024 <= size; kb *= 2 {
+		tags = append(tags, fmt.Sprintf("%s_gte_%dk", prefix, kb))
+	}
+	return tags
+}
+
+// FlashSize returns the total flash size of the chip in bytes, or 0 if it is
+// not known (for example, when compiling for a host system).
+func (c *Config) FlashSize() int64 {
+	return c.Target.FlashSize
+}
+
+// RAMSize returns the total RAM size of the chip in bytes, or 0 if it is not
+// known (for example, when compiling for a host system).
+func (c *Config) RAMSize() int64 {
+	return c.Target.RAMSize
+}
+
 // GC returns the garbage collection strategy in use on this platform. Valid
 // values are "none", "leaking", and "conservative".
 func (c *Config) GC() string {
@@ -106,8 +149,9 @@ func (c *Config) Scheduler() string {
 }
 
 // PanicStrategy returns the panic strategy selected for this target. Valid
-// values are "print" (print the panic value, then exit) or "trap" (issue a trap
-// instruction).
+// values are "print" (print the panic value, then exit), "trap" (issue a trap
+// instruction) or "host" (like print, but also keep the panic message for the
+// host to read, only supported on WebAssembly).
 func (c *Config) PanicStrategy() string {
 	return c.Options.PanicStrategy
 }
@@ -119,6 +163,11 @@ func (c *Config) CFlags() []string {
 	for _, flag := range c.Target.CFlags {
 		cflags = append(cflags, strings.Replace(flag, "{root}", goenv.Get("TINYGOROOT"), -1))
 	}
+	if c.WasmThreads() {
+		// The linker refuses to create a shared memory if not all object
+		// files have been compiled with these features.
+		cflags = append(cflags, "-matomics", "-mbulk-memory")
+	}
 	return cflags
 }
 
@@ -138,6 +187,22 @@ func (c *Config) LDFlags() []string {
 		// size).
 		heapSize := (c.Options.HeapSize + (65536 - 1)) &^ (65536 - 1)
 		ldflags = append(ldflags, "--initial-memory="+strconv.FormatInt(heapSize, 10))
+		if c.WasmThreads() {
+			// Shared memory can't grow beyond its maximum, so fix it to the
+			// initial size. It is imported so that every thread can
+			// instantiate the module with the same memory.
+			ldflags = append(ldflags, "--shared-memory", "--import-memory", "--max-memory="+strconv.FormatInt(heapSize, 10))
+		}
+		if !c.Debug() {
+			// wasm-ld emits a "name" section with the names of all functions
+			// (not just the exported ones) for use by debuggers and profilers.
+			// It is considered debug information, so strip it as well.
+			ldflags = append(ldflags, "--strip-debug")
+		}
+	}
+	if c.GCMetadataSize() != 0 {
+		// Used by the linker script to reserve the region.
+		ldflags = append(ldflags, "--defsym=_gc_metadata_size="+strconv.FormatInt(c.GCMetadataSize(), 10))
 	}
 	if c.Target.LinkerScript != "" {
 		ldflags = append(ldflags, "-T", c.Target.LinkerScript)
@@ -148,7 +213,16 @@ func (c *Config) LDFlags() []string {
 // ExtraFiles returns the list of extra files to be built and linked with the
 // executable. This can include extra C and assembly files.
 func (c *Config) ExtraFiles() []string {
-	return c.Target.ExtraFiles
+	files := c.Target.ExtraFiles
+	if c.WasmThreads() {
+		// Atomic operations used by the compiler to implement sync/atomic.
+		files = append(append([]string{}, files...), "targets/wasm_atomics.c")
+	}
+	if c.GOARCH() == "wasm" && c.PanicStrategy() == "host" {
+		// Access to the stack pointer, to reclaim the stack after a panic.
+		files = append(append([]string{}, files...), "targets/wasm_stack.s")
+	}
+	return files
 }
 
 // DumpSSA returns whether to dump Go SSA while compiling (-dumpssa flag). Only
@@ -163,12 +237,105 @@ func (c *Config) VerifyIR() bool {
 	return c.Options.VerifyIR
 }
 
+// PackGlobals returns whether small read-only globals should be packed
+// together in a single global to reduce their overhead (-pack-globals flag).
+func (c *Config) PackGlobals() bool {
+	return c.Options.PackGlobals
+}
+
+// FoldPureCalls returns whether calls to pure functions with constant
+// parameters should be evaluated at compile time (-fold-pure-calls flag).
+func (c *Config) FoldPureCalls() bool {
+	return c.Options.FoldPureCalls
+}
+
+// CompressData returns whether the initial values of large global variables
+// should be stored compressed in flash and be decompressed at startup
+// (-compress-data flag).
+func (c *Config) CompressData() bool {
+	return c.Options.CompressData
+}
+
+// StackProtector returns whether functions should be protected against stack
+// buffer overflows with a stack canary (-stack-protector flag).
+func (c *Config) StackProtector() bool {
+	return c.Options.StackProtector
+}
+
+// CallerTable returns whether functions should record their call sites in a
+// table, so that runtime.Caller and runtime.Callers can report every frame on
+// the stack (-caller-table flag).
+func (c *Config) CallerTable() bool {
+	return c.Options.CallerTable
+}
+
+// MaxGoroutines returns the maximum number of goroutines that may exist at the
+// same time, or 0 if there is no limit (-max-goroutines flag). Only supported
+// by the tasks scheduler.
+func (c *Config) MaxGoroutines() int {
+	return c.Options.MaxGoroutines
+}
+
+// GCMetadataSize returns the size of the fixed region reserved for the GC
+// metadata (-gc-metadata-size flag), or 0 to store the metadata at the start of
+// the heap. Only supported on Cortex-M.
+func (c *Config) GCMetadataSize() int64 {
+	return c.Options.GCMetadataSize
+}
+
+// GlobalValues returns the values of globals to set at build time (-ldflags
+// with -X), as a map of package paths to a map of global names to values.
+func (c *Config) GlobalValues() map[string]map[string]string {
+	return c.Options.GlobalValues
+}
+
+// VerifyPasses returns whether to run the LLVM verifier after each
+// optimization pass, to find which pass introduced invalid IR. This is very
+// slow and only meant for debugging the compiler.
+func (c *Config) VerifyPasses() bool {
+	return c.Options.VerifyPasses
+}
+
 // Debug returns whether to add debug symbols to the IR, for debugging with GDB
 // and similar.
 func (c *Config) Debug() bool {
 	return c.Options.Debug
 }
 
+// Race returns whether the program should be instrumented to detect data races
+// between goroutines at runtime (-race flag).
+func (c *Config) Race() bool {
+	return c.Options.Race
+}
+
+// SplitDebug returns whether the DWARF debug information should be moved to a
+// separate .debug file instead of being embedded in the executable.
+func (c *Config) SplitDebug() bool {
+	return c.Debug() && c.Options.SplitDebug
+}
+
+// TrimPath returns whether file paths in debug information should be based on
+// import paths instead of paths on disk (-trimpath flag), which makes builds
+// reproducible across machines and directories.
+func (c *Config) TrimPath() bool {
+	return c.Options.TrimPath
+}
+
+// WasmThreads returns whether WebAssembly should be emitted with a shared
+// memory and atomic instructions, so that multiple host threads can use the
+// same module instance memory (-wasm-threads flag).
+//
+// Only sync/atomic is made thread safe. Every instance starts with the same
+// stack pointer in linear memory and the heap is not locked, so only one
+// thread (normally the main thread) may run regular Go code. Other threads may
+// only call exported functions that don't allocate, don't start goroutines and
+// don't take the address of local variables (which puts them on the stack in
+// linear memory), such as functions that update counters or flags that are
+// shared with the main thread through sync/atomic.
+func (c *Config) WasmThreads() bool {
+	return c.Options.WasmThreads && c.Target.GOARCH == "wasm"
+}
+
 // Programmer returns the flash method and OpenOCD interface name given a
 // particular configuration. It may either be all configured in the target JSON
 // file or be modified using the -programmmer command-line option.
@@ -217,5 +384,6 @@ func (c *Config) OpenOCDConfiguration() (args []string, err error) {
 
 type TestConfig struct {
 	CompileTestBinary bool
+	Bench             string // regular expression of benchmarks to run, empty for none
 	// TODO: Filter the test functions to run, include verbose flag, etc
 }
@@ -3,21 +3,36 @@ package compileopts
 // Options contains extra options to give to the compiler. These options are
 // usually passed from the command line.
 type Options struct {
-	Target        string
-	Opt           string
-	GC            string
-	PanicStrategy string
-	Scheduler     string
-	PrintIR       bool
-	DumpSSA       bool
-	VerifyIR      bool
-	Debug         bool
-	PrintSizes    string
-	CFlags        []string
-	LDFlags       []string
-	Tags          string
-	WasmAbi       string
-	HeapSize      int64
-	TestConfig    TestConfig
-	Programmer    string
+	Target         string
+	Opt            string
+	GC             string
+	PanicStrategy  string
+	Scheduler      string
+	PrintIR        bool
+	DumpSSA        bool
+	VerifyIR       bool
+	VerifyPasses   bool
+	Debug          bool
+	SplitDebug     bool
+	TrimPath       bool
+	PrintSizes     string
+	SizeReport     string
+	CriticalPath   bool
+	PackGlobals    bool
+	FoldPureCalls  bool
+	CompressData   bool
+	StackProtector bool
+	CallerTable    bool
+	Race           bool
+	CFlags         []string
+	LDFlags        []string
+	GlobalValues   map[string]map[string]string // map[pkgpath]map[varname]value
+	Tags           string
+	WasmAbi        string
+	WasmThreads    bool
+	HeapSize       int64
+	GCMetadataSize int64
+	MaxGoroutines  int
+	TestConfig     TestConfig
+	Programmer     string
 }
@@ -46,6 +46,8 @@ type TargetSpec struct {
 	OpenOCDInterface string   `json:"openocd-interface"`
 	OpenOCDTarget    string   `json:"openocd-target"`
 	OpenOCDTransport string   `json:"openocd-transport"`
+	FlashSize        int64    `json:"flash-size"` // total flash size of the chip in bytes
+	RAMSize          int64    `json:"ram-size"`   // total RAM size of the chip in bytes
 }
 
 // copyProperties copies all properties that are set in spec2 into itself.
@@ -118,6 +120,12 @@ func (spec *TargetSpec) copyProperties(spec2 *TargetSpec) {
 	if spec2.OpenOCDTransport != "" {
 		spec.OpenOCDTransport = spec2.OpenOCDTransport
 	}
+	if spec2.FlashSize != 0 {
+		spec.FlashSize = spec2.FlashSize
+	}
+	if spec2.RAMSize != 0 {
+		spec.RAMSize = spec2.RAMSize
+	}
 }
 
 // load reads a target specification from the JSON in the given io.Reader. It
@@ -1,6 +1,9 @@
 package compileopts
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestLoadTarget(t *testing.T) {
 	_, err := LoadTarget("arduino")
@@ -17,3 +20,36 @@ func TestLoadTarget(t *testing.T) {
 		t.Error("LoadTarget failed for wrong reason:", err)
 	}
 }
+
+func TestMemorySize(t *testing.T) {
+	tests := []struct {
+		target    string
+		flashSize int64
+		ramSize   int64
+		hasTag    string
+		notTag    string
+	}{
+		{"circuitplay-express", 256 * 1024, 32 * 1024, "ram_gte_32k", "ram_gte_64k"},
+		{"feather-m4", 512 * 1024, 192 * 1024, "flash_gte_512k", "ram_gte_256k"},
+	}
+	for _, tc := range tests {
+		spec, err := LoadTarget(tc.target)
+		if err != nil {
+			t.Fatal("could not load target:", err)
+		}
+		config := &Config{Options: &Options{}, Target: spec}
+		if config.FlashSize() != tc.flashSize {
+			t.Errorf("%s: expected flash size %d, got %d", tc.target, tc.flashSize, config.FlashSize())
+		}
+		if config.RAMSize() != tc.ramSize {
+			t.Errorf("%s: expected RAM size %d, got %d", tc.target, tc.ramSize, config.RAMSize())
+		}
+		tags := " " + strings.Join(config.BuildTags(), " ") + " "
+		if !strings.Contains(tags, " "+tc.hasTag+" ") {
+			t.Errorf("%s: expected build tag %s in: %s", tc.target, tc.hasTag, tags)
+		}
+		if strings.Contains(tags, " "+tc.notTag+" ") {
+			t.Errorf("%s: unexpected build tag %s in: %s", tc.target, tc.notTag, tags)
+		}
+	}
+}
@@ -32,7 +32,7 @@ func (c *Compiler) emitLookupBoundsCheck(frame *Frame, arrayLen, index llvm.Valu
 		arrayLen = c.builder.CreateZExt(arrayLen, index.Type(), "")
 	}
 
-	faultBlock := c.ctx.AddBasicBlock(frame.fn.LLVMFn, "lookup.outofbounds")
+	faultBlock := c.getPanicBlock(frame, "lookupPanic", "lookup.outofbounds")
 	nextBlock := c.ctx.AddBasicBlock(frame.fn.LLVMFn, "lookup.next")
 	frame.blockExits[frame.currentBlock] = nextBlock // adjust outgoing block for phi nodes
 
@@ -40,12 +40,7 @@ func (c *Compiler) emitLookupBoundsCheck(frame *Frame, arrayLen, index llvm.Valu
 	outOfBounds := c.builder.CreateICmp(llvm.IntUGE, index, arrayLen, "")
 	c.builder.CreateCondBr(outOfBounds, faultBlock, nextBlock)
 
-	// Fail: this is a nil pointer, exit with a panic.
-	c.builder.SetInsertPointAtEnd(faultBlock)
-	c.createRuntimeCall("lookupPanic", nil, "")
-	c.builder.CreateUnreachable()
-
-	// Ok: this is a valid pointer.
+	// Ok: this is a valid index.
 	c.builder.SetInsertPointAtEnd(nextBlock)
 }
 
@@ -101,7 +96,7 @@ func (c *Compiler) emitSliceBoundsCheck(frame *Frame, capacity, low, high, max l
 		}
 	}
 
-	faultBlock := c.ctx.AddBasicBlock(frame.fn.LLVMFn, "slice.outofbounds")
+	faultBlock := c.getPanicBlock(frame, "slicePanic", "slice.outofbounds")
 	nextBlock := c.ctx.AddBasicBlock(frame.fn.LLVMFn, "slice.next")
 	frame.blockExits[frame.currentBlock] = nextBlock // adjust outgoing block for phi nodes
 
@@ -113,12 +108,7 @@ func (c *Compiler) emitSliceBoundsCheck(frame *Frame, capacity, low, high, max l
 	outOfBounds = c.builder.CreateOr(outOfBounds, outOfBounds3, "slice.lowcap")
 	c.builder.CreateCondBr(outOfBounds, faultBlock, nextBlock)
 
-	// Fail: this is a nil pointer, exit with a panic.
-	c.builder.SetInsertPointAtEnd(faultBlock)
-	c.createRuntimeCall("slicePanic", nil, "")
-	c.builder.CreateUnreachable()
-
-	// Ok: this is a valid pointer.
+	// Ok: this is a valid slice operation.
 	c.builder.SetInsertPointAtEnd(nextBlock)
 }
 
@@ -132,7 +122,7 @@ func (c *Compiler) emitNilCheck(frame *Frame, ptr llvm.Value, blockPrefix string
 	}
 
 	// Check whether this is a nil pointer.
-	faultBlock := c.ctx.AddBasicBlock(frame.fn.LLVMFn, blockPrefix+".nil")
+	faultBlock := c.getPanicBlock(frame, "nilPanic", "nil")
 	nextBlock := c.ctx.AddBasicBlock(frame.fn.LLVMFn, blockPrefix+".next")
 	frame.blockExits[frame.currentBlock] = nextBlock // adjust outgoing block for phi nodes
 
@@ -156,11 +146,67 @@ func (c *Compiler) emitNilCheck(frame *Frame, ptr llvm.Value, blockPrefix string
 	}
 	c.builder.CreateCondBr(isnil, faultBlock, nextBlock)
 
-	// Fail: this is a nil pointer, exit with a panic.
-	c.builder.SetInsertPointAtEnd(faultBlock)
-	c.createRuntimeCall("nilPanic", nil, "")
-	c.builder.CreateUnreachable()
-
 	// Ok: this is a valid pointer.
 	c.builder.SetInsertPointAtEnd(nextBlock)
 }
+
+// emitShiftCheck checks whether the shift count is negative, and panics if it
+// is. Go 1.13 allows signed shift counts, but requires a run-time panic for
+// negative ones. Unsigned and constant shift counts are never negative (the
+// latter is checked by the Go type checker), so they need no check.
+func (c *Compiler) emitShiftCheck(frame *Frame, shift llvm.Value, shiftType types.Type) {
+	if shiftType.Underlying().(*types.Basic).Info()&types.IsUnsigned != 0 {
+		return
+	}
+	if !shift.IsAConstantInt().IsNil() {
+		return
+	}
+
+	faultBlock := c.getPanicBlock(frame, "negativeShiftPanic", "shift.negative")
+	nextBlock := c.ctx.AddBasicBlock(frame.fn.LLVMFn, "shift.next")
+	frame.blockExits[frame.currentBlock] = nextBlock // adjust outgoing block for phi nodes
+
+	// Now do the check: shift < 0
+	negative := c.builder.CreateICmp(llvm.IntSLT, shift, llvm.ConstInt(shift.Type(), 0, false), "")
+	c.builder.CreateCondBr(negative, faultBlock, nextBlock)
+
+	// Ok: this is a valid shift count.
+	c.builder.SetInsertPointAtEnd(nextBlock)
+}
+
+// getPanicBlock returns the block in the current function that calls the given
+// runtime panic function (lookupPanic, slicePanic, nilPanic or
+// negativeShiftPanic), creating it the first time it is needed. All failing
+// checks of the same kind in a function branch to this one block instead of
+// each having their own block with an identical call, which keeps the code
+// size down: the blocks would otherwise differ in their debug location and
+// wouldn't be merged by LLVM.
+// With debug information, the shared panic call is attributed to the start of
+// the function.
+func (c *Compiler) getPanicBlock(frame *Frame, fnName, blockName string) llvm.BasicBlock {
+	if block, ok := frame.panicBlocks[fnName]; ok {
+		return block
+	}
+	if frame.panicBlocks == nil {
+		frame.panicBlocks = make(map[string]llvm.BasicBlock)
+	}
+	block := c.ctx.AddBasicBlock(frame.fn.LLVMFn, blockName)
+	frame.panicBlocks[fnName] = block
+
+	// Create the panic call, and continue where we were afterwards.
+	currentBlock := c.builder.GetInsertBlock()
+	var loc llvm.DebugLoc
+	if c.Debug() {
+		loc = c.builder.GetCurrentDebugLocation()
+		pos := c.ir.Program.Fset.Position(frame.fn.Pos())
+		c.builder.SetCurrentDebugLocation(uint(pos.Line), uint(pos.Column), frame.difunc, llvm.Metadata{})
+	}
+	c.builder.SetInsertPointAtEnd(block)
+	c.createRuntimeCall(fnName, nil, "")
+	c.builder.CreateUnreachable()
+	c.builder.SetInsertPointAtEnd(currentBlock)
+	if c.Debug() {
+		c.builder.SetCurrentDebugLocation(loc.Line, loc.Col, loc.Scope, loc.InlinedAt)
+	}
+	return block
+}
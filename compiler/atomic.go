@@ -0,0 +1,87 @@
+package compiler
+
+// This file implements the sync/atomic package when compiling for WebAssembly
+// with threads. Normally all TinyGo code runs on a single thread and the plain
+// load/store implementations in the runtime are sufficient, but with a shared
+// memory other host threads may access the same memory at the same time so
+// real atomic instructions are needed. These are provided by
+// targets/wasm_atomics.c, which is compiled with the atomics feature enabled.
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
+
+// emitAtomicOp lowers a call to a sync/atomic function to a call to the
+// equivalent function in wasm_atomics.c. It returns false if the function is
+// not supported, in which case a regular call should be emitted.
+func (c *Compiler) emitAtomicOp(frame *Frame, instr *ssa.CallCommon, name string) (llvm.Value, bool) {
+	name = strings.TrimPrefix(name, "sync/atomic.")
+	var op string
+	switch {
+	case strings.HasPrefix(name, "Add"):
+		op = "add"
+	case strings.HasPrefix(name, "Swap"):
+		op = "swap"
+	case strings.HasPrefix(name, "CompareAndSwap"):
+		op = "cas"
+	case strings.HasPrefix(name, "Load"):
+		op = "load"
+	case strings.HasPrefix(name, "Store"):
+		op = "store"
+	default:
+		return llvm.Value{}, false
+	}
+
+	// The C functions work on integers, so pointers (unsafe.Pointer) are
+	// passed as uintptr.
+	ptr := c.getValue(frame, instr.Args[0])
+	c.emitNilCheck(frame, ptr, "deref")
+	valueType := ptr.Type().ElementType()
+	intType := valueType
+	if valueType.TypeKind() == llvm.PointerTypeKind {
+		intType = c.uintptrType
+	}
+	args := []llvm.Value{c.builder.CreateBitCast(ptr, llvm.PointerType(intType, 0), "")}
+	for _, arg := range instr.Args[1:] {
+		value := c.getValue(frame, arg)
+		if value.Type().TypeKind() == llvm.PointerTypeKind {
+			value = c.builder.CreatePtrToInt(value, c.uintptrType, "")
+		}
+		args = append(args, value)
+	}
+
+	var returnType llvm.Type
+	switch op {
+	case "add", "swap", "load":
+		returnType = intType
+	case "cas":
+		returnType = c.ctx.Int32Type()
+	case "store":
+		returnType = c.ctx.VoidType()
+	}
+	fnName := "tinygo_atomic_" + op + strconv.Itoa(intType.IntTypeWidth())
+	fn := c.mod.NamedFunction(fnName)
+	if fn.IsNil() {
+		paramTypes := make([]llvm.Type, len(args))
+		for i, arg := range args {
+			paramTypes[i] = arg.Type()
+		}
+		fn = llvm.AddFunction(c.mod, fnName, llvm.FunctionType(returnType, paramTypes, false))
+	}
+	result := c.builder.CreateCall(fn, args, "")
+
+	switch op {
+	case "cas":
+		return c.builder.CreateICmp(llvm.IntNE, result, llvm.ConstInt(returnType, 0, false), ""), true
+	case "store":
+		return llvm.Value{}, true
+	}
+	if valueType != intType {
+		result = c.builder.CreateIntToPtr(result, valueType, "")
+	}
+	return result, true
+}
@@ -0,0 +1,199 @@
+package compiler
+
+// This file implements runtime.Caller and runtime.Callers. Without any flags,
+// only runtime.Caller(0) is supported, for the common case where it is called
+// to find the location of the call itself, as is done by logging libraries.
+//
+// With the -caller-table flag, every function (outside the runtime) keeps a
+// small frame record on the stack with the call site of the call it is making.
+// The records form a linked list through the parent field, starting at
+// runtime.callerTop, which the runtime walks to find the callers. The call
+// sites are stored as indices in a table of file names, lines and function
+// names, which is emitted as the runtime.callerSites global. As the records
+// are ordinary stack values, they survive inlining: a function that is inlined
+// still reports the call site in the source, not the one of the function it
+// was inlined into.
+
+import (
+	"go/constant"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
+
+// callerSite is a call site in the table emitted with -caller-table.
+type callerSite struct {
+	function string
+	file     string
+	line     int
+}
+
+// emitCaller replaces a call to runtime.Caller(0) with the source location of
+// the call. As the location is known at compile time, this is correct even when
+// the function containing the call is inlined, and it doesn't need any line
+// tables in the binary. It returns false if the call cannot be replaced, in
+// which case the runtime implementation should be called. That happens for
+// example for a non-zero skip value, which would require unwinding the stack.
+func (c *Compiler) emitCaller(frame *Frame, instr *ssa.CallCommon) (llvm.Value, bool) {
+	skip, ok := instr.Args[0].(*ssa.Const)
+	if !ok || skip.Int64() != 0 || instr.Pos() == token.NoPos {
+		return llvm.Value{}, false
+	}
+	pos := c.ir.Program.Fset.Position(instr.Pos())
+
+	// The program counter is not known at compile time, so it is left at 0.
+	results := instr.Signature().Results()
+	result := llvm.Undef(c.getLLVMType(results))
+	values := []llvm.Value{
+		llvm.ConstInt(c.uintptrType, 0, false),
+		c.parseConst(frame.fn.LinkName(), ssa.NewConst(constant.MakeString(c.callerFile(pos.Filename)), types.Typ[types.String])),
+		llvm.ConstInt(c.intType, uint64(pos.Line), false),
+		llvm.ConstInt(c.ctx.Int1Type(), 1, false),
+	}
+	for i, value := range values {
+		result = c.builder.CreateInsertValue(result, value, i, "")
+	}
+	return result, true
+}
+
+// callerFile returns the file name as reported by runtime.Caller.
+func (c *Compiler) callerFile(file string) string {
+	if trimmed, ok := c.trimmedPaths[file]; ok {
+		return trimmed
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		// Source paths are relative to the working directory, but the go tool
+		// returns absolute paths.
+		return abs
+	}
+	return file
+}
+
+// hasCallerFrame returns whether this function keeps a caller frame on the
+// stack with -caller-table. The runtime is excluded, as it reads the frames.
+// Synthetic wrappers are excluded as well: they only forward a call, so the
+// callee can link to the frame of the caller of the wrapper instead.
+func (c *Compiler) hasCallerFrame(frame *Frame) bool {
+	return c.CallerTable() && frame.fn.Pkg != nil && frame.fn.Pkg.Pkg.Path() != "runtime"
+}
+
+// getCallerTop returns the runtime.callerTop global, which points to the
+// innermost caller frame.
+func (c *Compiler) getCallerTop() llvm.Value {
+	return c.getGlobal(c.ir.Program.ImportedPackage("runtime").Members["callerTop"].(*ssa.Global))
+}
+
+// emitCallerFrame creates the caller frame of the function, linked to the
+// frame of the function that called it. It must be called at the start of the
+// entry block.
+func (c *Compiler) emitCallerFrame(frame *Frame) {
+	callerTop := c.getCallerTop()
+	frame.callerFrame = c.builder.CreateAlloca(c.getLLVMRuntimeType("callerFrame"), "caller.frame")
+	frame.callerParent = c.builder.CreateLoad(callerTop, "caller.parent")
+	parent := frame.callerParent
+	if frame.fn.IsExported() {
+		// Exported functions may be called from outside Go (by the host, or
+		// as an interrupt handler), at a time when callerTop doesn't point to
+		// the frame of the code that is running. Start a new list instead.
+		parent = llvm.ConstNull(callerTop.Type().ElementType())
+	}
+	c.builder.CreateStore(parent, c.builder.CreateStructGEP(frame.callerFrame, 0, "caller.frame.parent"))
+	c.builder.CreateStore(llvm.ConstInt(c.uintptrType, 0, false), c.builder.CreateStructGEP(frame.callerFrame, 1, "caller.frame.site"))
+}
+
+// emitCallerSite records the call site of the call that is about to be made
+// in the caller frame.
+func (c *Compiler) emitCallerSite(frame *Frame, pos token.Pos) {
+	if pos == token.NoPos {
+		return
+	}
+	position := c.ir.Program.Fset.Position(pos)
+	c.callerSites = append(c.callerSites, callerSite{
+		function: frame.fn.RelString(nil),
+		file:     c.callerFile(position.Filename),
+		line:     position.Line,
+	})
+	site := llvm.ConstInt(c.uintptrType, uint64(len(c.callerSites)), false)
+	c.builder.CreateStore(site, c.builder.CreateStructGEP(frame.callerFrame, 1, "caller.frame.site"))
+}
+
+// finishCallerFrame makes callerTop point to the caller frame of the function
+// before every call it makes, and restores callerTop before it returns. This is
+// done on the LLVM IR once the function is complete, so that it also covers
+// calls that are inserted by the compiler, such as deferred calls.
+func (c *Compiler) finishCallerFrame(frame *Frame) {
+	callerTop := c.getCallerTop()
+	for bb := frame.fn.LLVMFn.FirstBasicBlock(); !bb.IsNil(); bb = llvm.NextBasicBlock(bb) {
+		for inst := bb.FirstInstruction(); !inst.IsNil(); inst = llvm.NextInstruction(inst) {
+			switch {
+			case inst.InstructionOpcode() == llvm.Ret:
+				c.builder.SetInsertPointBefore(inst)
+				c.builder.CreateStore(frame.callerParent, callerTop)
+			case !inst.IsACallInst().IsNil():
+				callee := inst.CalledValue()
+				if !callee.IsAInlineAsm().IsNil() || strings.HasPrefix(callee.Name(), "llvm.") {
+					// Not a real call.
+					continue
+				}
+				value := frame.callerFrame
+				if c.isGoroutineStart(callee) {
+					// A new goroutine doesn't have any callers. The coroutine
+					// of the goroutine may outlive this function.
+					value = llvm.ConstNull(frame.callerFrame.Type())
+				}
+				c.builder.SetInsertPointBefore(inst)
+				c.builder.CreateStore(value, callerTop)
+			}
+		}
+	}
+}
+
+// isGoroutineStart returns whether this callee is the start of a new goroutine
+// with the coroutines scheduler, which calls the goroutine function directly.
+// Such calls are marked with runtime.makeGoroutine, see emitStartGoroutine.
+func (c *Compiler) isGoroutineStart(callee llvm.Value) bool {
+	inttoptr := callee.IsAIntToPtrInst()
+	if inttoptr.IsNil() {
+		return false
+	}
+	call := inttoptr.Operand(0).IsACallInst()
+	return !call.IsNil() && call.CalledValue().Name() == "runtime.makeGoroutine"
+}
+
+// createCallerSites emits the call site table, in the runtime.callerSites
+// global.
+func (c *Compiler) createCallerSites() {
+	global := c.getGlobal(c.ir.Program.ImportedPackage("runtime").Members["callerSites"].(*ssa.Global))
+	siteType := c.getLLVMRuntimeType("callerSite")
+	stringValues := map[string]llvm.Value{}
+	getString := func(s string) llvm.Value {
+		if value, ok := stringValues[s]; ok {
+			return value
+		}
+		value := c.parseConst("runtime.callerSites", ssa.NewConst(constant.MakeString(s), types.Typ[types.String]))
+		stringValues[s] = value
+		return value
+	}
+	sites := make([]llvm.Value, len(c.callerSites))
+	for i, site := range c.callerSites {
+		sites[i] = llvm.ConstNamedStruct(siteType, []llvm.Value{
+			getString(site.function),
+			getString(site.file),
+			llvm.ConstInt(c.intType, uint64(site.line), false),
+		})
+	}
+	table := llvm.AddGlobal(c.mod, llvm.ArrayType(siteType, len(sites)), "runtime.callerSites$table")
+	table.SetInitializer(llvm.ConstArray(siteType, sites))
+	table.SetGlobalConstant(true)
+	table.SetLinkage(llvm.InternalLinkage)
+	length := llvm.ConstInt(c.uintptrType, uint64(len(sites)), false)
+	global.SetInitializer(c.ctx.ConstStruct([]llvm.Value{
+		llvm.ConstBitCast(table, llvm.PointerType(siteType, 0)),
+		length,
+		length,
+	}, false))
+}
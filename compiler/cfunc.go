@@ -0,0 +1,118 @@
+package compiler
+
+// This file implements the tinygo.CFunc builtin, which makes it possible to
+// pass a Go func value (including closures) to C code as a callback.
+
+import (
+	"go/types"
+
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
+
+// emitCFunc implements tinygo.CFunc. It returns a pointer to a trampoline
+// function with the C calling convention and a context pointer to pass to
+// this trampoline as the last parameter. For example, for a func value with
+// the following signature:
+//
+//     func(a, b C.int) C.int
+//
+// a trampoline like this is created, which is shared between all func values
+// with the same signature:
+//
+//     int trampoline(int a, int b, void *context) {
+//         func(a, b C.int) C.int fn = *context;
+//         return fn(a, b);
+//     }
+//
+// The context is a heap allocated copy of the func value.
+func (c *Compiler) emitCFunc(frame *Frame, instr *ssa.CallCommon) (llvm.Value, error) {
+	// The parameter is an interface{}, but the type of the func value must be
+	// known at compile time to create the trampoline.
+	makeInterface, ok := instr.Args[0].(*ssa.MakeInterface)
+	if !ok {
+		return llvm.Value{}, c.makeError(instr.Pos(), "tinygo.CFunc: parameter must be a func value")
+	}
+	sig, ok := makeInterface.X.Type().Underlying().(*types.Signature)
+	if !ok {
+		return llvm.Value{}, c.makeError(instr.Pos(), "tinygo.CFunc: parameter must be a func value, not "+makeInterface.X.Type().String())
+	}
+	if sig.Results().Len() > 1 {
+		return llvm.Value{}, c.makeError(instr.Pos(), "tinygo.CFunc: func value must not have more than one result")
+	}
+	for _, vars := range []*types.Tuple{sig.Params(), sig.Results()} {
+		for i := 0; i < vars.Len(); i++ {
+			if !isCCompatible(vars.At(i).Type()) {
+				return llvm.Value{}, c.makeError(instr.Pos(), "tinygo.CFunc: unsupported parameter or result type: "+vars.At(i).Type().String())
+			}
+		}
+	}
+
+	funcValue := c.getValue(frame, makeInterface.X)
+	context := c.emitPointerPack([]llvm.Value{funcValue})
+	trampoline := c.getCFuncTrampoline(sig)
+
+	result := llvm.Undef(c.ctx.StructType([]llvm.Type{c.i8ptrType, c.i8ptrType}, false))
+	result = c.builder.CreateInsertValue(result, c.builder.CreateBitCast(trampoline, c.i8ptrType, ""), 0, "")
+	result = c.builder.CreateInsertValue(result, context, 1, "")
+	return result, nil
+}
+
+// getCFuncTrampoline returns the C calling convention trampoline for func
+// values of the given signature, creating it if needed.
+func (c *Compiler) getCFuncTrampoline(sig *types.Signature) llvm.Value {
+	name := "tinygo.cfunc:" + sig.String()
+	trampoline := c.mod.NamedFunction(name)
+	if !trampoline.IsNil() {
+		return trampoline
+	}
+
+	// Save the current position in the IR builder.
+	currentBlock := c.builder.GetInsertBlock()
+	defer c.builder.SetInsertPointAtEnd(currentBlock)
+
+	// The parameters of a C compatible func value are passed as-is, followed
+	// by the context parameter.
+	var paramTypes []llvm.Type
+	for i := 0; i < sig.Params().Len(); i++ {
+		paramTypes = append(paramTypes, c.getLLVMType(sig.Params().At(i).Type()))
+	}
+	paramTypes = append(paramTypes, c.i8ptrType)
+	returnType := c.ctx.VoidType()
+	if sig.Results().Len() == 1 {
+		returnType = c.getLLVMType(sig.Results().At(0).Type())
+	}
+	trampolineType := llvm.FunctionType(returnType, paramTypes, false)
+	trampoline = llvm.AddFunction(c.mod, name, trampolineType)
+	trampoline.SetLinkage(llvm.InternalLinkage)
+	trampoline.SetUnnamedAddr(true)
+	entry := c.ctx.AddBasicBlock(trampoline, "entry")
+	c.builder.SetInsertPointAtEnd(entry)
+
+	// Unpack the func value from the context and call it.
+	params := trampoline.Params()
+	funcValue := c.emitPointerUnpack(params[len(params)-1], []llvm.Type{c.getFuncType(sig)})[0]
+	funcPtr, context := c.decodeFuncValue(funcValue, sig)
+	params = append(params[:len(params)-1], context, llvm.Undef(c.i8ptrType))
+	result := c.createCall(funcPtr, params, "")
+	if sig.Results().Len() == 1 {
+		c.builder.CreateRet(result)
+	} else {
+		c.builder.CreateRetVoid()
+	}
+	return trampoline
+}
+
+// isCCompatible returns whether values of this type are passed in the same way
+// in Go and C functions, so that they can be used in the signature of a C
+// callback.
+func isCCompatible(t types.Type) bool {
+	switch t := t.Underlying().(type) {
+	case *types.Basic:
+		return t.Info()&(types.IsInteger|types.IsFloat) != 0 || t.Kind() == types.UnsafePointer
+	case *types.Pointer:
+		return true
+	default:
+		return false
+	}
+}
@@ -24,6 +24,13 @@ func (c *Compiler) emitChanSend(frame *Frame, instr *ssa.Send) {
 	ch := c.getValue(frame, instr.Chan)
 	chanValue := c.getValue(frame, instr.X)
 
+	if c.targetData.TypeAllocSize(chanValue.Type()) == 0 {
+		// Nothing to copy, for example in a chan struct{}. The send still
+		// synchronizes with the receiver.
+		c.createRuntimeCall("chanSend", []llvm.Value{ch, c.getZeroSizedValuePtr()}, "")
+		return
+	}
+
 	// store value-to-send
 	valueType := c.getLLVMType(instr.X.Type())
 	valueAlloca, valueAllocaCast, valueAllocaSize := c.createTemporaryAlloca(valueType, "chan.value")
@@ -44,13 +51,20 @@ func (c *Compiler) emitChanRecv(frame *Frame, unop *ssa.UnOp) llvm.Value {
 	valueType := c.getLLVMType(unop.X.Type().(*types.Chan).Elem())
 	ch := c.getValue(frame, unop.X)
 
-	// Allocate memory to receive into.
-	valueAlloca, valueAllocaCast, valueAllocaSize := c.createTemporaryAlloca(valueType, "chan.value")
+	var commaOk, received llvm.Value
+	if c.targetData.TypeAllocSize(valueType) == 0 {
+		// Nothing to receive into, only wait for a sender.
+		commaOk = c.createRuntimeCall("chanRecv", []llvm.Value{ch, c.getZeroSizedValuePtr()}, "")
+		received = llvm.ConstNull(valueType)
+	} else {
+		// Allocate memory to receive into.
+		valueAlloca, valueAllocaCast, valueAllocaSize := c.createTemporaryAlloca(valueType, "chan.value")
 
-	// Do the receive.
-	commaOk := c.createRuntimeCall("chanRecv", []llvm.Value{ch, valueAllocaCast}, "")
-	received := c.builder.CreateLoad(valueAlloca, "chan.received")
-	c.emitLifetimeEnd(valueAllocaCast, valueAllocaSize)
+		// Do the receive.
+		commaOk = c.createRuntimeCall("chanRecv", []llvm.Value{ch, valueAllocaCast}, "")
+		received = c.builder.CreateLoad(valueAlloca, "chan.received")
+		c.emitLifetimeEnd(valueAllocaCast, valueAllocaSize)
+	}
 
 	if unop.CommaOk {
 		tuple := llvm.Undef(c.ctx.StructType([]llvm.Type{valueType, c.ctx.Int1Type()}, false))
@@ -63,8 +77,7 @@ func (c *Compiler) emitChanRecv(frame *Frame, unop *ssa.UnOp) llvm.Value {
 }
 
 // emitChanClose closes the given channel.
-func (c *Compiler) emitChanClose(frame *Frame, param ssa.Value) {
-	ch := c.getValue(frame, param)
+func (c *Compiler) emitChanClose(ch llvm.Value) {
 	c.createRuntimeCall("chanClose", []llvm.Value{ch}, "")
 }
 
@@ -90,6 +103,17 @@ func (c *Compiler) emitSelect(frame *Frame, expr *ssa.Select) llvm.Value {
 		}
 	}
 
+	if !expr.Blocking && len(expr.States) == 1 {
+		// A select with a single case and a default case, which is common in
+		// polling loops:
+		//     select {
+		//     case v := <-ch:
+		//     default:
+		//     }
+		// This can be implemented with a single non-blocking send or receive.
+		return c.emitTrySelect(frame, expr)
+	}
+
 	// This code create a (stack-allocated) slice containing all the select
 	// cases and then calls runtime.chanSelect to perform the actual select
 	// statement.
@@ -123,9 +147,7 @@ func (c *Compiler) emitSelect(frame *Frame, expr *ssa.Select) llvm.Value {
 			// Store this value in an alloca and put a pointer to this alloca
 			// in the send state.
 			sendValue := c.getValue(frame, state.Send)
-			alloca := llvmutil.CreateEntryBlockAlloca(c.builder, sendValue.Type(), "select.send.value")
-			c.builder.CreateStore(sendValue, alloca)
-			ptr := c.builder.CreateBitCast(alloca, c.i8ptrType, "")
+			ptr := c.emitSelectSendValue(sendValue)
 			selectState = c.builder.CreateInsertValue(selectState, ptr, 1, "")
 		default:
 			panic("unreachable")
@@ -206,6 +228,58 @@ func (c *Compiler) emitSelect(frame *Frame, expr *ssa.Select) llvm.Value {
 	return results
 }
 
+// emitTrySelect emits a select statement with a single case and a default
+// case as a call to runtime.chanTrySend or runtime.chanTryRecv, which avoids
+// the overhead of the general select implementation. The result has the same
+// form as the result of runtime.tryChanSelect.
+func (c *Compiler) emitTrySelect(frame *Frame, expr *ssa.Select) llvm.Value {
+	state := expr.States[0]
+	ch := c.getValue(frame, state.Chan)
+	var selected, commaOk llvm.Value
+	switch state.Dir {
+	case types.RecvOnly:
+		// Receive into a buffer that is read in the *ssa.Extract instruction
+		// (see getChanSelectResult).
+		llvmType := c.getLLVMType(state.Chan.Type().Underlying().(*types.Chan).Elem())
+		recvbuf := c.getZeroSizedValuePtr()
+		if c.targetData.TypeAllocSize(llvmType) != 0 {
+			_, recvbuf, _ = c.createTemporaryAlloca(llvmType, "select.recvbuf")
+		}
+		if frame.selectRecvBuf == nil {
+			frame.selectRecvBuf = make(map[*ssa.Select]llvm.Value)
+		}
+		frame.selectRecvBuf[expr] = recvbuf
+		result := c.createRuntimeCall("chanTryRecv", []llvm.Value{ch, recvbuf}, "select.result")
+		selected = c.builder.CreateExtractValue(result, 0, "")
+		commaOk = c.builder.CreateExtractValue(result, 1, "")
+	case types.SendOnly:
+		sendValue := c.getValue(frame, state.Send)
+		ptr := c.emitSelectSendValue(sendValue)
+		selected = c.createRuntimeCall("chanTrySend", []llvm.Value{ch, ptr}, "select.result")
+		commaOk = selected
+	default:
+		panic("unreachable")
+	}
+
+	// Return {0, ok} if the case was selected and {-1, false} otherwise.
+	index := c.builder.CreateSelect(selected, llvm.ConstInt(c.uintptrType, 0, false), llvm.ConstAllOnes(c.uintptrType), "select.index")
+	retval := llvm.Undef(c.ctx.StructType([]llvm.Type{c.uintptrType, c.ctx.Int1Type()}, false))
+	retval = c.builder.CreateInsertValue(retval, index, 0, "")
+	retval = c.builder.CreateInsertValue(retval, commaOk, 1, "")
+	return retval
+}
+
+// emitSelectSendValue stores the value to send in a select statement in an
+// alloca and returns a pointer to it, to be used in the select state.
+func (c *Compiler) emitSelectSendValue(sendValue llvm.Value) llvm.Value {
+	if c.targetData.TypeAllocSize(sendValue.Type()) == 0 {
+		return c.getZeroSizedValuePtr()
+	}
+	alloca := llvmutil.CreateEntryBlockAlloca(c.builder, sendValue.Type(), "select.send.value")
+	c.builder.CreateStore(sendValue, alloca)
+	return c.builder.CreateBitCast(alloca, c.i8ptrType, "")
+}
+
 // getChanSelectResult returns the special values from a *ssa.Extract expression
 // when extracting a value from a select statement (*ssa.Select). Because
 // *ssa.Select cannot load all values in advance, it does this later in the
@@ -229,9 +303,12 @@ func (c *Compiler) getChanSelectResult(frame *Frame, expr *ssa.Extract) llvm.Val
 		// are. They are all combined into one alloca (because only one
 		// receive can proceed at a time) so we'll get that alloca, bitcast
 		// it to the correct type, and dereference it.
+		llvmType := c.getLLVMType(expr.Type())
+		if c.targetData.TypeAllocSize(llvmType) == 0 {
+			return llvm.ConstNull(llvmType)
+		}
 		recvbuf := frame.selectRecvBuf[expr.Tuple.(*ssa.Select)]
-		typ := llvm.PointerType(c.getLLVMType(expr.Type()), 0)
-		ptr := c.builder.CreateBitCast(recvbuf, typ, "")
+		ptr := c.builder.CreateBitCast(recvbuf, llvm.PointerType(llvmType, 0), "")
 		return c.builder.CreateLoad(ptr, "")
 	}
 }
@@ -13,6 +13,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/tinygo-org/tinygo/compileopts"
 	"github.com/tinygo-org/tinygo/compiler/llvmutil"
@@ -34,6 +35,23 @@ func init() {
 // The TinyGo import path.
 const tinygoPath = "github.com/tinygo-org/tinygo"
 
+// The default stack guard value, used on targets that don't seed it from a
+// random source at startup. It contains a zero, newline and 0xff byte to stop
+// most string based overflows (a so-called terminator canary).
+const stackGuardDefault = 0x000aff00
+
+// tinygoConstants is the source of a file that is added to the tinygo package,
+// with constants describing the target. It must be formatted with the flash
+// and RAM size.
+const tinygoConstants = `package tinygo
+
+// FlashSize is the total flash size of the chip in bytes, or 0 if unknown.
+const FlashSize = %d
+
+// RAMSize is the total RAM size of the chip in bytes, or 0 if unknown.
+const RAMSize = %d
+`
+
 // functionsUsedInTransform is a list of function symbols that may be used
 // during TinyGo optimization passes so they have to be marked as external
 // linkage until all TinyGo passes have finished.
@@ -46,6 +64,7 @@ var functionsUsedInTransforms = []string{
 
 var taskFunctionsUsedInTransforms = []string{
 	"runtime.startGoroutine",
+	"runtime.startGoroutineStack",
 }
 
 var coroFunctionsUsedInTransforms = []string{
@@ -54,12 +73,18 @@ var coroFunctionsUsedInTransforms = []string{
 	"runtime.setTaskStatePtr",
 	"runtime.getTaskStatePtr",
 	"runtime.activateTask",
+	"runtime.returnToParent",
 	"runtime.noret",
 	"runtime.getParentHandle",
 	"runtime.getCoroutine",
 	"runtime.llvmCoroRefHolder",
 }
 
+var raceFunctionsUsedInTransforms = []string{
+	"runtime.raceRead",
+	"runtime.raceWrite",
+}
+
 type Compiler struct {
 	*compileopts.Config
 	mod                     llvm.Module
@@ -68,6 +93,8 @@ type Compiler struct {
 	dibuilder               *llvm.DIBuilder
 	cu                      llvm.Metadata
 	difiles                 map[string]llvm.Metadata
+	trimmedPaths            map[string]string // file name -> path in debug info and runtime.Caller (-trimpath)
+	callerSites             []callerSite      // call site table (-caller-table)
 	ditypes                 map[types.Type]llvm.Metadata
 	machine                 llvm.TargetMachine
 	targetData              llvm.TargetData
@@ -78,6 +105,7 @@ type Compiler struct {
 	initFuncs               []llvm.Value
 	interfaceInvokeWrappers []interfaceInvokeWrapper
 	ir                      *ir.Program
+	lprogram                *loader.Program
 	diagnostics             []error
 	astComments             map[string]*ast.CommentGroup
 }
@@ -97,6 +125,9 @@ type Frame struct {
 	deferInvokeFuncs  map[string]int
 	deferClosureFuncs map[*ir.Function]int
 	selectRecvBuf     map[*ssa.Select]llvm.Value
+	panicBlocks       map[string]llvm.BasicBlock // shared blocks for failing runtime checks
+	callerFrame       llvm.Value                 // caller frame on the stack (-caller-table)
+	callerParent      llvm.Value                 // value of runtime.callerTop at function entry
 }
 
 type Phi struct {
@@ -168,6 +199,9 @@ func (c *Compiler) getFunctionsUsedInTransforms() []string {
 	default:
 		panic(fmt.Errorf("invalid scheduler %q", c.Scheduler()))
 	}
+	if c.Race() {
+		fnused = append(fnused, raceFunctionsUsedInTransforms...)
+	}
 	return fnused
 }
 
@@ -217,7 +251,7 @@ func (c *Compiler) Compile(mainPath string) []error {
 				path = path[len(tinygoPath+"/src/"):]
 			}
 			switch path {
-			case "machine", "os", "reflect", "runtime", "runtime/volatile", "sync", "testing", "internal/reflectlite":
+			case "machine", "os", "reflect", "runtime", "runtime/volatile", "sync", "testing", "tinygo", "internal/reflectlite":
 				return path
 			default:
 				if strings.HasPrefix(path, "device/") || strings.HasPrefix(path, "examples/") {
@@ -243,6 +277,10 @@ func (c *Compiler) Compile(mainPath string) []error {
 		TINYGOROOT:   goenv.Get("TINYGOROOT"),
 		CFlags:       c.CFlags(),
 		ClangHeaders: c.ClangHeaders,
+		Bench:        c.TestConfig.Bench,
+		GeneratedFiles: map[string][]byte{
+			"tinygo": []byte(fmt.Sprintf(tinygoConstants, c.FlashSize(), c.RAMSize())),
+		},
 	}
 
 	if strings.HasSuffix(mainPath, ".go") {
@@ -266,17 +304,28 @@ func (c *Compiler) Compile(mainPath string) []error {
 	if err != nil {
 		return []error{err}
 	}
+	c.lprogram = lprogram
 
 	c.ir = ir.NewProgram(lprogram, mainPath)
 
 	// Run a simple dead code elimination pass.
 	c.ir.SimpleDCE()
 
+	// File paths in debug info and runtime.Caller are based on import paths
+	// with -trimpath.
+	if c.TrimPath() {
+		c.trimmedPaths = trimmedPaths(lprogram, c.ir.Program.Fset)
+	}
+
 	// Initialize debug information.
 	if c.Debug() {
+		cuPath := mainPath
+		if c.TrimPath() {
+			cuPath = trimImportPath(mainPath)
+		}
 		c.cu = c.dibuilder.CreateCompileUnit(llvm.DICompileUnit{
 			Language:  0xb, // DW_LANG_C99 (0xc, off-by-one?)
-			File:      mainPath,
+			File:      cuPath,
 			Dir:       "",
 			Producer:  "TinyGo",
 			Optimized: true,
@@ -303,7 +352,65 @@ func (c *Compiler) Compile(mainPath string) []error {
 		if frame.fn.Blocks == nil {
 			continue // external function
 		}
+		if c.defineMathBitsIntrinsic(frame) {
+			continue
+		}
+		start := time.Now()
 		c.parseFunc(frame)
+		if frame.fn.Pkg != nil {
+			// Count IR construction as part of the compile time of the
+			// package, next to parsing and typechecking.
+			if pkg, ok := lprogram.Packages[frame.fn.Pkg.Pkg.Path()]; ok {
+				pkg.Duration += time.Since(start)
+			}
+		}
+	}
+
+	// Set the values of globals that were provided at build time.
+	c.setGlobalValues()
+
+	// Emit the table of call sites that were recorded in the caller frames.
+	if c.CallerTable() {
+		c.createCallerSites()
+	}
+
+	// Define the stack guard value if the runtime provides its own stack
+	// protector support (on targets without a libc).
+	if c.StackProtector() {
+		if g, ok := c.ir.Program.ImportedPackage("runtime").Members["stackChkGuard"].(*ssa.Global); ok {
+			c.getGlobal(g).SetInitializer(llvm.ConstInt(c.uintptrType, stackGuardDefault, false))
+		}
+	}
+
+	// Limit the number of goroutines that may exist at the same time, if
+	// requested. The runtime checks this limit when starting a goroutine.
+	if c.MaxGoroutines() > 0 {
+		if g, ok := c.ir.Program.ImportedPackage("runtime").Members["maxGoroutines"].(*ssa.Global); ok {
+			c.getGlobal(g).SetInitializer(llvm.ConstInt(c.uintptrType, uint64(c.MaxGoroutines()), false))
+		}
+	}
+
+	// Exported functions that take or return structs need a wrapper on
+	// WebAssembly, to pass those structs through linear memory. Functions
+	// with types that can't be passed at all are rejected.
+	if c.GOARCH() == "wasm" {
+		for _, frame := range frames {
+			if frame.fn.IsExported() && frame.fn.CName() == "" && frame.fn.Blocks != nil {
+				if c.checkWasmExportSignature(frame.fn) {
+					c.createWasmExportWrapper(frame.fn)
+				}
+			}
+		}
+	}
+
+	// With -panic=host, exported functions save the stack pointer so that it
+	// can be restored when a panic traps.
+	if c.GOARCH() == "wasm" && c.PanicStrategy() == "host" {
+		for _, frame := range frames {
+			if frame.fn.IsExported() && frame.fn.CName() == "" && frame.fn.Blocks != nil {
+				c.createExportStackWrapper(frame.fn)
+			}
+		}
 	}
 
 	// Define the already declared functions that wrap methods for use in
@@ -396,6 +503,7 @@ func (c *Compiler) Compile(mainPath string) []error {
 				llvm.ConstInt(c.ctx.Int32Type(), 4, false).ConstantAsMetadata(),
 			}),
 		)
+		c.finalizeGlobalDebugInfo()
 		c.dibuilder.Finalize()
 	}
 
@@ -494,7 +602,7 @@ func (c *Compiler) getLLVMType(goType types.Type) llvm.Type {
 		for i := 0; i < typ.NumFields(); i++ {
 			members[i] = c.getLLVMType(typ.Field(i).Type())
 		}
-		return c.ctx.StructType(members, false)
+		return c.ctx.StructType(members, isPackedStruct(typ))
 	case *types.Tuple:
 		members := make([]llvm.Type, typ.Len())
 		for i := 0; i < typ.Len(); i++ {
@@ -506,6 +614,31 @@ func (c *Compiler) getLLVMType(goType types.Type) llvm.Type {
 	}
 }
 
+// isPackedAddr returns whether this address points into a packed C struct:
+// either to a field of the struct or to an element or field of one of its
+// fields. Such an address may be unaligned, so it must be loaded from and
+// stored to with an alignment of 1.
+func isPackedAddr(addr ssa.Value) bool {
+	for {
+		switch a := addr.(type) {
+		case *ssa.FieldAddr:
+			structType := a.X.Type().Underlying().(*types.Pointer).Elem().Underlying().(*types.Struct)
+			if isPackedStruct(structType) {
+				return true
+			}
+			addr = a.X
+		case *ssa.IndexAddr:
+			if _, ok := a.X.Type().Underlying().(*types.Pointer); !ok {
+				// Slice elements are stored in a separate buffer.
+				return false
+			}
+			addr = a.X
+		default:
+			return false
+		}
+	}
+}
+
 // Is this a pointer type of some sort? Can be unsafe.Pointer or any *T pointer.
 func isPointer(typ types.Type) bool {
 	if _, ok := typ.(*types.Pointer); ok {
@@ -749,6 +882,12 @@ func (c *Compiler) parseFuncDecl(f *ir.Function) *Frame {
 			wasmImportModuleAttr := c.ctx.CreateStringAttribute("wasm-import-module", f.Module())
 			frame.fn.LLVMFn.AddFunctionAttr(wasmImportModuleAttr)
 		}
+		// Set the wasm-import-name attribute if the import has a different
+		// name than the function itself (with //go:wasmimport).
+		if f.ImportName() != "" {
+			wasmImportNameAttr := c.ctx.CreateStringAttribute("wasm-import-name", f.ImportName())
+			frame.fn.LLVMFn.AddFunctionAttr(wasmImportNameAttr)
+		}
 		nocaptureKind := llvm.AttributeKindID("nocapture")
 		nocapture := c.ctx.CreateEnumAttribute(nocaptureKind, 0)
 		for i, typ := range paramTypes {
@@ -766,14 +905,28 @@ func (c *Compiler) attachDebugInfo(f *ir.Function) llvm.Metadata {
 	return c.attachDebugInfoRaw(f, f.LLVMFn, "", pos.Filename, pos.Line)
 }
 
-func (c *Compiler) attachDebugInfoRaw(f *ir.Function, llvmFn llvm.Value, suffix, filename string, line int) llvm.Metadata {
-	if _, ok := c.difiles[filename]; !ok {
-		dir, file := filepath.Split(filename)
-		if dir != "" {
-			dir = dir[:len(dir)-1]
-		}
-		c.difiles[filename] = c.dibuilder.CreateFile(file, dir)
+// getDIFile returns the debug info file for the given file name, creating it if
+// needed. With -trimpath, the path in the debug info is based on the import
+// path of the package instead of the location on disk.
+func (c *Compiler) getDIFile(filename string) llvm.Metadata {
+	if difile, ok := c.difiles[filename]; ok {
+		return difile
 	}
+	path := filename
+	if trimmed, ok := c.trimmedPaths[filename]; ok {
+		path = trimmed
+	}
+	dir, file := filepath.Split(path)
+	if dir != "" {
+		dir = dir[:len(dir)-1]
+	}
+	difile := c.dibuilder.CreateFile(file, dir)
+	c.difiles[filename] = difile
+	return difile
+}
+
+func (c *Compiler) attachDebugInfoRaw(f *ir.Function, llvmFn llvm.Value, suffix, filename string, line int) llvm.Metadata {
+	difile := c.getDIFile(filename)
 
 	// Debug info for this function.
 	diparams := make([]llvm.Metadata, 0, len(f.Params))
@@ -781,14 +934,14 @@ func (c *Compiler) attachDebugInfoRaw(f *ir.Function, llvmFn llvm.Value, suffix,
 		diparams = append(diparams, c.getDIType(param.Type()))
 	}
 	diFuncType := c.dibuilder.CreateSubroutineType(llvm.DISubroutineType{
-		File:       c.difiles[filename],
+		File:       difile,
 		Parameters: diparams,
 		Flags:      0, // ?
 	})
-	difunc := c.dibuilder.CreateFunction(c.difiles[filename], llvm.DIFunction{
+	difunc := c.dibuilder.CreateFunction(difile, llvm.DIFunction{
 		Name:         f.RelString(nil) + suffix,
 		LinkageName:  f.LinkName() + suffix,
-		File:         c.difiles[filename],
+		File:         difile,
 		Line:         line,
 		Type:         diFuncType,
 		LocalToUnit:  true,
@@ -829,6 +982,33 @@ func (c *Compiler) parseFunc(frame *Frame) {
 		frame.fn.LLVMFn.AddFunctionAttr(noinline)
 	}
 
+	// Functions with a //go:ramfunc pragma are put in a separate section, which
+	// the linker script places in RAM and the runtime copies from flash at
+	// startup. They must not be inlined, as they would end up in flash again.
+	if frame.fn.IsRAMFunc() {
+		supported := false
+		for _, tag := range c.BuildTags() {
+			if tag == "cortexm" {
+				supported = true
+			}
+		}
+		if !supported {
+			c.addError(frame.fn.Pos(), "//go:ramfunc is only supported on Cortex-M")
+		}
+		frame.fn.LLVMFn.SetSection(".ramfunc." + frame.fn.LLVMFn.Name())
+		noinline := c.ctx.CreateEnumAttribute(llvm.AttributeKindID("noinline"), 0)
+		frame.fn.LLVMFn.AddFunctionAttr(noinline)
+	}
+
+	// Protect functions against stack buffer overflows, if enabled. The
+	// runtime is excluded as it initializes the stack guard value at startup,
+	// which would cause false positives in the functions that are active while
+	// it changes.
+	if c.StackProtector() && (frame.fn.Pkg == nil || frame.fn.Pkg.Pkg.Path() != "runtime") {
+		sspstrong := c.ctx.CreateEnumAttribute(llvm.AttributeKindID("sspstrong"), 0)
+		frame.fn.LLVMFn.AddFunctionAttr(sspstrong)
+	}
+
 	// Add debug info, if needed.
 	if c.Debug() {
 		if frame.fn.Synthetic == "package initializer" {
@@ -851,6 +1031,9 @@ func (c *Compiler) parseFunc(frame *Frame) {
 	}
 	entryBlock := frame.blockEntries[frame.fn.Blocks[0]]
 	c.builder.SetInsertPointAtEnd(entryBlock)
+	if c.hasCallerFrame(frame) {
+		c.emitCallerFrame(frame)
+	}
 
 	// Load function parameters
 	llvmParamIndex := 0
@@ -869,7 +1052,7 @@ func (c *Compiler) parseFunc(frame *Frame) {
 			diType := c.getDIType(param.Type())
 			dbgParam := c.dibuilder.CreateParameterVariable(frame.difunc, llvm.DIParameterVariable{
 				Name:           param.Name(),
-				File:           c.difiles[pos.Filename],
+				File:           c.getDIFile(pos.Filename),
 				Line:           pos.Line,
 				Type:           diType,
 				AlwaysPreserve: true,
@@ -958,6 +1141,10 @@ func (c *Compiler) parseFunc(frame *Frame) {
 			phi.llvm.AddIncoming([]llvm.Value{llvmVal}, []llvm.BasicBlock{llvmBlock})
 		}
 	}
+
+	if c.hasCallerFrame(frame) {
+		c.finishCallerFrame(frame)
+	}
 }
 
 func (c *Compiler) parseInstr(frame *Frame, instr ssa.Instruction) {
@@ -966,6 +1153,13 @@ func (c *Compiler) parseInstr(frame *Frame, instr ssa.Instruction) {
 		c.builder.SetCurrentDebugLocation(uint(pos.Line), uint(pos.Column), frame.difunc, llvm.Metadata{})
 	}
 
+	if !frame.callerFrame.IsNil() {
+		switch instr.(type) {
+		case *ssa.Call, *ssa.Go:
+			c.emitCallerSite(frame, instr.Pos())
+		}
+	}
+
 	switch instr := instr.(type) {
 	case ssa.Value:
 		if value, err := c.parseExpr(frame, instr); err != nil {
@@ -1013,7 +1207,7 @@ func (c *Compiler) parseInstr(frame *Frame, instr ssa.Instruction) {
 				panic("StaticCallee returned an unexpected value")
 			}
 			params = append(params, context) // context parameter
-			c.emitStartGoroutine(calleeFn.LLVMFn, params)
+			c.emitStartGoroutine(calleeFn.LLVMFn, params, llvm.Value{})
 		} else if !instr.Call.IsInvoke() {
 			// This is a function pointer.
 			// At the moment, two extra params are passed to the newly started
@@ -1031,7 +1225,7 @@ func (c *Compiler) parseInstr(frame *Frame, instr ssa.Instruction) {
 			default:
 				panic("unknown scheduler type")
 			}
-			c.emitStartGoroutine(funcPtr, params)
+			c.emitStartGoroutine(funcPtr, params, llvm.Value{})
 		} else {
 			c.addError(instr.Pos(), "todo: go on interface call")
 		}
@@ -1073,6 +1267,14 @@ func (c *Compiler) parseInstr(frame *Frame, instr ssa.Instruction) {
 	case *ssa.Send:
 		c.emitChanSend(frame, instr)
 	case *ssa.Store:
+		if g, ok := instr.Addr.(*ssa.Global); ok && frame.fn.Synthetic == "package initializer" {
+			if _, ok := instr.Val.(*ssa.Const); ok && c.hasGlobalValue(g) {
+				// The value of this global was set at build time, which takes
+				// precedence over a constant initializer like with the go
+				// tool. Non-constant initializers are still run.
+				return
+			}
+		}
 		llvmAddr := c.getValue(frame, instr.Addr)
 		llvmVal := c.getValue(frame, instr.Val)
 		c.emitNilCheck(frame, llvmAddr, "store")
@@ -1080,17 +1282,50 @@ func (c *Compiler) parseInstr(frame *Frame, instr ssa.Instruction) {
 			// nothing to store
 			return
 		}
-		c.builder.CreateStore(llvmVal, llvmAddr)
+		store := c.builder.CreateStore(llvmVal, llvmAddr)
+		if isPackedAddr(instr.Addr) {
+			store.SetAlignment(1)
+		}
 	default:
 		c.addError(instr.Pos(), "unknown instruction: "+instr.String())
 	}
 }
 
+// parseBuiltin emits a call to a builtin function with the given arguments.
 func (c *Compiler) parseBuiltin(frame *Frame, args []ssa.Value, callName string, pos token.Pos) (llvm.Value, error) {
+	argTypes, argValues := c.getBuiltinArgs(frame, args, callName)
+	return c.createBuiltin(argTypes, argValues, callName, pos)
+}
+
+// getBuiltinArgs returns the types and values of the arguments of a call to a
+// builtin function. The values are evaluated at the point of the call, which
+// for deferred calls is the defer statement.
+func (c *Compiler) getBuiltinArgs(frame *Frame, args []ssa.Value, callName string) ([]types.Type, []llvm.Value) {
+	argTypes := make([]types.Type, len(args))
+	argValues := make([]llvm.Value, len(args))
+	for i, arg := range args {
+		argTypes[i] = arg.Type()
+		argValues[i] = c.getValue(frame, arg)
+		if (callName == "print" || callName == "println") && isHexType(arg.Type()) {
+			// Print as many digits as the size of the integer that was
+			// converted to tinygo.Hex, if known.
+			if conv, ok := arg.(*ssa.Convert); ok {
+				if basic, ok := conv.X.Type().Underlying().(*types.Basic); ok && basic.Info()&types.IsInteger != 0 {
+					argValues[i] = c.getValue(frame, conv.X)
+				}
+			}
+		}
+	}
+	return argTypes, argValues
+}
+
+// createBuiltin emits a call to a builtin function, with arguments that have
+// already been evaluated.
+func (c *Compiler) createBuiltin(argTypes []types.Type, argValues []llvm.Value, callName string, pos token.Pos) (llvm.Value, error) {
 	switch callName {
 	case "append":
-		src := c.getValue(frame, args[0])
-		elems := c.getValue(frame, args[1])
+		src := argValues[0]
+		elems := argValues[1]
 		srcBuf := c.builder.CreateExtractValue(src, 0, "append.srcBuf")
 		srcPtr := c.builder.CreateBitCast(srcBuf, c.i8ptrType, "append.srcPtr")
 		srcLen := c.builder.CreateExtractValue(src, 1, "append.srcLen")
@@ -1111,9 +1346,9 @@ func (c *Compiler) parseBuiltin(frame *Frame, args []ssa.Value, callName string,
 		newSlice = c.builder.CreateInsertValue(newSlice, newCap, 2, "")
 		return newSlice, nil
 	case "cap":
-		value := c.getValue(frame, args[0])
+		value := argValues[0]
 		var llvmCap llvm.Value
-		switch args[0].Type().(type) {
+		switch argTypes[0].(type) {
 		case *types.Chan:
 			// Channel. Buffered channels haven't been implemented yet so always
 			// return 0.
@@ -1128,12 +1363,12 @@ func (c *Compiler) parseBuiltin(frame *Frame, args []ssa.Value, callName string,
 		}
 		return llvmCap, nil
 	case "close":
-		c.emitChanClose(frame, args[0])
+		c.emitChanClose(argValues[0])
 		return llvm.Value{}, nil
 	case "complex":
-		r := c.getValue(frame, args[0])
-		i := c.getValue(frame, args[1])
-		t := args[0].Type().Underlying().(*types.Basic)
+		r := argValues[0]
+		i := argValues[1]
+		t := argTypes[0].Underlying().(*types.Basic)
 		var cplx llvm.Value
 		switch t.Kind() {
 		case types.Float32:
@@ -1147,8 +1382,8 @@ func (c *Compiler) parseBuiltin(frame *Frame, args []ssa.Value, callName string,
 		cplx = c.builder.CreateInsertValue(cplx, i, 1, "")
 		return cplx, nil
 	case "copy":
-		dst := c.getValue(frame, args[0])
-		src := c.getValue(frame, args[1])
+		dst := argValues[0]
+		src := argValues[1]
 		dstLen := c.builder.CreateExtractValue(dst, 1, "copy.dstLen")
 		srcLen := c.builder.CreateExtractValue(src, 1, "copy.srcLen")
 		dstBuf := c.builder.CreateExtractValue(dst, 0, "copy.dstArray")
@@ -1159,16 +1394,16 @@ func (c *Compiler) parseBuiltin(frame *Frame, args []ssa.Value, callName string,
 		elemSize := llvm.ConstInt(c.uintptrType, c.targetData.TypeAllocSize(elemType), false)
 		return c.createRuntimeCall("sliceCopy", []llvm.Value{dstBuf, srcBuf, dstLen, srcLen, elemSize}, "copy.n"), nil
 	case "delete":
-		m := c.getValue(frame, args[0])
-		key := c.getValue(frame, args[1])
-		return llvm.Value{}, c.emitMapDelete(args[1].Type(), m, key, pos)
+		m := argValues[0]
+		key := argValues[1]
+		return llvm.Value{}, c.emitMapDelete(argTypes[1], m, key, pos)
 	case "imag":
-		cplx := c.getValue(frame, args[0])
+		cplx := argValues[0]
 		return c.builder.CreateExtractValue(cplx, 1, "imag"), nil
 	case "len":
-		value := c.getValue(frame, args[0])
+		value := argValues[0]
 		var llvmLen llvm.Value
-		switch args[0].Type().Underlying().(type) {
+		switch argTypes[0].Underlying().(type) {
 		case *types.Basic, *types.Slice:
 			// string or slice
 			llvmLen = c.builder.CreateExtractValue(value, 1, "len")
@@ -1186,12 +1421,19 @@ func (c *Compiler) parseBuiltin(frame *Frame, args []ssa.Value, callName string,
 		}
 		return llvmLen, nil
 	case "print", "println":
-		for i, arg := range args {
+		for i, value := range argValues {
 			if i >= 1 && callName == "println" {
 				c.createRuntimeCall("printspace", nil, "")
 			}
-			value := c.getValue(frame, arg)
-			typ := arg.Type().Underlying()
+			if isHexType(argTypes[i]) {
+				// runtime.printhex{8,16,32,64}
+				// The value may be smaller than tinygo.Hex, see
+				// getBuiltinArgs.
+				name := "printhex" + strconv.FormatUint(c.targetData.TypeAllocSize(value.Type())*8, 10)
+				c.createRuntimeCall(name, []llvm.Value{value}, "")
+				continue
+			}
+			typ := argTypes[i].Underlying()
 			switch typ := typ.(type) {
 			case *types.Basic:
 				switch typ.Kind() {
@@ -1242,19 +1484,45 @@ func (c *Compiler) parseBuiltin(frame *Frame, args []ssa.Value, callName string,
 			c.createRuntimeCall("printnl", nil, "")
 		}
 		return llvm.Value{}, nil // print() or println() returns void
+	case "panic":
+		// Only reached for deferred calls, other calls to panic are *ssa.Panic
+		// instructions.
+		c.createRuntimeCall("_panic", argValues, "")
+		return llvm.Value{}, nil
 	case "real":
-		cplx := c.getValue(frame, args[0])
+		cplx := argValues[0]
 		return c.builder.CreateExtractValue(cplx, 0, "real"), nil
 	case "recover":
 		return c.createRuntimeCall("_recover", nil, ""), nil
 	case "ssa:wrapnilchk":
 		// TODO: do an actual nil check?
-		return c.getValue(frame, args[0]), nil
+		return argValues[0], nil
 	default:
 		return llvm.Value{}, c.makeError(pos, "todo: builtin: "+callName)
 	}
 }
 
+// maxSliceSize returns the maximum length of a slice with the given element
+// size, as a constant: the size in bytes of its backing array must not exceed
+// maxSize. Without this limit, multiplying the length by the element size can
+// overflow and result in a backing array that is too small.
+func (c *Compiler) maxSliceSize(maxSize llvm.Value, elemSize uint64) llvm.Value {
+	if elemSize <= 1 {
+		return maxSize
+	}
+	return llvm.ConstInt(c.uintptrType, maxSize.ZExtValue()/elemSize, false)
+}
+
+// isHexType returns whether the given type is tinygo.Hex, which is printed in
+// hexadecimal notation by the print and println builtins.
+func isHexType(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return false
+	}
+	return named.Obj().Pkg().Path() == "tinygo" && named.Obj().Name() == "Hex"
+}
+
 func (c *Compiler) parseFunctionCall(frame *Frame, args []ssa.Value, llvmFn, context llvm.Value, exported bool) llvm.Value {
 	var params []llvm.Value
 	for _, param := range args {
@@ -1297,12 +1565,35 @@ func (c *Compiler) parseCall(frame *Frame, instr *ssa.CallCommon) (llvm.Value, e
 			return c.emitVolatileLoad(frame, instr)
 		case strings.HasPrefix(name, "runtime/volatile.Store"):
 			return c.emitVolatileStore(frame, instr)
+		case name == "tinygo.Go":
+			return c.emitGoWithStackSize(frame, instr)
+		case name == "tinygo.CFunc":
+			return c.emitCFunc(frame, instr)
+		case name == "tinygo.NoCopyString":
+			return c.emitNoCopyString(frame, instr)
+		case strings.HasPrefix(name, "tinygo.LoadUnaligned"):
+			return c.emitUnalignedLoad(frame, instr, name)
+		case strings.HasPrefix(name, "tinygo.StoreUnaligned"):
+			return c.emitUnalignedStore(frame, instr, name)
+		case name == "tinygo.Prefetch":
+			return c.emitPrefetch(frame, instr)
+		case name == "runtime.Caller" && !c.CallerTable():
+			if value, ok := c.emitCaller(frame, instr); ok {
+				return value, nil
+			}
+		case strings.HasPrefix(name, "sync/atomic.") && c.WasmThreads():
+			if value, ok := c.emitAtomicOp(frame, instr, name); ok {
+				return value, nil
+			}
 		}
 
 		targetFunc := c.ir.GetFunction(fn)
 		if targetFunc.LLVMFn.IsNil() {
 			return llvm.Value{}, c.makeError(instr.Pos(), "undefined function: "+targetFunc.LinkName())
 		}
+		if c.emitSyncFastPath(frame, instr, name, targetFunc) {
+			return llvm.Value{}, nil
+		}
 		var context llvm.Value
 		switch value := instr.Value.(type) {
 		case *ssa.Function:
@@ -1396,6 +1687,9 @@ func (c *Compiler) parseExpr(frame *Frame, expr ssa.Value) (llvm.Value, error) {
 	case *ssa.BinOp:
 		x := c.getValue(frame, expr.X)
 		y := c.getValue(frame, expr.Y)
+		if expr.Op == token.SHL || expr.Op == token.SHR {
+			c.emitShiftCheck(frame, y, expr.Y.Type())
+		}
 		return c.parseBinOp(expr.Op, expr.X.Type(), x, y, expr.Pos())
 	case *ssa.Call:
 		// Passing the current task here to the subroutine. It is only used when
@@ -1417,7 +1711,9 @@ func (c *Compiler) parseExpr(frame *Frame, expr ssa.Value) (llvm.Value, error) {
 		llvmType := c.getLLVMType(expr.Type())
 		if x.Type() == llvmType {
 			// Different Go type but same LLVM type (for example, named int).
-			// This is the common case.
+			// This is the common case. It includes conversions between
+			// function types with the same underlying signature, as the LLVM
+			// type of a function value only depends on the signature.
 			return x, nil
 		}
 		// Figure out what kind of type we need to cast.
@@ -1604,10 +1900,12 @@ func (c *Compiler) parseExpr(frame *Frame, expr ssa.Value) (llvm.Value, error) {
 			return llvm.Value{}, c.makeError(expr.Pos(), fmt.Sprintf("slice element type is too big (%v bytes)", elemSize))
 		}
 
-		// Bounds checking.
+		// Bounds checking. The capacity is checked against the maximum slice
+		// size for this element type, so that the size of the backing array
+		// below can't overflow.
 		lenType := expr.Len.Type().(*types.Basic)
 		capType := expr.Cap.Type().(*types.Basic)
-		c.emitSliceBoundsCheck(frame, maxSize, sliceLen, sliceCap, sliceCap, lenType, capType, capType)
+		c.emitSliceBoundsCheck(frame, c.maxSliceSize(maxSize, elemSize), sliceLen, sliceCap, sliceCap, lenType, capType, capType)
 
 		// Allocate the backing array.
 		sliceCapCast, err := c.parseConvert(expr.Cap.Type(), types.Typ[types.Uintptr], sliceCap, expr.Pos())
@@ -1890,28 +2188,37 @@ func (c *Compiler) parseBinOp(op token.Token, typ types.Type, x, y llvm.Value, p
 			case token.XOR: // ^
 				return c.builder.CreateXor(x, y, ""), nil
 			case token.SHL, token.SHR:
+				// Go defines shifts by at least the integer width, while LLVM
+				// (and most CPUs) do not: the result is either 0 or, for signed
+				// right shifts, the sign bit in every bit. Check for this using
+				// the original shift count, as it may be wider than x.
 				sizeX := c.targetData.TypeAllocSize(x.Type())
 				sizeY := c.targetData.TypeAllocSize(y.Type())
+				width := uint64(x.Type().IntTypeWidth())
+				overshifted := c.builder.CreateICmp(llvm.IntUGE, y, llvm.ConstInt(y.Type(), width, false), "shift.overflow")
 				if sizeX > sizeY {
 					// x and y must have equal sizes, make Y bigger in this case.
-					// y is unsigned, this has been checked by the Go type checker.
+					// A signed y has been checked to not be negative by
+					// emitShiftCheck, so it can be treated as unsigned.
 					y = c.builder.CreateZExt(y, x.Type(), "")
 				} else if sizeX < sizeY {
-					// What about shifting more than the integer width?
-					// I'm not entirely sure what the Go spec is on that, but as
-					// Intel CPUs have undefined behavior when shifting more
-					// than the integer width I'm assuming it is also undefined
-					// in Go.
+					// Overshifting has been checked above, so it is safe to
+					// truncate y.
 					y = c.builder.CreateTrunc(y, x.Type(), "")
 				}
 				switch op {
 				case token.SHL: // <<
-					return c.builder.CreateShl(x, y, ""), nil
+					result := c.builder.CreateShl(x, y, "")
+					return c.builder.CreateSelect(overshifted, llvm.ConstInt(x.Type(), 0, false), result, ""), nil
 				case token.SHR: // >>
 					if signed {
+						// Shifting by width-1 fills every bit with the sign
+						// bit, which is also the result of larger shifts.
+						y = c.builder.CreateSelect(overshifted, llvm.ConstInt(x.Type(), width-1, false), y, "")
 						return c.builder.CreateAShr(x, y, ""), nil
 					} else {
-						return c.builder.CreateLShr(x, y, ""), nil
+						result := c.builder.CreateLShr(x, y, "")
+						return c.builder.CreateSelect(overshifted, llvm.ConstInt(x.Type(), 0, false), result, ""), nil
 					}
 				default:
 					panic("unreachable")
@@ -1962,18 +2269,21 @@ func (c *Compiler) parseBinOp(op token.Token, typ types.Type, x, y llvm.Value, p
 				return c.builder.CreateFMul(x, y, ""), nil
 			case token.QUO: // /
 				return c.builder.CreateFDiv(x, y, ""), nil
+			// All comparisons except != are false if one of the operands is
+			// NaN, so they use ordered predicates. != is true in that case,
+			// so it uses an unordered predicate.
 			case token.EQL: // ==
-				return c.builder.CreateFCmp(llvm.FloatUEQ, x, y, ""), nil
+				return c.builder.CreateFCmp(llvm.FloatOEQ, x, y, ""), nil
 			case token.NEQ: // !=
 				return c.builder.CreateFCmp(llvm.FloatUNE, x, y, ""), nil
 			case token.LSS: // <
-				return c.builder.CreateFCmp(llvm.FloatULT, x, y, ""), nil
+				return c.builder.CreateFCmp(llvm.FloatOLT, x, y, ""), nil
 			case token.LEQ: // <=
-				return c.builder.CreateFCmp(llvm.FloatULE, x, y, ""), nil
+				return c.builder.CreateFCmp(llvm.FloatOLE, x, y, ""), nil
 			case token.GTR: // >
-				return c.builder.CreateFCmp(llvm.FloatUGT, x, y, ""), nil
+				return c.builder.CreateFCmp(llvm.FloatOGT, x, y, ""), nil
 			case token.GEQ: // >=
-				return c.builder.CreateFCmp(llvm.FloatUGE, x, y, ""), nil
+				return c.builder.CreateFCmp(llvm.FloatOGE, x, y, ""), nil
 			default:
 				panic("binop on float: " + op.String())
 			}
@@ -1988,10 +2298,10 @@ func (c *Compiler) parseBinOp(op token.Token, typ types.Type, x, y llvm.Value, p
 				ieq := c.builder.CreateFCmp(llvm.FloatOEQ, i1, i2, "")
 				return c.builder.CreateAnd(req, ieq, ""), nil
 			case token.NEQ: // !=
-				req := c.builder.CreateFCmp(llvm.FloatOEQ, r1, r2, "")
-				ieq := c.builder.CreateFCmp(llvm.FloatOEQ, i1, i2, "")
-				neq := c.builder.CreateAnd(req, ieq, "")
-				return c.builder.CreateNot(neq, ""), nil
+				// True if either component differs or is NaN.
+				rne := c.builder.CreateFCmp(llvm.FloatUNE, r1, r2, "")
+				ine := c.builder.CreateFCmp(llvm.FloatUNE, i1, i2, "")
+				return c.builder.CreateOr(rne, ine, ""), nil
 			case token.ADD, token.SUB:
 				var r, i llvm.Value
 				switch op {
@@ -2237,20 +2547,19 @@ func (c *Compiler) parseConst(prefix string, expr *ssa.Const) llvm.Value {
 		} else if typ.Info()&types.IsFloat != 0 {
 			n, _ := constant.Float64Val(expr.Value)
 			return llvm.ConstFloat(llvmType, n)
-		} else if typ.Kind() == types.Complex64 {
-			r := c.parseConst(prefix, ssa.NewConst(constant.Real(expr.Value), types.Typ[types.Float32]))
-			i := c.parseConst(prefix, ssa.NewConst(constant.Imag(expr.Value), types.Typ[types.Float32]))
-			cplx := llvm.Undef(c.ctx.StructType([]llvm.Type{c.ctx.FloatType(), c.ctx.FloatType()}, false))
-			cplx = c.builder.CreateInsertValue(cplx, r, 0, "")
-			cplx = c.builder.CreateInsertValue(cplx, i, 1, "")
-			return cplx
-		} else if typ.Kind() == types.Complex128 {
-			r := c.parseConst(prefix, ssa.NewConst(constant.Real(expr.Value), types.Typ[types.Float64]))
-			i := c.parseConst(prefix, ssa.NewConst(constant.Imag(expr.Value), types.Typ[types.Float64]))
-			cplx := llvm.Undef(c.ctx.StructType([]llvm.Type{c.ctx.DoubleType(), c.ctx.DoubleType()}, false))
-			cplx = c.builder.CreateInsertValue(cplx, r, 0, "")
-			cplx = c.builder.CreateInsertValue(cplx, i, 1, "")
-			return cplx
+		} else if typ.Kind() == types.Complex64 || typ.Kind() == types.Complex128 {
+			// Build the complex number as a constant struct, so that it is
+			// folded at compile time and can be used in global initializers.
+			// Untyped constants (for example an integer constant converted to
+			// complex) are converted to the float element type first.
+			elemType := types.Typ[types.Float32]
+			if typ.Kind() == types.Complex128 {
+				elemType = types.Typ[types.Float64]
+			}
+			value := constant.ToComplex(expr.Value)
+			r := c.parseConst(prefix, ssa.NewConst(constant.ToFloat(constant.Real(value)), elemType))
+			i := c.parseConst(prefix, ssa.NewConst(constant.ToFloat(constant.Imag(value)), elemType))
+			return c.ctx.ConstStruct([]llvm.Value{r, i}, false)
 		} else {
 			panic("unknown constant of basic type: " + expr.String())
 		}
@@ -2507,6 +2816,9 @@ func (c *Compiler) parseUnOp(frame *Frame, unop *ssa.UnOp) (llvm.Value, error) {
 		} else {
 			c.emitNilCheck(frame, x, "deref")
 			load := c.builder.CreateLoad(x, "")
+			if isPackedAddr(unop.X) {
+				load.SetAlignment(1)
+			}
 			return load, nil
 		}
 	case token.XOR: // ^x, toggle all bits in integer
@@ -2523,6 +2835,13 @@ func (c *Compiler) IR() string {
 	return c.mod.String()
 }
 
+// CriticalPath returns the chain of package imports that took the longest to
+// compile, and the total compile time of this chain. Only valid after a
+// successful compile.
+func (c *Compiler) CriticalPath() ([]*loader.Package, time.Duration) {
+	return c.lprogram.CriticalPath()
+}
+
 func (c *Compiler) Verify() error {
 	return llvm.VerifyModule(c.mod, llvm.PrintMessageAction)
 }
@@ -2571,6 +2890,11 @@ func (c *Compiler) ExternalInt64AsPtr() error {
 			// coroutine lowering.
 			continue
 		}
+		if strings.HasPrefix(fn.Name(), "tinygo_atomic_") {
+			// Atomic operations for -wasm-threads, which are implemented in C
+			// in the same module and not visible to JavaScript.
+			continue
+		}
 
 		hasInt64 := false
 		paramTypes := []llvm.Type{}
@@ -14,11 +14,24 @@ package compiler
 //     frames.
 
 import (
+	"go/token"
+	"go/types"
+
 	"github.com/tinygo-org/tinygo/ir"
 	"golang.org/x/tools/go/ssa"
 	"tinygo.org/x/go-llvm"
 )
 
+// deferBuiltin is a deferred call to a builtin function, like close or delete.
+// The arguments are stored in the defer frame, just like the arguments of
+// other deferred calls.
+type deferBuiltin struct {
+	callName  string
+	argTypes  []types.Type
+	llvmTypes []llvm.Type // types of the arguments in the defer frame
+	pos       token.Pos
+}
+
 // deferInitFunc sets up this function for future deferred calls. It must be
 // called from within the entry block when this function contains deferred
 // calls.
@@ -115,6 +128,29 @@ func (c *Compiler) emitDefer(frame *Frame, instr *ssa.Defer) {
 		values = append(values, context)
 		valueTypes = append(valueTypes, context.Type())
 
+	} else if builtin, ok := instr.Call.Value.(*ssa.Builtin); ok {
+		// Builtin function, like close or delete. The arguments are evaluated
+		// now and stored in the defer frame, like for other calls. A separate
+		// callback is used for every defer statement, because the argument
+		// types may differ.
+		argTypes, argValues := c.getBuiltinArgs(frame, instr.Call.Args, builtin.Name())
+		deferred := &deferBuiltin{
+			callName: builtin.Name(),
+			argTypes: argTypes,
+			pos:      instr.Pos(),
+		}
+		callback := llvm.ConstInt(c.uintptrType, uint64(len(frame.allDeferFuncs)), false)
+		frame.allDeferFuncs = append(frame.allDeferFuncs, deferred)
+
+		// Collect all values to be put in the struct (starting with
+		// runtime._defer fields).
+		values = []llvm.Value{callback, next}
+		for _, value := range argValues {
+			values = append(values, value)
+			valueTypes = append(valueTypes, value.Type())
+			deferred.llvmTypes = append(deferred.llvmTypes, value.Type())
+		}
+
 	} else {
 		c.addError(instr.Pos(), "todo: defer on uncommon function call type")
 		return
@@ -287,6 +323,28 @@ func (c *Compiler) emitRunDefers(frame *Frame) {
 			// Call deferred function.
 			c.createCall(fn.LLVMFn, forwardParams, "")
 
+		case *deferBuiltin:
+			// Get the real defer struct type and cast to it.
+			valueTypes := []llvm.Type{c.uintptrType, llvm.PointerType(c.getLLVMRuntimeType("_defer"), 0)}
+			valueTypes = append(valueTypes, callback.llvmTypes...)
+			deferFrameType := c.ctx.StructType(valueTypes, false)
+			deferFramePtr := c.builder.CreateBitCast(deferData, llvm.PointerType(deferFrameType, 0), "deferFrame")
+
+			// Extract the arguments from the struct.
+			argValues := []llvm.Value{}
+			zero := llvm.ConstInt(c.ctx.Int32Type(), 0, false)
+			for i := 2; i < len(valueTypes); i++ {
+				gep := c.builder.CreateInBoundsGEP(deferFramePtr, []llvm.Value{zero, llvm.ConstInt(c.ctx.Int32Type(), uint64(i), false)}, "")
+				argValue := c.builder.CreateLoad(gep, "param")
+				argValues = append(argValues, argValue)
+			}
+
+			// Call the builtin, ignoring the result (if any).
+			_, err := c.createBuiltin(callback.argTypes, argValues, callback.callName, callback.pos)
+			if err != nil {
+				c.diagnostics = append(c.diagnostics, err)
+			}
+
 		default:
 			panic("unknown deferred function type")
 		}
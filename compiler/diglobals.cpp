@@ -0,0 +1,53 @@
+// This file creates the debug info of global variables. The DIBuilder bindings
+// of go-llvm don't support global variables. Also, the debug info of a global
+// variable is only emitted if it is listed in the compile unit, which isn't
+// possible with the LLVM C API.
+
+#include <llvm/ADT/SmallVector.h>
+#include <llvm/IR/DIBuilder.h>
+#include <llvm/IR/DebugInfoMetadata.h>
+#include <llvm/IR/GlobalVariable.h>
+#include <llvm/IR/Module.h>
+#include <llvm-c/Core.h>
+#include <llvm-c/DebugInfo.h>
+
+using namespace llvm;
+
+namespace {
+
+// unwrapDI converts a metadata reference to a debug info node, which may be
+// nil.
+template <typename T>
+T *unwrapDI(LLVMMetadataRef ref) {
+	return ref ? cast<T>(unwrap(ref)) : nullptr;
+}
+
+} // namespace
+
+extern "C" {
+
+// Create the debug info of a global variable and attach it to the global. The
+// scope and file may be nil. It is only emitted once it has been added to the
+// compile unit by tinygo_finalizeGlobalDebugInfo.
+void tinygo_createGlobalDebugInfo(LLVMValueRef global, LLVMMetadataRef scope, const char *name, const char *linkageName, LLVMMetadataRef file, unsigned line, LLVMMetadataRef type, LLVMBool localToUnit) {
+	GlobalVariable *gv = unwrap<GlobalVariable>(global);
+	DIBuilder builder(*gv->getParent());
+	DIGlobalVariableExpression *expr = builder.createGlobalVariableExpression(unwrapDI<DIScope>(scope), name, linkageName, unwrapDI<DIFile>(file), line, unwrapDI<DIType>(type), localToUnit);
+	gv->addDebugInfo(expr);
+}
+
+// Add the debug info of all global variables in the module to the compile
+// unit, so that it is emitted.
+void tinygo_finalizeGlobalDebugInfo(LLVMModuleRef mod, LLVMMetadataRef cu) {
+	DICompileUnit *unit = unwrapDI<DICompileUnit>(cu);
+	SmallVector<Metadata *, 16> elements;
+	SmallVector<DIGlobalVariableExpression *, 1> exprs;
+	for (GlobalVariable &gv : unwrap(mod)->globals()) {
+		exprs.clear();
+		gv.getDebugInfo(exprs);
+		elements.append(exprs.begin(), exprs.end());
+	}
+	unit->replaceGlobalVariables(MDTuple::get(unit->getContext(), elements));
+}
+
+} // extern "C"
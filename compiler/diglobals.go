@@ -0,0 +1,49 @@
+package compiler
+
+// This file creates the debug info of global variables, see diglobals.cpp.
+
+import (
+	"unsafe"
+
+	"tinygo.org/x/go-llvm"
+)
+
+/*
+#cgo CXXFLAGS: -fno-rtti
+#include <stdlib.h>
+#include <llvm-c/Core.h>
+#include <llvm-c/DebugInfo.h>
+void tinygo_createGlobalDebugInfo(LLVMValueRef global, LLVMMetadataRef scope, const char *name, const char *linkageName, LLVMMetadataRef file, unsigned line, LLVMMetadataRef type, LLVMBool localToUnit);
+void tinygo_finalizeGlobalDebugInfo(LLVMModuleRef mod, LLVMMetadataRef cu);
+*/
+import "C"
+
+// createGlobalDebugInfo creates the debug info of a global variable and
+// attaches it to the global. The scope and file may be nil. It is only emitted
+// after finalizeGlobalDebugInfo has been called.
+func (c *Compiler) createGlobalDebugInfo(global llvm.Value, scope llvm.Metadata, name, linkageName string, file llvm.Metadata, line int, typ llvm.Metadata, localToUnit bool) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	clinkageName := C.CString(linkageName)
+	defer C.free(unsafe.Pointer(clinkageName))
+	var clocalToUnit C.LLVMBool
+	if localToUnit {
+		clocalToUnit = 1
+	}
+	C.tinygo_createGlobalDebugInfo(
+		C.LLVMValueRef(unsafe.Pointer(global.C)),
+		C.LLVMMetadataRef(unsafe.Pointer(scope.C)),
+		cname,
+		clinkageName,
+		C.LLVMMetadataRef(unsafe.Pointer(file.C)),
+		C.unsigned(line),
+		C.LLVMMetadataRef(unsafe.Pointer(typ.C)),
+		clocalToUnit)
+}
+
+// finalizeGlobalDebugInfo adds the debug info of the global variables in the
+// module to the compile unit. It must be called right before the DIBuilder is
+// finalized.
+func (c *Compiler) finalizeGlobalDebugInfo() {
+	C.tinygo_finalizeGlobalDebugInfo(C.LLVMModuleRef(unsafe.Pointer(c.mod.C)), C.LLVMMetadataRef(unsafe.Pointer(c.cu.C)))
+}
@@ -77,7 +77,7 @@ package compiler
 //         bar(hdl)                                // await, pass a continuation (hdl) to bar
 //         llvm.suspend(hdl)                       // suspend point, wait for the callee to re-activate
 //         println("done", *i)
-//         runtime.activateTask(parent)            // re-activate the parent (nop, there is no parent)
+//         runtime.returnToParent(parent)          // re-activate the parent (nop, there is no parent)
 //     }
 //
 //     func foo(parent) {
@@ -94,7 +94,7 @@ package compiler
 //         runtime.sleepTask(hdl, time.Second) // ask the scheduler to re-activate this coroutine at the right time
 //         llvm.suspend(hdl)                   // suspend point
 //         println("blocking operation completed)
-//         runtime.activateTask(parent)        // re-activate the parent coroutine before returning
+//         runtime.returnToParent(parent)      // re-activate the parent coroutine before returning
 //     }
 //
 // The real LLVM code is more complicated, but this is the general idea.
@@ -146,7 +146,7 @@ func (c *Compiler) lowerTasks() error {
 	mainCall := uses[0]
 
 	realMain := c.mod.NamedFunction(c.ir.MainPkg().Pkg.Path() + ".main")
-	if len(getUses(c.mod.NamedFunction("runtime.startGoroutine"))) != 0 || len(getUses(c.mod.NamedFunction("runtime.yield"))) != 0 {
+	if len(getUses(c.mod.NamedFunction("runtime.startGoroutine"))) != 0 || len(getUses(c.mod.NamedFunction("runtime.startGoroutineStack"))) != 0 || len(getUses(c.mod.NamedFunction("runtime.yield"))) != 0 {
 		// Program needs a scheduler. Start main.main as a goroutine and start
 		// the scheduler.
 		realMainWrapper := c.createGoroutineStartWrapper(realMain)
@@ -681,7 +681,7 @@ func (c *Compiler) markAsyncFunctions() (needsScheduler bool, err error) {
 					// insert reactivation call
 					c.builder.SetInsertPointBefore(inst)
 					parentHandle := c.createRuntimeCall("getParentHandle", []llvm.Value{}, "")
-					c.createRuntimeCall("activateTask", []llvm.Value{parentHandle}, "")
+					c.createRuntimeCall("returnToParent", []llvm.Value{parentHandle}, "")
 
 					// mark as noret
 					c.builder.SetInsertPointBefore(inst)
@@ -788,6 +788,11 @@ func (c *Compiler) markAsyncFunctions() (needsScheduler bool, err error) {
 		// invoke llvm.coro.begin intrinsic and save task pointer
 		frame.taskHandle = c.builder.CreateCall(coroBeginFunc, []llvm.Value{id, data}, "task.handle")
 
+		// The task state lives in the coroutine frame, which is not zeroed.
+		// Clear it, as the scheduler may read fields that haven't been set
+		// yet (such as the LockGoroutine state).
+		c.builder.CreateStore(llvm.ConstNull(taskState.Type().ElementType()), taskState)
+
 		// Coroutine cleanup. Free resources associated with this coroutine.
 		c.builder.SetInsertPointAtEnd(frame.cleanupBlock)
 		mem := c.builder.CreateCall(coroFreeFunc, []llvm.Value{id, frame.taskHandle}, "task.data.free")
@@ -961,6 +966,7 @@ func (c *Compiler) internalArgumentValue(call llvm.Value, arg llvm.Value) llvm.V
 var specialCoroFuncs = map[string]bool{
 	"runtime.runqueuePushBack": true,
 	"runtime.activateTask":     true,
+	"runtime.returnToParent":   true,
 }
 
 // isCoroNecessary checks if a coroutine pointer value must be non-nil for the program to function.
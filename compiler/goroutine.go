@@ -3,7 +3,12 @@ package compiler
 // This file implements the 'go' keyword to start a new goroutine. See
 // goroutine-lowering.go for more details.
 
-import "tinygo.org/x/go-llvm"
+import (
+	"go/types"
+
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
 
 // emitStartGoroutine starts a new goroutine with the provided function pointer
 // and parameters.
@@ -11,15 +16,22 @@ import "tinygo.org/x/go-llvm"
 // There is one exception: the task-based scheduler needs to have the function
 // pointer passed in as a parameter too in addition to the context.
 //
+// The stack size is only used by the task-based scheduler. If it is nil, the
+// default stack size is used.
+//
 // Because a go statement doesn't return anything, return undef.
-func (c *Compiler) emitStartGoroutine(funcPtr llvm.Value, params []llvm.Value) llvm.Value {
+func (c *Compiler) emitStartGoroutine(funcPtr llvm.Value, params []llvm.Value, stackSize llvm.Value) llvm.Value {
 	switch c.Scheduler() {
 	case "tasks":
 		paramBundle := c.emitPointerPack(params)
 		paramBundle = c.builder.CreatePtrToInt(paramBundle, c.uintptrType, "")
 
 		calleeValue := c.createGoroutineStartWrapper(funcPtr)
-		c.createRuntimeCall("startGoroutine", []llvm.Value{calleeValue, paramBundle}, "")
+		if stackSize.IsNil() {
+			c.createRuntimeCall("startGoroutine", []llvm.Value{calleeValue, paramBundle}, "")
+		} else {
+			c.createRuntimeCall("startGoroutineStack", []llvm.Value{calleeValue, paramBundle, stackSize}, "")
+		}
 	case "coroutines":
 		// We roundtrip through runtime.makeGoroutine as a signal (to find these
 		// calls) and to break any optimizations LLVM will try to do: they are
@@ -27,13 +39,49 @@ func (c *Compiler) emitStartGoroutine(funcPtr llvm.Value, params []llvm.Value) l
 		calleeValue := c.builder.CreatePtrToInt(funcPtr, c.uintptrType, "")
 		calleeValue = c.createRuntimeCall("makeGoroutine", []llvm.Value{calleeValue}, "")
 		calleeValue = c.builder.CreateIntToPtr(calleeValue, funcPtr.Type(), "")
+		var prevGoroutine llvm.Value
+		if c.Race() {
+			// The new goroutine starts running right away, until it blocks.
+			// Tell the race detector, so that it is tracked as a separate
+			// goroutine during that time.
+			prevGoroutine = c.createRuntimeCall("raceGoStart", nil, "")
+		}
+		// The same goes for runtime.LockGoroutine: the new goroutine doesn't
+		// inherit the lock of the goroutine that starts it.
+		prevLocks := c.createRuntimeCall("startGoroutineLock", nil, "")
 		c.createCall(calleeValue, append(params, llvm.ConstPointerNull(c.i8ptrType)), "")
+		c.createRuntimeCall("endGoroutineLock", []llvm.Value{prevLocks}, "")
+		if c.Race() {
+			c.createRuntimeCall("raceGoEnd", []llvm.Value{prevGoroutine}, "")
+		}
 	default:
 		panic("unreachable")
 	}
 	return llvm.Undef(funcPtr.Type().ElementType().ReturnType())
 }
 
+// emitGoWithStackSize implements tinygo.Go, which starts a new goroutine much
+// like a go statement but with a custom stack size:
+//
+//     tinygo.Go(stackSize, fn)
+//
+// is equivalent to the following, except for the stack size:
+//
+//     go fn()
+func (c *Compiler) emitGoWithStackSize(frame *Frame, instr *ssa.CallCommon) (llvm.Value, error) {
+	stackSize := c.getValue(frame, instr.Args[0])
+	funcValue := c.getValue(frame, instr.Args[1])
+	funcPtr, context := c.decodeFuncValue(funcValue, instr.Args[1].Type().Underlying().(*types.Signature))
+	c.emitNilCheck(frame, funcPtr, "fpcall")
+	params := []llvm.Value{context}
+	if c.Scheduler() == "tasks" {
+		// Add the function pointer as a parameter to start the goroutine.
+		params = append(params, funcPtr)
+	}
+	c.emitStartGoroutine(funcPtr, params, stackSize)
+	return llvm.Value{}, nil
+}
+
 // createGoroutineStartWrapper creates a wrapper for the task-based
 // implementation of goroutines. For example, to call a function like this:
 //
@@ -5,6 +5,7 @@ package compiler
 import (
 	"fmt"
 	"go/constant"
+	"go/types"
 	"regexp"
 	"strconv"
 	"strings"
@@ -52,10 +53,12 @@ func (c *Compiler) emitAsm(args []ssa.Value) (llvm.Value, error) {
 // This is a compiler builtin, which allows assembly to be called in a flexible
 // way.
 //
-//     func AsmFull(asm string, regs map[string]interface{})
+//     func AsmFull(asm string, regs map[string]interface{}, clobbers ...string)
 //
 // The asm parameter must be a constant string. The regs parameter must be
-// provided immediately. For example:
+// provided immediately. The clobbers are the registers modified by the
+// assembly, including "cc" for the condition flags, and must be constant
+// strings as well. For example:
 //
 //     arm.AsmFull(
 //         "str {value}, {result}",
@@ -121,11 +124,66 @@ func (c *Compiler) emitAsmFull(frame *Frame, instr *ssa.CallCommon) (llvm.Value,
 	if err != nil {
 		return llvm.Value{}, err
 	}
+	clobbers, err := c.getAsmClobbers(instr)
+	if err != nil {
+		return llvm.Value{}, err
+	}
+	for _, clobber := range clobbers {
+		constraints = append(constraints, "~{"+clobber+"}")
+	}
 	fnType := llvm.FunctionType(c.ctx.VoidType(), argTypes, false)
 	target := llvm.InlineAsm(fnType, asmString, strings.Join(constraints, ","), true, false, 0)
 	return c.builder.CreateCall(target, args, ""), nil
 }
 
+// getAsmClobbers returns the clobbers passed to AsmFull. They are passed as
+// variadic arguments, which means the SSA form stores them one by one in an
+// array that is then sliced.
+func (c *Compiler) getAsmClobbers(instr *ssa.CallCommon) ([]string, error) {
+	if len(instr.Args) < 3 {
+		return nil, nil
+	}
+	switch arg := instr.Args[2].(type) {
+	case *ssa.Const:
+		// No clobbers: this is a nil slice.
+		return nil, nil
+	case *ssa.Slice:
+		alloc, ok := arg.X.(*ssa.Alloc)
+		if !ok {
+			break
+		}
+		clobbers := make([]string, alloc.Type().(*types.Pointer).Elem().(*types.Array).Len())
+		for _, ref := range *alloc.Referrers() {
+			indexAddr, ok := ref.(*ssa.IndexAddr)
+			if !ok {
+				continue
+			}
+			index, ok := indexAddr.Index.(*ssa.Const)
+			if !ok {
+				return nil, c.makeError(instr.Pos(), "clobbers of inline assembly must be constant strings")
+			}
+			for _, ref := range *indexAddr.Referrers() {
+				store, ok := ref.(*ssa.Store)
+				if !ok {
+					continue
+				}
+				value, ok := store.Val.(*ssa.Const)
+				if !ok {
+					return nil, c.makeError(instr.Pos(), "clobbers of inline assembly must be constant strings")
+				}
+				clobbers[index.Int64()] = constant.StringVal(value.Value)
+			}
+		}
+		for _, clobber := range clobbers {
+			if clobber == "" {
+				return nil, c.makeError(instr.Pos(), "clobbers of inline assembly must be constant strings")
+			}
+		}
+		return clobbers, nil
+	}
+	return nil, c.makeError(instr.Pos(), "clobbers of inline assembly must be constant strings")
+}
+
 // This is a compiler builtin which emits an inline SVCall instruction. It can
 // be one of:
 //
@@ -0,0 +1,111 @@
+package compiler
+
+// This file replaces the implementation of some math/bits functions with LLVM
+// intrinsics or wide arithmetic. The Go implementations of these functions are
+// written for portability and are rather slow, especially on 32-bit targets
+// where they are used for bignum and crypto code. LLVM lowers the intrinsics to
+// add-with-carry instructions and widening multiplies where available.
+
+import (
+	"tinygo.org/x/go-llvm"
+)
+
+// defineMathBitsIntrinsic defines the body of the given function using LLVM
+// intrinsics if it is one of the supported math/bits functions. It returns
+// whether the function was defined, otherwise it must be compiled from the Go
+// implementation as usual.
+func (c *Compiler) defineMathBitsIntrinsic(frame *Frame) bool {
+	name := frame.fn.RelString(nil)
+	switch name {
+	case "math/bits.Add64", "math/bits.Sub64", "math/bits.Mul64":
+	default:
+		return false
+	}
+
+	fn := frame.fn.LLVMFn
+	fn.SetLinkage(llvm.InternalLinkage)
+	fn.SetUnnamedAddr(true)
+	if c.Debug() {
+		difunc := c.attachDebugInfo(frame.fn)
+		pos := c.ir.Program.Fset.Position(frame.fn.Pos())
+		c.builder.SetCurrentDebugLocation(uint(pos.Line), uint(pos.Column), difunc, llvm.Metadata{})
+	}
+	block := c.ctx.AddBasicBlock(fn, "entry")
+	c.builder.SetInsertPointAtEnd(block)
+
+	var result0, result1 llvm.Value
+	switch name {
+	case "math/bits.Add64":
+		// func Add64(x, y, carry uint64) (sum, carryOut uint64)
+		result0, result1 = c.emitAddWithCarry("llvm.uadd.with.overflow.i64", fn.Param(0), fn.Param(1), fn.Param(2))
+	case "math/bits.Sub64":
+		// func Sub64(x, y, borrow uint64) (diff, borrowOut uint64)
+		result0, result1 = c.emitAddWithCarry("llvm.usub.with.overflow.i64", fn.Param(0), fn.Param(1), fn.Param(2))
+	case "math/bits.Mul64":
+		// func Mul64(x, y uint64) (hi, lo uint64)
+		result0, result1 = c.emitMul64(fn.Param(0), fn.Param(1))
+	}
+
+	retType := fn.Type().ElementType().ReturnType()
+	tuple := llvm.Undef(retType)
+	tuple = c.builder.CreateInsertValue(tuple, result0, 0, "")
+	tuple = c.builder.CreateInsertValue(tuple, result1, 1, "")
+	c.builder.CreateRet(tuple)
+	return true
+}
+
+// emitAddWithCarry adds (or subtracts, depending on the intrinsic) x and y and
+// then the carry, which must be 0 or 1. It returns the result and the outgoing
+// carry as a 0 or 1 value.
+func (c *Compiler) emitAddWithCarry(intrinsicName string, x, y, carry llvm.Value) (llvm.Value, llvm.Value) {
+	i64Type := c.ctx.Int64Type()
+	intrinsic := c.mod.NamedFunction(intrinsicName)
+	if intrinsic.IsNil() {
+		resultType := c.ctx.StructType([]llvm.Type{i64Type, c.ctx.Int1Type()}, false)
+		fnType := llvm.FunctionType(resultType, []llvm.Type{i64Type, i64Type}, false)
+		intrinsic = llvm.AddFunction(c.mod, intrinsicName, fnType)
+	}
+	result1 := c.builder.CreateCall(intrinsic, []llvm.Value{x, y}, "")
+	result2 := c.builder.CreateCall(intrinsic, []llvm.Value{c.builder.CreateExtractValue(result1, 0, ""), carry}, "")
+	overflow := c.builder.CreateOr(c.builder.CreateExtractValue(result1, 1, ""), c.builder.CreateExtractValue(result2, 1, ""), "")
+	return c.builder.CreateExtractValue(result2, 0, ""), c.builder.CreateZExt(overflow, i64Type, "")
+}
+
+// emitMul64 returns the 128-bit product of x and y as the high and low 64 bits.
+// On 64-bit targets, this is a single widening multiply. On other targets, 128
+// bit multiplies may need a library call that is not available, so the product
+// is built from 32x32->64 bit multiplies which map to a single instruction on
+// most 32-bit architectures.
+func (c *Compiler) emitMul64(x, y llvm.Value) (hi, lo llvm.Value) {
+	i64Type := c.ctx.Int64Type()
+	if c.targetData.PointerSize() >= 8 {
+		i128Type := c.ctx.IntType(128)
+		product := c.builder.CreateMul(c.builder.CreateZExt(x, i128Type, ""), c.builder.CreateZExt(y, i128Type, ""), "")
+		hi = c.builder.CreateTrunc(c.builder.CreateLShr(product, llvm.ConstInt(i128Type, 64, false), ""), i64Type, "")
+		lo = c.builder.CreateTrunc(product, i64Type, "")
+		return
+	}
+
+	// Same algorithm as the Go implementation, but the 32-bit halves are
+	// truncated and extended again so that LLVM knows only the lower 32 bits of
+	// each multiplicand are set.
+	i32Type := c.ctx.Int32Type()
+	shift := llvm.ConstInt(i64Type, 32, false)
+	half := func(v llvm.Value) llvm.Value {
+		return c.builder.CreateZExt(c.builder.CreateTrunc(v, i32Type, ""), i64Type, "")
+	}
+	mul := func(a, b llvm.Value) llvm.Value {
+		return c.builder.CreateMul(a, b, "")
+	}
+	x0 := half(x)
+	x1 := half(c.builder.CreateLShr(x, shift, ""))
+	y0 := half(y)
+	y1 := half(c.builder.CreateLShr(y, shift, ""))
+	w0 := mul(x0, y0)
+	t := c.builder.CreateAdd(mul(x1, y0), c.builder.CreateLShr(w0, shift, ""), "")
+	w1 := c.builder.CreateAdd(half(t), mul(x0, y1), "")
+	w2 := c.builder.CreateLShr(t, shift, "")
+	hi = c.builder.CreateAdd(c.builder.CreateAdd(mul(x1, y1), w2, ""), c.builder.CreateLShr(w1, shift, ""), "")
+	lo = c.builder.CreateMul(x, y, "")
+	return
+}
@@ -40,6 +40,22 @@ func (c *Compiler) emitLifetimeEnd(ptr, size llvm.Value) {
 	llvmutil.EmitLifetimeEnd(c.builder, c.mod, ptr, size)
 }
 
+// getZeroSizedValuePtr returns a pointer that is passed to the runtime instead
+// of a temporary alloca for zero-sized values, such as the struct{} values of a
+// channel used for signalling. The runtime copies zero bytes from or to this
+// pointer, so it is never dereferenced. It is not nil, as a nil value pointer
+// marks a receive operation in select statements.
+func (c *Compiler) getZeroSizedValuePtr() llvm.Value {
+	global := c.mod.NamedGlobal("tinygo.zeroSizedValue")
+	if global.IsNil() {
+		global = llvm.AddGlobal(c.mod, c.ctx.Int8Type(), "tinygo.zeroSizedValue")
+		global.SetInitializer(llvm.ConstNull(c.ctx.Int8Type()))
+		global.SetLinkage(llvm.InternalLinkage)
+		global.SetGlobalConstant(true)
+	}
+	return global
+}
+
 // emitPointerPack packs the list of values into a single pointer value using
 // bitcasts, or else allocates a value on the heap if it cannot be packed in the
 // pointer value directly. It returns the pointer with the packed data.
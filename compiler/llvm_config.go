@@ -0,0 +1,13 @@
+// +build !byollvm
+
+package compiler
+
+// The include paths for passes.cpp, which are the same as the ones used by the
+// LLVM bindings. With the byollvm tag, they are provided by the Makefile.
+
+/*
+#cgo linux  CPPFLAGS: -I/usr/lib/llvm-9/include -D_GNU_SOURCE -D__STDC_CONSTANT_MACROS -D__STDC_FORMAT_MACROS -D__STDC_LIMIT_MACROS
+#cgo darwin CPPFLAGS: -I/usr/local/opt/llvm@9/include -D__STDC_CONSTANT_MACROS -D__STDC_FORMAT_MACROS -D__STDC_LIMIT_MACROS
+#cgo CXXFLAGS: -std=c++11
+*/
+import "C"
@@ -6,6 +6,7 @@ import (
 	"go/token"
 	"go/types"
 
+	"golang.org/x/tools/go/ssa"
 	"tinygo.org/x/go-llvm"
 )
 
@@ -14,8 +15,15 @@ func (c *Compiler) emitMapLookup(keyType, valueType types.Type, m, key llvm.Valu
 
 	// Allocate the memory for the resulting type. Do not zero this memory: it
 	// will be zeroed by the hashmap get implementation if the key is not
-	// present in the map.
-	mapValueAlloca, mapValuePtr, mapValueSize := c.createTemporaryAlloca(llvmValueType, "hashmap.value")
+	// present in the map. Zero-sized values (as in a map[K]struct{} used as a
+	// set) don't need any memory.
+	zeroSizedValue := c.targetData.TypeAllocSize(llvmValueType) == 0
+	var mapValueAlloca, mapValuePtr, mapValueSize llvm.Value
+	if zeroSizedValue {
+		mapValuePtr = c.getZeroSizedValuePtr()
+	} else {
+		mapValueAlloca, mapValuePtr, mapValueSize = c.createTemporaryAlloca(llvmValueType, "hashmap.value")
+	}
 
 	// Do the lookup. How it is done depends on the key type.
 	var commaOkValue llvm.Value
@@ -33,15 +41,28 @@ func (c *Compiler) emitMapLookup(keyType, valueType types.Type, m, key llvm.Valu
 		params := []llvm.Value{m, mapKeyPtr, mapValuePtr}
 		commaOkValue = c.createRuntimeCall("hashmapBinaryGet", params, "")
 		c.emitLifetimeEnd(mapKeyPtr, mapKeySize)
+	} else if hashmapIsFieldwiseKey(keyType) {
+		// key is a struct or array containing strings
+		mapKeyAlloca, mapKeyPtr, mapKeySize := c.createTemporaryAlloca(key.Type(), "hashmap.key")
+		c.builder.CreateStore(key, mapKeyAlloca)
+		hash, equal := c.emitHashmapKeyFuncs(keyType, mapKeyPtr)
+		params := []llvm.Value{m, mapKeyPtr, mapValuePtr, hash, equal}
+		commaOkValue = c.createRuntimeCall("hashmapGet", params, "")
+		c.emitLifetimeEnd(mapKeyPtr, mapKeySize)
 	} else {
 		// Not trivially comparable using memcmp.
-		return llvm.Value{}, c.makeError(pos, "only strings, bools, ints, pointers or structs of bools/ints are supported as map keys, but got: "+keyType.String())
+		return llvm.Value{}, c.makeError(pos, "only strings, bools, ints, pointers or structs/arrays of these are supported as map keys, but got: "+keyType.String())
 	}
 
 	// Load the resulting value from the hashmap. The value is set to the zero
 	// value if the key doesn't exist in the hashmap.
-	mapValue := c.builder.CreateLoad(mapValueAlloca, "")
-	c.emitLifetimeEnd(mapValuePtr, mapValueSize)
+	var mapValue llvm.Value
+	if zeroSizedValue {
+		mapValue = llvm.ConstNull(llvmValueType)
+	} else {
+		mapValue = c.builder.CreateLoad(mapValueAlloca, "")
+		c.emitLifetimeEnd(mapValuePtr, mapValueSize)
+	}
 
 	if commaOk {
 		tuple := llvm.Undef(c.ctx.StructType([]llvm.Type{llvmValueType, c.ctx.Int1Type()}, false))
@@ -54,8 +75,16 @@ func (c *Compiler) emitMapLookup(keyType, valueType types.Type, m, key llvm.Valu
 }
 
 func (c *Compiler) emitMapUpdate(keyType types.Type, m, key, value llvm.Value, pos token.Pos) {
-	valueAlloca, valuePtr, valueSize := c.createTemporaryAlloca(value.Type(), "hashmap.value")
-	c.builder.CreateStore(value, valueAlloca)
+	zeroSizedValue := c.targetData.TypeAllocSize(value.Type()) == 0
+	var valuePtr, valueSize llvm.Value
+	if zeroSizedValue {
+		// Nothing to store, only the key is added to the map.
+		valuePtr = c.getZeroSizedValuePtr()
+	} else {
+		var valueAlloca llvm.Value
+		valueAlloca, valuePtr, valueSize = c.createTemporaryAlloca(value.Type(), "hashmap.value")
+		c.builder.CreateStore(value, valueAlloca)
+	}
 	keyType = keyType.Underlying()
 	if t, ok := keyType.(*types.Basic); ok && t.Info()&types.IsString != 0 {
 		// key is a string
@@ -68,10 +97,19 @@ func (c *Compiler) emitMapUpdate(keyType types.Type, m, key, value llvm.Value, p
 		params := []llvm.Value{m, keyPtr, valuePtr}
 		c.createRuntimeCall("hashmapBinarySet", params, "")
 		c.emitLifetimeEnd(keyPtr, keySize)
+	} else if hashmapIsFieldwiseKey(keyType) {
+		keyAlloca, keyPtr, keySize := c.createTemporaryAlloca(key.Type(), "hashmap.key")
+		c.builder.CreateStore(key, keyAlloca)
+		hash, equal := c.emitHashmapKeyFuncs(keyType, keyPtr)
+		params := []llvm.Value{m, keyPtr, valuePtr, hash, equal}
+		c.createRuntimeCall("hashmapSet", params, "")
+		c.emitLifetimeEnd(keyPtr, keySize)
 	} else {
-		c.addError(pos, "only strings, bools, ints, pointers or structs of bools/ints are supported as map keys, but got: "+keyType.String())
+		c.addError(pos, "only strings, bools, ints, pointers or structs/arrays of these are supported as map keys, but got: "+keyType.String())
+	}
+	if !zeroSizedValue {
+		c.emitLifetimeEnd(valuePtr, valueSize)
 	}
-	c.emitLifetimeEnd(valuePtr, valueSize)
 }
 
 func (c *Compiler) emitMapDelete(keyType types.Type, m, key llvm.Value, pos token.Pos) error {
@@ -88,11 +126,192 @@ func (c *Compiler) emitMapDelete(keyType types.Type, m, key llvm.Value, pos toke
 		c.createRuntimeCall("hashmapBinaryDelete", params, "")
 		c.emitLifetimeEnd(keyPtr, keySize)
 		return nil
+	} else if hashmapIsFieldwiseKey(keyType) {
+		keyAlloca, keyPtr, keySize := c.createTemporaryAlloca(key.Type(), "hashmap.key")
+		c.builder.CreateStore(key, keyAlloca)
+		hash, equal := c.emitHashmapKeyFuncs(keyType, keyPtr)
+		params := []llvm.Value{m, keyPtr, hash, equal}
+		c.createRuntimeCall("hashmapDelete", params, "")
+		c.emitLifetimeEnd(keyPtr, keySize)
+		return nil
 	} else {
-		return c.makeError(pos, "only strings, bools, ints, pointers or structs of bools/ints are supported as map keys, but got: "+keyType.String())
+		return c.makeError(pos, "only strings, bools, ints, pointers or structs/arrays of these are supported as map keys, but got: "+keyType.String())
 	}
 }
 
+// emitHashmapKeyFuncs returns the hash of the key stored at keyPtr and a func
+// value of the function to compare two keys, for keys that must be hashed and
+// compared field by field (see hashmapIsFieldwiseKey). Both functions are
+// generated once per key type.
+func (c *Compiler) emitHashmapKeyFuncs(keyType types.Type, keyPtr llvm.Value) (hash, equal llvm.Value) {
+	hashFn := c.getHashmapHashFunc(keyType)
+	hash = c.builder.CreateCall(hashFn, []llvm.Value{keyPtr}, "")
+
+	// The equal function is passed to the runtime as a func value, so it must
+	// have the same signature as the keyEqual parameter of the runtime
+	// hashmap functions.
+	hashmapGet := c.ir.Program.ImportedPackage("runtime").Members["hashmapGet"].(*ssa.Function)
+	sig := hashmapGet.Signature.Params().At(4).Type().(*types.Signature)
+	equalFn := c.getHashmapEqualFunc(keyType, sig)
+	equal = c.createFuncValue(equalFn, llvm.Undef(c.i8ptrType), sig)
+	return hash, equal
+}
+
+// getHashmapHashFunc returns a function that calculates the hash of the map key
+// of the given type at the given address:
+//
+//     uint32 hash(void *key)
+//
+// The fields are hashed one by one, so that padding between them and the
+// contents of strings are handled correctly.
+func (c *Compiler) getHashmapHashFunc(keyType types.Type) llvm.Value {
+	name := "hashmap.hash:" + getTypeCodeName(keyType)
+	fn := c.mod.NamedFunction(name)
+	if !fn.IsNil() {
+		return fn
+	}
+
+	// Save the current position in the IR builder.
+	currentBlock := c.builder.GetInsertBlock()
+	defer c.builder.SetInsertPointAtEnd(currentBlock)
+
+	fnType := llvm.FunctionType(c.ctx.Int32Type(), []llvm.Type{c.i8ptrType}, false)
+	fn = llvm.AddFunction(c.mod, name, fnType)
+	fn.SetLinkage(llvm.InternalLinkage)
+	fn.SetUnnamedAddr(true)
+	entry := c.ctx.AddBasicBlock(fn, "entry")
+	c.builder.SetInsertPointAtEnd(entry)
+
+	keyPtr := c.builder.CreateBitCast(fn.Param(0), llvm.PointerType(c.getLLVMType(keyType), 0), "")
+	hash := llvm.ConstInt(c.ctx.Int32Type(), 2166136261, false) // FNV offset basis
+	hash = c.emitHashmapFieldHash(hash, keyPtr, keyType)
+	c.builder.CreateRet(hash)
+	return fn
+}
+
+// emitHashmapFieldHash mixes the hash of the value at ptr into the given hash.
+func (c *Compiler) emitHashmapFieldHash(hash, ptr llvm.Value, typ types.Type) llvm.Value {
+	zero := llvm.ConstInt(c.ctx.Int32Type(), 0, false)
+	var fieldHash llvm.Value
+	switch typ := typ.Underlying().(type) {
+	case *types.Struct:
+		for i := 0; i < typ.NumFields(); i++ {
+			if typ.Field(i).Name() == "_" {
+				// Blank fields are ignored in comparisons.
+				continue
+			}
+			index := llvm.ConstInt(c.ctx.Int32Type(), uint64(i), false)
+			fieldPtr := c.builder.CreateInBoundsGEP(ptr, []llvm.Value{zero, index}, "")
+			hash = c.emitHashmapFieldHash(hash, fieldPtr, typ.Field(i).Type())
+		}
+		return hash
+	case *types.Array:
+		switch elem := typ.Elem().Underlying().(type) {
+		case *types.Basic:
+			if elem.Info()&types.IsString == 0 {
+				// There is no padding between the elements, so hash the
+				// array at once.
+				fieldHash = c.emitHashmapBinaryHash(ptr)
+			}
+		case *types.Pointer:
+			fieldHash = c.emitHashmapBinaryHash(ptr)
+		}
+		if fieldHash.IsNil() {
+			for i := int64(0); i < typ.Len(); i++ {
+				index := llvm.ConstInt(c.ctx.Int32Type(), uint64(i), false)
+				elemPtr := c.builder.CreateInBoundsGEP(ptr, []llvm.Value{zero, index}, "")
+				hash = c.emitHashmapFieldHash(hash, elemPtr, typ.Elem())
+			}
+			return hash
+		}
+	case *types.Basic:
+		if typ.Info()&types.IsString != 0 {
+			str := c.builder.CreateLoad(ptr, "")
+			fieldHash = c.createRuntimeCall("hashmapStringHash", []llvm.Value{str}, "")
+		} else {
+			fieldHash = c.emitHashmapBinaryHash(ptr)
+		}
+	default:
+		fieldHash = c.emitHashmapBinaryHash(ptr)
+	}
+	// Mix in the hash of this field like FNV-1a mixes in a byte.
+	hash = c.builder.CreateXor(hash, fieldHash, "")
+	return c.builder.CreateMul(hash, llvm.ConstInt(c.ctx.Int32Type(), 16777619, false), "") // FNV prime
+}
+
+// emitHashmapBinaryHash returns the hash of the bytes of the value at ptr.
+func (c *Compiler) emitHashmapBinaryHash(ptr llvm.Value) llvm.Value {
+	size := llvm.ConstInt(c.uintptrType, c.targetData.TypeAllocSize(ptr.Type().ElementType()), false)
+	bytePtr := c.builder.CreateBitCast(ptr, c.i8ptrType, "")
+	return c.createRuntimeCall("hashmapHash", []llvm.Value{bytePtr, size}, "")
+}
+
+// getHashmapEqualFunc returns a function with the given signature that
+// compares two map keys of the given type, like the == operator:
+//
+//     func equal(x, y unsafe.Pointer, n uintptr) bool
+//
+// The size parameter n is unused, it is only there so that the function can be
+// used in place of runtime.memequal.
+func (c *Compiler) getHashmapEqualFunc(keyType types.Type, sig *types.Signature) llvm.Value {
+	name := "hashmap.equal:" + getTypeCodeName(keyType)
+	fn := c.mod.NamedFunction(name)
+	if !fn.IsNil() {
+		return fn
+	}
+
+	// Save the current position in the IR builder.
+	currentBlock := c.builder.GetInsertBlock()
+	defer c.builder.SetInsertPointAtEnd(currentBlock)
+
+	fn = llvm.AddFunction(c.mod, name, c.getRawFuncType(sig).ElementType())
+	fn.SetLinkage(llvm.InternalLinkage)
+	fn.SetUnnamedAddr(true)
+	entry := c.ctx.AddBasicBlock(fn, "entry")
+	c.builder.SetInsertPointAtEnd(entry)
+
+	keyPtrType := llvm.PointerType(c.getLLVMType(keyType), 0)
+	x := c.builder.CreateBitCast(fn.Param(0), keyPtrType, "")
+	y := c.builder.CreateBitCast(fn.Param(1), keyPtrType, "")
+	c.builder.CreateRet(c.emitHashmapFieldEqual(x, y, keyType))
+	return fn
+}
+
+// emitHashmapFieldEqual returns whether the values at x and y are equal.
+func (c *Compiler) emitHashmapFieldEqual(x, y llvm.Value, typ types.Type) llvm.Value {
+	zero := llvm.ConstInt(c.ctx.Int32Type(), 0, false)
+	switch typ := typ.Underlying().(type) {
+	case *types.Struct:
+		result := llvm.ConstInt(c.ctx.Int1Type(), 1, false)
+		for i := 0; i < typ.NumFields(); i++ {
+			if typ.Field(i).Name() == "_" {
+				continue
+			}
+			index := llvm.ConstInt(c.ctx.Int32Type(), uint64(i), false)
+			fieldX := c.builder.CreateInBoundsGEP(x, []llvm.Value{zero, index}, "")
+			fieldY := c.builder.CreateInBoundsGEP(y, []llvm.Value{zero, index}, "")
+			result = c.builder.CreateAnd(result, c.emitHashmapFieldEqual(fieldX, fieldY, typ.Field(i).Type()), "")
+		}
+		return result
+	case *types.Array:
+		result := llvm.ConstInt(c.ctx.Int1Type(), 1, false)
+		for i := int64(0); i < typ.Len(); i++ {
+			index := llvm.ConstInt(c.ctx.Int32Type(), uint64(i), false)
+			elemX := c.builder.CreateInBoundsGEP(x, []llvm.Value{zero, index}, "")
+			elemY := c.builder.CreateInBoundsGEP(y, []llvm.Value{zero, index}, "")
+			result = c.builder.CreateAnd(result, c.emitHashmapFieldEqual(elemX, elemY, typ.Elem()), "")
+		}
+		return result
+	case *types.Basic:
+		if typ.Info()&types.IsString != 0 {
+			strX := c.builder.CreateLoad(x, "")
+			strY := c.builder.CreateLoad(y, "")
+			return c.createRuntimeCall("stringEqual", []llvm.Value{strX, strY}, "")
+		}
+	}
+	return c.builder.CreateICmp(llvm.IntEQ, c.builder.CreateLoad(x, ""), c.builder.CreateLoad(y, ""), "")
+}
+
 // Get FNV-1a hash of this string.
 //
 // https://en.wikipedia.org/wiki/Fowler%E2%80%93Noll%E2%80%93Vo_hash_function#FNV-1a_hash
@@ -115,6 +334,41 @@ func hashmapTopHash(hash uint32) uint8 {
 	return tophash
 }
 
+// Returns true if this key type is a struct or array that contains strings but
+// otherwise only contains values that can be compared with runtime.memequal.
+// These keys are hashed and compared field by field, with functions generated
+// by the compiler.
+func hashmapIsFieldwiseKey(keyType types.Type) bool {
+	switch keyType.Underlying().(type) {
+	case *types.Struct, *types.Array:
+		return !hashmapIsBinaryKey(keyType) && hashmapIsFieldwiseComparable(keyType)
+	default:
+		return false
+	}
+}
+
+// Returns true if this type only contains strings and values that can be
+// compared with runtime.memequal.
+func hashmapIsFieldwiseComparable(typ types.Type) bool {
+	switch typ := typ.Underlying().(type) {
+	case *types.Basic:
+		return typ.Info()&(types.IsBoolean|types.IsInteger|types.IsString) != 0
+	case *types.Pointer:
+		return true
+	case *types.Struct:
+		for i := 0; i < typ.NumFields(); i++ {
+			if !hashmapIsFieldwiseComparable(typ.Field(i).Type()) {
+				return false
+			}
+		}
+		return true
+	case *types.Array:
+		return hashmapIsFieldwiseComparable(typ.Elem())
+	default:
+		return false
+	}
+}
+
 // Returns true if this key type does not contain strings, interfaces etc., so
 // can be compared with runtime.memequal.
 func hashmapIsBinaryKey(keyType types.Type) bool {
@@ -2,13 +2,23 @@ package compiler
 
 import (
 	"errors"
+	"fmt"
 
+	"github.com/tinygo-org/tinygo/interp"
 	"github.com/tinygo-org/tinygo/transform"
 	"tinygo.org/x/go-llvm"
 )
 
 // Run the LLVM optimizer over the module.
 // The inliner can be disabled (if necessary) by passing 0 to the inlinerThreshold.
+//
+// The size levels differ in more than the size level of the pass manager
+// builder. At size levels 1 (-Os) and 2 (-Oz) all functions are marked optsize,
+// which stops the regular loop unroller from unrolling anything that makes the
+// code bigger. Only at size level 1 an extra pass fully unrolls loops with a
+// small constant trip count, so that these are still flattened as at -O2. The
+// loop and SLP vectorizers are not enabled by the pass manager builder at any
+// level.
 func (c *Compiler) Optimize(optLevel, sizeLevel int, inlinerThreshold uint) []error {
 	builder := llvm.NewPassManagerBuilder()
 	defer builder.Dispose()
@@ -17,10 +27,23 @@ func (c *Compiler) Optimize(optLevel, sizeLevel int, inlinerThreshold uint) []er
 	if inlinerThreshold != 0 {
 		builder.UseInlinerWithThreshold(inlinerThreshold)
 	}
+	if sizeLevel == 1 {
+		addFullUnrollPass(builder, sizeUnrollThreshold)
+	}
 	builder.AddCoroutinePassesToExtensionPoints()
 
 	if c.PanicStrategy() == "trap" {
 		transform.ReplacePanicsWithTrap(c.mod) // -panic=trap
+		if err := c.verifyPass("ReplacePanicsWithTrap"); err != nil {
+			return []error{err}
+		}
+	}
+
+	if c.Race() {
+		transform.InstrumentRace(c.mod) // -race
+		if err := c.verifyPass("InstrumentRace"); err != nil {
+			return []error{err}
+		}
 	}
 
 	// run a check of all of our code
@@ -32,42 +55,62 @@ func (c *Compiler) Optimize(optLevel, sizeLevel int, inlinerThreshold uint) []er
 	}
 
 	// Run function passes for each function.
-	funcPasses := llvm.NewFunctionPassManagerForModule(c.mod)
-	defer funcPasses.Dispose()
-	builder.PopulateFunc(funcPasses)
-	funcPasses.InitializeFunc()
-	for fn := c.mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
-		funcPasses.RunFunc(fn)
+	if err := c.runFunctionPasses(builder); err != nil {
+		return []error{err}
 	}
-	funcPasses.FinalizeFunc()
 
 	if optLevel > 0 {
 		// Run some preparatory passes for the Go optimizer.
-		goPasses := llvm.NewPassManager()
-		defer goPasses.Dispose()
-		goPasses.AddGlobalOptimizerPass()
-		goPasses.AddConstantPropagationPass()
-		goPasses.AddAggressiveDCEPass()
-		goPasses.AddFunctionAttrsPass()
-		goPasses.Run(c.mod)
+		if err := c.runGoPasses(); err != nil {
+			return []error{err}
+		}
 
 		// Run Go-specific optimization passes.
 		transform.OptimizeMaps(c.mod)
+		if err := c.verifyPass("OptimizeMaps"); err != nil {
+			return []error{err}
+		}
 		transform.OptimizeStringToBytes(c.mod)
+		if err := c.verifyPass("OptimizeStringToBytes"); err != nil {
+			return []error{err}
+		}
 		transform.OptimizeAllocs(c.mod)
+		if err := c.verifyPass("OptimizeAllocs"); err != nil {
+			return []error{err}
+		}
 		transform.LowerInterfaces(c.mod)
+		if err := c.verifyPass("LowerInterfaces"); err != nil {
+			return []error{err}
+		}
 		if c.funcImplementation() == funcValueSwitch {
 			transform.LowerFuncValues(c.mod)
+			if err := c.verifyPass("LowerFuncValues"); err != nil {
+				return []error{err}
+			}
 		}
 
 		// After interfaces are lowered, there are many more opportunities for
 		// interprocedural optimizations. To get them to work, function
 		// attributes have to be updated first.
-		goPasses.Run(c.mod)
+		if err := c.runGoPasses(); err != nil {
+			return []error{err}
+		}
 
 		// Run TinyGo-specific interprocedural optimizations.
 		transform.OptimizeAllocs(c.mod)
+		if err := c.verifyPass("OptimizeAllocs"); err != nil {
+			return []error{err}
+		}
 		transform.OptimizeStringToBytes(c.mod)
+		if err := c.verifyPass("OptimizeStringToBytes"); err != nil {
+			return []error{err}
+		}
+		if c.FoldPureCalls() {
+			interp.FoldPureCalls(c.mod, c.DumpSSA()) // -fold-pure-calls
+			if err := c.verifyPass("FoldPureCalls"); err != nil {
+				return []error{err}
+			}
+		}
 
 		// Lower runtime.isnil calls to regular nil comparisons.
 		isnil := c.mod.NamedFunction("runtime.isnil")
@@ -84,21 +127,36 @@ func (c *Compiler) Optimize(optLevel, sizeLevel int, inlinerThreshold uint) []er
 				use.EraseFromParentAsInstruction()
 			}
 		}
+		if err := c.verifyPass("runtime.isnil lowering"); err != nil {
+			return []error{err}
+		}
 
 		err := c.LowerGoroutines()
 		if err != nil {
 			return []error{err}
 		}
+		if err := c.verifyPass("LowerGoroutines"); err != nil {
+			return []error{err}
+		}
 	} else {
 		// Must be run at any optimization level.
 		transform.LowerInterfaces(c.mod)
+		if err := c.verifyPass("LowerInterfaces"); err != nil {
+			return []error{err}
+		}
 		if c.funcImplementation() == funcValueSwitch {
 			transform.LowerFuncValues(c.mod)
+			if err := c.verifyPass("LowerFuncValues"); err != nil {
+				return []error{err}
+			}
 		}
 		err := c.LowerGoroutines()
 		if err != nil {
 			return []error{err}
 		}
+		if err := c.verifyPass("LowerGoroutines"); err != nil {
+			return []error{err}
+		}
 	}
 	if c.VerifyIR() {
 		if errs := c.checkModule(); errs != nil {
@@ -109,7 +167,7 @@ func (c *Compiler) Optimize(optLevel, sizeLevel int, inlinerThreshold uint) []er
 		return []error{errors.New("optimizations caused a verification failure")}
 	}
 
-	if sizeLevel >= 2 {
+	if sizeLevel >= 1 {
 		// Set the "optsize" attribute to make slightly smaller binaries at the
 		// cost of some performance.
 		kind := llvm.AttributeKindID("optsize")
@@ -130,19 +188,26 @@ func (c *Compiler) Optimize(optLevel, sizeLevel int, inlinerThreshold uint) []er
 
 	// Run function passes again, because without it, llvm.coro.size.i32()
 	// doesn't get lowered.
-	for fn := c.mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
-		funcPasses.RunFunc(fn)
+	if err := c.runFunctionPasses(builder); err != nil {
+		return []error{err}
 	}
-	funcPasses.FinalizeFunc()
 
 	// Run module passes.
-	modPasses := llvm.NewPassManager()
-	defer modPasses.Dispose()
-	builder.Populate(modPasses)
-	modPasses.Run(c.mod)
+	if err := c.runModulePasses(builder); err != nil {
+		return []error{err}
+	}
 
-	hasGCPass := transform.AddGlobalsBitmap(c.mod)
+	hasGCPass, err := transform.AddGlobalsBitmap(c.mod)
+	if err != nil {
+		return []error{err}
+	}
+	if err := c.verifyPass("AddGlobalsBitmap"); err != nil {
+		return []error{err}
+	}
 	hasGCPass = transform.MakeGCStackSlots(c.mod) || hasGCPass
+	if err := c.verifyPass("MakeGCStackSlots"); err != nil {
+		return []error{err}
+	}
 	if hasGCPass {
 		if err := c.Verify(); err != nil {
 			return []error{errors.New("GC pass caused a verification failure")}
@@ -151,3 +216,18 @@ func (c *Compiler) Optimize(optLevel, sizeLevel int, inlinerThreshold uint) []er
 
 	return nil
 }
+
+// verifyPass runs the LLVM verifier when -verifypasses is set, and returns an
+// error mentioning the given pass name if the IR is invalid. It is called after
+// each TinyGo-specific pass, to find out which pass first introduced invalid IR.
+// The passes of the pass manager builder are verified in passes.cpp instead.
+// Because it is slow, it is disabled by default.
+func (c *Compiler) verifyPass(name string) error {
+	if !c.VerifyPasses() {
+		return nil
+	}
+	if err := llvm.VerifyModule(c.mod, llvm.ReturnStatusAction); err != nil {
+		return fmt.Errorf("verification failure after %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+// This file implements pass managers that run the LLVM verifier after every
+// single pass, for -verifypasses. The pass manager builder adds many passes at
+// once, so verifying the module after all of them have run doesn't tell which
+// pass broke the IR.
+//
+// The verifier that is added after a pass is of the same kind as the pass. For
+// example, a function pass is followed by a function pass that verifies the
+// function it has just been run on. This keeps the structure of the pipeline
+// intact: function passes are still run together on one function at a time,
+// and loop passes still share the same loop pass manager.
+//
+// A verification failure is returned to the caller as an error message, like
+// LLVMVerifyModule does. The passes after the failure would run on invalid IR,
+// on which they may crash. Therefore, the invalid function is replaced with one
+// that only contains unreachable instructions, and the passes after the
+// failure are skipped with a pass gate (which most passes check before doing
+// anything).
+
+#include <llvm/Analysis/CallGraph.h>
+#include <llvm/Analysis/CallGraphSCCPass.h>
+#include <llvm/Analysis/LoopPass.h>
+#include <llvm/IR/Constants.h>
+#include <llvm/IR/Instructions.h>
+#include <llvm/IR/LLVMContext.h>
+#include <llvm/IR/LegacyPassManager.h>
+#include <llvm/IR/Module.h>
+#include <llvm/IR/OptBisect.h>
+#include <llvm/IR/Verifier.h>
+#include <llvm/Support/raw_ostream.h>
+#include <llvm-c/Core.h>
+#include <llvm-c/Transforms/PassManagerBuilder.h>
+
+using namespace llvm;
+
+namespace {
+
+// VerificationGate records the first verification failure, and skips all
+// passes after it.
+class VerificationGate : public OptPassGate {
+public:
+	std::string error;
+	bool isEnabled() const override { return !error.empty(); }
+	bool shouldRunPass(const Pass *P, StringRef IRDescription) override { return false; }
+};
+
+// clearFunction replaces the body of an invalid function with unreachable
+// instructions, to keep later passes from crashing on it. The basic blocks are
+// kept, as analyses of the function that are still cached may refer to them.
+void clearFunction(Function &F) {
+	for (BasicBlock &BB : F) {
+		for (Instruction &I : BB)
+			I.dropAllReferences();
+	}
+	for (BasicBlock &BB : F) {
+		while (!BB.empty()) {
+			Instruction &I = BB.back();
+			I.replaceAllUsesWith(UndefValue::get(I.getType()));
+			I.eraseFromParent();
+		}
+		new UnreachableInst(F.getContext(), &BB);
+	}
+}
+
+// verify checks the function after the given pass. If it is invalid, it records
+// an error naming the pass (unless an earlier pass already failed) and clears
+// the function.
+void verify(VerificationGate *gate, StringRef pass, Function &F) {
+	if (F.isDeclaration())
+		return;
+	std::string message;
+	raw_string_ostream os(message);
+	if (!verifyFunction(F, &os))
+		return;
+	if (!gate->isEnabled())
+		gate->error = ("verification failure after " + pass + " on " + F.getName() + ": " + StringRef(os.str()).rtrim()).str();
+	clearFunction(F);
+}
+
+// verify checks the whole module after the given pass, like the function
+// version above.
+void verify(VerificationGate *gate, StringRef pass, Module &M) {
+	std::string message;
+	raw_string_ostream os(message);
+	if (!verifyModule(M, &os))
+		return;
+	if (!gate->isEnabled())
+		gate->error = ("verification failure after " + pass + ": " + StringRef(os.str()).rtrim()).str();
+	for (Function &F : M) {
+		if (!F.isDeclaration() && verifyFunction(F))
+			clearFunction(F);
+	}
+}
+
+class ModuleVerifier : public ModulePass {
+	VerificationGate *gate;
+	std::string pass;
+
+public:
+	static char ID;
+	ModuleVerifier(VerificationGate *gate, StringRef pass) : ModulePass(ID), gate(gate), pass(pass) {}
+	StringRef getPassName() const override { return "TinyGo module verifier"; }
+	void getAnalysisUsage(AnalysisUsage &AU) const override { AU.setPreservesAll(); }
+	bool runOnModule(Module &M) override {
+		verify(gate, pass, M);
+		return false;
+	}
+};
+
+class SCCVerifier : public CallGraphSCCPass {
+	VerificationGate *gate;
+	std::string pass;
+
+public:
+	static char ID;
+	SCCVerifier(VerificationGate *gate, StringRef pass) : CallGraphSCCPass(ID), gate(gate), pass(pass) {}
+	StringRef getPassName() const override { return "TinyGo SCC verifier"; }
+	void getAnalysisUsage(AnalysisUsage &AU) const override {
+		CallGraphSCCPass::getAnalysisUsage(AU);
+		AU.setPreservesAll();
+	}
+	bool runOnSCC(CallGraphSCC &SCC) override {
+		for (CallGraphNode *node : SCC) {
+			if (Function *F = node->getFunction())
+				verify(gate, pass, *F);
+		}
+		return false;
+	}
+};
+
+class FunctionVerifier : public FunctionPass {
+	VerificationGate *gate;
+	std::string pass;
+
+public:
+	static char ID;
+	FunctionVerifier(VerificationGate *gate, StringRef pass) : FunctionPass(ID), gate(gate), pass(pass) {}
+	StringRef getPassName() const override { return "TinyGo function verifier"; }
+	void getAnalysisUsage(AnalysisUsage &AU) const override { AU.setPreservesAll(); }
+	bool runOnFunction(Function &F) override {
+		verify(gate, pass, F);
+		return false;
+	}
+};
+
+class LoopVerifier : public LoopPass {
+	VerificationGate *gate;
+	std::string pass;
+
+public:
+	static char ID;
+	LoopVerifier(VerificationGate *gate, StringRef pass) : LoopPass(ID), gate(gate), pass(pass) {}
+	StringRef getPassName() const override { return "TinyGo loop verifier"; }
+	void getAnalysisUsage(AnalysisUsage &AU) const override { AU.setPreservesAll(); }
+	bool runOnLoop(Loop *L, LPPassManager &LPM) override {
+		verify(gate, pass, *L->getHeader()->getParent());
+		return false;
+	}
+};
+
+char ModuleVerifier::ID = 0;
+char SCCVerifier::ID = 0;
+char FunctionVerifier::ID = 0;
+char LoopVerifier::ID = 0;
+
+// createVerifier returns a verifier to run after the given pass, or nullptr if
+// the pass doesn't change the IR. It must be called before the pass is added to
+// a pass manager, as the pass manager may delete it.
+Pass *createVerifier(VerificationGate *gate, Pass *P) {
+	StringRef pass = P->getPassName();
+	switch (P->getPassKind()) {
+	case PT_Module:
+		if (P->getAsImmutablePass())
+			return nullptr;
+		return new ModuleVerifier(gate, pass);
+	case PT_CallGraphSCC:
+		return new SCCVerifier(gate, pass);
+	case PT_Function:
+		return new FunctionVerifier(gate, pass);
+	case PT_Loop:
+		return new LoopVerifier(gate, pass);
+	default:
+		return nullptr;
+	}
+}
+
+class VerifyingPassManager : public legacy::PassManager {
+	VerificationGate *gate;
+
+public:
+	VerifyingPassManager(VerificationGate *gate) : gate(gate) {}
+	void add(Pass *P) override {
+		Pass *verifier = createVerifier(gate, P);
+		legacy::PassManager::add(P);
+		if (verifier)
+			legacy::PassManager::add(verifier);
+	}
+};
+
+class VerifyingFunctionPassManager : public legacy::FunctionPassManager {
+	VerificationGate *gate;
+
+public:
+	VerifyingFunctionPassManager(VerificationGate *gate, Module *M) : legacy::FunctionPassManager(M), gate(gate) {}
+	void add(Pass *P) override {
+		Pass *verifier = createVerifier(gate, P);
+		legacy::FunctionPassManager::add(P);
+		if (verifier)
+			legacy::FunctionPassManager::add(verifier);
+	}
+};
+
+// runVerified runs the passes with the gate installed in the context of the
+// module, and returns the verification failure (if any) in errorMessage.
+template <typename F>
+LLVMBool runVerified(Module &M, char **errorMessage, F run) {
+	VerificationGate gate;
+	LLVMContext &ctx = M.getContext();
+	OptPassGate &previous = ctx.getOptPassGate();
+	ctx.setOptPassGate(gate);
+	run(&gate);
+	ctx.setOptPassGate(previous);
+	if (!gate.isEnabled())
+		return false;
+	*errorMessage = LLVMCreateMessage(gate.error.c_str());
+	return true;
+}
+
+} // namespace
+
+extern "C" {
+
+LLVMBool tinygo_runVerifiedFunctionPasses(LLVMPassManagerBuilderRef builder, LLVMModuleRef mod, char **errorMessage) {
+	return runVerified(*unwrap(mod), errorMessage, [&](VerificationGate *gate) {
+		VerifyingFunctionPassManager passes(gate, unwrap(mod));
+		LLVMPassManagerBuilderPopulateFunctionPassManager(builder, wrap(&passes));
+		passes.doInitialization();
+		for (Function &F : *unwrap(mod))
+			passes.run(F);
+		passes.doFinalization();
+	});
+}
+
+LLVMBool tinygo_runVerifiedModulePasses(LLVMPassManagerBuilderRef builder, LLVMModuleRef mod, char **errorMessage) {
+	return runVerified(*unwrap(mod), errorMessage, [&](VerificationGate *gate) {
+		VerifyingPassManager passes(gate);
+		LLVMPassManagerBuilderPopulateModulePassManager(builder, wrap(&passes));
+		passes.run(*unwrap(mod));
+	});
+}
+
+} // extern "C"
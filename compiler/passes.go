@@ -0,0 +1,98 @@
+package compiler
+
+// This file runs the passes of the LLVM pass manager builder. With
+// -verifypasses, they are run by the pass managers in passes.cpp instead, which
+// verify the IR after every single pass.
+
+import (
+	"errors"
+	"unsafe"
+
+	"tinygo.org/x/go-llvm"
+)
+
+/*
+#cgo CXXFLAGS: -fno-rtti
+#include <llvm-c/Core.h>
+#include <llvm-c/Transforms/PassManagerBuilder.h>
+LLVMBool tinygo_runVerifiedFunctionPasses(LLVMPassManagerBuilderRef builder, LLVMModuleRef mod, char **errorMessage);
+LLVMBool tinygo_runVerifiedModulePasses(LLVMPassManagerBuilderRef builder, LLVMModuleRef mod, char **errorMessage);
+*/
+import "C"
+
+// runFunctionPasses runs the function passes of the pass manager builder on
+// each function in the module. It only returns an error with -verifypasses.
+func (c *Compiler) runFunctionPasses(builder llvm.PassManagerBuilder) error {
+	if c.VerifyPasses() {
+		var errorMessage *C.char
+		failed := C.tinygo_runVerifiedFunctionPasses(C.LLVMPassManagerBuilderRef(unsafe.Pointer(builder.C)), C.LLVMModuleRef(unsafe.Pointer(c.mod.C)), &errorMessage)
+		return verificationError(failed, errorMessage)
+	}
+	funcPasses := llvm.NewFunctionPassManagerForModule(c.mod)
+	defer funcPasses.Dispose()
+	builder.PopulateFunc(funcPasses)
+	funcPasses.InitializeFunc()
+	for fn := c.mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
+		funcPasses.RunFunc(fn)
+	}
+	funcPasses.FinalizeFunc()
+	return nil
+}
+
+// runModulePasses runs the module passes of the pass manager builder. It only
+// returns an error with -verifypasses.
+func (c *Compiler) runModulePasses(builder llvm.PassManagerBuilder) error {
+	if c.VerifyPasses() {
+		var errorMessage *C.char
+		failed := C.tinygo_runVerifiedModulePasses(C.LLVMPassManagerBuilderRef(unsafe.Pointer(builder.C)), C.LLVMModuleRef(unsafe.Pointer(c.mod.C)), &errorMessage)
+		return verificationError(failed, errorMessage)
+	}
+	modPasses := llvm.NewPassManager()
+	defer modPasses.Dispose()
+	builder.Populate(modPasses)
+	modPasses.Run(c.mod)
+	return nil
+}
+
+// verificationError converts the result of the verifying pass managers in
+// passes.cpp to an error, freeing the error message.
+func verificationError(failed C.LLVMBool, errorMessage *C.char) error {
+	if failed == 0 {
+		return nil
+	}
+	defer C.LLVMDisposeMessage(errorMessage)
+	return errors.New(C.GoString(errorMessage))
+}
+
+// runGoPasses runs some preparatory passes for the Go optimizer. With
+// -verifypasses, each pass is run on its own and verified.
+func (c *Compiler) runGoPasses() error {
+	passes := []struct {
+		name string
+		add  func(llvm.PassManager)
+	}{
+		{"GlobalOptimizer", llvm.PassManager.AddGlobalOptimizerPass},
+		{"ConstantPropagation", llvm.PassManager.AddConstantPropagationPass},
+		{"AggressiveDCE", llvm.PassManager.AddAggressiveDCEPass},
+		{"FunctionAttrs", llvm.PassManager.AddFunctionAttrsPass},
+	}
+	if !c.VerifyPasses() {
+		goPasses := llvm.NewPassManager()
+		defer goPasses.Dispose()
+		for _, pass := range passes {
+			pass.add(goPasses)
+		}
+		goPasses.Run(c.mod)
+		return nil
+	}
+	for _, pass := range passes {
+		goPasses := llvm.NewPassManager()
+		pass.add(goPasses)
+		goPasses.Run(c.mod)
+		goPasses.Dispose()
+		if err := c.verifyPass(pass.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
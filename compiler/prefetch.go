@@ -0,0 +1,49 @@
+package compiler
+
+// This file implements the tinygo.Prefetch builtin, which is lowered to the
+// llvm.prefetch intrinsic on targets that have a prefetch instruction.
+
+import (
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
+
+// hasPrefetch returns whether the target architecture may have a prefetch
+// instruction. The backends of other architectures (such as AVR and
+// WebAssembly) may not support the llvm.prefetch intrinsic at all, so calls to
+// tinygo.Prefetch are removed there. Targets in the list that don't have a
+// prefetch instruction (like ARMv6-M) simply drop the intrinsic.
+func (c *Compiler) hasPrefetch() bool {
+	arch := strings.Split(c.Triple(), "-")[0]
+	for _, prefix := range []string{"arm", "thumb", "aarch64", "i386", "i686", "x86_64", "riscv"} {
+		if strings.HasPrefix(arch, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// emitPrefetch implements tinygo.Prefetch, which hints that the memory at the
+// given pointer will be read soon. It is emitted as a read prefetch of data
+// with the highest temporal locality (keep in all cache levels).
+func (c *Compiler) emitPrefetch(frame *Frame, instr *ssa.CallCommon) (llvm.Value, error) {
+	ptr := c.getValue(frame, instr.Args[0])
+	if !c.hasPrefetch() {
+		return llvm.Value{}, nil
+	}
+	prefetch := c.mod.NamedFunction("llvm.prefetch")
+	if prefetch.IsNil() {
+		i32Type := c.ctx.Int32Type()
+		fnType := llvm.FunctionType(c.ctx.VoidType(), []llvm.Type{c.i8ptrType, i32Type, i32Type, i32Type}, false)
+		prefetch = llvm.AddFunction(c.mod, "llvm.prefetch", fnType)
+	}
+	c.builder.CreateCall(prefetch, []llvm.Value{
+		ptr,
+		llvm.ConstInt(c.ctx.Int32Type(), 0, false), // read
+		llvm.ConstInt(c.ctx.Int32Type(), 3, false), // high temporal locality
+		llvm.ConstInt(c.ctx.Int32Type(), 1, false), // data cache
+	}, "")
+	return llvm.Value{}, nil
+}
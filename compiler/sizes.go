@@ -28,6 +28,10 @@ func (s *StdSizes) Alignof(T types.Type) int64 {
 		// spec: "For a variable x of struct type: unsafe.Alignof(x)
 		// is the largest of the values unsafe.Alignof(x.f) for each
 		// field f of x, but at least 1."
+		// Packed C structs are the exception, with an alignment of 1.
+		if isPackedStruct(t) {
+			return 1
+		}
 		max := int64(1)
 		for i := 0; i < t.NumFields(); i++ {
 			f := t.Field(i)
@@ -63,9 +67,13 @@ func (s *StdSizes) Alignof(T types.Type) int64 {
 
 func (s *StdSizes) Offsetsof(fields []*types.Var) []int64 {
 	offsets := make([]int64, len(fields))
+	packed := len(fields) != 0 && fields[0].Name() == packedFieldName
 	var o int64
 	for i, f := range fields {
 		a := s.Alignof(f.Type())
+		if packed {
+			a = 1
+		}
 		o = align(o, a)
 		offsets[i] = o
 		o += s.Sizeof(f.Type())
@@ -128,15 +136,10 @@ func (s *StdSizes) Sizeof(T types.Type) int64 {
 			return 0
 		}
 		fields := make([]*types.Var, t.NumFields())
-		maxAlign := int64(1)
 		for i := range fields {
-			field := t.Field(i)
-			fields[i] = field
-			al := s.Alignof(field.Type())
-			if al > maxAlign {
-				maxAlign = al
-			}
+			fields[i] = t.Field(i)
 		}
+		maxAlign := s.Alignof(t)
 		// Pick the size that fits this struct and add some alignment. Some
 		// structs have some extra padding at the end which should also be taken
 		// care of:
@@ -152,6 +155,17 @@ func (s *StdSizes) Sizeof(T types.Type) int64 {
 	}
 }
 
+// packedFieldName is the name of the zero-length field that CGo puts at the
+// start of packed C structs.
+const packedFieldName = "$packed"
+
+// isPackedStruct returns whether this is a packed C struct, which has no
+// padding between its fields and an alignment of 1, like the C struct it was
+// translated from.
+func isPackedStruct(t *types.Struct) bool {
+	return t.NumFields() != 0 && t.Field(0).Name() == packedFieldName
+}
+
 // align returns the smallest y >= x such that y % a == 0.
 func align(x, a int64) int64 {
 	y := x + a - 1
@@ -0,0 +1,19 @@
+package compiler
+
+// This file implements string related compiler builtins.
+
+import (
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
+
+// emitNoCopyString implements tinygo.NoCopyString, which converts a byte slice
+// to a string that shares the backing array of the slice. Unlike a regular
+// conversion, no memory is allocated and nothing is copied.
+func (c *Compiler) emitNoCopyString(frame *Frame, instr *ssa.CallCommon) (llvm.Value, error) {
+	slice := c.getValue(frame, instr.Args[0])
+	str := llvm.Undef(c.getLLVMRuntimeType("_string"))
+	str = c.builder.CreateInsertValue(str, c.builder.CreateExtractValue(slice, 0, ""), 0, "")
+	str = c.builder.CreateInsertValue(str, c.builder.CreateExtractValue(slice, 1, ""), 1, "")
+	return str, nil
+}
@@ -5,6 +5,7 @@ package compiler
 
 import (
 	"go/ast"
+	"go/constant"
 	"go/token"
 	"go/types"
 	"strconv"
@@ -22,6 +23,7 @@ type globalInfo struct {
 	linkName string // go:extern
 	extern   bool   // go:extern
 	align    int    // go:align
+	noinit   bool   // go:noinit
 }
 
 // loadASTComments loads comments on globals from the AST, for use later in the
@@ -54,6 +56,35 @@ func (c *Compiler) loadASTComments(lprogram *loader.Program) {
 	}
 }
 
+// SymbolPackages returns a map from symbol names to the import path of the
+// package they were defined in, for all functions and globals that originate
+// from Go code. It can be used to attribute the size of each symbol in the
+// final binary to a package. Only valid after a successful compile.
+func (c *Compiler) SymbolPackages() map[string]string {
+	symbols := make(map[string]string)
+	for _, f := range c.ir.Functions {
+		var pkg *types.Package
+		if f.Pkg != nil {
+			pkg = f.Pkg.Pkg
+		} else if obj := f.Object(); obj != nil {
+			// Synthetic wrapper functions don't have a package, but the
+			// function they wrap does.
+			pkg = obj.Pkg()
+		}
+		if pkg != nil {
+			symbols[f.LinkName()] = pkg.Path()
+		}
+	}
+	for _, pkg := range c.ir.Program.AllPackages() {
+		for _, member := range pkg.Members {
+			if g, ok := member.(*ssa.Global); ok {
+				symbols[c.getGlobalInfo(g).linkName] = pkg.Pkg.Path()
+			}
+		}
+	}
+	return symbols
+}
+
 // getGlobal returns a LLVM IR global value for a Go SSA global. It is added to
 // the LLVM IR if it has not been added already.
 func (c *Compiler) getGlobal(g *ssa.Global) llvm.Value {
@@ -62,17 +93,139 @@ func (c *Compiler) getGlobal(g *ssa.Global) llvm.Value {
 	if llvmGlobal.IsNil() {
 		llvmType := c.getLLVMType(g.Type().(*types.Pointer).Elem())
 		llvmGlobal = llvm.AddGlobal(c.mod, llvmType, info.linkName)
-		if !info.extern {
+		if info.noinit && !info.extern {
+			// The global is not initialized at startup, so its contents are
+			// unknown. It is not made internal, as that would allow LLVM to
+			// assume the initializer is the only possible value.
+			supported := false
+			for _, tag := range c.BuildTags() {
+				if tag == "cortexm" {
+					supported = true
+				}
+			}
+			if !supported {
+				c.addError(g.Pos(), "//go:noinit is only supported on Cortex-M")
+			}
+			llvmGlobal.SetInitializer(llvm.Undef(llvmType))
+			llvmGlobal.SetSection(".noinit")
+		} else if !info.extern {
 			llvmGlobal.SetInitializer(llvm.ConstNull(llvmType))
 			llvmGlobal.SetLinkage(llvm.InternalLinkage)
 		}
 		if info.align > c.targetData.ABITypeAlignment(llvmType) {
 			llvmGlobal.SetAlignment(info.align)
 		}
+		if c.Debug() && !info.extern {
+			c.attachGlobalDebugInfo(g, llvmGlobal, info)
+		}
 	}
 	return llvmGlobal
 }
 
+// attachGlobalDebugInfo adds a debug info entry to the given global, so that
+// debuggers can find it by its Go name and show its value with the right type.
+func (c *Compiler) attachGlobalDebugInfo(g *ssa.Global, llvmGlobal llvm.Value, info globalInfo) {
+	// Globals created by the compiler, like the init guard of a package, don't
+	// have a position. Put them in the compile unit instead of in a file.
+	scope := c.cu
+	var difile llvm.Metadata
+	pos := c.ir.Program.Fset.Position(g.Pos())
+	if pos.IsValid() {
+		difile = c.getDIFile(pos.Filename)
+		scope = difile
+	}
+	typ := c.getDIType(g.Type().(*types.Pointer).Elem())
+	localToUnit := llvmGlobal.Linkage() == llvm.InternalLinkage
+	c.createGlobalDebugInfo(llvmGlobal, scope, g.RelString(nil), info.linkName, difile, pos.Line, typ, localToUnit)
+}
+
+// setGlobalValues sets the initializer of globals of which the value was
+// provided at build time (-ldflags with -X). Unlike the go tool, which only
+// supports string globals, globals of integer and boolean types are supported
+// as well. The value is parsed according to the type of the global.
+//
+// Globals in any package can be set, by their full import path. Like with the
+// go tool, the main package is called "main" regardless of its import path.
+func (c *Compiler) setGlobalValues() {
+	for pkgPath, values := range c.GlobalValues() {
+		pkg := c.globalValuesPackage(pkgPath)
+		if pkg == nil {
+			// The package is not part of the program, ignore it like the go
+			// tool does.
+			continue
+		}
+		for name, value := range values {
+			g, ok := pkg.Members[name].(*ssa.Global)
+			if !ok {
+				continue
+			}
+			typ := g.Type().(*types.Pointer).Elem()
+			basic, ok := typ.Underlying().(*types.Basic)
+			if !ok {
+				c.addError(g.Pos(), "cannot set global "+g.RelString(nil)+" of type "+typ.String()+" at build time")
+				continue
+			}
+			var constValue constant.Value
+			switch {
+			case basic.Info()&types.IsString != 0:
+				constValue = constant.MakeString(value)
+			case basic.Info()&types.IsBoolean != 0:
+				b, err := strconv.ParseBool(value)
+				if err != nil {
+					c.addError(g.Pos(), "cannot set global "+g.RelString(nil)+" of type "+typ.String()+" to "+strconv.Quote(value))
+					continue
+				}
+				constValue = constant.MakeBool(b)
+			case basic.Info()&types.IsInteger != 0:
+				bitSize := int(c.targetData.TypeAllocSize(c.getLLVMType(typ))) * 8
+				var err error
+				if basic.Info()&types.IsUnsigned != 0 {
+					var n uint64
+					n, err = strconv.ParseUint(value, 0, bitSize)
+					constValue = constant.MakeUint64(n)
+				} else {
+					var n int64
+					n, err = strconv.ParseInt(value, 0, bitSize)
+					constValue = constant.MakeInt64(n)
+				}
+				if err != nil {
+					c.addError(g.Pos(), "cannot set global "+g.RelString(nil)+" of type "+typ.String()+" to "+strconv.Quote(value))
+					continue
+				}
+			default:
+				c.addError(g.Pos(), "cannot set global "+g.RelString(nil)+" of type "+typ.String()+" at build time")
+				continue
+			}
+			llvmGlobal := c.getGlobal(g)
+			if c.getGlobalInfo(g).extern {
+				c.addError(g.Pos(), "cannot set extern global "+g.RelString(nil)+" at build time")
+				continue
+			}
+			llvmGlobal.SetInitializer(c.parseConst(llvmGlobal.Name(), ssa.NewConst(constValue, typ)))
+		}
+	}
+}
+
+// globalValuesPackage returns the package with the given import path as used
+// in -ldflags=-X, or nil if it is not part of the program.
+func (c *Compiler) globalValuesPackage(pkgPath string) *ssa.Package {
+	if pkgPath == "main" {
+		return c.ir.MainPkg()
+	}
+	return c.ir.Program.ImportedPackage(pkgPath)
+}
+
+// hasGlobalValue returns whether the value of this global is set at build
+// time, see setGlobalValues.
+func (c *Compiler) hasGlobalValue(g *ssa.Global) bool {
+	for pkgPath, values := range c.GlobalValues() {
+		if _, ok := values[g.Name()]; ok && c.globalValuesPackage(pkgPath) == g.Pkg {
+			return true
+		}
+	}
+	return false
+}
+
 // getGlobalInfo returns some information about a specific global.
 func (c *Compiler) getGlobalInfo(g *ssa.Global) globalInfo {
 	info := globalInfo{}
@@ -107,6 +260,8 @@ func (info *globalInfo) parsePragmas(doc *ast.CommentGroup) {
 			if len(parts) == 2 {
 				info.linkName = parts[1]
 			}
+		case "//go:noinit":
+			info.noinit = true
 		case "//go:align":
 			align, err := strconv.Atoi(parts[1])
 			if err == nil {
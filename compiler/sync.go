@@ -0,0 +1,99 @@
+package compiler
+
+// This file implements inline fast paths for sync.Mutex and sync.Once. All
+// schedulers supported by TinyGo are cooperative and run on a single core, so
+// the state of a mutex or once can't change in the middle of one of these
+// operations. The common (uncontended) case can therefore be reduced to a flag
+// check, falling back to a call to the real implementation otherwise.
+
+import (
+	"go/types"
+
+	"github.com/tinygo-org/tinygo/ir"
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
+
+// syncFastPath describes the inline fast path of a sync method. The method
+// receiver is a pointer to a struct of which the first field is a bool flag.
+type syncFastPath struct {
+	field    string // name of the flag field, for sanity checking
+	fastWhen bool   // the flag value for which the fast path is taken
+	store    bool   // whether to invert the flag on the fast path
+}
+
+var syncFastPaths = map[string]syncFastPath{
+	"(*sync.Mutex).Lock":   {field: "locked", fastWhen: false, store: true},
+	"(*sync.Mutex).Unlock": {field: "locked", fastWhen: true, store: true},
+	"(*sync.Once).Do":      {field: "done", fastWhen: true, store: false},
+}
+
+// emitSyncFastPath emits the inline fast path for the given sync method call,
+// if there is one. It returns false when the call has to be emitted as a
+// regular call.
+func (c *Compiler) emitSyncFastPath(frame *Frame, instr *ssa.CallCommon, name string, targetFunc *ir.Function) bool {
+	fastPath, ok := syncFastPaths[name]
+	if !ok {
+		return false
+	}
+	switch c.Scheduler() {
+	case "coroutines", "tasks":
+		// Cooperative single-core scheduler, the fast path is safe.
+	default:
+		return false
+	}
+	if c.Race() {
+		// The race detector needs the happens-before relations created by
+		// Lock and Unlock, which the fast path would skip.
+		return false
+	}
+	if _, ok := instr.Value.(*ssa.Function); !ok || targetFunc.LLVMFn.IsNil() {
+		return false
+	}
+
+	// Make sure the struct layout is what we expect, in case the sync package
+	// changes.
+	st, ok := instr.Args[0].Type().Underlying().(*types.Pointer).Elem().Underlying().(*types.Struct)
+	if !ok || st.NumFields() == 0 || st.Field(0).Name() != fastPath.field {
+		return false
+	}
+	if basic, ok := st.Field(0).Type().(*types.Basic); !ok || basic.Kind() != types.Bool {
+		return false
+	}
+
+	// Load the flag.
+	ptr := c.getValue(frame, instr.Args[0])
+	c.emitNilCheck(frame, ptr, "gep")
+	zero := llvm.ConstInt(c.ctx.Int32Type(), 0, false)
+	flagPtr := c.builder.CreateInBoundsGEP(ptr, []llvm.Value{zero, zero}, "")
+	flag := c.builder.CreateLoad(flagPtr, "sync.flag")
+
+	fastBlock := c.ctx.AddBasicBlock(frame.fn.LLVMFn, "sync.fast")
+	slowBlock := c.ctx.AddBasicBlock(frame.fn.LLVMFn, "sync.slow")
+	nextBlock := c.ctx.AddBasicBlock(frame.fn.LLVMFn, "sync.next")
+	frame.blockExits[frame.currentBlock] = nextBlock // adjust outgoing block for phi nodes
+	isFast := flag
+	if !fastPath.fastWhen {
+		isFast = c.builder.CreateNot(flag, "")
+	}
+	c.builder.CreateCondBr(isFast, fastBlock, slowBlock)
+
+	// Fast path: only update the flag, if necessary.
+	c.builder.SetInsertPointAtEnd(fastBlock)
+	if fastPath.store {
+		newFlag := llvm.ConstInt(c.ctx.Int1Type(), 0, false)
+		if !fastPath.fastWhen {
+			newFlag = llvm.ConstInt(c.ctx.Int1Type(), 1, false)
+		}
+		c.builder.CreateStore(newFlag, flagPtr)
+	}
+	c.builder.CreateBr(nextBlock)
+
+	// Slow path: call the real implementation.
+	c.builder.SetInsertPointAtEnd(slowBlock)
+	c.parseFunctionCall(frame, instr.Args, targetFunc.LLVMFn, llvm.Undef(c.i8ptrType), false)
+	c.builder.CreateBr(nextBlock)
+
+	c.builder.SetInsertPointAtEnd(nextBlock)
+	return true
+}
@@ -0,0 +1,38 @@
+package compiler
+
+import (
+	"go/build"
+	"go/token"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/tinygo-org/tinygo/loader"
+)
+
+// trimmedPaths returns the path to use in debug info for each source file in
+// the program when -trimpath is used. Files are named after the import path of
+// their package, so that the debug info doesn't depend on the directory the
+// program was built in or where the sources are stored. This matches the
+// behavior of the -trimpath flag of the go tool.
+func trimmedPaths(lprogram *loader.Program, fset *token.FileSet) map[string]string {
+	paths := make(map[string]string)
+	for _, pkg := range lprogram.Sorted() {
+		importPath := trimImportPath(pkg.ImportPath)
+		for _, file := range pkg.Files {
+			filename := fset.File(file.Pos()).Name()
+			paths[filename] = path.Join(importPath, filepath.Base(filename))
+		}
+	}
+	return paths
+}
+
+// trimImportPath returns the import path to use for a package in debug info.
+// Packages that were specified by file name or by a relative path don't have a
+// real import path, they are named command-line-arguments like in the go tool.
+func trimImportPath(importPath string) string {
+	if strings.HasSuffix(importPath, ".go") || build.IsLocalImport(importPath) || filepath.IsAbs(importPath) {
+		return "command-line-arguments"
+	}
+	return importPath
+}
@@ -0,0 +1,70 @@
+package compiler
+
+// This file implements the tinygo.LoadUnalignedN and tinygo.StoreUnalignedN
+// builtins. They are lowered to a single load or store with an alignment of 1,
+// which LLVM turns into a single instruction on targets that support unaligned
+// memory accesses (like ARMv7-M) and into byte-by-byte accesses on targets with
+// strict alignment requirements (like AVR and ARMv6-M).
+
+import (
+	"go/types"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
+
+// unalignedAccess returns the pointer to the first bits/8 bytes of the byte
+// slice passed as the first parameter, after checking that the slice is long
+// enough.
+func (c *Compiler) unalignedAccess(frame *Frame, instr *ssa.CallCommon, bits int) llvm.Value {
+	slice := c.getValue(frame, instr.Args[0])
+	buf := c.builder.CreateExtractValue(slice, 0, "")
+	bufLen := c.builder.CreateExtractValue(slice, 1, "")
+	lastIndex := llvm.ConstInt(c.uintptrType, uint64(bits/8-1), false)
+	c.emitLookupBoundsCheck(frame, bufLen, lastIndex, types.Typ[types.Uintptr])
+	return c.builder.CreateBitCast(buf, llvm.PointerType(c.ctx.IntType(bits), 0), "")
+}
+
+// emitUnalignedLoad implements tinygo.LoadUnaligned16/32/64, which read a
+// little-endian integer from the start of a byte slice.
+func (c *Compiler) emitUnalignedLoad(frame *Frame, instr *ssa.CallCommon, name string) (llvm.Value, error) {
+	bits, err := strconv.Atoi(strings.TrimPrefix(name, "tinygo.LoadUnaligned"))
+	if err != nil {
+		return llvm.Value{}, c.makeError(instr.Pos(), "unknown unaligned load: "+name)
+	}
+	ptr := c.unalignedAccess(frame, instr, bits)
+	value := c.builder.CreateLoad(ptr, "")
+	value.SetAlignment(1)
+	return c.swapToLittleEndian(value), nil
+}
+
+// emitUnalignedStore implements tinygo.StoreUnaligned16/32/64, which write a
+// little-endian integer to the start of a byte slice.
+func (c *Compiler) emitUnalignedStore(frame *Frame, instr *ssa.CallCommon, name string) (llvm.Value, error) {
+	bits, err := strconv.Atoi(strings.TrimPrefix(name, "tinygo.StoreUnaligned"))
+	if err != nil {
+		return llvm.Value{}, c.makeError(instr.Pos(), "unknown unaligned store: "+name)
+	}
+	ptr := c.unalignedAccess(frame, instr, bits)
+	value := c.swapToLittleEndian(c.getValue(frame, instr.Args[1]))
+	store := c.builder.CreateStore(value, ptr)
+	store.SetAlignment(1)
+	return llvm.Value{}, nil
+}
+
+// swapToLittleEndian swaps the bytes of the given integer on big-endian targets,
+// so that it has the same memory layout as on little-endian targets.
+func (c *Compiler) swapToLittleEndian(value llvm.Value) llvm.Value {
+	if c.targetData.ByteOrder() == llvm.LittleEndian {
+		return value
+	}
+	name := "llvm.bswap.i" + strconv.Itoa(value.Type().IntTypeWidth())
+	bswap := c.mod.NamedFunction(name)
+	if bswap.IsNil() {
+		fnType := llvm.FunctionType(value.Type(), []llvm.Type{value.Type()}, false)
+		bswap = llvm.AddFunction(c.mod, name, fnType)
+	}
+	return c.builder.CreateCall(bswap, []llvm.Value{value}, "")
+}
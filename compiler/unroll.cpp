@@ -0,0 +1,27 @@
+// This file adds the loop unroll pass used at -opt=s to the pass manager
+// builder. The LLVM C API only provides the loop unroll pass with its default
+// settings, which doesn't unroll anything in functions marked optsize.
+
+#include <llvm/IR/LegacyPassManager.h>
+#include <llvm/Transforms/IPO/PassManagerBuilder.h>
+#include <llvm/Transforms/Scalar.h>
+#include <llvm-c/Transforms/PassManagerBuilder.h>
+
+using namespace llvm;
+
+extern "C" {
+
+// Add a loop unroll pass at the end of the loop optimizer that only fully
+// unrolls loops with a constant trip count, when the unrolled loop has a cost
+// of at most the given threshold. The threshold is used even in functions
+// marked optsize. Partial and runtime unrolling, unrolling by an upper bound
+// and loop peeling are disabled.
+void tinygo_addFullUnrollPass(LLVMPassManagerBuilderRef builder, int threshold) {
+	PassManagerBuilder *pmb = reinterpret_cast<PassManagerBuilder *>(builder);
+	pmb->addExtension(PassManagerBuilder::EP_LoopOptimizerEnd,
+		[threshold](const PassManagerBuilder &, legacy::PassManagerBase &PM) {
+			PM.add(createLoopUnrollPass(2, false, false, threshold, -1, 0, 0, 0, 0));
+		});
+}
+
+} // extern "C"
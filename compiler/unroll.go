@@ -0,0 +1,28 @@
+package compiler
+
+// This file adds a loop unroll pass for -opt=s, see unroll.cpp.
+
+import (
+	"unsafe"
+
+	"tinygo.org/x/go-llvm"
+)
+
+/*
+#cgo CXXFLAGS: -fno-rtti
+#include <llvm-c/Transforms/PassManagerBuilder.h>
+void tinygo_addFullUnrollPass(LLVMPassManagerBuilderRef builder, int threshold);
+*/
+import "C"
+
+// Cost of a loop after it has been fully unrolled, up to which the loop is
+// unrolled at -opt=s. This only unrolls loops with a very small trip count and
+// body, unlike the threshold of 150 that LLVM uses at -O2.
+const sizeUnrollThreshold = 50
+
+// addFullUnrollPass adds a pass to the loop optimizer of the pass manager
+// builder that fully unrolls loops with a constant trip count if the unrolled
+// loop costs at most threshold, also in functions marked optsize.
+func addFullUnrollPass(builder llvm.PassManagerBuilder, threshold int) {
+	C.tinygo_addFullUnrollPass(C.LLVMPassManagerBuilderRef(unsafe.Pointer(builder.C)), C.int(threshold))
+}
@@ -0,0 +1,258 @@
+package compiler
+
+// This file implements the ABI for exported functions on WebAssembly that take
+// or return structs. Such structs are passed through linear memory:
+//
+//   - A struct parameter is passed as a pointer to the struct in linear
+//     memory. The struct is copied before the Go function is called.
+//   - A struct return value is written to a caller-allocated struct in linear
+//     memory, of which the pointer is passed as the first parameter. The
+//     function itself doesn't return a value in that case.
+//
+// Structs are laid out in memory with the natural alignment of each field, as
+// in C. Structs containing pointers (including strings, slices, etc.) are
+// rejected, as their contents would need to be managed by the Go heap.
+//
+// Maps, channels, interfaces and func values have no representation outside of
+// Go, and functions with multiple results can't be expressed in the wasm ABI
+// used by LLVM. Exported functions using them are rejected with an error.
+//
+// It also implements the wrapper that saves the stack pointer in exported
+// functions for -panic=host.
+
+import (
+	"go/types"
+	"strconv"
+
+	"github.com/tinygo-org/tinygo/ir"
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
+
+// checkWasmExportSignature checks whether the signature of an exported
+// function can be used from outside the module. It reports an error for each
+// unsupported parameter or result and returns whether the signature is valid.
+func (c *Compiler) checkWasmExportSignature(f *ir.Function) bool {
+	valid := true
+	results := f.Signature.Results()
+	if results.Len() > 1 {
+		c.addError(f.Pos(), "exported function "+f.LinkName()+" cannot return multiple values")
+		valid = false
+	}
+	for _, tuple := range []*types.Tuple{f.Signature.Params(), results} {
+		kind := "parameter"
+		if tuple == results {
+			kind = "result"
+		}
+		for i := 0; i < tuple.Len(); i++ {
+			v := tuple.At(i)
+			reason := wasmExportUnsupportedType(v.Type())
+			if reason == "" {
+				continue
+			}
+			name := v.Name()
+			if name == "" || name == "_" {
+				name = "#" + strconv.Itoa(i)
+			}
+			pos := v.Pos()
+			if !pos.IsValid() {
+				pos = f.Pos()
+			}
+			c.addError(pos, "exported function "+f.LinkName()+" has unsupported "+kind+" "+name+" of type "+v.Type().String()+": "+reason)
+			valid = false
+		}
+	}
+	return valid
+}
+
+// wasmExportUnsupportedType returns why the given type can't be passed to or
+// from an exported function, or the empty string if it can.
+func wasmExportUnsupportedType(typ types.Type) string {
+	switch typ := typ.Underlying().(type) {
+	case *types.Map:
+		return "maps cannot be passed to or from WebAssembly"
+	case *types.Chan:
+		return "channels cannot be passed to or from WebAssembly"
+	case *types.Interface:
+		return "interfaces cannot be passed to or from WebAssembly"
+	case *types.Signature:
+		return "func values cannot be passed to or from WebAssembly"
+	case *types.Struct:
+		for i := 0; i < typ.NumFields(); i++ {
+			if reason := wasmExportUnsupportedType(typ.Field(i).Type()); reason != "" {
+				return reason
+			}
+		}
+	case *types.Array:
+		return wasmExportUnsupportedType(typ.Elem())
+	}
+	return ""
+}
+
+// createWasmExportWrapper creates a wrapper for an exported function if it
+// takes or returns structs, using the ABI described above. The original
+// function is renamed and made internal, so that calls from Go code still use
+// the regular calling convention.
+func (c *Compiler) createWasmExportWrapper(f *ir.Function) {
+	params := f.Signature.Params()
+	results := f.Signature.Results()
+	hasStructs := false
+	for i := 0; i < params.Len(); i++ {
+		if isStructType(params.At(i).Type()) {
+			hasStructs = true
+		}
+	}
+	returnsStruct := results.Len() == 1 && isStructType(results.At(0).Type())
+	if !hasStructs && !returnsStruct {
+		// Nothing to do.
+		return
+	}
+
+	// Check that the structs can be passed through memory.
+	for _, tuple := range []*types.Tuple{params, results} {
+		for i := 0; i < tuple.Len(); i++ {
+			typ := tuple.At(i).Type()
+			if isStructType(typ) && typeHasPointers(c.getLLVMType(typ)) {
+				c.addError(f.Pos(), "exported function "+f.LinkName()+" cannot pass struct containing pointers: "+typ.String())
+				return
+			}
+		}
+	}
+
+	// Rename the original function, to be used only from Go code.
+	fn := f.LLVMFn
+	name := fn.Name()
+	fn.SetName(name + "$structwrap")
+	fn.SetLinkage(llvm.InternalLinkage)
+	fn.SetUnnamedAddr(true)
+
+	// Create the new signature.
+	var paramTypes []llvm.Type
+	retType := fn.Type().ElementType().ReturnType()
+	if returnsStruct {
+		paramTypes = append(paramTypes, llvm.PointerType(retType, 0))
+		retType = c.ctx.VoidType()
+	}
+	for i := 0; i < params.Len(); i++ {
+		typ := c.getLLVMType(params.At(i).Type())
+		if isStructType(params.At(i).Type()) {
+			paramTypes = append(paramTypes, llvm.PointerType(typ, 0))
+		} else {
+			paramTypes = append(paramTypes, c.expandFormalParamType(typ)...)
+		}
+	}
+	wrapper := llvm.AddFunction(c.mod, name, llvm.FunctionType(retType, paramTypes, false))
+	nocapture := c.ctx.CreateEnumAttribute(llvm.AttributeKindID("nocapture"), 0)
+	for i, typ := range paramTypes {
+		if typ.TypeKind() == llvm.PointerTypeKind {
+			wrapper.AddAttributeAtIndex(i+1, nocapture)
+		}
+	}
+
+	// add debug info if needed
+	if c.Debug() {
+		pos := c.ir.Program.Fset.Position(f.Pos())
+		difunc := c.attachDebugInfoRaw(f, wrapper, "$export", pos.Filename, pos.Line)
+		c.builder.SetCurrentDebugLocation(uint(pos.Line), uint(pos.Column), difunc, llvm.Metadata{})
+	}
+
+	// Create the wrapper body, which loads all struct parameters and calls the
+	// original function.
+	block := c.ctx.AddBasicBlock(wrapper, "entry")
+	c.builder.SetInsertPointAtEnd(block)
+	index := 0
+	if returnsStruct {
+		index++ // skip the result pointer
+	}
+	var args []llvm.Value
+	for i := 0; i < params.Len(); i++ {
+		if isStructType(params.At(i).Type()) {
+			value := c.builder.CreateLoad(wrapper.Param(index), "")
+			args = append(args, c.expandFormalParam(value)...)
+			index++
+			continue
+		}
+		typ := c.getLLVMType(params.At(i).Type())
+		for range c.expandFormalParamType(typ) {
+			args = append(args, wrapper.Param(index))
+			index++
+		}
+	}
+	switch {
+	case returnsStruct:
+		result := c.builder.CreateCall(fn, args, "result")
+		c.builder.CreateStore(result, wrapper.Param(0))
+		c.builder.CreateRetVoid()
+	case retType.TypeKind() == llvm.VoidTypeKind:
+		c.builder.CreateCall(fn, args, "")
+		c.builder.CreateRetVoid()
+	default:
+		result := c.builder.CreateCall(fn, args, "result")
+		c.builder.CreateRet(result)
+	}
+}
+
+// createExportStackWrapper creates a wrapper for an exported function that
+// saves the stack pointer at entry in runtime.exportStackPointer, for the
+// -panic=host strategy. A panic traps without running the epilogues of the
+// functions on the stack, so the runtime restores the stack pointer from this
+// value before trapping. Otherwise, every panic would leak the stack that was
+// in use at the time.
+//
+// The stack pointer is read with tinygo_getStackPointer from
+// targets/wasm_stack.s. The wrapper doesn't have a stack frame of its own, so
+// the saved value is the stack pointer at the time the host called the
+// function. For that reason, the original function (which may have been wrapped
+// already by createWasmExportWrapper) is never inlined into it.
+func (c *Compiler) createExportStackWrapper(f *ir.Function) {
+	fn := c.mod.NamedFunction(f.LinkName())
+	name := fn.Name()
+	fn.SetName(name + "$stackwrap")
+	fn.SetLinkage(llvm.InternalLinkage)
+	fn.SetUnnamedAddr(true)
+	fn.AddFunctionAttr(c.ctx.CreateEnumAttribute(llvm.AttributeKindID("noinline"), 0))
+
+	fnType := fn.Type().ElementType()
+	wrapper := llvm.AddFunction(c.mod, name, fnType)
+	nocapture := c.ctx.CreateEnumAttribute(llvm.AttributeKindID("nocapture"), 0)
+	for i, typ := range fnType.ParamTypes() {
+		if typ.TypeKind() == llvm.PointerTypeKind {
+			wrapper.AddAttributeAtIndex(i+1, nocapture)
+		}
+	}
+
+	// add debug info if needed
+	if c.Debug() {
+		pos := c.ir.Program.Fset.Position(f.Pos())
+		difunc := c.attachDebugInfoRaw(f, wrapper, "$stackwrap", pos.Filename, pos.Line)
+		c.builder.SetCurrentDebugLocation(uint(pos.Line), uint(pos.Column), difunc, llvm.Metadata{})
+	}
+
+	getStackPointer := c.mod.NamedFunction("tinygo_getStackPointer")
+	if getStackPointer.IsNil() {
+		getStackPointer = llvm.AddFunction(c.mod, "tinygo_getStackPointer", llvm.FunctionType(c.i8ptrType, nil, false))
+	}
+	exportStackPointer := c.getGlobal(c.ir.Program.ImportedPackage("runtime").Members["exportStackPointer"].(*ssa.Global))
+
+	// Save the stack pointer, while keeping the previous value for when this
+	// function returns to another exported function.
+	block := c.ctx.AddBasicBlock(wrapper, "entry")
+	c.builder.SetInsertPointAtEnd(block)
+	prev := c.builder.CreateLoad(exportStackPointer, "stack.prev")
+	sp := c.builder.CreateCall(getStackPointer, nil, "stack.sp")
+	c.builder.CreateStore(sp, exportStackPointer)
+	result := c.builder.CreateCall(fn, wrapper.Params(), "")
+	c.builder.CreateStore(prev, exportStackPointer)
+	if fnType.ReturnType().TypeKind() == llvm.VoidTypeKind {
+		c.builder.CreateRetVoid()
+	} else {
+		c.builder.CreateRet(result)
+	}
+}
+
+// isStructType returns whether the underlying type of the given type is a
+// struct.
+func isStructType(typ types.Type) bool {
+	_, ok := typ.Underlying().(*types.Struct)
+	return ok
+}
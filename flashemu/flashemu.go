@@ -0,0 +1,155 @@
+// Package flashemu emulates a flash block device (like machine.Flash) on the
+// host, so that libraries that store data in flash can be tested without
+// hardware.
+//
+// The emulation follows the constraints of NOR flash: erasing sets all bytes
+// of an erase block to 0xff and writing can only clear bits, so writing to
+// flash that hasn't been erased results in the bitwise AND of the old and the
+// new data. Writes must be aligned to the write block size.
+package flashemu
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+var (
+	ErrOutOfRange = errors.New("flashemu: address out of range")
+	ErrNotAligned = errors.New("flashemu: write is not aligned")
+)
+
+// Device is an emulated flash block device. It implements the same methods as
+// machine.Flash: ReadAt, WriteAt, Size, WriteBlockSize, EraseBlockSize and
+// EraseBlocks. The contents are kept in memory, and are also written to a file
+// if the device was created with Open.
+type Device struct {
+	data           []byte
+	writeBlockSize int64
+	eraseBlockSize int64
+	file           *os.File
+}
+
+// New returns an in-memory device of the given size, which is fully erased.
+// The size must be a multiple of the erase block size, which must be a
+// multiple of the write block size.
+func New(size, writeBlockSize, eraseBlockSize int64) *Device {
+	if writeBlockSize <= 0 || eraseBlockSize%writeBlockSize != 0 || size%eraseBlockSize != 0 {
+		panic("flashemu: invalid block sizes")
+	}
+	d := &Device{
+		data:           make([]byte, size),
+		writeBlockSize: writeBlockSize,
+		eraseBlockSize: eraseBlockSize,
+	}
+	for i := range d.data {
+		d.data[i] = 0xff
+	}
+	return d
+}
+
+// Open returns a device backed by the given file, which is created if it
+// doesn't exist. The initial contents are read from the file: a file that is
+// shorter than the device is treated as erased after its end. All changes are
+// written to the file immediately, so that the contents persist between test
+// runs or can be inspected afterwards. The file must be closed with Close.
+func Open(path string, size, writeBlockSize, eraseBlockSize int64) (*Device, error) {
+	d := New(size, writeBlockSize, eraseBlockSize)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if int64(len(data)) > size {
+		f.Close()
+		return nil, errors.New("flashemu: file is bigger than the device")
+	}
+	copy(d.data, data)
+	d.file = f
+	if err := d.sync(0, size); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// Close closes the file backing the device, if there is one.
+func (d *Device) Close() error {
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	return err
+}
+
+// ReadAt reads len(p) bytes from the device at the given offset.
+func (d *Device) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > d.Size() {
+		return 0, ErrOutOfRange
+	}
+	return copy(p, d.data[off:]), nil
+}
+
+// WriteAt writes p to the device at the given offset. Both the offset and the
+// length of p must be a multiple of WriteBlockSize. Like real flash, writing
+// can only clear bits: the written bytes are ANDed with the current contents,
+// which is why the region must have been erased before.
+func (d *Device) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > d.Size() {
+		return 0, ErrOutOfRange
+	}
+	if off%d.writeBlockSize != 0 || int64(len(p))%d.writeBlockSize != 0 {
+		return 0, ErrNotAligned
+	}
+	for i, b := range p {
+		d.data[off+int64(i)] &= b
+	}
+	if err := d.sync(off, int64(len(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Size returns the size of the device in bytes.
+func (d *Device) Size() int64 {
+	return int64(len(d.data))
+}
+
+// WriteBlockSize returns the alignment of writes to the device.
+func (d *Device) WriteBlockSize() int64 {
+	return d.writeBlockSize
+}
+
+// EraseBlockSize returns the size of an erase block, which is the smallest
+// unit that can be erased.
+func (d *Device) EraseBlockSize() int64 {
+	return d.eraseBlockSize
+}
+
+// EraseBlocks erases the given number of erase blocks, starting at the given
+// block number, by setting all their bytes to 0xff.
+func (d *Device) EraseBlocks(start, length int64) error {
+	if start < 0 || length < 0 || (start+length)*d.eraseBlockSize > d.Size() {
+		return ErrOutOfRange
+	}
+	off := start * d.eraseBlockSize
+	size := length * d.eraseBlockSize
+	for i := off; i < off+size; i++ {
+		d.data[i] = 0xff
+	}
+	return d.sync(off, size)
+}
+
+// sync writes the given range to the backing file, if there is one.
+func (d *Device) sync(off, size int64) error {
+	if d.file == nil {
+		return nil
+	}
+	_, err := d.file.WriteAt(d.data[off:off+size], off)
+	return err
+}
@@ -0,0 +1,125 @@
+package flashemu
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestErased(t *testing.T) {
+	d := New(1024, 4, 256)
+	buf := make([]byte, d.Size())
+	if _, err := d.ReadAt(buf, 0); err != nil {
+		t.Fatal("could not read:", err)
+	}
+	if !bytes.Equal(buf, bytes.Repeat([]byte{0xff}, len(buf))) {
+		t.Error("new device is not erased")
+	}
+}
+
+func TestWriteWithoutErase(t *testing.T) {
+	d := New(1024, 4, 256)
+	if _, err := d.WriteAt([]byte{0xf0, 0x0f, 0x33, 0xff}, 8); err != nil {
+		t.Fatal("could not write:", err)
+	}
+	// Writing again without erasing can only clear more bits.
+	if _, err := d.WriteAt([]byte{0x3c, 0x3c, 0xff, 0x00}, 8); err != nil {
+		t.Fatal("could not write:", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := d.ReadAt(buf, 8); err != nil {
+		t.Fatal("could not read:", err)
+	}
+	if expected := []byte{0x30, 0x0c, 0x33, 0x00}; !bytes.Equal(buf, expected) {
+		t.Errorf("expected the ANDed data %x, got %x", expected, buf)
+	}
+
+	// After erasing, the new data is written as-is.
+	if err := d.EraseBlocks(0, 1); err != nil {
+		t.Fatal("could not erase:", err)
+	}
+	if _, err := d.WriteAt([]byte{0x3c, 0x3c, 0xff, 0x00}, 8); err != nil {
+		t.Fatal("could not write:", err)
+	}
+	if _, err := d.ReadAt(buf, 8); err != nil {
+		t.Fatal("could not read:", err)
+	}
+	if expected := []byte{0x3c, 0x3c, 0xff, 0x00}; !bytes.Equal(buf, expected) {
+		t.Errorf("expected %x after erasing, got %x", expected, buf)
+	}
+}
+
+func TestEraseBlocks(t *testing.T) {
+	d := New(1024, 4, 256)
+	if _, err := d.WriteAt(make([]byte, d.Size()), 0); err != nil {
+		t.Fatal("could not write:", err)
+	}
+	if err := d.EraseBlocks(1, 2); err != nil {
+		t.Fatal("could not erase:", err)
+	}
+	buf := make([]byte, d.Size())
+	if _, err := d.ReadAt(buf, 0); err != nil {
+		t.Fatal("could not read:", err)
+	}
+	for i, b := range buf {
+		erased := i >= 256 && i < 768
+		if erased && b != 0xff || !erased && b != 0 {
+			t.Fatalf("unexpected byte %#x at offset %d", b, i)
+		}
+	}
+	if err := d.EraseBlocks(3, 2); err != ErrOutOfRange {
+		t.Errorf("expected ErrOutOfRange when erasing past the end, got %v", err)
+	}
+}
+
+func TestAlignment(t *testing.T) {
+	d := New(1024, 4, 256)
+	if _, err := d.WriteAt([]byte{1, 2, 3, 4}, 2); err != ErrNotAligned {
+		t.Errorf("expected ErrNotAligned for an unaligned offset, got %v", err)
+	}
+	if _, err := d.WriteAt([]byte{1, 2}, 4); err != ErrNotAligned {
+		t.Errorf("expected ErrNotAligned for an unaligned length, got %v", err)
+	}
+	if _, err := d.WriteAt([]byte{1, 2, 3, 4}, 1024); err != ErrOutOfRange {
+		t.Errorf("expected ErrOutOfRange when writing past the end, got %v", err)
+	}
+	if _, err := d.ReadAt(make([]byte, 2), 1023); err != ErrOutOfRange {
+		t.Errorf("expected ErrOutOfRange when reading past the end, got %v", err)
+	}
+}
+
+func TestFile(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "flashemu-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	path := filepath.Join(tmpdir, "flash.bin")
+
+	d, err := Open(path, 1024, 4, 256)
+	if err != nil {
+		t.Fatal("could not open device:", err)
+	}
+	if _, err := d.WriteAt([]byte("data"), 256); err != nil {
+		t.Fatal("could not write:", err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal("could not close device:", err)
+	}
+
+	// The data must persist when the file is opened again.
+	d, err = Open(path, 1024, 4, 256)
+	if err != nil {
+		t.Fatal("could not open device:", err)
+	}
+	defer d.Close()
+	buf := make([]byte, 8)
+	if _, err := d.ReadAt(buf, 252); err != nil {
+		t.Fatal("could not read:", err)
+	}
+	if expected := []byte("\xff\xff\xff\xffdata"); !bytes.Equal(buf, expected) {
+		t.Errorf("expected %q, got %q", expected, buf)
+	}
+}
@@ -23,6 +23,12 @@ type frame struct {
 // and operations on the result of such instructions.
 func (fr *frame) evalBasicBlock(bb, incoming llvm.BasicBlock, indent string) (retval Value, outgoing []llvm.Value, err error) {
 	for inst := bb.FirstInstruction(); !inst.IsNil(); inst = llvm.NextInstruction(inst) {
+		if fr.maxInstructions != 0 {
+			fr.instructionCount++
+			if fr.instructionCount > fr.maxInstructions {
+				return nil, nil, errInstructionLimit
+			}
+		}
 		if fr.Debug {
 			print(indent)
 			inst.Dump()
@@ -225,6 +231,21 @@ func (fr *frame) evalBasicBlock(bb, incoming llvm.BasicBlock, indent string) (re
 			rhs := fr.getLocal(inst.Operand(1)).(*LocalValue).Underlying
 			predicate := inst.FloatPredicate()
 			fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateFCmp(predicate, lhs, rhs, "")}
+		case !inst.IsASelectInst().IsNil():
+			// Emitted for example for shifts, to handle shifts by at least the
+			// integer width.
+			cond := fr.getLocal(inst.Operand(0)).Value()
+			trueValue := fr.getLocal(inst.Operand(1))
+			falseValue := fr.getLocal(inst.Operand(2))
+			if !cond.IsAConstantInt().IsNil() {
+				if cond.ZExtValue() != 0 {
+					fr.locals[inst] = trueValue
+				} else {
+					fr.locals[inst] = falseValue
+				}
+				continue
+			}
+			fr.locals[inst] = &LocalValue{fr.Eval, fr.builder.CreateSelect(cond, trueValue.Value(), falseValue.Value(), "")}
 		case !inst.IsAPHINode().IsNil():
 			for i := 0; i < inst.IncomingCount(); i++ {
 				if inst.IncomingBlock(i) == incoming {
@@ -322,6 +343,18 @@ func (fr *frame) evalBasicBlock(bb, incoming llvm.BasicBlock, indent string) (re
 					continue
 				}
 				m.PutBinary(keyBuf, valPtr)
+			case callee.Name() == "runtime.hashmapSet":
+				// Set a key that is hashed and compared using functions
+				// generated by the compiler (for example, a struct with a
+				// string field). This is not supported at compile time, so do
+				// it at runtime.
+				m := fr.getLocal(inst.Operand(0)).Value()
+				fr.markDirty(m)
+				var llvmParams []llvm.Value
+				for i := 0; i < inst.OperandsCount()-1; i++ {
+					llvmParams = append(llvmParams, fr.getLocal(inst.Operand(i)).Value())
+				}
+				fr.builder.CreateCall(callee, llvmParams, "")
 			case callee.Name() == "runtime.stringConcat":
 				// adding two strings together
 				buf1Ptr := fr.getLocal(inst.Operand(0))
@@ -384,14 +417,20 @@ func (fr *frame) evalBasicBlock(bb, incoming llvm.BasicBlock, indent string) (re
 				if length < 0 {
 					return nil, nil, fr.errorAt(inst, "interp: trying to copy a slice with negative length?")
 				}
-				for i := int64(0); i < length; i++ {
-					// *dst = *src
-					dstArray.Store(srcArray.Load())
-					// dst++
-					dstArray = dstArray.GetElementPtr([]uint32{1}).(*LocalValue)
+				// The source and destination may overlap, so load all source
+				// elements before storing any of them (like memmove).
+				values := make([]llvm.Value, length)
+				for i := range values {
+					values[i] = srcArray.Load()
 					// src++
 					srcArray = srcArray.GetElementPtr([]uint32{1}).(*LocalValue)
 				}
+				for _, value := range values {
+					// *dst = value
+					dstArray.Store(value)
+					// dst++
+					dstArray = dstArray.GetElementPtr([]uint32{1}).(*LocalValue)
+				}
 			case callee.Name() == "runtime.stringToBytes":
 				// convert a string to a []byte
 				bufPtr := fr.getLocal(inst.Operand(0))
@@ -19,6 +19,10 @@ type Eval struct {
 	builder         llvm.Builder
 	dirtyGlobals    map[llvm.Value]struct{}
 	sideEffectFuncs map[llvm.Value]*sideEffectResult // cache of side effect scan results
+
+	// Limit of the number of interpreted instructions, or 0 for no limit.
+	maxInstructions  int
+	instructionCount int
 }
 
 // evalPackage encapsulates the Eval type for just a single package. The Eval
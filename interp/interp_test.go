@@ -24,7 +24,34 @@ func TestInterp(t *testing.T) {
 	}
 }
 
+func TestFoldPureCalls(t *testing.T) {
+	t.Parallel()
+	runPassTest(t, "testdata/purecalls", func(mod llvm.Module) error {
+		FoldPureCalls(mod, false)
+		return nil
+	})
+}
+
 func runTest(t *testing.T, pathPrefix string) {
+	runPassTest(t, pathPrefix, func(mod llvm.Module) error {
+		err := Run(mod, false)
+		if err != nil {
+			return err
+		}
+
+		// Run some cleanup passes to get easy-to-read outputs.
+		pm := llvm.NewPassManager()
+		defer pm.Dispose()
+		pm.AddGlobalOptimizerPass()
+		pm.AddDeadStoreEliminationPass()
+		pm.Run(mod)
+		return nil
+	})
+}
+
+// runPassTest runs the given pass over the IR in pathPrefix+".ll" and compares
+// the result with pathPrefix+".out.ll".
+func runPassTest(t *testing.T, pathPrefix string, pass func(llvm.Module) error) {
 	// Read the input IR.
 	ctx := llvm.NewContext()
 	buf, err := llvm.NewMemoryBufferFromFile(pathPrefix + ".ll")
@@ -38,18 +65,11 @@ func runTest(t *testing.T, pathPrefix string) {
 	}
 
 	// Perform the transform.
-	err = Run(mod, false)
+	err = pass(mod)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// Run some cleanup passes to get easy-to-read outputs.
-	pm := llvm.NewPassManager()
-	defer pm.Dispose()
-	pm.AddGlobalOptimizerPass()
-	pm.AddDeadStoreEliminationPass()
-	pm.Run(mod)
-
 	// Read the expected output IR.
 	out, err := ioutil.ReadFile(pathPrefix + ".out.ll")
 	if err != nil {
@@ -89,8 +109,9 @@ func fuzzyEqualIR(s1, s2 string) bool {
 func filterIrrelevantIRLines(lines []string) []string {
 	var out []string
 	for _, line := range lines {
-		line = strings.TrimSpace(line) // drop '\r' on Windows
-		if line == "" || line[0] == ';' {
+		line = strings.Split(line, ";")[0] // strip out comments/info
+		line = strings.TrimSpace(line)     // drop '\r' on Windows and remove trailing spaces from comments
+		if line == "" {
 			continue
 		}
 		if strings.HasPrefix(line, "source_filename = ") {
@@ -0,0 +1,117 @@
+package interp
+
+// This file evaluates calls to pure functions with constant parameters at
+// compile time, outside of package initializers. This is useful for example for
+// lookup tables or configuration values that are computed by a function from
+// constants: LLVM can only constant fold such calls if the function is inlined.
+
+import (
+	"errors"
+
+	"tinygo.org/x/go-llvm"
+)
+
+// Maximum number of instructions to interpret for a single call. Calls that
+// need more are left alone, to avoid slowing down compilation on expensive (or
+// non-terminating) functions.
+const pureCallInstructionLimit = 10000
+
+// errInstructionLimit is returned when a pure function call takes too long to
+// evaluate.
+var errInstructionLimit = errors.New("interp: instruction limit reached")
+
+// FoldPureCalls replaces calls to pure functions with constant parameters with
+// the result of the call. A function is considered pure if LLVM has marked it
+// readnone and it has no side effects according to the interp scanner, so
+// function attributes must have been computed before running this pass.
+//
+// This is an optimization, so a call that can't be evaluated (because interp
+// doesn't support some of the IR in the function, for example) is left alone
+// instead of resulting in an error.
+func FoldPureCalls(mod llvm.Module, debug bool) {
+	e := &Eval{
+		Mod:             mod,
+		TargetData:      llvm.NewTargetData(mod.DataLayout()),
+		Debug:           debug,
+		dirtyGlobals:    map[llvm.Value]struct{}{},
+		maxInstructions: pureCallInstructionLimit,
+	}
+	e.builder = mod.Context().NewBuilder()
+	defer e.builder.Dispose()
+	evalPkg := &evalPackage{Eval: e}
+
+	readnone := llvm.AttributeKindID("readnone")
+	var calls []llvm.Value
+	for fn := mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
+		for bb := fn.FirstBasicBlock(); !bb.IsNil(); bb = llvm.NextBasicBlock(bb) {
+			for inst := bb.FirstInstruction(); !inst.IsNil(); inst = llvm.NextInstruction(inst) {
+				if inst.IsACallInst().IsNil() || inst.Type().TypeKind() == llvm.VoidTypeKind {
+					continue
+				}
+				callee := inst.CalledValue()
+				if callee.IsAFunction().IsNil() || callee.IsDeclaration() || callee == fn {
+					continue
+				}
+				if callee.GetEnumFunctionAttribute(readnone).IsNil() {
+					continue
+				}
+				calls = append(calls, inst)
+			}
+		}
+	}
+
+	// Do this in a separate step to avoid corrupting the iterator above.
+	for _, call := range calls {
+		result, ok := evalPkg.evalPureCall(call)
+		if !ok {
+			continue
+		}
+		if debug {
+			println("folded call to", call.CalledValue().Name())
+		}
+		call.ReplaceAllUsesWith(result)
+		call.EraseFromParentAsInstruction()
+	}
+}
+
+// evalPureCall tries to evaluate the given call instruction at compile time. It
+// returns the result and whether the call could be evaluated.
+func (e *evalPackage) evalPureCall(call llvm.Value) (result llvm.Value, ok bool) {
+	callee := call.CalledValue()
+	var params []Value
+	for i := 0; i < call.OperandsCount()-1; i++ {
+		param := call.Operand(i)
+		if !param.IsConstant() {
+			return llvm.Value{}, false
+		}
+		params = append(params, e.getValue(param))
+	}
+	scanResult, err := e.hasSideEffects(callee)
+	if err != nil || scanResult.severity != sideEffectNone {
+		return llvm.Value{}, false
+	}
+
+	// Instructions that can't be evaluated at compile time are inserted before
+	// the call. This should not happen for pure functions, but if it does the
+	// call is left alone and those instructions are removed again. The same
+	// happens when interp panics on IR that it doesn't support.
+	prev := llvm.PrevInstruction(call)
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+		if ok {
+			return
+		}
+		for inst := llvm.PrevInstruction(call); inst != prev; inst = llvm.PrevInstruction(call) {
+			inst.EraseFromParentAsInstruction()
+		}
+	}()
+	e.builder.SetInsertPointBefore(call)
+	e.instructionCount = 0
+	value, err := e.function(callee, params, "")
+	if err != nil || value == nil || !value.IsConstant() || llvm.PrevInstruction(call) != prev {
+		return llvm.Value{}, false
+	}
+	return value.Value(), true
+}
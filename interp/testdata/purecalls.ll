@@ -0,0 +1,74 @@
+target datalayout = "e-m:e-i64:64-f80:128-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@global = global i32 3
+@a = global i32 0
+@b = global i32 0
+@c = global i32 0
+@d = global i32 0
+@e = global i32 0
+@f = global i32 0
+
+define i32 @square(i32 %x) readnone {
+entry:
+  %result = mul i32 %x, %x
+  ret i32 %result
+}
+
+define i32 @sumTo(i32 %n) readnone {
+entry:
+  br label %loop
+
+loop:
+  %i = phi i32 [ 0, %entry ], [ %i.next, %loop ]
+  %sum = phi i32 [ 0, %entry ], [ %sum.next, %loop ]
+  %i.next = add i32 %i, 1
+  %sum.next = add i32 %sum, %i.next
+  %done = icmp eq i32 %i.next, %n
+  br i1 %done, label %exit, label %loop
+
+exit:
+  ret i32 %sum.next
+}
+
+define i32 @readGlobal() readonly {
+entry:
+  %value = load i32, i32* @global
+  ret i32 %value
+}
+
+define i32 @classify(i32 %x) readnone {
+entry:
+  switch i32 %x, label %other [
+    i32 1, label %one
+  ]
+
+one:
+  ret i32 10
+
+other:
+  ret i32 20
+}
+
+define void @main(i32 %x) {
+entry:
+  ; constant parameter: can be folded
+  %a = call i32 @square(i32 7)
+  store i32 %a, i32* @a
+  ; parameter not known at compile time
+  %b = call i32 @square(i32 %x)
+  store i32 %b, i32* @b
+  ; loop that can be evaluated at compile time
+  %c = call i32 @sumTo(i32 100)
+  store i32 %c, i32* @c
+  ; loop that takes too long to evaluate
+  %d = call i32 @sumTo(i32 -1)
+  store i32 %d, i32* @d
+  ; function is not pure, as it reads a global
+  %e = call i32 @readGlobal()
+  store i32 %e, i32* @e
+  ; interp doesn't support switch instructions: left alone
+  %f = call i32 @classify(i32 1)
+  store i32 %f, i32* @f
+  ret void
+}
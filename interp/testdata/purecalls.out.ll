@@ -0,0 +1,69 @@
+target datalayout = "e-m:e-i64:64-f80:128-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@global = global i32 3
+@a = global i32 0
+@b = global i32 0
+@c = global i32 0
+@d = global i32 0
+@e = global i32 0
+@f = global i32 0
+
+define i32 @square(i32 %x) #0 {
+entry:
+  %result = mul i32 %x, %x
+  ret i32 %result
+}
+
+define i32 @sumTo(i32 %n) #0 {
+entry:
+  br label %loop
+
+loop:
+  %i = phi i32 [ 0, %entry ], [ %i.next, %loop ]
+  %sum = phi i32 [ 0, %entry ], [ %sum.next, %loop ]
+  %i.next = add i32 %i, 1
+  %sum.next = add i32 %sum, %i.next
+  %done = icmp eq i32 %i.next, %n
+  br i1 %done, label %exit, label %loop
+
+exit:
+  ret i32 %sum.next
+}
+
+define i32 @readGlobal() #1 {
+entry:
+  %value = load i32, i32* @global
+  ret i32 %value
+}
+
+define i32 @classify(i32 %x) #0 {
+entry:
+  switch i32 %x, label %other [
+    i32 1, label %one
+  ]
+
+one:
+  ret i32 10
+
+other:
+  ret i32 20
+}
+
+define void @main(i32 %x) {
+entry:
+  store i32 49, i32* @a
+  %b = call i32 @square(i32 %x)
+  store i32 %b, i32* @b
+  store i32 5050, i32* @c
+  %d = call i32 @sumTo(i32 -1)
+  store i32 %d, i32* @d
+  %e = call i32 @readGlobal()
+  store i32 %e, i32* @e
+  %f = call i32 @classify(i32 1)
+  store i32 %f, i32* @f
+  ret void
+}
+
+attributes #0 = { readnone }
+attributes #1 = { readonly }
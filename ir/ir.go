@@ -27,14 +27,16 @@ type Program struct {
 // Function or method.
 type Function struct {
 	*ssa.Function
-	LLVMFn    llvm.Value
-	module    string     // go:wasm-module
-	linkName  string     // go:linkname, go:export, go:interrupt
-	exported  bool       // go:export
-	nobounds  bool       // go:nobounds
-	flag      bool       // used by dead code elimination
-	interrupt bool       // go:interrupt
-	inline    InlineType // go:inline
+	LLVMFn     llvm.Value
+	module     string     // go:wasm-module, go:wasmimport
+	importName string     // go:wasmimport
+	linkName   string     // go:linkname, go:export, go:interrupt
+	exported   bool       // go:export
+	nobounds   bool       // go:nobounds
+	flag       bool       // used by dead code elimination
+	interrupt  bool       // go:interrupt
+	inline     InlineType // go:inline
+	ramfunc    bool       // go:ramfunc
 }
 
 // Interface type that is at some point used in a type assert (to check whether
@@ -239,10 +241,24 @@ func (f *Function) parsePragmas() {
 					continue
 				}
 				f.module = parts[1]
+			case "//go:wasmimport":
+				// Import a function from a WebAssembly module with the given
+				// module and field name. The module name may be anything,
+				// including component model interface names like
+				// "wasi:cli/environment@0.2.0", and the field name doesn't
+				// need to be unique as the function keeps its Go link name.
+				if len(parts) != 3 || decl.Body != nil {
+					continue
+				}
+				f.module = parts[1]
+				f.importName = parts[2]
+				f.exported = true
 			case "//go:inline":
 				f.inline = InlineHint
 			case "//go:noinline":
 				f.inline = InlineNone
+			case "//go:ramfunc":
+				f.ramfunc = true
 			case "//go:interrupt":
 				if len(parts) != 2 {
 					continue
@@ -279,6 +295,12 @@ func (f *Function) parsePragmas() {
 	}
 }
 
+// Return true iff this function must be executed from RAM instead of flash
+// (signalled using //go:ramfunc).
+func (f *Function) IsRAMFunc() bool {
+	return f.ramfunc
+}
+
 func (f *Function) IsNoBounds() bool {
 	return f.nobounds
 }
@@ -306,6 +328,12 @@ func (f *Function) Module() string {
 	return f.module
 }
 
+// Return the field name of the WebAssembly import (set with //go:wasmimport),
+// if it is different from the link name.
+func (f *Function) ImportName() string {
+	return f.importName
+}
+
 // Return the link name for this function.
 func (f *Function) LinkName() string {
 	if f.linkName != "" {
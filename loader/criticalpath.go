@@ -0,0 +1,54 @@
+package loader
+
+import (
+	"sort"
+	"time"
+)
+
+// CriticalPath returns the chain of packages through the import graph with the
+// largest total Duration, together with that total. This is the minimum build
+// time of the program even if all packages could be compiled in parallel, so
+// it shows which packages would be worth splitting up to speed up the build.
+//
+// The returned chain starts with a package without imports and ends with the
+// package that (indirectly) imports all others in the chain.
+func (p *Program) CriticalPath() ([]*Package, time.Duration) {
+	// Calculate for each package the most expensive chain that ends in that
+	// package. Packages are sorted such that all imports have already been
+	// visited.
+	totals := make(map[*Package]time.Duration, len(p.Packages))
+	slowestImport := make(map[*Package]*Package, len(p.Packages))
+	var last *Package
+	for _, pkg := range p.Sorted() {
+		paths := make([]string, 0, len(pkg.Imports))
+		for path := range pkg.Imports {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		var slowest *Package
+		for _, path := range paths {
+			imported := pkg.Imports[path]
+			if slowest == nil || totals[imported] > totals[slowest] {
+				slowest = imported
+			}
+		}
+		totals[pkg] = pkg.Duration
+		if slowest != nil {
+			slowestImport[pkg] = slowest
+			totals[pkg] += totals[slowest]
+		}
+		if last == nil || totals[pkg] > totals[last] {
+			last = pkg
+		}
+	}
+	if last == nil {
+		return nil, 0
+	}
+
+	// Walk back from the last package in the chain.
+	var chain []*Package
+	for pkg := last; pkg != nil; pkg = slowestImport[pkg] {
+		chain = append([]*Package{pkg}, chain...)
+	}
+	return chain, totals[last]
+}
@@ -0,0 +1,49 @@
+package loader
+
+import (
+	"go/build"
+	"testing"
+	"time"
+)
+
+func TestCriticalPath(t *testing.T) {
+	// Create the following import graph, with the compile time of each
+	// package in parentheses:
+	//
+	//   main (1) -> a (5) -> c (3)
+	//            -> b (2) -> c (3)
+	//            -> d (7)
+	//
+	// The slowest chain is c, a, main (9) even though d is the slowest
+	// package.
+	program := &Program{Packages: map[string]*Package{}}
+	addPackage := func(path string, duration time.Duration, imports ...string) {
+		pkg := &Package{
+			Program:  program,
+			Package:  &build.Package{ImportPath: path},
+			Imports:  map[string]*Package{},
+			Duration: duration * time.Millisecond,
+		}
+		for _, imported := range imports {
+			pkg.Imports[imported] = program.Packages[imported]
+		}
+		program.Packages[path] = pkg
+	}
+	addPackage("c", 3)
+	addPackage("a", 5, "c")
+	addPackage("b", 2, "c")
+	addPackage("d", 7)
+	addPackage("main", 1, "a", "b", "d")
+
+	chain, total := program.CriticalPath()
+	var paths []string
+	for _, pkg := range chain {
+		paths = append(paths, pkg.ImportPath)
+	}
+	if len(paths) != 3 || paths[0] != "c" || paths[1] != "a" || paths[2] != "main" {
+		t.Errorf("unexpected critical path: %v", paths)
+	}
+	if total != 9*time.Millisecond {
+		t.Errorf("unexpected total time: %v", total)
+	}
+}
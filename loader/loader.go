@@ -3,6 +3,7 @@ package loader
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"go/ast"
 	"go/build"
 	"go/parser"
@@ -10,9 +11,11 @@ import (
 	"go/types"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/tinygo-org/tinygo/cgo"
 )
@@ -31,6 +34,11 @@ type Program struct {
 	TINYGOROOT   string // root of the TinyGo installation or root of the source code
 	CFlags       []string
 	ClangHeaders string
+	Bench        string // regular expression of benchmarks to run in a test binary
+
+	// GeneratedFiles contains extra source files (one per package, keyed by
+	// import path) that are parsed together with the files of the package.
+	GeneratedFiles map[string][]byte
 }
 
 // Package holds a loaded package, its imports, and its parsed files.
@@ -41,6 +49,7 @@ type Package struct {
 	Importing bool
 	Files     []*ast.File
 	Pkg       *types.Package
+	Duration  time.Duration // time spent compiling this package, see CriticalPath
 	types.Info
 }
 
@@ -228,7 +237,16 @@ func (p *Program) Parse(compileTestBinary bool) error {
 }
 
 func (p *Program) SwapTestMain() error {
-	var tests []string
+	var tests, benchmarks []string
+
+	var benchRegexp *regexp.Regexp
+	if p.Bench != "" {
+		var err error
+		benchRegexp, err = regexp.Compile(p.Bench)
+		if err != nil {
+			return fmt.Errorf("invalid -bench regular expression: %v", err)
+		}
+	}
 
 	isTestFunc := func(f *ast.FuncDecl) bool {
 		// TODO: improve signature check
@@ -237,6 +255,9 @@ func (p *Program) SwapTestMain() error {
 		}
 		return false
 	}
+	isBenchmarkFunc := func(f *ast.FuncDecl) bool {
+		return strings.HasPrefix(f.Name.Name, "Benchmark") && benchRegexp != nil && benchRegexp.MatchString(f.Name.Name)
+	}
 	mainPkg := p.Packages[p.mainPkg]
 	for _, f := range mainPkg.Files {
 		for i, d := range f.Decls {
@@ -245,6 +266,9 @@ func (p *Program) SwapTestMain() error {
 				if isTestFunc(v) {
 					tests = append(tests, v.Name.Name)
 				}
+				if isBenchmarkFunc(v) {
+					benchmarks = append(benchmarks, v.Name.Name)
+				}
 				if v.Name.Name == "main" {
 					// Remove main
 					if len(f.Decls) == 1 {
@@ -270,6 +294,11 @@ func main () {
 		Tests: []testing.TestToCall{
 {{range .TestFunctions}}
 			{Name: "{{.}}", Func: {{.}}},
+{{end}}
+		},
+		Benchmarks: []testing.BenchmarkToCall{
+{{range .BenchmarkFunctions}}
+			{Name: "{{.}}", Func: {{.}}},
 {{end}}
 		},
 	}
@@ -280,9 +309,11 @@ func main () {
 	tmpl := template.Must(template.New("testmain").Parse(mainBody))
 	b := bytes.Buffer{}
 	tmplData := struct {
-		TestFunctions []string
+		TestFunctions      []string
+		BenchmarkFunctions []string
 	}{
-		TestFunctions: tests,
+		TestFunctions:      tests,
+		BenchmarkFunctions: benchmarks,
 	}
 
 	err := tmpl.Execute(&b, tmplData)
@@ -342,11 +373,13 @@ func (p *Package) Parse(includeTests bool) error {
 		return nil
 	}
 
+	start := time.Now()
 	files, err := p.parseFiles(includeTests)
 	if err != nil {
 		return err
 	}
 	p.Files = files
+	p.Duration += time.Since(start)
 
 	return nil
 }
@@ -369,7 +402,9 @@ func (p *Package) Check() error {
 	// Do typechecking of the package.
 	checker.Importer = p
 
+	start := time.Now()
 	typesPkg, err := checker.Check(p.ImportPath, p.fset, p.Files, &p.Info)
+	p.Duration += time.Since(start)
 	if err != nil {
 		if err, ok := err.(Errors); ok {
 			return err
@@ -407,6 +442,14 @@ func (p *Package) parseFiles(includeTests bool) ([]*ast.File, error) {
 		}
 		files = append(files, f)
 	}
+	if src, ok := p.GeneratedFiles[p.ImportPath]; ok {
+		f, err := parser.ParseFile(p.fset, filepath.Join(p.Package.Dir, "$generated.go"), src, parser.ParseComments)
+		if err != nil {
+			fileErrs = append(fileErrs, err)
+		} else {
+			files = append(files, f)
+		}
+	}
 	for _, file := range p.CgoFiles {
 		path := filepath.Join(p.Package.Dir, file)
 		f, err := p.parseFile(path, parser.ParseComments)
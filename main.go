@@ -112,6 +112,7 @@ func Build(pkgName, outpath string, options *compileopts.Options) error {
 
 // Test runs the tests in the given package.
 func Test(pkgName string, options *compileopts.Options) error {
+	options.TestConfig.CompileTestBinary = true
 	config, err := builder.NewConfig(options)
 	if err != nil {
 		return err
@@ -123,8 +124,26 @@ func Test(pkgName string, options *compileopts.Options) error {
 	// For details: https://github.com/golang/go/issues/21360
 	config.Target.BuildTags = append(config.Target.BuildTags, "test")
 
-	options.TestConfig.CompileTestBinary = true
 	return builder.Build(pkgName, ".elf", config, func(tmppath string) error {
+		if len(config.Target.Emulator) != 0 {
+			// Run in an emulator. The exit code of the test binary is not
+			// passed through by QEMU, so failures can only be seen in the
+			// output.
+			args := append(config.Target.Emulator[1:], tmppath)
+			cmd := exec.Command(config.Target.Emulator[0], args...)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			err := cmd.Run()
+			if err != nil {
+				if err, ok := err.(*exec.ExitError); ok && err.Exited() {
+					// Workaround for QEMU which always exits with an error.
+					return nil
+				}
+				return &commandError{"failed to run emulator with", tmppath, err}
+			}
+			return nil
+		}
+
 		cmd := exec.Command(tmppath)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -549,6 +568,46 @@ func parseSize(s string) (int64, error) {
 	return n, err
 }
 
+// parseLDFlags splits the -ldflags value into the flags to pass to the linker
+// and the values of globals to set with -X, like the go tool does:
+//
+//     -X importpath.name=value
+//
+// The values are returned as a map of package paths to a map of global names to
+// values.
+func parseLDFlags(s string) ([]string, map[string]map[string]string, error) {
+	var ldflags []string
+	globalValues := map[string]map[string]string{}
+	fields := strings.Fields(s)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		var definition string
+		if field == "-X" {
+			if i+1 >= len(fields) {
+				return nil, nil, errors.New("-X flag requires argument")
+			}
+			i++
+			definition = fields[i]
+		} else if strings.HasPrefix(field, "-X=") {
+			definition = field[len("-X="):]
+		} else {
+			ldflags = append(ldflags, field)
+			continue
+		}
+		eq := strings.IndexByte(definition, '=')
+		dot := strings.LastIndexByte(definition[:eq+1], '.')
+		if eq < 0 || dot <= 0 {
+			return nil, nil, fmt.Errorf("-X flag requires argument of the form importpath.name=value, got %q", definition)
+		}
+		pkgPath := definition[:dot]
+		if globalValues[pkgPath] == nil {
+			globalValues[pkgPath] = map[string]string{}
+		}
+		globalValues[pkgPath][definition[dot+1:eq]] = definition[eq+1:]
+	}
+	return ldflags, globalValues, nil
+}
+
 // getDefaultPort returns the default serial port depending on the operating system.
 // Currently only supports macOS and Linux.
 func getDefaultPort() (port string, err error) {
@@ -654,22 +713,37 @@ func main() {
 	outpath := flag.String("o", "", "output filename")
 	opt := flag.String("opt", "z", "optimization level: 0, 1, 2, s, z")
 	gc := flag.String("gc", "", "garbage collector to use (none, leaking, conservative)")
-	panicStrategy := flag.String("panic", "print", "panic strategy (print, trap)")
+	panicStrategy := flag.String("panic", "print", "panic strategy (print, trap, host)")
 	scheduler := flag.String("scheduler", "", "which scheduler to use (coroutines, tasks)")
 	printIR := flag.Bool("printir", false, "print LLVM IR")
 	dumpSSA := flag.Bool("dumpssa", false, "dump internal Go SSA")
 	verifyIR := flag.Bool("verifyir", false, "run extra verification steps on LLVM IR")
+	verifyPasses := flag.Bool("verifypasses", false, "verify LLVM IR after each optimization pass (slow)")
 	tags := flag.String("tags", "", "a space-separated list of extra build tags")
 	target := flag.String("target", "", "LLVM target | .json file with TargetSpec")
-	printSize := flag.String("size", "", "print sizes (none, short, full)")
-	nodebug := flag.Bool("no-debug", false, "disable DWARF debug symbol generation")
+	printSize := flag.String("size", "", "print sizes (none, short, full, summary)")
+	sizeReport := flag.String("size-report", "", "write the size of each package to the given .csv or .json file")
+	criticalPath := flag.Bool("critical-path", false, "print the chain of package imports that takes the longest to compile")
+	packGlobals := flag.Bool("pack-globals", false, "pack small read-only globals together to reduce code size")
+	foldPureCalls := flag.Bool("fold-pure-calls", false, "evaluate calls to pure functions with constant parameters at compile time")
+	compressData := flag.Bool("compress-data", false, "store the initial values of large global variables compressed in flash (only supported on Cortex-M)")
+	stackProtector := flag.Bool("stack-protector", false, "protect functions with local arrays against stack buffer overflows (increases code size)")
+	callerTable := flag.Bool("caller-table", false, "record call sites so that runtime.Caller and runtime.Callers work for all frames, including inlined ones (increases code size)")
+	race := flag.Bool("race", false, "detect data races between goroutines at runtime (only supported on Linux and macOS hosts)")
+	nodebug := flag.Bool("no-debug", false, "disable DWARF debug symbol generation and the WebAssembly name section")
+	splitDebug := flag.Bool("split-debug", false, "store DWARF debug symbols in a separate .debug file")
+	trimPath := flag.Bool("trimpath", false, "remove file system paths from debug information")
 	ocdOutput := flag.Bool("ocd-output", false, "print OCD daemon output during debug")
 	port := flag.String("port", "", "flash port")
 	programmer := flag.String("programmer", "", "which hardware programmer to use")
 	cFlags := flag.String("cflags", "", "additional cflags for compiler")
 	ldFlags := flag.String("ldflags", "", "additional ldflags for linker")
 	wasmAbi := flag.String("wasm-abi", "js", "WebAssembly ABI conventions: js (no i64 params) or generic")
+	wasmThreads := flag.Bool("wasm-threads", false, "WebAssembly: use a shared memory and atomic instructions so that other host threads can use sync/atomic on the module memory")
+	maxGoroutines := flag.Int("max-goroutines", 0, "maximum number of goroutines that may exist at the same time, 0 for no limit (only supported with -scheduler=tasks)")
 	heapSize := flag.String("heap-size", "1M", "default heap size in bytes (only supported by WebAssembly)")
+	bench := flag.String("bench", "", "run the benchmarks matching the regular expression (test only), for example -bench=.")
+	gcMetadataSize := flag.String("gc-metadata-size", "0", "size of a fixed region for the GC metadata that can be protected with the MPU (a power of two), 0 to store it in the heap (only supported on Cortex-M)")
 
 	if len(os.Args) < 2 {
 		fmt.Fprintln(os.Stderr, "No command-line arguments supplied.")
@@ -679,20 +753,37 @@ func main() {
 	command := os.Args[1]
 
 	flag.CommandLine.Parse(os.Args[2:])
+	var err error
 	options := &compileopts.Options{
-		Target:        *target,
-		Opt:           *opt,
-		GC:            *gc,
-		PanicStrategy: *panicStrategy,
-		Scheduler:     *scheduler,
-		PrintIR:       *printIR,
-		DumpSSA:       *dumpSSA,
-		VerifyIR:      *verifyIR,
-		Debug:         !*nodebug,
-		PrintSizes:    *printSize,
-		Tags:          *tags,
-		WasmAbi:       *wasmAbi,
-		Programmer:    *programmer,
+		Target:         *target,
+		Opt:            *opt,
+		GC:             *gc,
+		PanicStrategy:  *panicStrategy,
+		Scheduler:      *scheduler,
+		PrintIR:        *printIR,
+		DumpSSA:        *dumpSSA,
+		VerifyIR:       *verifyIR,
+		VerifyPasses:   *verifyPasses,
+		Debug:          !*nodebug,
+		SplitDebug:     *splitDebug,
+		TrimPath:       *trimPath,
+		PrintSizes:     *printSize,
+		SizeReport:     *sizeReport,
+		CriticalPath:   *criticalPath,
+		PackGlobals:    *packGlobals,
+		FoldPureCalls:  *foldPureCalls,
+		CompressData:   *compressData,
+		StackProtector: *stackProtector,
+		CallerTable:    *callerTable,
+		Race:           *race,
+		Tags:           *tags,
+		WasmAbi:        *wasmAbi,
+		WasmThreads:    *wasmThreads,
+		MaxGoroutines:  *maxGoroutines,
+		Programmer:     *programmer,
+		TestConfig: compileopts.TestConfig{
+			Bench: *bench,
+		},
 	}
 
 	if *cFlags != "" {
@@ -700,22 +791,32 @@ func main() {
 	}
 
 	if *ldFlags != "" {
-		options.LDFlags = strings.Split(*ldFlags, " ")
+		options.LDFlags, options.GlobalValues, err = parseLDFlags(*ldFlags)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not parse ldflags:", err)
+			usage()
+			os.Exit(1)
+		}
 	}
 
-	if *panicStrategy != "print" && *panicStrategy != "trap" {
-		fmt.Fprintln(os.Stderr, "Panic strategy must be either print or trap.")
+	if *panicStrategy != "print" && *panicStrategy != "trap" && *panicStrategy != "host" {
+		fmt.Fprintln(os.Stderr, "Panic strategy must be one of print, trap or host.")
 		usage()
 		os.Exit(1)
 	}
 
-	var err error
 	if options.HeapSize, err = parseSize(*heapSize); err != nil {
 		fmt.Fprintln(os.Stderr, "Could not read heap size:", *heapSize)
 		usage()
 		os.Exit(1)
 	}
 
+	if options.GCMetadataSize, err = parseSize(*gcMetadataSize); err != nil {
+		fmt.Fprintln(os.Stderr, "Could not read GC metadata size:", *gcMetadataSize)
+		usage()
+		os.Exit(1)
+	}
+
 	os.Setenv("CC", "clang -target="+*target)
 
 	switch command {
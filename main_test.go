@@ -6,16 +6,28 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"testing"
 
+	"github.com/tinygo-org/tinygo/builder"
 	"github.com/tinygo-org/tinygo/compileopts"
+	"github.com/tinygo-org/tinygo/goenv"
 	"github.com/tinygo-org/tinygo/loader"
 )
 
@@ -109,6 +121,12 @@ func runBuild(src, out string, opts *compileopts.Options) error {
 }
 
 func runTest(path, target string, t *testing.T) {
+	runTestWithConfig(path, target, t, nil)
+}
+
+// runTestWithConfig is like runTest, but allows changing the compiler options
+// with the configure callback (if not nil) before building the test.
+func runTestWithConfig(path, target string, t *testing.T, configure func(*compileopts.Options)) {
 	// Get the expected output for this test.
 	txtpath := path[:len(path)-3] + ".txt"
 	if path[len(path)-1] == os.PathSeparator {
@@ -142,6 +160,9 @@ func runTest(path, target string, t *testing.T) {
 		PrintSizes: "",
 		WasmAbi:    "js",
 	}
+	if configure != nil {
+		configure(config)
+	}
 	binary := filepath.Join(tmpdir, "test")
 	err = runBuild("./"+path, binary, config)
 	if err != nil {
@@ -207,3 +228,1399 @@ func runTest(path, target string, t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestCallerTable(t *testing.T) {
+	// With -caller-table, runtime.Caller and runtime.Callers can find all
+	// callers. Test both schedulers: the host uses coroutines and Cortex-M
+	// uses tasks.
+	configure := func(options *compileopts.Options) {
+		options.CallerTable = true
+	}
+	path := filepath.Join(TESTDATA, "callertable") + string(filepath.Separator)
+	if runtime.GOOS != "windows" {
+		runTestWithConfig(path, "", t, configure)
+	}
+	if !testing.Short() {
+		runTestWithConfig(path, "cortex-m-qemu", t, configure)
+	}
+}
+
+func TestLDFlags(t *testing.T) {
+	// Set the values of globals at build time, like with -ldflags=-X. The main
+	// package is always called "main", other packages are referred to by their
+	// import path.
+	runTestWithConfig(filepath.Join(TESTDATA, "ldflags")+string(filepath.Separator), "", t, func(options *compileopts.Options) {
+		options.GlobalValues = map[string]map[string]string{
+			"main": {
+				"someString":  "foobar",
+				"someInt":     "-42",
+				"someBool":    "true",
+				"someUint8":   "200",
+				"someDefault": "overridden",
+			},
+			"github.com/tinygo-org/tinygo/testdata/ldflags/version": {
+				"Version": "v1.2.3",
+				"Commit":  "abc123",
+				"Date":    "2019-11-01",
+			},
+		}
+	})
+
+	// A value that doesn't match the type of the global must be rejected.
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	err = runBuild("./"+filepath.Join(TESTDATA, "ldflags"), filepath.Join(tmpdir, "test"), &compileopts.Options{
+		Opt: "z",
+		GlobalValues: map[string]map[string]string{
+			"main": {"someInt": "foobar"},
+		},
+	})
+	if err == nil {
+		t.Error("expected an error when setting an int global to a string")
+	}
+}
+
+func TestStackProtector(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires QEMU")
+	}
+
+	// The overflow must be detected before the function returns to main.
+	runTestWithConfig(filepath.Join(TESTDATA, "stackprotector")+string(filepath.Separator), "cortex-m-qemu", t, func(options *compileopts.Options) {
+		options.StackProtector = true
+	})
+}
+
+func TestRAMFunc(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires QEMU")
+	}
+
+	runTest(filepath.Join(TESTDATA, "ramfunc")+string(filepath.Separator), "cortex-m-qemu", t)
+}
+
+func TestGoroutineStackPool(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires QEMU")
+	}
+
+	// Memory is never freed with the leaking GC, so starting 1000 goroutines
+	// only fits in the 64kB of RAM if their stacks are reused.
+	runTestWithConfig(filepath.Join(TESTDATA, "stackpool")+string(filepath.Separator), "cortex-m-qemu", t, func(options *compileopts.Options) {
+		options.GC = "leaking"
+	})
+}
+
+func TestStackRemaining(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires QEMU")
+	}
+
+	// Goroutines have their own (small) stacks with the tasks scheduler used
+	// on Cortex-M, so this checks the stack bounds of both the main goroutine
+	// and a new goroutine.
+	runTest(filepath.Join(TESTDATA, "stackremaining")+string(filepath.Separator), "cortex-m-qemu", t)
+}
+
+func TestNoInit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires QEMU")
+	}
+
+	runTest(filepath.Join(TESTDATA, "noinit")+string(filepath.Separator), "cortex-m-qemu", t)
+}
+
+func TestMemorySize(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires QEMU")
+	}
+
+	// The constants and build tags must match the 256kB flash and 64kB RAM of
+	// the emulated chip.
+	runTest(filepath.Join(TESTDATA, "memsize")+string(filepath.Separator), "cortex-m-qemu", t)
+}
+
+func TestGCMetadataRegion(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires QEMU")
+	}
+
+	// The region is too small for the whole heap, so only part of the heap is
+	// used. The GC must still work in that case.
+	runTestWithConfig(filepath.Join(TESTDATA, "gcmetadata")+string(filepath.Separator), "cortex-m-qemu", t, func(options *compileopts.Options) {
+		options.GCMetadataSize = 256
+	})
+}
+
+func TestCompressData(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires QEMU")
+	}
+
+	// The program must see the same initial values when they are stored
+	// compressed.
+	path := filepath.Join(TESTDATA, "compressdata") + string(filepath.Separator)
+	runTestWithConfig(path, "cortex-m-qemu", t, func(options *compileopts.Options) {
+		options.CompressData = true
+	})
+
+	// The program must be smaller in flash.
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	var flash [2]uint64
+	for i, compress := range []bool{false, true} {
+		executable := filepath.Join(tmpdir, "test"+strconv.Itoa(i)+".elf")
+		err := runBuild(path, executable, &compileopts.Options{
+			Target:       "cortex-m-qemu",
+			Opt:          "z",
+			CompressData: compress,
+		})
+		if err != nil {
+			t.Fatal("failed to build:", err)
+		}
+		file, err := elf.Open(executable)
+		if err != nil {
+			t.Fatal("could not open executable:", err)
+		}
+		for _, section := range file.Sections {
+			if section.Flags&elf.SHF_ALLOC != 0 && section.Type == elf.SHT_PROGBITS {
+				flash[i] += section.Size
+			}
+		}
+		file.Close()
+	}
+	if flash[1] >= flash[0] {
+		t.Errorf("expected a smaller program with compressed data, got %d bytes without and %d bytes with", flash[0], flash[1])
+	}
+}
+
+func TestMakeSliceOverflow(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a host build")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// The program panics, so it can't be run with runTest. The panic message
+	// itself is not checked, as abort() doesn't flush stdout.
+	binary := filepath.Join(tmpdir, "makeslice")
+	err = runBuild("./"+filepath.Join(TESTDATA, "makeslice"), binary, &compileopts.Options{
+		Opt: "z",
+	})
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+	output, err := exec.Command(binary).Output()
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Errorf("expected make to panic, got: %v", err)
+	}
+	if bytes.Contains(output, []byte("unreachable")) {
+		t.Errorf("make returned a slice with an overflowing size: %q", output)
+	}
+}
+
+func TestNegativeShiftPanic(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a host build")
+	}
+	version, err := builder.GorootVersionString(goenv.Get("GOROOT"))
+	if err != nil {
+		t.Fatal("could not read Go version:", err)
+	}
+	if strings.HasPrefix(version, "go1.11") || strings.HasPrefix(version, "go1.12") {
+		t.Skip("signed shift counts need Go 1.13")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// The program panics, so it can't be run with runTest. As with
+	// TestMakeSliceOverflow, the panic message itself is not checked.
+	binary := filepath.Join(tmpdir, "negativeshift")
+	err = runBuild("./"+filepath.Join(TESTDATA, "negativeshift"), binary, &compileopts.Options{
+		Opt: "z",
+	})
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+	output, err := exec.Command(binary).Output()
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Errorf("expected a shift by a negative amount to panic, got: %v (output: %q)", err, output)
+	}
+	if bytes.Contains(output, []byte("unreachable")) {
+		t.Errorf("shift by a negative amount did not panic: %q", output)
+	}
+}
+
+func TestLockGoroutine(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires QEMU")
+	}
+
+	// The tasks scheduler used on Cortex-M must keep the LockGoroutine state of
+	// a goroutine that blocks on a channel while locked.
+	runTest(filepath.Join(TESTDATA, "lockgoroutine")+string(filepath.Separator), "cortex-m-qemu", t)
+}
+
+func TestMaxGoroutines(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires QEMU")
+	}
+
+	// Starting a goroutine beyond the limit must result in a clear panic.
+	runTestWithConfig(filepath.Join(TESTDATA, "maxgoroutines")+string(filepath.Separator), "cortex-m-qemu", t, func(options *compileopts.Options) {
+		options.MaxGoroutines = 3
+	})
+}
+
+func TestNoCopyString(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a host build")
+	}
+
+	// Without a heap, any allocation results in a link error.
+	runTestWithConfig(filepath.Join(TESTDATA, "nocopystring")+string(filepath.Separator), "", t, func(options *compileopts.Options) {
+		options.GC = "none"
+	})
+}
+
+func TestLeakingFree(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a host build")
+	}
+
+	// The heap would run out of memory if the allocations weren't freed.
+	runTestWithConfig(filepath.Join(TESTDATA, "leakingfree")+string(filepath.Separator), "", t, func(options *compileopts.Options) {
+		options.GC = "leaking"
+	})
+}
+
+func TestDeterministicScheduler(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a host build")
+	}
+
+	// Run the test a few times, to check that the output is stable.
+	for i := 0; i < 3; i++ {
+		runTestWithConfig(filepath.Join(TESTDATA, "deterministic")+string(filepath.Separator), "", t, func(options *compileopts.Options) {
+			options.Tags = "deterministic"
+		})
+	}
+}
+
+func TestRace(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("the race detector is only supported on Linux and macOS")
+	}
+
+	// A program without data races runs as usual.
+	runTestWithConfig(filepath.Join(TESTDATA, "race", "racefree")+string(filepath.Separator), "", t, func(options *compileopts.Options) {
+		options.Race = true
+	})
+
+	// A program with a data race reports it, and exits with status 66 like
+	// programs built with the standard race detector.
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	dir := filepath.Join(TESTDATA, "race", "racy")
+	binary := filepath.Join(tmpdir, "racy")
+	err = runBuild("./"+dir, binary, &compileopts.Options{
+		Opt:  "z",
+		Race: true,
+	})
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+	output, err := exec.Command(binary).Output()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.Sys().(syscall.WaitStatus).ExitStatus() != 66 {
+		t.Errorf("expected exit status 66, got: %v", err)
+	}
+	expected, err := ioutil.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatal("could not read expected output file:", err)
+	}
+	// Addresses are different on every build.
+	actual := regexp.MustCompile(`0x[0-9a-f]+`).ReplaceAll(output, []byte("0x..."))
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("output did not match, expected %q but got %q", expected, output)
+	}
+}
+
+func TestWasmThreads(t *testing.T) {
+	if testing.Short() || runtime.GOOS != "linux" {
+		t.Skip("requires Node.js")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Two threads update counters in a shared memory, which only add up when
+	// the updates are atomic. Meanwhile the main thread runs Go code that uses
+	// the heap and the stack.
+	dir := filepath.Join(TESTDATA, "wasmthreads")
+	outpath := filepath.Join(tmpdir, "counter.wasm")
+	err = runBuild("./"+filepath.Join(dir, "counter.go"), outpath, &compileopts.Options{
+		Target:      "wasm",
+		Opt:         "z",
+		WasmThreads: true,
+		HeapSize:    1024 * 1024,
+	})
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+	expected, err := ioutil.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatal("could not read expected output file:", err)
+	}
+	pages := strconv.Itoa(1024 * 1024 / 65536)
+	actual, err := exec.Command("node", filepath.Join(dir, "run.js"), outpath, pages).Output()
+	if err != nil {
+		t.Fatal("failed to run:", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("output did not match, expected %q but got %q", expected, actual)
+	}
+}
+
+func TestWasmPanicHost(t *testing.T) {
+	if testing.Short() || runtime.GOOS != "linux" {
+		t.Skip("requires Node.js")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// An exported function panics, after which the host reads the message and
+	// calls the function again.
+	dir := filepath.Join(TESTDATA, "wasmpanic")
+	outpath := filepath.Join(tmpdir, "divide.wasm")
+	err = runBuild("./"+filepath.Join(dir, "divide.go"), outpath, &compileopts.Options{
+		Target:        "wasm",
+		Opt:           "z",
+		PanicStrategy: "host",
+	})
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+	expected, err := ioutil.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatal("could not read expected output file:", err)
+	}
+	actual, err := exec.Command("node", filepath.Join(dir, "run.js"), outpath).Output()
+	if err != nil {
+		t.Fatal("failed to run:", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("output did not match, expected %q but got %q", expected, actual)
+	}
+}
+
+func TestWasmImport(t *testing.T) {
+	if testing.Short() || runtime.GOOS != "linux" {
+		t.Skip("requires Node.js")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Functions are imported from component model style interface names, as
+	// used by WASI preview 2. Floating point values must be passed as they are,
+	// without being converted to integers.
+	dir := filepath.Join(TESTDATA, "wasmimport")
+	outpath := filepath.Join(tmpdir, "imports.wasm")
+	err = runBuild("./"+filepath.Join(dir, "imports.go"), outpath, &compileopts.Options{
+		Target: "wasm",
+		Opt:    "z",
+	})
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+	expected, err := ioutil.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatal("could not read expected output file:", err)
+	}
+	actual, err := exec.Command("node", filepath.Join(dir, "run.js"), outpath).Output()
+	if err != nil {
+		t.Fatal("failed to run:", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("output did not match, expected %q but got %q", expected, actual)
+	}
+}
+
+func TestWasmExportStruct(t *testing.T) {
+	if testing.Short() || runtime.GOOS != "linux" {
+		t.Skip("requires Node.js")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Structs are passed to and returned from exported functions through
+	// linear memory, with the fields aligned as in C.
+	dir := filepath.Join(TESTDATA, "wasmexportstruct")
+	outpath := filepath.Join(tmpdir, "structs.wasm")
+	err = runBuild("./"+filepath.Join(dir, "structs.go"), outpath, &compileopts.Options{
+		Target: "wasm",
+		Opt:    "z",
+	})
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+	expected, err := ioutil.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatal("could not read expected output file:", err)
+	}
+	actual, err := exec.Command("node", filepath.Join(dir, "run.js"), outpath).Output()
+	if err != nil {
+		t.Fatal("failed to run:", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("output did not match, expected %q but got %q", expected, actual)
+	}
+}
+
+func TestWasmExportErrors(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Exported functions with types that can't be passed to or from
+	// WebAssembly must be rejected with an error naming the function and the
+	// offending parameter or result.
+	path := "./" + filepath.Join(TESTDATA, "wasmexporterrors", "errors.go")
+	err = runBuild(path, filepath.Join(tmpdir, "errors.wasm"), &compileopts.Options{
+		Target: "wasm",
+		Opt:    "z",
+	})
+	if err == nil {
+		t.Fatal("expected an error for unsupported export signatures")
+	}
+	var messages []string
+	if errs, ok := err.(*builder.MultiError); ok {
+		for _, err := range errs.Errs {
+			messages = append(messages, err.Error())
+		}
+	} else {
+		messages = append(messages, err.Error())
+	}
+	for _, expected := range []string{
+		"exported function lookup has unsupported parameter table of type map[string]int32: maps cannot be passed to or from WebAssembly",
+		"exported function callback has unsupported parameter fn of type main.handler: func values cannot be passed to or from WebAssembly",
+		"exported function describe has unsupported result #0 of type interface{}: interfaces cannot be passed to or from WebAssembly",
+		"exported function divmod cannot return multiple values",
+	} {
+		found := false
+		for _, msg := range messages {
+			if strings.HasSuffix(msg, expected) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("expected error %q, got: %q", expected, messages)
+		}
+	}
+	if len(messages) != 4 {
+		t.Errorf("expected 4 errors, got: %q", messages)
+	}
+}
+
+func TestWasmNameSection(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// With debug information, all functions must be named in the name
+	// section, including ones that are not exported.
+	path := "./" + filepath.Join(TESTDATA, "wasmnames", "names.go")
+	outpath := filepath.Join(tmpdir, "names.wasm")
+	err = runBuild(path, outpath, &compileopts.Options{
+		Target: "wasm",
+		Opt:    "z",
+		Debug:  true,
+	})
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+	names, err := readWasmFunctionNames(outpath)
+	if err != nil {
+		t.Fatal("could not read name section:", err)
+	}
+	for _, name := range []string{"_start", "calculate", "main.fib"} {
+		found := false
+		for _, n := range names {
+			if n == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("function %s is missing from the name section", name)
+		}
+	}
+
+	// Without debug information the name section must be left out.
+	err = runBuild(path, outpath, &compileopts.Options{
+		Target: "wasm",
+		Opt:    "z",
+		Debug:  false,
+	})
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+	names, err = readWasmFunctionNames(outpath)
+	if err != nil {
+		t.Fatal("could not read name section:", err)
+	}
+	if names != nil {
+		t.Errorf("expected no name section without debug information, got %d names", len(names))
+	}
+}
+
+// readWasmFunctionNames returns the function names from the "name" custom
+// section of the given WebAssembly file, or nil if there is no such section.
+func readWasmFunctionNames(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 || string(data[:4]) != "\x00asm" {
+		return nil, fmt.Errorf("%s: not a WebAssembly file", path)
+	}
+	r := bytes.NewReader(data[8:])
+	for r.Len() != 0 {
+		id, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		section, err := readWasmBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		if id != 0 {
+			continue
+		}
+		sr := bytes.NewReader(section)
+		name, err := readWasmBytes(sr)
+		if err != nil {
+			return nil, err
+		}
+		if string(name) != "name" {
+			continue
+		}
+
+		// Look for the function names subsection, which maps function
+		// indices to names.
+		for sr.Len() != 0 {
+			subid, err := sr.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			subsection, err := readWasmBytes(sr)
+			if err != nil {
+				return nil, err
+			}
+			if subid != 1 {
+				continue
+			}
+			nr := bytes.NewReader(subsection)
+			count, err := binary.ReadUvarint(nr)
+			if err != nil {
+				return nil, err
+			}
+			names := []string{}
+			for i := uint64(0); i < count; i++ {
+				if _, err := binary.ReadUvarint(nr); err != nil {
+					return nil, err
+				}
+				name, err := readWasmBytes(nr)
+				if err != nil {
+					return nil, err
+				}
+				names = append(names, string(name))
+			}
+			return names, nil
+		}
+		return []string{}, nil
+	}
+	return nil, nil
+}
+
+// readWasmBytes reads a LEB128 encoded length followed by that many bytes, as
+// used for sections and names in WebAssembly files.
+func readWasmBytes(r *bytes.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, length)
+	_, err = io.ReadFull(r, buf)
+	return buf, err
+}
+
+func TestRelocatableObject(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("requires ELF object files and a system C compiler")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// The object file must contain both the exported Go functions and the
+	// functions from the C files of the package.
+	dir := filepath.Join(TESTDATA, "cgo")
+	objpath := filepath.Join(tmpdir, "cgo.o")
+	err = runBuild("./"+dir, objpath, &compileopts.Options{
+		Opt: "z",
+	})
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+	f, err := elf.Open(objpath)
+	if err != nil {
+		t.Fatal("could not open object file:", err)
+	}
+	defer f.Close()
+	if f.Type != elf.ET_REL {
+		t.Errorf("expected a relocatable object file, got %s", f.Type)
+	}
+	symbols, err := f.Symbols()
+	if err != nil {
+		t.Fatal("could not read symbols:", err)
+	}
+	defined := map[string]bool{}
+	for _, sym := range symbols {
+		if sym.Section != elf.SHN_UNDEF && elf.ST_BIND(sym.Info) == elf.STB_GLOBAL {
+			defined[sym.Name] = true
+		}
+	}
+	for _, name := range []string{"main", "mul", "fortytwo", "add"} {
+		if !defined[name] {
+			t.Errorf("symbol %s is not defined in the object file", name)
+		}
+	}
+
+	// The object file contains the whole program, so the system linker can
+	// turn it into a working executable.
+	executable := filepath.Join(tmpdir, "cgo")
+	output, err := exec.Command("cc", "-no-pie", "-o", executable, objpath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to link: %s\n%s", err, output)
+	}
+	expected, err := ioutil.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatal("could not read expected output file:", err)
+	}
+	actual, err := exec.Command(executable).Output()
+	if err != nil {
+		t.Fatal("failed to run:", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("output did not match, expected %q but got %q", expected, actual)
+	}
+}
+
+func TestUnaligned(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a host build")
+	}
+
+	// Check the behavior on the host and on a target that traps on unaligned
+	// accesses for some instructions.
+	for _, target := range []string{"", "cortex-m-qemu"} {
+		runTestWithConfig(filepath.Join(TESTDATA, "unaligned")+string(filepath.Separator), target, t, func(options *compileopts.Options) {})
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// The builtins must result in a single load or store with an alignment of
+	// 1, which the backend either emits as a single instruction (ARM) or splits
+	// into byte accesses (AVR).
+	for _, target := range []string{"cortex-m-qemu", "arduino"} {
+		outpath := filepath.Join(tmpdir, "unaligned-"+target+".ll")
+		err = runBuild(filepath.Join(TESTDATA, "unaligned")+string(filepath.Separator), outpath, &compileopts.Options{
+			Target: target,
+			Opt:    "z",
+		})
+		if err != nil {
+			t.Fatalf("failed to build for %s: %v", target, err)
+		}
+		ir, err := ioutil.ReadFile(outpath)
+		if err != nil {
+			t.Fatal("could not read IR:", err)
+		}
+		for _, instr := range []string{"load i32", "store i32"} {
+			if !regexp.MustCompile(instr + `[^\n]*, align 1\b`).Match(ir) {
+				t.Errorf("%s: expected an unaligned %s in the IR", target, instr)
+			}
+		}
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a host build")
+	}
+
+	// The hint must not change the behavior of the program.
+	for _, target := range []string{"", "cortex-m-qemu"} {
+		runTestWithConfig(filepath.Join(TESTDATA, "prefetch")+string(filepath.Separator), target, t, func(options *compileopts.Options) {})
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// The builtin is emitted as llvm.prefetch on targets with a prefetch
+	// instruction and removed on other targets.
+	for _, tc := range []struct {
+		target   string
+		prefetch bool
+	}{
+		{"cortex-m-qemu", true},
+		{"arduino", false},
+		{"wasm", false},
+	} {
+		outpath := filepath.Join(tmpdir, "prefetch-"+tc.target+".ll")
+		err = runBuild(filepath.Join(TESTDATA, "prefetch")+string(filepath.Separator), outpath, &compileopts.Options{
+			Target: tc.target,
+			Opt:    "z",
+		})
+		if err != nil {
+			t.Fatalf("failed to build for %s: %v", tc.target, err)
+		}
+		ir, err := ioutil.ReadFile(outpath)
+		if err != nil {
+			t.Fatal("could not read IR:", err)
+		}
+		if hasPrefetch := bytes.Contains(ir, []byte("call void @llvm.prefetch")); hasPrefetch != tc.prefetch {
+			t.Errorf("%s: expected llvm.prefetch in the IR: %v, got: %v", tc.target, tc.prefetch, hasPrefetch)
+		}
+	}
+}
+
+func TestBoundsCheckPanicBlocks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a host build")
+	}
+
+	runTest(filepath.Join(TESTDATA, "boundschecks")+string(filepath.Separator), "", t)
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// All failing bounds checks in a function must branch to a single panic
+	// call, instead of each check having its own call.
+	outpath := filepath.Join(tmpdir, "boundschecks.ll")
+	err = runBuild(filepath.Join(TESTDATA, "boundschecks")+string(filepath.Separator), outpath, &compileopts.Options{
+		Opt:   "z",
+		Debug: true,
+	})
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+	ir, err := ioutil.ReadFile(outpath)
+	if err != nil {
+		t.Fatal("could not read IR:", err)
+	}
+	fn := regexp.MustCompile(`(?s)\ndefine [^\n]*@main\.sum\(.*?\n}\n`).Find(ir)
+	if fn == nil {
+		t.Fatal("could not find main.sum in the IR")
+	}
+	if n := bytes.Count(fn, []byte("@runtime.lookupPanic(")); n != 1 {
+		t.Errorf("expected 1 call to runtime.lookupPanic in main.sum, got %d", n)
+	}
+	if n := bytes.Count(fn, []byte("@runtime.slicePanic(")); n > 1 {
+		t.Errorf("expected at most 1 call to runtime.slicePanic in main.sum, got %d", n)
+	}
+}
+
+func TestMathBitsIntrinsics(t *testing.T) {
+	version, err := builder.GorootVersionString(goenv.Get("GOROOT"))
+	if err != nil {
+		t.Fatal("could not read Go version:", err)
+	}
+	if strings.HasPrefix(version, "go1.11") {
+		t.Skip("math/bits.Add64, Sub64 and Mul64 need Go 1.12")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Compile without optimizations, so that the intrinsics are not constant
+	// folded away.
+	outpath := filepath.Join(tmpdir, "mathbits.ll")
+	err = runBuild("./testdata/mathbits/", outpath, &compileopts.Options{
+		Opt: "0",
+	})
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+	ir, err := ioutil.ReadFile(outpath)
+	if err != nil {
+		t.Fatal("could not read IR:", err)
+	}
+	for _, intrinsic := range []string{"@llvm.uadd.with.overflow.i64", "@llvm.usub.with.overflow.i64"} {
+		if !bytes.Contains(ir, []byte(intrinsic)) {
+			t.Errorf("expected %s in the IR", intrinsic)
+		}
+	}
+	if strconv.IntSize == 64 && !bytes.Contains(ir, []byte("mul i128")) {
+		t.Error("expected a 128-bit multiply in the IR")
+	}
+}
+
+func TestZeroAlloc(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Storing a value that fits in a pointer in an interface must not
+	// allocate, on 64-bit and on 32-bit targets. Neither must passing values
+	// to a variadic logging function, including a value that has to be boxed:
+	// the box can be allocated on the stack.
+	for _, target := range []string{"", "cortex-m-qemu"} {
+		outpath := filepath.Join(tmpdir, "zeroalloc-"+target+".ll")
+		err = runBuild("./testdata/zeroalloc.go", outpath, &compileopts.Options{
+			Target: target,
+			Opt:    "z",
+		})
+		if err != nil {
+			t.Fatalf("failed to build for %q: %v", target, err)
+		}
+		ir, err := ioutil.ReadFile(outpath)
+		if err != nil {
+			t.Fatal("could not read IR:", err)
+		}
+		for _, fn := range []string{"main.boxInt", "main.boxPair", "main.logValues"} {
+			body := regexp.MustCompile(`(?s)define [^\n]*@` + regexp.QuoteMeta(fn) + `\(.*?\n}`).Find(ir)
+			if body == nil {
+				t.Errorf("%q: could not find %s in the IR", target, fn)
+			} else if bytes.Contains(body, []byte("@runtime.alloc")) {
+				t.Errorf("%q: %s allocates:\n%s", target, fn, body)
+			}
+		}
+	}
+}
+
+func TestOptSize(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// The loop in main.weightedSum has a constant trip count of 4. It should
+	// be fully unrolled (leaving no phi nodes) at -opt=s, as it is at -opt=2,
+	// but not at -opt=z. Unlike at -opt=2, functions are marked optsize at
+	// -opt=s and -opt=z.
+	for _, opt := range []string{"2", "s", "z"} {
+		outpath := filepath.Join(tmpdir, "optsize-"+opt+".ll")
+		err = runBuild("./testdata/optsize.go", outpath, &compileopts.Options{
+			Target: "cortex-m-qemu",
+			Opt:    opt,
+		})
+		if err != nil {
+			t.Fatalf("failed to build with -opt=%s: %v", opt, err)
+		}
+		ir, err := ioutil.ReadFile(outpath)
+		if err != nil {
+			t.Fatal("could not read IR:", err)
+		}
+		optsize := bytes.Contains(ir, []byte("optsize"))
+		if optsize != (opt != "2") {
+			t.Errorf("-opt=%s: expected functions marked optsize: %v", opt, opt != "2")
+		}
+		body := regexp.MustCompile(`(?s)define [^\n]*@main\.weightedSum\(.*?\n}`).Find(ir)
+		if body == nil {
+			t.Errorf("-opt=%s: could not find main.weightedSum in the IR", opt)
+			continue
+		}
+		unrolled := !bytes.Contains(body, []byte(" phi "))
+		if unrolled != (opt != "z") {
+			t.Errorf("-opt=%s: expected loop unrolled: %v, got:\n%s", opt, opt != "z", body)
+		}
+	}
+}
+
+func TestTrimPath(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reading debug information is only supported for ELF files")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// Build the same program from two different working directories. The
+	// paths of the source files are relative to the working directory, so
+	// they end up differently in the debug info without -trimpath.
+	var files [2][]string
+	for i, dir := range []string{wd, filepath.Join(wd, "testdata")} {
+		if err := os.Chdir(dir); err != nil {
+			t.Fatal(err)
+		}
+		binary := filepath.Join(tmpdir, "test"+strconv.Itoa(i))
+		err := runBuild(filepath.Join(wd, "testdata", "print.go"), binary, &compileopts.Options{
+			Opt:      "z",
+			Debug:    true,
+			TrimPath: true,
+		})
+		if err != nil {
+			t.Fatal("failed to build:", err)
+		}
+		files[i] = readDWARFFiles(t, binary)
+	}
+
+	if len(files[0]) == 0 {
+		t.Fatal("no files found in the debug info")
+	}
+	if strings.Join(files[0], "\n") != strings.Join(files[1], "\n") {
+		t.Errorf("debug info file paths differ between builds:\n%v\n%v", files[0], files[1])
+	}
+	for _, file := range files[0] {
+		if strings.Contains(file, wd) || strings.Contains(file, "..") {
+			t.Errorf("file path not trimmed: %s", file)
+		}
+	}
+}
+
+// readDWARFFiles returns the sorted list of source files in the line tables of
+// the compile units generated by TinyGo in the given ELF file.
+func readDWARFFiles(t *testing.T, path string) []string {
+	f, err := elf.Open(path)
+	if err != nil {
+		t.Fatal("could not open ELF file:", err)
+	}
+	defer f.Close()
+	data, err := f.DWARF()
+	if err != nil {
+		t.Fatal("could not read debug info:", err)
+	}
+
+	files := map[string]struct{}{}
+	r := data.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			t.Fatal("could not read debug info:", err)
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Tag != dwarf.TagCompileUnit {
+			continue
+		}
+		r.SkipChildren()
+		if producer, _ := entry.Val(dwarf.AttrProducer).(string); producer != "TinyGo" {
+			continue // C code or libc
+		}
+		lr, err := data.LineReader(entry)
+		if err != nil || lr == nil {
+			continue
+		}
+		var line dwarf.LineEntry
+		for lr.Next(&line) == nil {
+			files[line.File.Name] = struct{}{}
+		}
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestDebugGlobals(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reading debug information is only supported for ELF files")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	binary := filepath.Join(tmpdir, "test")
+	err = runBuild(filepath.Join(TESTDATA, "debugglobals")+string(filepath.Separator), binary, &compileopts.Options{
+		Opt:   "z",
+		Debug: true,
+	})
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+
+	f, err := elf.Open(binary)
+	if err != nil {
+		t.Fatal("could not open ELF file:", err)
+	}
+	defer f.Close()
+	data, err := f.DWARF()
+	if err != nil {
+		t.Fatal("could not read debug info:", err)
+	}
+
+	// Collect the types of all global variables by name.
+	globals := map[string]string{}
+	r := data.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			t.Fatal("could not read debug info:", err)
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Tag != dwarf.TagVariable {
+			continue
+		}
+		name, _ := entry.Val(dwarf.AttrName).(string)
+		off, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+		if name == "" || !ok {
+			continue
+		}
+		typ, err := data.Type(off)
+		if err != nil {
+			t.Fatalf("could not read type of %s: %v", name, err)
+		}
+		globals[name] = typ.String()
+	}
+
+	for name, typ := range map[string]string{
+		"main.counter": "uint32",
+		"main.origin":  "main.point",
+	} {
+		if got, ok := globals[name]; !ok {
+			t.Errorf("global %s not found in the debug info", name)
+		} else if got != typ {
+			t.Errorf("global %s: expected type %s, got %s", name, typ, got)
+		}
+	}
+}
+
+func TestVerifyPasses(t *testing.T) {
+	if testing.Short() {
+		t.Skip("verifying after each pass is slow")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// A known-good program should pass verification after every pass.
+	for _, name := range []string{"calls.go", "interface.go"} {
+		err := runBuild("./"+filepath.Join(TESTDATA, name), filepath.Join(tmpdir, "test"), &compileopts.Options{
+			Opt:          "z",
+			VerifyIR:     true,
+			VerifyPasses: true,
+		})
+		if err != nil {
+			t.Errorf("failed to build %s with -verifypasses: %v", name, err)
+		}
+	}
+}
+
+func TestSplitDebug(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("split debug information is only tested on Linux")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Build the same program twice: once with embedded debug information and
+	// once with the debug information in a separate file.
+	embedded := filepath.Join(tmpdir, "embedded")
+	split := filepath.Join(tmpdir, "split")
+	for _, build := range []struct {
+		out        string
+		splitDebug bool
+	}{{embedded, false}, {split, true}} {
+		err := runBuild("./testdata/print.go", build.out, &compileopts.Options{
+			Opt:        "z",
+			Debug:      true,
+			SplitDebug: build.splitDebug,
+		})
+		if err != nil {
+			t.Fatal("failed to build:", err)
+		}
+	}
+
+	embeddedInfo, err := os.Stat(embedded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	splitInfo, err := os.Stat(split)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if splitInfo.Size() >= embeddedInfo.Size() {
+		t.Errorf("expected stripped binary (%d bytes) to be smaller than binary with debug info (%d bytes)", splitInfo.Size(), embeddedInfo.Size())
+	}
+
+	// The stripped binary must only contain the debug link, while the
+	// companion file must contain the DWARF sections.
+	f, err := elf.Open(split)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Section(".debug_info") != nil {
+		t.Error("stripped binary still contains .debug_info")
+	}
+	if f.Section(".gnu_debuglink") == nil {
+		t.Error("stripped binary does not contain .gnu_debuglink")
+	}
+	debugFile, err := elf.Open(split + ".debug")
+	if err != nil {
+		t.Fatal("could not open debug file:", err)
+	}
+	defer debugFile.Close()
+	if debugFile.Section(".debug_info") == nil {
+		t.Error("debug file does not contain .debug_info")
+	}
+}
+
+func TestSizeReport(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("size reports are only supported for ELF files")
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	report := filepath.Join(tmpdir, "sizes.json")
+	err = runBuild("./testdata/print.go", filepath.Join(tmpdir, "test"), &compileopts.Options{
+		Opt:        "z",
+		SizeReport: report,
+	})
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+
+	data, err := ioutil.ReadFile(report)
+	if err != nil {
+		t.Fatal("could not read size report:", err)
+	}
+	var packages []struct {
+		Package string
+		Flash   uint64
+	}
+	if err := json.Unmarshal(data, &packages); err != nil {
+		t.Fatal("could not parse size report:", err)
+	}
+	sizes := map[string]uint64{}
+	for i, pkg := range packages {
+		if i > 0 && pkg.Flash > packages[i-1].Flash {
+			t.Errorf("size report is not sorted by size: %s comes after %s", pkg.Package, packages[i-1].Package)
+		}
+		sizes[pkg.Package] = pkg.Flash
+	}
+	for _, name := range []string{"main", "runtime"} {
+		if sizes[name] == 0 {
+			t.Errorf("expected package %s in the size report with a non-zero size", name)
+		}
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires QEMU")
+	}
+
+	// The test output is printed to stdout, so capture it.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal("could not create pipe:", err)
+	}
+	output := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		output <- data
+	}()
+	stdout := os.Stdout
+	os.Stdout = w
+	err = Test("./tests/tinygotest", &compileopts.Options{
+		Target: "cortex-m-qemu",
+		Opt:    "z",
+		TestConfig: compileopts.TestConfig{
+			Bench: "Sum",
+		},
+	})
+	os.Stdout = stdout
+	w.Close()
+	result := string(<-output)
+	if err != nil {
+		t.Fatal("failed to run tests:", err)
+	}
+
+	// The benchmark must have run enough iterations to take about a second,
+	// and each iteration takes some time.
+	match := regexp.MustCompile(`BenchmarkSum\t *(\d+)\t *(\d+) ns/op`).FindStringSubmatch(result)
+	if match == nil {
+		t.Fatalf("could not find benchmark result in the output:\n%s", result)
+	}
+	n, _ := strconv.Atoi(match[1])
+	nsPerOp, _ := strconv.Atoi(match[2])
+	if n < 10 || nsPerOp <= 0 || nsPerOp > 1e8 {
+		t.Errorf("unexpected benchmark result: %d iterations at %d ns/op", n, nsPerOp)
+	}
+}
+
+func TestSizeSummary(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// The summary is printed to stdout, so capture it.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal("could not create pipe:", err)
+	}
+	output := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		output <- data
+	}()
+	stdout := os.Stdout
+	os.Stdout = w
+	// The program has a //go:ramfunc function, which takes up both flash and
+	// RAM.
+	executable := filepath.Join(tmpdir, "test.elf")
+	err = runBuild("./testdata/ramfunc/", executable, &compileopts.Options{
+		Target:     "cortex-m-qemu",
+		Opt:        "z",
+		PrintSizes: "summary",
+	})
+	os.Stdout = stdout
+	w.Close()
+	summary := string(<-output)
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+
+	var flash, ram uint64
+	for _, line := range strings.Split(summary, "\n") {
+		if strings.HasPrefix(line, "flash used:") {
+			fmt.Sscanf(line, "flash used: %d", &flash)
+		} else if strings.HasPrefix(line, "ram used:") {
+			fmt.Sscanf(line, "ram used: %d", &ram)
+		}
+	}
+	if flash == 0 || ram == 0 {
+		t.Fatalf("expected non-zero flash and RAM usage in the summary:\n%s", summary)
+	}
+	if !strings.Contains(summary, "largest symbols:") {
+		t.Errorf("expected the largest symbols in the summary:\n%s", summary)
+	}
+
+	// Compare against the section sizes in the ELF file.
+	file, err := elf.Open(executable)
+	if err != nil {
+		t.Fatal("could not open executable:", err)
+	}
+	defer file.Close()
+	var elfFlash, elfRAM, ramfuncSize uint64
+	for _, section := range file.Sections {
+		if section.Flags&elf.SHF_ALLOC == 0 {
+			continue
+		}
+		switch {
+		case section.Type == elf.SHT_NOBITS:
+			elfRAM += section.Size
+		case section.Type != elf.SHT_PROGBITS:
+		case section.Name == ".ramfunc":
+			ramfuncSize = section.Size
+			elfFlash += section.Size
+			elfRAM += section.Size
+		case section.Flags&elf.SHF_WRITE != 0:
+			elfFlash += section.Size
+			elfRAM += section.Size
+		default:
+			elfFlash += section.Size
+		}
+	}
+	if ramfuncSize == 0 {
+		t.Error("expected a non-empty .ramfunc section")
+	}
+	if flash != elfFlash {
+		t.Errorf("flash usage is %d, but the ELF sections add up to %d", flash, elfFlash)
+	}
+	if ram != elfRAM {
+		t.Errorf("RAM usage is %d, but the ELF sections add up to %d", ram, elfRAM)
+	}
+}
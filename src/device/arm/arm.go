@@ -50,7 +50,11 @@ func Asm(asm string)
 //             "value":  1
 //             "result": &dest,
 //         })
-func AsmFull(asm string, regs map[string]interface{})
+//
+// The template values are inputs, which the assembly must not modify. Any
+// other registers that it modifies, including the condition flags ("cc"), must
+// be listed as clobbers. They must be constant strings.
+func AsmFull(asm string, regs map[string]interface{}, clobbers ...string)
 
 // ReadRegister returns the contents of the specified register. The register
 // must be a processor register, reachable with the "mov" instruction.
@@ -173,6 +177,11 @@ func EnableIRQ(irq uint32) {
 	NVIC.ISER[irq>>5].Set(1 << (irq & 0x1F))
 }
 
+// Disable the given interrupt number.
+func DisableIRQ(irq uint32) {
+	NVIC.ICER[irq>>5].Set(1 << (irq & 0x1F))
+}
+
 // Set the priority of the given interrupt number.
 // Note that the priority is given as a 0-255 number, where some of the lower
 // bits are not implemented by the hardware. For example, to set a low interrupt
@@ -243,3 +252,20 @@ func SetupSystemTimer(cyclecount uint32) error {
 	SYST.SYST_CSR.SetBits(SYST_CSR_TICKINT | SYST_CSR_ENABLE | SYST_CSR_CLKSOURCE)
 	return nil
 }
+
+// setBitMasked sets a single bit in the given word using a read-modify-write
+// sequence with interrupts disabled, so that it cannot be interrupted halfway.
+func setBitMasked(reg *uint32, bit uint8) {
+	mask := DisableInterrupts()
+	volatile.StoreUint32(reg, volatile.LoadUint32(reg)|1<<(bit&31))
+	EnableInterrupts(mask)
+}
+
+// clearBitMasked clears a single bit in the given word using a
+// read-modify-write sequence with interrupts disabled, so that it cannot be
+// interrupted halfway.
+func clearBitMasked(reg *uint32, bit uint8) {
+	mask := DisableInterrupts()
+	volatile.StoreUint32(reg, volatile.LoadUint32(reg)&^(1<<(bit&31)))
+	EnableInterrupts(mask)
+}
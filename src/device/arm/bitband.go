@@ -0,0 +1,57 @@
+// +build bitband
+
+package arm
+
+// This file implements atomic single-bit access through the bit-band alias
+// regions of the Cortex-M3 and Cortex-M4. Not all chips implement bit-banding,
+// which is why this file is only included when the target specification sets
+// the bitband build tag.
+//
+// Source:
+// http://infocenter.arm.com/help/index.jsp?topic=/com.arm.doc.dui0552a/Behcjiic.html
+
+import (
+	"runtime/volatile"
+	"unsafe"
+)
+
+// HasBitBand indicates whether the current target supports bit-banding.
+const HasBitBand = true
+
+// bitBandAlias returns the bit-band alias word for the given bit in the given
+// word. It returns nil if the word is not located in one of the two bit-band
+// regions (the first megabyte of SRAM and of the peripheral address space).
+func bitBandAlias(reg *uint32, bit uint8) *uint32 {
+	addr := uintptr(unsafe.Pointer(reg))
+	base := addr &^ 0x0fffffff
+	if base != 0x20000000 && base != 0x40000000 {
+		return nil
+	}
+	offset := addr - base
+	if offset >= 0x00100000 {
+		return nil
+	}
+	return (*uint32)(unsafe.Pointer(base + 0x02000000 + offset*32 + uintptr(bit&31)*4))
+}
+
+// SetBit atomically sets a single bit in the given word, using the bit-band
+// alias region when possible. It falls back to a read-modify-write with
+// interrupts disabled when the word is outside of the bit-band regions.
+func SetBit(reg *uint32, bit uint8) {
+	if alias := bitBandAlias(reg, bit); alias != nil {
+		volatile.StoreUint32(alias, 1)
+		return
+	}
+	setBitMasked(reg, bit)
+}
+
+// ClearBit atomically clears a single bit in the given word, using the
+// bit-band alias region when possible. It falls back to a read-modify-write
+// with interrupts disabled when the word is outside of the bit-band regions.
+func ClearBit(reg *uint32, bit uint8) {
+	if alias := bitBandAlias(reg, bit); alias != nil {
+		volatile.StoreUint32(alias, 0)
+		return
+	}
+	clearBitMasked(reg, bit)
+}
@@ -0,0 +1,20 @@
+// +build !bitband
+
+package arm
+
+// HasBitBand indicates whether the current target supports bit-banding.
+const HasBitBand = false
+
+// SetBit atomically sets a single bit in the given word. This target does not
+// support bit-banding, so it does a read-modify-write with interrupts
+// disabled.
+func SetBit(reg *uint32, bit uint8) {
+	setBitMasked(reg, bit)
+}
+
+// ClearBit atomically clears a single bit in the given word. This target does
+// not support bit-banding, so it does a read-modify-write with interrupts
+// disabled.
+func ClearBit(reg *uint32, bit uint8) {
+	clearBitMasked(reg, bit)
+}
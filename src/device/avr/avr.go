@@ -15,4 +15,8 @@ func Asm(asm string)
 //             "value":  1
 //             "result": &dest,
 //         })
-func AsmFull(asm string, regs map[string]interface{})
+//
+// The template values are inputs, which the assembly must not modify. Any
+// other registers that it modifies, including the condition flags ("cc"), must
+// be listed as clobbers. They must be constant strings.
+func AsmFull(asm string, regs map[string]interface{}, clobbers ...string)
@@ -0,0 +1,108 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"device/arm"
+	"device/sam"
+)
+
+// Bits in RSTC.RCAUSE, see the RSTC chapter of the datasheet.
+const (
+	rstcRcausePOR    = 1 << 0
+	rstcRcauseBOD12  = 1 << 1
+	rstcRcauseBOD33  = 1 << 2
+	rstcRcauseNVM    = 1 << 3
+	rstcRcauseEXT    = 1 << 4
+	rstcRcauseWDT    = 1 << 5
+	rstcRcauseSYST   = 1 << 6
+	rstcRcauseBACKUP = 1 << 7
+)
+
+var brownoutCallback func()
+
+// ConfigureBrownout configures and enables the brown-out detector of the 3.3V
+// supply. This replaces the configuration loaded from the user row at reset.
+//
+// Be careful with BrownoutReset: if the supply voltage is already below the
+// threshold, the chip is reset right away and stays in reset until the voltage
+// rises again.
+func ConfigureBrownout(config BrownoutConfig) error {
+	value, err := bod33Value(config)
+	if err != nil {
+		return err
+	}
+
+	// The brown-out detector must be disabled while it is being configured.
+	sam.SUPC.INTENCLR.Set(supcBod33Det)
+	sam.SUPC.BOD33.ClearBits(supcBod33Enable)
+	brownoutCallback = config.Callback
+	sam.SUPC.BOD33.Set(value)
+	sam.SUPC.BOD33.SetBits(supcBod33Enable)
+	for !sam.SUPC.STATUS.HasBits(supcBod33Rdy) {
+	}
+
+	if config.Action == BrownoutInterrupt {
+		sam.SUPC.INTFLAG.Set(supcBod33Det)
+		sam.SUPC.INTENSET.Set(supcBod33Det)
+		arm.EnableIRQ(sam.IRQ_SUPC_1)
+	}
+	return nil
+}
+
+// Brownout returns whether the supply voltage is currently below the
+// threshold of the brown-out detector. The detector must have been enabled,
+// either with ConfigureBrownout or in the user row.
+func Brownout() bool {
+	return sam.SUPC.STATUS.HasBits(supcBod33Det)
+}
+
+//go:export SUPC_1_IRQHandler
+func handleSUPC1() {
+	sam.SUPC.INTFLAG.Set(supcBod33Det)
+	if brownoutCallback != nil {
+		brownoutCallback()
+	}
+}
+
+// ResetCause is the cause of the last reset of the chip, see ResetReason.
+type ResetCause uint8
+
+const (
+	ResetUnknown ResetCause = iota
+	ResetPowerOn
+	ResetBrownout     // supply voltage dropped below the brown-out threshold
+	ResetCoreBrownout // core voltage dropped too low
+	ResetExternal     // reset pin
+	ResetWatchdog
+	ResetSoftware // system reset request, for example from the bootloader
+	ResetNVM
+	ResetBackup // wakeup from backup sleep mode
+)
+
+// ResetReason returns the cause of the last reset. This makes it possible to
+// distinguish, for example, a reset by the brown-out detector from a normal
+// power-on.
+func ResetReason() ResetCause {
+	rcause := sam.RSTC.RCAUSE.Get()
+	switch {
+	case rcause&rstcRcausePOR != 0:
+		return ResetPowerOn
+	case rcause&rstcRcauseBOD33 != 0:
+		return ResetBrownout
+	case rcause&rstcRcauseBOD12 != 0:
+		return ResetCoreBrownout
+	case rcause&rstcRcauseEXT != 0:
+		return ResetExternal
+	case rcause&rstcRcauseWDT != 0:
+		return ResetWatchdog
+	case rcause&rstcRcauseSYST != 0:
+		return ResetSoftware
+	case rcause&rstcRcauseNVM != 0:
+		return ResetNVM
+	case rcause&rstcRcauseBACKUP != 0:
+		return ResetBackup
+	default:
+		return ResetUnknown
+	}
+}
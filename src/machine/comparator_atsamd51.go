@@ -0,0 +1,203 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"device/arm"
+	"device/sam"
+	"errors"
+)
+
+var ErrInvalidACInput = errors.New("machine: invalid analog comparator input")
+
+// Bits in the AC registers, see the AC chapter of the datasheet.
+const (
+	acCtrlaSwrst         = 1 << 0
+	acCtrlaEnable        = 1 << 1
+	acSyncbusySwrst      = 1 << 0
+	acSyncbusyEnable     = 1 << 1
+	acSyncbusyCompctrl0  = 1 << 3
+	acCompctrlEnable     = 1 << 1
+	acCompctrlIntselPos  = 3
+	acCompctrlMuxnegPos  = 8
+	acCompctrlMuxposPos  = 12
+	acCompctrlSpeedHigh  = 3 << 16
+	acCompctrlHystEnable = 1 << 19
+	acCompctrlHystPos    = 20
+	acCompctrlFlenMaj3   = 1 << 24 // majority of 3 output filter
+	acCompctrlOutAsync   = 1 << 28
+	acScalerMask         = 0x3f
+)
+
+// Peripheral channel of the AC clock in GCLK.PCHCTRL.
+const gclkPchctrlAC = 32
+
+// Pins of the AIN0 to AIN3 comparator inputs.
+var acInputPins = [4]Pin{PA04, PA05, PA06, PA07}
+
+// AnalogComparator is one of the two comparators of the analog comparator
+// (AC) peripheral. It compares two analog voltages and can raise an interrupt
+// when the result changes, without needing to sample them with the ADC.
+type AnalogComparator struct {
+	Index uint8 // comparator 0 or 1
+}
+
+var (
+	AC0 = AnalogComparator{0}
+	AC1 = AnalogComparator{1}
+)
+
+// ACInput is an input of an analog comparator.
+type ACInput uint8
+
+const (
+	ACInputPin0    ACInput = iota // AIN0 (PA04)
+	ACInputPin1                   // AIN1 (PA05)
+	ACInputPin2                   // AIN2 (PA06)
+	ACInputPin3                   // AIN3 (PA07)
+	ACInputGround                 // negative input only
+	ACInputVScale                 // VDD scaled by ACConfig.VScale
+	ACInputBandgap                // internal bandgap reference, negative input only
+	ACInputDAC                    // DAC output, negative input only
+)
+
+// ACHysteresis is the hysteresis of an analog comparator, which avoids rapid
+// toggling of the output for slowly changing or noisy inputs.
+type ACHysteresis uint8
+
+const (
+	ACHysteresisNone ACHysteresis = iota
+	ACHysteresis50mV
+	ACHysteresis100mV
+	ACHysteresis150mV
+)
+
+// ACChange is the change in comparator output that raises an interrupt.
+type ACChange uint8
+
+const (
+	ACToggle  ACChange = 0 // either edge
+	ACRising  ACChange = 1 // positive input becomes higher than the negative input
+	ACFalling ACChange = 2 // positive input becomes lower than the negative input
+)
+
+// ACConfig is the configuration of an analog comparator.
+type ACConfig struct {
+	// Positive and Negative are the inputs to compare. The positive input
+	// must be one of the pins or ACInputVScale.
+	Positive ACInput
+	Negative ACInput
+
+	Hysteresis ACHysteresis
+
+	// VScale sets the voltage of ACInputVScale to VDD*(VScale+1)/64. It must
+	// be between 0 and 63.
+	VScale uint8
+}
+
+var acCallbacks [2]func(AnalogComparator)
+
+// Configure sets up the comparator with the given inputs and enables it. The
+// comparator runs continuously, its result can be read with Output or be
+// monitored with SetInterrupt.
+func (ac AnalogComparator) Configure(config ACConfig) error {
+	var muxpos uint32
+	switch {
+	case config.Positive <= ACInputPin3:
+		muxpos = uint32(config.Positive)
+	case config.Positive == ACInputVScale:
+		muxpos = 4
+	default:
+		return ErrInvalidACInput
+	}
+	if config.Negative > ACInputDAC {
+		return ErrInvalidACInput
+	}
+
+	// Enable the clocks and the AC peripheral itself, the first time a
+	// comparator is used.
+	if !sam.AC.CTRLA.HasBits(acCtrlaEnable) {
+		sam.MCLK.APBCMASK.SetBits(sam.MCLK_APBCMASK_AC_)
+		sam.GCLK.PCHCTRL[gclkPchctrlAC].Set((sam.GCLK_PCHCTRL_GEN_GCLK0 << sam.GCLK_PCHCTRL_GEN_Pos) |
+			sam.GCLK_PCHCTRL_CHEN)
+		sam.AC.CTRLA.Set(acCtrlaSwrst)
+		for sam.AC.SYNCBUSY.HasBits(acSyncbusySwrst) {
+		}
+		sam.AC.CTRLA.Set(acCtrlaEnable)
+		for sam.AC.SYNCBUSY.HasBits(acSyncbusyEnable) {
+		}
+	}
+
+	// Connect the analog input pins.
+	for _, input := range []ACInput{config.Positive, config.Negative} {
+		if input <= ACInputPin3 {
+			acInputPins[input].Configure(PinConfig{Mode: PinAnalog})
+		}
+	}
+
+	// The comparator must be disabled while it is being configured.
+	compctrl := &sam.AC.COMPCTRL[ac.Index]
+	syncbusy := uint32(acSyncbusyCompctrl0 << ac.Index)
+	compctrl.ClearBits(acCompctrlEnable)
+	for sam.AC.SYNCBUSY.HasBits(syncbusy) {
+	}
+	sam.AC.SCALER[ac.Index].Set(config.VScale & acScalerMask)
+	value := muxpos<<acCompctrlMuxposPos |
+		uint32(config.Negative)<<acCompctrlMuxnegPos |
+		acCompctrlSpeedHigh | acCompctrlFlenMaj3 | acCompctrlOutAsync
+	if config.Hysteresis != ACHysteresisNone {
+		value |= acCompctrlHystEnable | uint32(config.Hysteresis-1)<<acCompctrlHystPos
+	}
+	if acCallbacks[ac.Index] != nil {
+		value |= compctrl.Get() & (3 << acCompctrlIntselPos)
+	}
+	compctrl.Set(value)
+	compctrl.SetBits(acCompctrlEnable)
+	for sam.AC.SYNCBUSY.HasBits(syncbusy) {
+	}
+	return nil
+}
+
+// Output returns whether the positive input is higher than the negative input.
+func (ac AnalogComparator) Output() bool {
+	return sam.AC.STATUSA.HasBits(1 << ac.Index)
+}
+
+// SetInterrupt calls the given callback (from an interrupt) when the output of
+// the comparator changes as given. The comparator must have been configured
+// already. Passing a nil callback disables the interrupt.
+func (ac AnalogComparator) SetInterrupt(change ACChange, callback func(AnalogComparator)) {
+	mask := uint8(1 << ac.Index)
+	sam.AC.INTENCLR.Set(mask)
+	acCallbacks[ac.Index] = callback
+	if callback == nil {
+		return
+	}
+
+	// The interrupt selection can only be changed while the comparator is
+	// disabled.
+	compctrl := &sam.AC.COMPCTRL[ac.Index]
+	syncbusy := uint32(acSyncbusyCompctrl0 << ac.Index)
+	compctrl.ClearBits(acCompctrlEnable)
+	for sam.AC.SYNCBUSY.HasBits(syncbusy) {
+	}
+	compctrl.Set(compctrl.Get()&^(3<<acCompctrlIntselPos) | uint32(change)<<acCompctrlIntselPos)
+	compctrl.SetBits(acCompctrlEnable)
+	for sam.AC.SYNCBUSY.HasBits(syncbusy) {
+	}
+
+	sam.AC.INTFLAG.Set(mask)
+	sam.AC.INTENSET.Set(mask)
+	arm.EnableIRQ(sam.IRQ_AC)
+}
+
+//go:export AC_IRQHandler
+func handleAC() {
+	flags := sam.AC.INTFLAG.Get() & 0x3
+	sam.AC.INTFLAG.Set(flags)
+	for i := uint8(0); i < 2; i++ {
+		if flags&(1<<i) != 0 && acCallbacks[i] != nil {
+			acCallbacks[i](AnalogComparator{i})
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"device/sam"
+	"unsafe"
+)
+
+// Bits in the DSU registers, see the DSU chapter of the datasheet.
+const (
+	dsuCtrlCRC      = 1 << 2
+	dsuStatusaDone  = 1 << 0
+	dsuStatusaBERR  = 1 << 2
+	pacWrctrlKeyClr = 1 << 16 // remove the write protection of a peripheral
+	pacPeridDSU     = 33
+)
+
+// Below this size, the CRC is calculated in software as setting up the DSU
+// takes longer than that.
+const crcMinHardwareLength = 64
+
+// CRC32 returns the CRC-32 checksum of data, using the IEEE 802.3 polynomial
+// (0xedb88320 in reversed notation). This is the same checksum as calculated by
+// crc32.ChecksumIEEE in the standard library, as used by Ethernet, zip and PNG.
+//
+// The CRC32 engine of the DSU is used for large buffers, which is much faster
+// than calculating it on the CPU. The CPU waits for the DSU to finish.
+func CRC32(data []byte) uint32 {
+	return CRC32Update(0, data)
+}
+
+// CRC32Update returns the result of adding the bytes in data to the CRC-32
+// checksum crc, like crc32.Update in the standard library. It can be used to
+// calculate the checksum of data that is not available all at once, starting
+// with a crc of 0.
+func CRC32Update(crc uint32, data []byte) uint32 {
+	state := ^crc
+
+	// The DSU only works on whole words, so do the unaligned start and end of
+	// the buffer in software.
+	if len(data) >= crcMinHardwareLength {
+		start := int(-uintptr(unsafe.Pointer(&data[0])) & 3)
+		end := start + (len(data)-start)&^3
+		state = crc32Software(state, data[:start])
+		var ok bool
+		state, ok = crc32DSU(state, data[start:end])
+		if !ok {
+			// The DSU couldn't read the memory, for example because the data
+			// is stored in a region that it doesn't have access to.
+			state = crc32Software(state, data[start:end])
+		}
+		data = data[end:]
+	}
+	state = crc32Software(state, data)
+
+	return ^state
+}
+
+// crc32DSU updates the CRC state with the given data, which must be word
+// aligned and have a length that is a multiple of 4, using the DSU. It returns
+// false if the DSU could not read the data.
+func crc32DSU(state uint32, data []byte) (uint32, bool) {
+	// The DSU is write protected after reset.
+	sam.PAC.WRCTRL.Set(pacWrctrlKeyClr | pacPeridDSU)
+
+	sam.DSU.STATUSA.Set(dsuStatusaDone | dsuStatusaBERR)
+	sam.DSU.ADDR.Set(uint32(uintptr(unsafe.Pointer(&data[0]))))
+	sam.DSU.LENGTH.Set(uint32(len(data)))
+	sam.DSU.DATA.Set(state)
+	sam.DSU.CTRL.Set(dsuCtrlCRC)
+	for !sam.DSU.STATUSA.HasBits(dsuStatusaDone) {
+	}
+	if sam.DSU.STATUSA.HasBits(dsuStatusaBERR) {
+		sam.DSU.STATUSA.Set(dsuStatusaDone | dsuStatusaBERR)
+		return state, false
+	}
+	state = sam.DSU.DATA.Get()
+	sam.DSU.STATUSA.Set(dsuStatusaDone)
+	return state, true
+}
@@ -0,0 +1,46 @@
+// +build sam nrf stm32
+
+package machine
+
+import "device/arm"
+
+// Number of cycles taken by one iteration of the delay loop in DelayCycles
+// (subs + taken bne) on most Cortex-M cores. It is 4 on the Cortex-M0, which
+// makes the delay about a third longer there.
+const delayCyclesPerLoop = 3
+
+// DelayCycles busy-waits for about the given number of CPU cycles, without
+// involving the scheduler. It is meant for short delays in timing sensitive
+// code, like bit-banged protocols, that are much shorter than the resolution of
+// time.Sleep.
+//
+// The delay is a counted loop, so it is only as precise as the CPU executes
+// it: interrupts that happen during the delay make it longer, as do flash wait
+// states on chips that run the loop from flash without a cache. Disable
+// interrupts around the delay (see arm.DisableInterrupts) where that matters.
+// The call itself takes a few cycles too, so very short delays are rounded
+// up.
+func DelayCycles(n uint32) {
+	loops := n / delayCyclesPerLoop
+	if loops == 0 {
+		return
+	}
+	// The loop counts down in r4, which is declared as clobbered together
+	// with the condition flags set by subs.
+	arm.AsmFull(`
+		mov  r4, {loops}
+	1:
+		subs r4, #1
+		bne  1b
+	`, map[string]interface{}{
+		"loops": loops,
+	}, "r4", "cc")
+}
+
+// DelayNanoseconds busy-waits for about the given number of nanoseconds, using
+// DelayCycles with the number of cycles derived from CPUFrequency. See
+// DelayCycles for the sources of jitter. The resolution is one loop iteration
+// of DelayCycles, which is 3 cycles or about 25ns at 120MHz.
+func DelayNanoseconds(ns uint32) {
+	DelayCycles(nanosecondsToCycles(ns, CPUFrequency()))
+}
@@ -0,0 +1,277 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"device/arm"
+	"device/sam"
+	"errors"
+	"unsafe"
+)
+
+// Number of DMA channels that can be allocated. The hardware supports 32
+// channels, but every channel needs 32 bytes of descriptor memory so only the
+// first channels are made available.
+const dmaChannelCount = 8
+
+var ErrNoDMAChannel = errors.New("machine: no free DMA channel")
+
+// Bits in the DMAC CTRL register.
+const (
+	dmacCtrlDMAEnable = 1 << 1
+	dmacCtrlLvlEnAll  = 0xf << 8 // enable all priority levels
+)
+
+// Bits in the CHCTRLA register of each channel.
+const (
+	dmacChctrlaSwrst       = 1 << 0
+	dmacChctrlaEnable      = 1 << 1
+	dmacChctrlaTrigsrcPos  = 8
+	dmacChctrlaTrigactPos  = 20
+	dmacChctrlaTrigactTx   = 3 // one trigger per beat (transaction)
+	dmacChctrlaTrigactBlk  = 0 // one trigger per block
+	dmacChctrlaBurstlenPos = 24
+)
+
+// Bits in the CHINTENSET/CHINTENCLR/CHINTFLAG registers of each channel.
+const (
+	dmacChintTerr  = 1 << 0 // transfer error
+	dmacChintTcmpl = 1 << 1 // transfer complete
+)
+
+// Bits in the BTCTRL field of a transfer descriptor.
+const (
+	dmaBtctrlValid       = 1 << 0
+	dmaBtctrlBlockactInt = 1 << 3 // raise an interrupt after the block
+	dmaBtctrlBeatsizePos = 8
+	dmaBtctrlSrcinc      = 1 << 10
+	dmaBtctrlDstinc      = 1 << 11
+)
+
+// DMA beat sizes, the unit of a single DMA transfer.
+const (
+	DMABeatSize8  = 0
+	DMABeatSize16 = 1
+	DMABeatSize32 = 2
+)
+
+// DMADescriptor is a DMAC transfer descriptor, as stored in memory. See the
+// DMAC chapter of the datasheet for details.
+type DMADescriptor struct {
+	BTCTRL   uint16
+	BTCNT    uint16
+	SRCADDR  uint32
+	DSTADDR  uint32
+	DESCADDR uint32
+}
+
+// The DMAC reads the first descriptor of each channel from this array. It must
+// be aligned to 128 bits.
+//go:align 16
+var dmaDescriptors [dmaChannelCount]DMADescriptor
+
+// The DMAC stores the state of each active channel in this array. It must be
+// aligned to 128 bits.
+//go:align 16
+var dmaWriteback [dmaChannelCount]DMADescriptor
+
+// DMAChannel is a single DMA channel, allocated with AllocateDMAChannel. It is
+// owned by the driver that allocated it until it is freed again.
+type DMAChannel struct {
+	id       uint8
+	config   DMAConfig
+	callback func(*DMAChannel)
+}
+
+// DMAConfig is the configuration of a DMA channel.
+type DMAConfig struct {
+	// Trigger is the peripheral trigger source (TRIGSRC) that starts each
+	// beat, see the datasheet. If it is 0, the transfer is started by
+	// software, which is used for memory-to-memory transfers.
+	Trigger uint8
+
+	// BeatSize is the size of a single beat, one of DMABeatSize8,
+	// DMABeatSize16 or DMABeatSize32.
+	BeatSize uint8
+
+	// Whether to increment the source and destination address after each
+	// beat. This is usually enabled for memory and disabled for peripheral
+	// registers.
+	SrcIncrement bool
+	DstIncrement bool
+}
+
+var (
+	dmaChannels    [dmaChannelCount]DMAChannel
+	dmaAllocated   uint32 // bitmask of allocated channels
+	dmaInitialized bool
+)
+
+// AllocateDMAChannel allocates a free DMA channel. The channel is owned by the
+// caller until it is released with Free, so that different drivers can use DMA
+// at the same time without interfering with each other. It returns
+// ErrNoDMAChannel if all channels are in use.
+func AllocateDMAChannel() (*DMAChannel, error) {
+	mask := arm.DisableInterrupts()
+	defer arm.EnableInterrupts(mask)
+
+	if !dmaInitialized {
+		initDMA()
+	}
+	for i := uint8(0); i < dmaChannelCount; i++ {
+		if dmaAllocated&(1<<i) == 0 {
+			dmaAllocated |= 1 << i
+			ch := &dmaChannels[i]
+			*ch = DMAChannel{id: i}
+			ch.reset()
+			return ch, nil
+		}
+	}
+	return nil, ErrNoDMAChannel
+}
+
+// initDMA enables the DMAC and its interrupts.
+func initDMA() {
+	sam.MCLK.AHBMASK.SetBits(sam.MCLK_AHBMASK_DMAC_)
+	sam.DMAC.BASEADDR.Set(uint32(uintptr(unsafe.Pointer(&dmaDescriptors))))
+	sam.DMAC.WRBADDR.Set(uint32(uintptr(unsafe.Pointer(&dmaWriteback))))
+	sam.DMAC.CTRL.Set(dmacCtrlDMAEnable | dmacCtrlLvlEnAll)
+	arm.EnableIRQ(sam.IRQ_DMAC_0)
+	arm.EnableIRQ(sam.IRQ_DMAC_1)
+	arm.EnableIRQ(sam.IRQ_DMAC_2)
+	arm.EnableIRQ(sam.IRQ_DMAC_3)
+	arm.EnableIRQ(sam.IRQ_DMAC_OTHER)
+	dmaInitialized = true
+}
+
+// Free stops the channel and releases it, so it can be allocated again. The
+// channel must not be used anymore afterwards.
+func (ch *DMAChannel) Free() {
+	ch.Stop()
+	mask := arm.DisableInterrupts()
+	ch.callback = nil
+	dmaAllocated &^= 1 << ch.id
+	arm.EnableInterrupts(mask)
+}
+
+// Configure sets the trigger and beat configuration of this channel. The
+// channel must not be busy.
+func (ch *DMAChannel) Configure(config DMAConfig) {
+	ch.reset()
+	ch.config = config
+	trigact := uint32(dmacChctrlaTrigactTx)
+	if config.Trigger == 0 {
+		// Software trigger: transfer the whole block at once.
+		trigact = dmacChctrlaTrigactBlk
+	}
+	sam.DMAC.CHANNEL[ch.id].CHCTRLA.Set(uint32(config.Trigger)<<dmacChctrlaTrigsrcPos | trigact<<dmacChctrlaTrigactPos)
+}
+
+// SetCallback sets the function that is called (from an interrupt) when a
+// transfer has completed or failed. It may be nil.
+func (ch *DMAChannel) SetCallback(callback func(*DMAChannel)) {
+	ch.callback = callback
+}
+
+// SetTransfer sets up the descriptor for a single transfer of count beats from
+// src to dst. The channel must not be busy.
+func (ch *DMAChannel) SetTransfer(src, dst unsafe.Pointer, count uint16) {
+	beatSize := uintptr(1) << ch.config.BeatSize
+	btctrl := uint16(dmaBtctrlValid | dmaBtctrlBlockactInt | uint16(ch.config.BeatSize)<<dmaBtctrlBeatsizePos)
+	srcAddr := uintptr(src)
+	dstAddr := uintptr(dst)
+	// When incrementing, the DMAC expects the address just past the end of
+	// the transfer.
+	if ch.config.SrcIncrement {
+		btctrl |= dmaBtctrlSrcinc
+		srcAddr += uintptr(count) * beatSize
+	}
+	if ch.config.DstIncrement {
+		btctrl |= dmaBtctrlDstinc
+		dstAddr += uintptr(count) * beatSize
+	}
+	dmaDescriptors[ch.id] = DMADescriptor{
+		BTCTRL:  btctrl,
+		BTCNT:   count,
+		SRCADDR: uint32(srcAddr),
+		DSTADDR: uint32(dstAddr),
+	}
+}
+
+// Start starts the transfer. For a software triggered channel, the transfer
+// starts immediately, otherwise it waits for the peripheral trigger.
+func (ch *DMAChannel) Start() {
+	channel := &sam.DMAC.CHANNEL[ch.id]
+	channel.CHINTFLAG.Set(dmacChintTcmpl | dmacChintTerr)
+	channel.CHINTENSET.Set(dmacChintTcmpl | dmacChintTerr)
+	channel.CHCTRLA.SetBits(dmacChctrlaEnable)
+	if ch.config.Trigger == 0 {
+		sam.DMAC.SWTRIGCTRL.SetBits(1 << ch.id)
+	}
+}
+
+// Stop aborts the current transfer, if any.
+func (ch *DMAChannel) Stop() {
+	channel := &sam.DMAC.CHANNEL[ch.id]
+	channel.CHINTENCLR.Set(dmacChintTcmpl | dmacChintTerr)
+	channel.CHCTRLA.ClearBits(dmacChctrlaEnable)
+	for channel.CHCTRLA.HasBits(dmacChctrlaEnable) {
+	}
+}
+
+// Busy returns whether the channel is still transferring data.
+func (ch *DMAChannel) Busy() bool {
+	return sam.DMAC.CHANNEL[ch.id].CHCTRLA.HasBits(dmacChctrlaEnable)
+}
+
+// reset resets the channel to its initial state.
+func (ch *DMAChannel) reset() {
+	channel := &sam.DMAC.CHANNEL[ch.id]
+	channel.CHCTRLA.ClearBits(dmacChctrlaEnable)
+	for channel.CHCTRLA.HasBits(dmacChctrlaEnable) {
+	}
+	channel.CHCTRLA.SetBits(dmacChctrlaSwrst)
+	for channel.CHCTRLA.HasBits(dmacChctrlaSwrst) {
+	}
+}
+
+// handleDMAInterrupt dispatches DMA interrupts to the callbacks of the
+// channels that raised them.
+func handleDMAInterrupt() {
+	for i := uint8(0); i < dmaChannelCount; i++ {
+		channel := &sam.DMAC.CHANNEL[i]
+		flags := channel.CHINTFLAG.Get() & (dmacChintTcmpl | dmacChintTerr)
+		if flags == 0 {
+			continue
+		}
+		channel.CHINTFLAG.Set(flags)
+		if ch := &dmaChannels[i]; dmaAllocated&(1<<i) != 0 && ch.callback != nil {
+			ch.callback(ch)
+		}
+	}
+}
+
+//go:export DMAC_0_IRQHandler
+func handleDMAC_0() {
+	handleDMAInterrupt()
+}
+
+//go:export DMAC_1_IRQHandler
+func handleDMAC_1() {
+	handleDMAInterrupt()
+}
+
+//go:export DMAC_2_IRQHandler
+func handleDMAC_2() {
+	handleDMAInterrupt()
+}
+
+//go:export DMAC_3_IRQHandler
+func handleDMAC_3() {
+	handleDMAInterrupt()
+}
+
+//go:export DMAC_OTHER_IRQHandler
+func handleDMAC_OTHER() {
+	handleDMAInterrupt()
+}
@@ -0,0 +1,87 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"device/sam"
+)
+
+// PinChange is the kind of change on a pin that generates an event, see
+// SetEventOutput.
+type PinChange uint8
+
+// Pin change events, which are also the values of the SENSE field in the EIC
+// CONFIG registers.
+const (
+	PinRising  PinChange = 1
+	PinFalling PinChange = 2
+	PinToggle  PinChange = 3
+)
+
+// EventID is the ID of an event generator in the event system (EVSYS). It is
+// written to the EVGEN field of an EVSYS channel to route the event to a
+// peripheral, see the EVSYS chapter of the datasheet.
+type EventID uint8
+
+// Bits in the EIC registers.
+const (
+	eicCtrlaEnable  = 1 << 1
+	eicSenseHigh    = 4 // level detection, as needed for pulse width capture and faults
+	eicSyncbusyBusy = 0x3
+)
+
+// SetEventOutput configures the pin to generate an event in the event system
+// on the given change, and returns the ID of the event generator. The event
+// can then be routed to another peripheral (for example to start an ADC
+// conversion) without involving the CPU: no interrupt is enabled for the pin.
+//
+// The pin is connected to the external interrupt with the pin number modulo
+// 16 (see the pinout table in the datasheet), so other pins with the same
+// external interrupt can't generate events or interrupts at the same time.
+// Edges are detected asynchronously, which has the lowest latency and doesn't
+// need a clock.
+func (p Pin) SetEventOutput(change PinChange) (EventID, error) {
+	if p == NoPin {
+		return 0, ErrInvalidInputPin
+	}
+	extint := uint8(p) & 0xf
+
+	sam.MCLK.APBAMASK.SetBits(sam.MCLK_APBAMASK_EIC_)
+	configureEventPin(p, extint, uint32(change))
+	return EventID(evsysGenEICExtint0 + extint), nil
+}
+
+// configureEventPin connects the pin to the given external interrupt of the
+// EIC, which generates an event (but no interrupt) on the given SENSE
+// condition.
+func configureEventPin(pin Pin, extint uint8, sense uint32) {
+	// Connect the pin to the EIC (peripheral function A).
+	if pin&1 > 0 {
+		// odd pin, so save the even pins
+		val := pin.getPMux() & sam.PORT_GROUP_PMUX_PMUXE_Msk
+		pin.setPMux(val)
+	} else {
+		// even pin, so save the odd pins
+		val := pin.getPMux() & sam.PORT_GROUP_PMUX_PMUXO_Msk
+		pin.setPMux(val)
+	}
+	pin.setPinCfg(sam.PORT_GROUP_PINCFG_PMUXEN | sam.PORT_GROUP_PINCFG_INEN)
+
+	// The EIC must be disabled while changing its configuration.
+	sam.EIC.CTRLA.ClearBits(eicCtrlaEnable)
+	for sam.EIC.SYNCBUSY.HasBits(eicSyncbusyBusy) {
+	}
+	shift := (extint % 8) * 4
+	config := &sam.EIC.CONFIG[extint/8]
+	config.Set(config.Get()&^(0xf<<shift) | sense<<shift)
+	if sense != eicSenseHigh {
+		sam.EIC.ASYNCH.SetBits(1 << extint)
+	} else {
+		sam.EIC.ASYNCH.ClearBits(1 << extint)
+	}
+	sam.EIC.INTENCLR.Set(1 << extint)
+	sam.EIC.EVCTRL.SetBits(1 << extint)
+	sam.EIC.CTRLA.SetBits(eicCtrlaEnable)
+	for sam.EIC.SYNCBUSY.HasBits(eicSyncbusyBusy) {
+	}
+}
@@ -0,0 +1,215 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"device/sam"
+	"errors"
+	"runtime/volatile"
+	"unsafe"
+)
+
+var (
+	ErrFlashLocked       = errors.New("machine: flash region is locked")
+	ErrFlashNotAligned   = errors.New("machine: flash write or erase is not aligned")
+	ErrFlashOutOfRange   = errors.New("machine: flash address out of range")
+	ErrFlashProgramError = errors.New("machine: flash programming error")
+)
+
+// NVMCTRL commands, see the CTRLB register description in the datasheet.
+const (
+	nvmctrlCmdexKey = 0xa5 << 8
+	nvmctrlCmdEB    = 0x01 // erase block
+	nvmctrlCmdWP    = 0x03 // write page
+	nvmctrlCmdLR    = 0x11 // lock region
+	nvmctrlCmdUR    = 0x12 // unlock region
+	nvmctrlCmdPBC   = 0x15 // page buffer clear
+)
+
+// The flash is divided in 32 lock regions of equal size.
+const flashLockRegions = 32
+
+// Flash is the internal flash memory of the SAMD51. Offsets are relative to the
+// start of the flash, which is also the start of the address space.
+var Flash flashBlockDevice
+
+type flashBlockDevice struct{}
+
+// ReadAt reads len(p) bytes from the flash at the given offset.
+func (f flashBlockDevice) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > f.Size() {
+		return 0, ErrFlashOutOfRange
+	}
+	for i := range p {
+		p[i] = *(*byte)(unsafe.Pointer(uintptr(off) + uintptr(i)))
+	}
+	return len(p), nil
+}
+
+// WriteAt writes p to the flash at the given offset. Both the offset and the
+// length of p must be a multiple of WriteBlockSize. The flash must have been
+// erased before writing. It returns ErrFlashLocked without writing anything if
+// part of the data would be written to a locked region.
+func (f flashBlockDevice) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > f.Size() {
+		return 0, ErrFlashOutOfRange
+	}
+	if off%f.WriteBlockSize() != 0 || int64(len(p))%f.WriteBlockSize() != 0 {
+		return 0, ErrFlashNotAligned
+	}
+	if f.anyLocked(uintptr(off), uintptr(len(p))) {
+		return 0, ErrFlashLocked
+	}
+
+	defer f.restoreCache(f.disableCache())
+	pageSize := f.pageSize()
+	n := 0
+	for n < len(p) {
+		// Fill the page buffer, up to the end of the page.
+		addr := uintptr(off) + uintptr(n)
+		if err := f.command(nvmctrlCmdPBC, addr); err != nil {
+			return n, err
+		}
+		chunk := int(pageSize - addr%pageSize)
+		if chunk > len(p)-n {
+			chunk = len(p) - n
+		}
+		for i := 0; i < chunk; i += 4 {
+			word := uint32(p[n+i]) | uint32(p[n+i+1])<<8 | uint32(p[n+i+2])<<16 | uint32(p[n+i+3])<<24
+			volatile.StoreUint32((*uint32)(unsafe.Pointer(addr+uintptr(i))), word)
+		}
+
+		// Write the page buffer to flash.
+		if err := f.command(nvmctrlCmdWP, addr); err != nil {
+			return n, err
+		}
+		n += chunk
+	}
+	return n, nil
+}
+
+// Size returns the size of the flash in bytes.
+func (f flashBlockDevice) Size() int64 {
+	pages := int64(sam.NVMCTRL.PARAM.Get() & 0xffff)
+	return pages * int64(f.pageSize())
+}
+
+// WriteBlockSize returns the alignment of writes to the flash.
+func (f flashBlockDevice) WriteBlockSize() int64 {
+	return 4
+}
+
+// EraseBlockSize returns the size of an erase block, which is the smallest
+// unit that can be erased.
+func (f flashBlockDevice) EraseBlockSize() int64 {
+	return int64(f.pageSize()) * 16
+}
+
+// EraseBlocks erases the given number of erase blocks, starting at the given
+// block number. It returns ErrFlashLocked without erasing anything if any of
+// the blocks is in a locked region.
+func (f flashBlockDevice) EraseBlocks(start, length int64) error {
+	blockSize := f.EraseBlockSize()
+	if start < 0 || length < 0 || (start+length)*blockSize > f.Size() {
+		return ErrFlashOutOfRange
+	}
+	if f.anyLocked(uintptr(start*blockSize), uintptr(length*blockSize)) {
+		return ErrFlashLocked
+	}
+
+	defer f.restoreCache(f.disableCache())
+	for block := start; block < start+length; block++ {
+		if err := f.command(nvmctrlCmdEB, uintptr(block*blockSize)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LockRegion locks the lock region that contains the given address, so that it
+// can't be erased or written until it is unlocked again. This can be used for
+// example by a bootloader to protect itself. The lock is lost on reset, unless
+// the region is also locked in the user page.
+func (f flashBlockDevice) LockRegion(addr uintptr) error {
+	if int64(addr) >= f.Size() {
+		return ErrFlashOutOfRange
+	}
+	return f.command(nvmctrlCmdLR, addr)
+}
+
+// UnlockRegion unlocks the lock region that contains the given address.
+func (f flashBlockDevice) UnlockRegion(addr uintptr) error {
+	if int64(addr) >= f.Size() {
+		return ErrFlashOutOfRange
+	}
+	return f.command(nvmctrlCmdUR, addr)
+}
+
+// IsLocked returns whether the lock region that contains the given address is
+// locked.
+func (f flashBlockDevice) IsLocked(addr uintptr) bool {
+	region := addr / f.lockRegionSize()
+	// A bit in RUNLOCK is set if the region is unlocked.
+	return !sam.NVMCTRL.RUNLOCK.HasBits(1 << region)
+}
+
+// anyLocked returns whether any of the lock regions overlapping with the given
+// address range is locked.
+func (f flashBlockDevice) anyLocked(addr, size uintptr) bool {
+	if size == 0 {
+		return false
+	}
+	regionSize := f.lockRegionSize()
+	for region := addr / regionSize; region <= (addr+size-1)/regionSize; region++ {
+		if f.IsLocked(region * regionSize) {
+			return true
+		}
+	}
+	return false
+}
+
+// pageSize returns the size of a flash page (usually 512 bytes).
+func (f flashBlockDevice) pageSize() uintptr {
+	psz := (sam.NVMCTRL.PARAM.Get() >> 16) & 0x7
+	return 8 << psz
+}
+
+// lockRegionSize returns the size of a single lock region.
+func (f flashBlockDevice) lockRegionSize() uintptr {
+	return uintptr(f.Size()) / flashLockRegions
+}
+
+// command executes a single NVMCTRL command on the given address and waits
+// until it has finished.
+func (f flashBlockDevice) command(cmd uint16, addr uintptr) error {
+	for !sam.NVMCTRL.STATUS.HasBits(sam.NVMCTRL_STATUS_READY) {
+	}
+	// Clear the status flags of the previous command.
+	sam.NVMCTRL.INTFLAG.Set(sam.NVMCTRL_INTFLAG_DONE | sam.NVMCTRL_INTFLAG_ADDRE | sam.NVMCTRL_INTFLAG_PROGE | sam.NVMCTRL_INTFLAG_LOCKE)
+	sam.NVMCTRL.ADDR.Set(uint32(addr))
+	sam.NVMCTRL.CTRLB.Set(nvmctrlCmdexKey | cmd)
+	for !sam.NVMCTRL.INTFLAG.HasBits(sam.NVMCTRL_INTFLAG_DONE) {
+	}
+
+	switch {
+	case sam.NVMCTRL.INTFLAG.HasBits(sam.NVMCTRL_INTFLAG_LOCKE):
+		return ErrFlashLocked
+	case sam.NVMCTRL.INTFLAG.HasBits(sam.NVMCTRL_INTFLAG_ADDRE | sam.NVMCTRL_INTFLAG_PROGE):
+		return ErrFlashProgramError
+	}
+	return nil
+}
+
+// disableCache disables the NVM caches while modifying the flash, so that no
+// stale data is read afterwards. It returns the previous CTRLA value, to be
+// passed to restoreCache.
+func (f flashBlockDevice) disableCache() uint16 {
+	ctrla := sam.NVMCTRL.CTRLA.Get()
+	sam.NVMCTRL.CTRLA.SetBits(sam.NVMCTRL_CTRLA_CACHEDIS0 | sam.NVMCTRL_CTRLA_CACHEDIS1)
+	return ctrla
+}
+
+// restoreCache restores the NVM cache configuration.
+func (f flashBlockDevice) restoreCache(ctrla uint16) {
+	sam.NVMCTRL.CTRLA.Set(ctrla)
+}
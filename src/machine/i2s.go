@@ -1,4 +1,4 @@
-// +build sam
+// +build sam test,!baremetal
 
 // This is the definition for I2S bus functions.
 // Actual implementations if available for any given hardware
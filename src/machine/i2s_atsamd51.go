@@ -0,0 +1,170 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"device/sam"
+	"unsafe"
+)
+
+// I2S on the SAMD51. Only the first clock unit is used, for both transmitting
+// and receiving, and all samples are transferred with DMA.
+type I2S struct {
+	Bus *sam.I2S_Type
+	tx  *DMAChannel
+	rx  *DMAChannel
+}
+
+// I2S0 is the only I2S peripheral of the SAMD51.
+var I2S0 = I2S{Bus: sam.I2S}
+
+// Bits in the I2S CTRLA and SYNCBUSY registers.
+const (
+	i2sCtrlaSwrst  = 1 << 0
+	i2sCtrlaEnable = 1 << 1
+	i2sCtrlaCken0  = 1 << 2
+	i2sCtrlaTxen   = 1 << 4
+	i2sCtrlaRxen   = 1 << 5
+)
+
+// The I2S clock is generated by GCLK generator 5 (which is otherwise unused)
+// from the 48MHz DFLL.
+const (
+	i2sGCLKGenerator = 5
+	gclkPchctrlI2S0  = 43
+)
+
+// DMA trigger sources of the serializers.
+const (
+	dmaTriggerI2SRX0 = 0x4c
+	dmaTriggerI2STX0 = 0x4e
+)
+
+// Configure sets up the I2S peripheral for transmitting and receiving audio
+// with the given sample rate (AudioFrequency, 48kHz by default), sample size
+// (DataFormat, 16 bits by default) and number of channels (Stereo, otherwise
+// the left channel is duplicated to the right channel). The SCK, WS and SD
+// pins must be set, SD is the data output (SDO) or input (SDI) pin.
+//
+// As the I2S master, the bit clock is derived from the 48MHz DFLL, which
+// results in a sample rate that may differ slightly from the requested one:
+// 44117Hz instead of 44.1kHz for 16-bit stereo audio. As a slave
+// (I2SModeSlave or I2SClockSourceExternal), the bit clock and frame sync are
+// inputs. PDM and master clock output are not supported.
+//
+// Configure allocates two DMA channels, which are freed again by Close.
+func (i2s *I2S) Configure(config I2SConfig) error {
+	if config.AudioFrequency == 0 {
+		config.AudioFrequency = 48000
+	}
+	if config.DataFormat == I2SDataFormatDefault {
+		config.DataFormat = I2SDataFormat16bit
+	}
+	if config.SCK == 0 || config.SD == 0 {
+		return ErrInvalidI2SConfig
+	}
+	clkctrl, serctrl, gclkDiv, err := i2sRegisters(config)
+	if err != nil {
+		return err
+	}
+
+	if i2s.tx == nil {
+		tx, err := AllocateDMAChannel()
+		if err != nil {
+			return err
+		}
+		rx, err := AllocateDMAChannel()
+		if err != nil {
+			tx.Free()
+			return err
+		}
+		i2s.tx, i2s.rx = tx, rx
+	}
+
+	// Enable the clocks of the peripheral.
+	sam.MCLK.APBDMASK.SetBits(sam.MCLK_APBDMASK_I2S_)
+	sam.GCLK.GENCTRL[i2sGCLKGenerator].Set((sam.GCLK_GENCTRL_SRC_DFLL << sam.GCLK_GENCTRL_SRC_Pos) |
+		(gclkDiv << sam.GCLK_GENCTRL_DIV_Pos) |
+		sam.GCLK_GENCTRL_IDC |
+		sam.GCLK_GENCTRL_GENEN)
+	for sam.GCLK.SYNCBUSY.HasBits(sam.GCLK_SYNCBUSY_GENCTRL_GCLK5) {
+	}
+	sam.GCLK.PCHCTRL[gclkPchctrlI2S0].Set((sam.GCLK_PCHCTRL_GEN_GCLK5 << sam.GCLK_PCHCTRL_GEN_Pos) |
+		sam.GCLK_PCHCTRL_CHEN)
+
+	// Reset the peripheral, and configure it while it is disabled.
+	i2s.Bus.CTRLA.Set(i2sCtrlaSwrst)
+	for i2s.Bus.SYNCBUSY.HasBits(i2sCtrlaSwrst) {
+	}
+	i2s.Bus.CLKCTRL[0].Set(clkctrl)
+	i2s.Bus.TXCTRL.Set(serctrl)
+	i2s.Bus.RXCTRL.Set(serctrl)
+
+	config.SCK.Configure(PinConfig{Mode: PinI2S})
+	if config.WS != NoPin {
+		config.WS.Configure(PinConfig{Mode: PinI2S})
+	}
+	config.SD.Configure(PinConfig{Mode: PinI2S})
+
+	// Each sample is transferred as a 32-bit word, of which the upper bits are
+	// ignored for smaller sample sizes.
+	i2s.tx.Configure(DMAConfig{Trigger: dmaTriggerI2STX0, BeatSize: DMABeatSize32, SrcIncrement: true})
+	i2s.rx.Configure(DMAConfig{Trigger: dmaTriggerI2SRX0, BeatSize: DMABeatSize32, DstIncrement: true})
+
+	const enable = i2sCtrlaEnable | i2sCtrlaCken0 | i2sCtrlaTxen | i2sCtrlaRxen
+	i2s.Bus.CTRLA.Set(enable)
+	for i2s.Bus.SYNCBUSY.HasBits(enable) {
+	}
+	return nil
+}
+
+// Write sends the samples in p, alternating between the left and right
+// channel in stereo mode, and blocks until they have been sent. The samples
+// are copied with DMA, so the CPU is free to run interrupts in the meantime.
+// For continuous audio, call Write again right after it returns: the
+// transmitter holds the last sample while the next transfer is set up.
+func (i2s *I2S) Write(p []uint32) (n int, err error) {
+	for n < len(p) {
+		count := len(p) - n
+		if count > 0xffff {
+			count = 0xffff
+		}
+		i2s.tx.SetTransfer(unsafe.Pointer(&p[n]), unsafe.Pointer(&i2s.Bus.TXDATA.Reg), uint16(count))
+		i2s.tx.Start()
+		for i2s.tx.Busy() {
+		}
+		n += count
+	}
+	return n, nil
+}
+
+// Read receives samples into p, alternating between the left and right
+// channel in stereo mode, and blocks until p is filled. Like Write, the
+// samples are copied with DMA.
+func (i2s *I2S) Read(p []uint32) (n int, err error) {
+	for n < len(p) {
+		count := len(p) - n
+		if count > 0xffff {
+			count = 0xffff
+		}
+		i2s.rx.SetTransfer(unsafe.Pointer(&i2s.Bus.RXDATA.Reg), unsafe.Pointer(&p[n]), uint16(count))
+		i2s.rx.Start()
+		for i2s.rx.Busy() {
+		}
+		n += count
+	}
+	return n, nil
+}
+
+// Close disables the I2S peripheral and frees its DMA channels.
+func (i2s *I2S) Close() error {
+	i2s.Bus.CTRLA.Set(0)
+	for i2s.Bus.SYNCBUSY.HasBits(i2sCtrlaEnable) {
+	}
+	if i2s.tx != nil {
+		i2s.tx.Free()
+		i2s.rx.Free()
+		i2s.tx, i2s.rx = nil, nil
+	}
+	return nil
+}
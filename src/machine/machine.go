@@ -43,3 +43,35 @@ type PWM struct {
 type ADC struct {
 	Pin Pin
 }
+
+// nanosecondsToCycles returns the number of CPU cycles (rounded down) in the
+// given number of nanoseconds, for a CPU running at the given frequency in Hz.
+// The frequency is rounded down to whole MHz.
+func nanosecondsToCycles(ns, frequency uint32) uint32 {
+	mhz := frequency / 1000000
+	// Split the calculation to avoid overflow without 64-bit division.
+	return ns/1000*mhz + ns%1000*mhz/1000
+}
+
+// sampleRate16X is the 16x oversampling of the SERCOM USART of the SAMD chips.
+const sampleRate16X = 16
+
+// uartBaudTimes8 returns the baud value in asynchronous fractional mode (Table
+// 24-2 in the SAMD21 datasheet), multiplied by 8 to include the fractional
+// part:
+//
+//     BAUD = fref / (sampleRateValue * fbaud)
+func uartBaudTimes8(fref, br uint32) uint32 {
+	return (fref * 8) / (sampleRate16X * br)
+}
+
+// uartBaudRate returns the baud rate, rounded to the nearest integer, that
+// results from a baud value as returned by uartBaudTimes8. It returns 0 if the
+// baud value is 0.
+func uartBaudRate(fref, baudTimes8 uint32) uint32 {
+	if baudTimes8 == 0 {
+		return 0
+	}
+	// fbaud = fref * 8 / (sampleRateValue * baudTimes8), rounded
+	return (fref*8 + sampleRate16X*baudTimes8/2) / (sampleRate16X * baudTimes8)
+}
@@ -246,6 +246,12 @@ func (uart UART) Configure(config UARTConfig) {
 	avr.UCSR0C.Set(avr.UCSR0C_UCSZ01 | avr.UCSR0C_UCSZ00)
 }
 
+// Close disables the UART. It can be enabled again with Configure.
+func (uart UART) Close() error {
+	avr.UCSR0B.Set(0)
+	return nil
+}
+
 // WriteByte writes a byte of data to the UART.
 func (uart UART) WriteByte(c byte) error {
 	// Wait until UART buffer is not busy.
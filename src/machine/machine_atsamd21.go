@@ -33,84 +33,6 @@ const (
 	PinInputPulldown PinMode = 12
 )
 
-const (
-	pinPadMapSERCOM0Pad0 byte = (0x10 << 1) | 0x00
-	pinPadMapSERCOM1Pad0 byte = (0x20 << 1) | 0x00
-	pinPadMapSERCOM2Pad0 byte = (0x30 << 1) | 0x00
-	pinPadMapSERCOM3Pad0 byte = (0x40 << 1) | 0x00
-	pinPadMapSERCOM4Pad0 byte = (0x50 << 1) | 0x00
-	pinPadMapSERCOM5Pad0 byte = (0x60 << 1) | 0x00
-	pinPadMapSERCOM0Pad2 byte = (0x10 << 1) | 0x10
-	pinPadMapSERCOM1Pad2 byte = (0x20 << 1) | 0x10
-	pinPadMapSERCOM2Pad2 byte = (0x30 << 1) | 0x10
-	pinPadMapSERCOM3Pad2 byte = (0x40 << 1) | 0x10
-	pinPadMapSERCOM4Pad2 byte = (0x50 << 1) | 0x10
-	pinPadMapSERCOM5Pad2 byte = (0x60 << 1) | 0x10
-
-	pinPadMapSERCOM0AltPad0 byte = (0x01 << 1) | 0x00
-	pinPadMapSERCOM1AltPad0 byte = (0x02 << 1) | 0x00
-	pinPadMapSERCOM2AltPad0 byte = (0x03 << 1) | 0x00
-	pinPadMapSERCOM3AltPad0 byte = (0x04 << 1) | 0x00
-	pinPadMapSERCOM4AltPad0 byte = (0x05 << 1) | 0x00
-	pinPadMapSERCOM5AltPad0 byte = (0x06 << 1) | 0x00
-	pinPadMapSERCOM0AltPad2 byte = (0x01 << 1) | 0x01
-	pinPadMapSERCOM1AltPad2 byte = (0x02 << 1) | 0x01
-	pinPadMapSERCOM2AltPad2 byte = (0x03 << 1) | 0x01
-	pinPadMapSERCOM3AltPad2 byte = (0x04 << 1) | 0x01
-	pinPadMapSERCOM4AltPad2 byte = (0x05 << 1) | 0x01
-	pinPadMapSERCOM5AltPad2 byte = (0x06 << 1) | 0x01
-)
-
-// pinPadMapping lists which pins have which SERCOMs attached to them.
-// The encoding is rather dense, with each byte encoding two pins and both
-// SERCOM and SERCOM-ALT.
-//
-// Observations:
-//   * There are six SERCOMs. Those SERCOM numbers can be encoded in 3 bits.
-//   * Even pad numbers are always on even pins, and odd pad numbers are always on
-//     odd pins.
-//   * Pin pads come in pairs. If PA00 has pad 0, then PA01 has pad 1.
-// With this information, we can encode SERCOM pin/pad numbers much more
-// efficiently. First of all, due to pads coming in pairs, we can ignore half
-// the pins: the information for an odd pin can be calculated easily from the
-// preceding even pin. And second, if odd pads are always on odd pins and even
-// pads on even pins, we can drop a single bit from the pad number.
-//
-// Each byte below is split in two nibbles. The 4 high bits are for SERCOM and
-// the 4 low bits are for SERCOM-ALT. Of each nibble, the 3 high bits encode the
-// SERCOM + 1 while the low bit encodes whether this is PAD0 or PAD2 (0 means
-// PAD0, 1 means PAD2). It encodes SERCOM + 1 instead of just the SERCOM number,
-// to make it easy to check whether a nibble is set at all.
-var pinPadMapping = [32]byte{
-	// page 21
-	PA00 / 2: 0 | pinPadMapSERCOM1AltPad0,
-	PB08 / 2: 0 | pinPadMapSERCOM4AltPad0,
-	PA04 / 2: 0 | pinPadMapSERCOM0AltPad0,
-	PA06 / 2: 0 | pinPadMapSERCOM0AltPad2,
-	PA08 / 2: pinPadMapSERCOM0Pad0 | pinPadMapSERCOM2AltPad0,
-	PA10 / 2: pinPadMapSERCOM0Pad2 | pinPadMapSERCOM2AltPad2,
-
-	// page 22
-	PB10 / 2: 0 | pinPadMapSERCOM4AltPad2,
-	PB12 / 2: pinPadMapSERCOM4Pad0 | 0,
-	PB14 / 2: pinPadMapSERCOM4Pad2 | 0,
-	PA12 / 2: pinPadMapSERCOM2Pad0 | pinPadMapSERCOM4AltPad0,
-	PA14 / 2: pinPadMapSERCOM2Pad2 | pinPadMapSERCOM4AltPad2,
-	PA16 / 2: pinPadMapSERCOM1Pad0 | pinPadMapSERCOM3AltPad0,
-	PA18 / 2: pinPadMapSERCOM1Pad2 | pinPadMapSERCOM3AltPad2,
-	PB16 / 2: pinPadMapSERCOM5Pad0 | 0,
-	PA20 / 2: pinPadMapSERCOM5Pad2 | pinPadMapSERCOM3AltPad2,
-	PA22 / 2: pinPadMapSERCOM3Pad0 | pinPadMapSERCOM5AltPad0,
-	PA24 / 2: pinPadMapSERCOM3Pad2 | pinPadMapSERCOM5AltPad2,
-
-	// page 23
-	PB22 / 2: 0 | pinPadMapSERCOM5AltPad2,
-	PA30 / 2: 0 | pinPadMapSERCOM1AltPad2,
-	PB30 / 2: 0 | pinPadMapSERCOM5AltPad0,
-	PB00 / 2: 0 | pinPadMapSERCOM5AltPad2,
-	PB02 / 2: 0 | pinPadMapSERCOM5AltPad0,
-}
-
 // findPinPadMapping looks up the pad number and the pinmode for a given pin,
 // given a SERCOM number. The result can either be SERCOM, SERCOM-ALT, or "not
 // found" (indicated by returning ok=false). The pad number is returned to
@@ -302,10 +224,7 @@ var (
 	UART0 = USBCDC{Buffer: NewRingBuffer()}
 )
 
-const (
-	sampleRate16X = 16
-	lsbFirst      = 1
-)
+const lsbFirst = 1
 
 // Configure the UART.
 func (uart UART) Configure(config UARTConfig) error {
@@ -324,7 +243,7 @@ func (uart UART) Configure(config UARTConfig) error {
 	// Determine transmit pinout.
 	txPinMode, txPad, ok := findPinPadMapping(uart.SERCOM, config.TX)
 	if !ok {
-		return ErrInvalidOutputPin
+		return pinMappingError(ErrInvalidOutputPin, "TX", config.TX, uart.SERCOM, "0 or 2")
 	}
 	var txPinOut uint32
 	// See table 25-9 of the datasheet (page 459) for how pads are mapped to
@@ -336,13 +255,13 @@ func (uart UART) Configure(config UARTConfig) error {
 		txPinOut = 1
 	default:
 		// TODO: flow control (RTS/CTS)
-		return ErrInvalidOutputPin
+		return pinMappingError(ErrInvalidOutputPin, "TX", config.TX, uart.SERCOM, "0 or 2")
 	}
 
 	// Determine receive pinout.
 	rxPinMode, rxPad, ok := findPinPadMapping(uart.SERCOM, config.RX)
 	if !ok {
-		return ErrInvalidInputPin
+		return pinMappingError(ErrInvalidInputPin, "RX", config.RX, uart.SERCOM, "")
 	}
 	// As you can see in table 25-8 on page 459 of the datasheet, input pins
 	// are mapped directly.
@@ -409,13 +328,19 @@ func (uart UART) Configure(config UARTConfig) error {
 	return nil
 }
 
+// Close disables the UART. It can be enabled again with Configure.
+func (uart UART) Close() error {
+	arm.DisableIRQ(sam.IRQ_SERCOM0 + uint32(uart.SERCOM))
+	uart.Bus.INTENCLR.Set(sam.SERCOM_USART_INTENCLR_RXC)
+	uart.Bus.CTRLA.ClearBits(sam.SERCOM_USART_CTRLA_ENABLE)
+	for uart.Bus.SYNCBUSY.HasBits(sam.SERCOM_USART_SYNCBUSY_ENABLE) {
+	}
+	return nil
+}
+
 // SetBaudRate sets the communication speed for the UART.
 func (uart UART) SetBaudRate(br uint32) {
-	// Asynchronous fractional mode (Table 24-2 in datasheet)
-	//   BAUD = fref / (sampleRateValue * fbaud)
-	// (multiply by 8, to calculate fractional piece)
-	// uint32_t baudTimes8 = (SystemCoreClock * 8) / (16 * baudrate);
-	baud := (CPUFrequency() * 8) / (sampleRate16X * br)
+	baud := uartBaudTimes8(CPUFrequency(), br)
 
 	// sercom->USART.BAUD.FRAC.FP   = (baudTimes8 % 8);
 	// sercom->USART.BAUD.FRAC.BAUD = (baudTimes8 / 8);
@@ -423,6 +348,17 @@ func (uart UART) SetBaudRate(br uint32) {
 		((baud / 8) << sam.SERCOM_USART_BAUD_FRAC_MODE_BAUD_Pos)))
 }
 
+// ActualBaudRate returns the communication speed that the UART actually
+// uses, as configured with SetBaudRate. It differs slightly from the requested
+// baud rate because the BAUD register has a resolution of 1/8th of the
+// reference clock period, for example 115385 instead of 115200 (an error of
+// 0.16%). An error of up to about 2% is usually tolerated by receivers.
+func (uart UART) ActualBaudRate() uint32 {
+	reg := uint32(uart.Bus.BAUD.Get())
+	baud := ((reg>>sam.SERCOM_USART_BAUD_FRAC_MODE_BAUD_Pos)&0x1fff)*8 + (reg>>sam.SERCOM_USART_BAUD_FRAC_MODE_FP_Pos)&0x7
+	return uartBaudRate(CPUFrequency(), baud)
+}
+
 // WriteByte writes a byte of data to the UART.
 func (uart UART) WriteByte(c byte) error {
 	// wait until ready to receive
@@ -487,14 +423,14 @@ func (i2c I2C) Configure(config I2CConfig) error {
 		// SCL must be on pad 1, according to section 27.5 of the datasheet.
 		// Note: this is not an exhaustive test for I2C support on the pin: not
 		// all pins support I2C.
-		return ErrInvalidClockPin
+		return pinMappingError(ErrInvalidClockPin, "SCL", config.SCL, i2c.SERCOM, "1")
 	}
 	sdaPinMode, sdaPad, ok := findPinPadMapping(i2c.SERCOM, config.SDA)
 	if !ok || sdaPad != 0 {
 		// SDA must be on pad 0, according to section 27.5 of the datasheet.
 		// Note: this is not an exhaustive test for I2C support on the pin: not
 		// all pins support I2C.
-		return ErrInvalidDataPin
+		return pinMappingError(ErrInvalidDataPin, "SDA", config.SDA, i2c.SERCOM, "0")
 	}
 
 	// reset SERCOM
@@ -952,7 +888,7 @@ func (spi SPI) Configure(config SPIConfig) error {
 	// Determine the input pinout (for MISO).
 	misoPinMode, misoPad, ok := findPinPadMapping(spi.SERCOM, config.MISO)
 	if !ok {
-		return ErrInvalidInputPin
+		return pinMappingError(ErrInvalidInputPin, "MISO", config.MISO, spi.SERCOM, "")
 	}
 	dataInPinout := misoPad // mapped directly
 
@@ -961,11 +897,11 @@ func (spi SPI) Configure(config SPIConfig) error {
 	var dataOutPinout uint32
 	sckPinMode, sckPad, ok := findPinPadMapping(spi.SERCOM, config.SCK)
 	if !ok {
-		return ErrInvalidOutputPin
+		return pinMappingError(ErrInvalidOutputPin, "SCK", config.SCK, spi.SERCOM, "1 or 3")
 	}
 	mosiPinMode, mosiPad, ok := findPinPadMapping(spi.SERCOM, config.MOSI)
 	if !ok {
-		return ErrInvalidOutputPin
+		return pinMappingError(ErrInvalidOutputPin, "MOSI", config.MOSI, spi.SERCOM, "")
 	}
 	switch sckPad {
 	case 1:
@@ -975,7 +911,7 @@ func (spi SPI) Configure(config SPIConfig) error {
 		case 3:
 			dataOutPinout = 0x2
 		default:
-			return ErrInvalidOutputPin
+			return pinMappingError(ErrInvalidOutputPin, "MOSI", config.MOSI, spi.SERCOM, "0 or 3")
 		}
 	case 3:
 		switch mosiPad {
@@ -984,10 +920,10 @@ func (spi SPI) Configure(config SPIConfig) error {
 		case 0:
 			dataOutPinout = 0x3
 		default:
-			return ErrInvalidOutputPin
+			return pinMappingError(ErrInvalidOutputPin, "MOSI", config.MOSI, spi.SERCOM, "0 or 2")
 		}
 	default:
-		return ErrInvalidOutputPin
+		return pinMappingError(ErrInvalidOutputPin, "SCK", config.SCK, spi.SERCOM, "1 or 3")
 	}
 
 	// Disable SPI port.
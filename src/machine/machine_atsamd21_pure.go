@@ -0,0 +1,163 @@
+// +build sam,atsamd21 test,!baremetal
+
+package machine
+
+// This file contains the parts of the atsamd21 support that don't access the
+// hardware. It is also built for tests on the host, so that it can be tested
+// with "tinygo test machine".
+
+// SERCOM pin mapping and the errors that describe it.
+
+const (
+	pinPadMapSERCOM0Pad0 byte = (0x10 << 1) | 0x00
+	pinPadMapSERCOM1Pad0 byte = (0x20 << 1) | 0x00
+	pinPadMapSERCOM2Pad0 byte = (0x30 << 1) | 0x00
+	pinPadMapSERCOM3Pad0 byte = (0x40 << 1) | 0x00
+	pinPadMapSERCOM4Pad0 byte = (0x50 << 1) | 0x00
+	pinPadMapSERCOM5Pad0 byte = (0x60 << 1) | 0x00
+	pinPadMapSERCOM0Pad2 byte = (0x10 << 1) | 0x10
+	pinPadMapSERCOM1Pad2 byte = (0x20 << 1) | 0x10
+	pinPadMapSERCOM2Pad2 byte = (0x30 << 1) | 0x10
+	pinPadMapSERCOM3Pad2 byte = (0x40 << 1) | 0x10
+	pinPadMapSERCOM4Pad2 byte = (0x50 << 1) | 0x10
+	pinPadMapSERCOM5Pad2 byte = (0x60 << 1) | 0x10
+
+	pinPadMapSERCOM0AltPad0 byte = (0x01 << 1) | 0x00
+	pinPadMapSERCOM1AltPad0 byte = (0x02 << 1) | 0x00
+	pinPadMapSERCOM2AltPad0 byte = (0x03 << 1) | 0x00
+	pinPadMapSERCOM3AltPad0 byte = (0x04 << 1) | 0x00
+	pinPadMapSERCOM4AltPad0 byte = (0x05 << 1) | 0x00
+	pinPadMapSERCOM5AltPad0 byte = (0x06 << 1) | 0x00
+	pinPadMapSERCOM0AltPad2 byte = (0x01 << 1) | 0x01
+	pinPadMapSERCOM1AltPad2 byte = (0x02 << 1) | 0x01
+	pinPadMapSERCOM2AltPad2 byte = (0x03 << 1) | 0x01
+	pinPadMapSERCOM3AltPad2 byte = (0x04 << 1) | 0x01
+	pinPadMapSERCOM4AltPad2 byte = (0x05 << 1) | 0x01
+	pinPadMapSERCOM5AltPad2 byte = (0x06 << 1) | 0x01
+)
+
+// pinPadMapping lists which pins have which SERCOMs attached to them.
+// The encoding is rather dense, with each byte encoding two pins and both
+// SERCOM and SERCOM-ALT.
+//
+// Observations:
+//   * There are six SERCOMs. Those SERCOM numbers can be encoded in 3 bits.
+//   * Even pad numbers are always on even pins, and odd pad numbers are always on
+//     odd pins.
+//   * Pin pads come in pairs. If PA00 has pad 0, then PA01 has pad 1.
+// With this information, we can encode SERCOM pin/pad numbers much more
+// efficiently. First of all, due to pads coming in pairs, we can ignore half
+// the pins: the information for an odd pin can be calculated easily from the
+// preceding even pin. And second, if odd pads are always on odd pins and even
+// pads on even pins, we can drop a single bit from the pad number.
+//
+// Each byte below is split in two nibbles. The 4 high bits are for SERCOM and
+// the 4 low bits are for SERCOM-ALT. Of each nibble, the 3 high bits encode the
+// SERCOM + 1 while the low bit encodes whether this is PAD0 or PAD2 (0 means
+// PAD0, 1 means PAD2). It encodes SERCOM + 1 instead of just the SERCOM number,
+// to make it easy to check whether a nibble is set at all.
+var pinPadMapping = [32]byte{
+	// page 21
+	PA00 / 2: 0 | pinPadMapSERCOM1AltPad0,
+	PB08 / 2: 0 | pinPadMapSERCOM4AltPad0,
+	PA04 / 2: 0 | pinPadMapSERCOM0AltPad0,
+	PA06 / 2: 0 | pinPadMapSERCOM0AltPad2,
+	PA08 / 2: pinPadMapSERCOM0Pad0 | pinPadMapSERCOM2AltPad0,
+	PA10 / 2: pinPadMapSERCOM0Pad2 | pinPadMapSERCOM2AltPad2,
+
+	// page 22
+	PB10 / 2: 0 | pinPadMapSERCOM4AltPad2,
+	PB12 / 2: pinPadMapSERCOM4Pad0 | 0,
+	PB14 / 2: pinPadMapSERCOM4Pad2 | 0,
+	PA12 / 2: pinPadMapSERCOM2Pad0 | pinPadMapSERCOM4AltPad0,
+	PA14 / 2: pinPadMapSERCOM2Pad2 | pinPadMapSERCOM4AltPad2,
+	PA16 / 2: pinPadMapSERCOM1Pad0 | pinPadMapSERCOM3AltPad0,
+	PA18 / 2: pinPadMapSERCOM1Pad2 | pinPadMapSERCOM3AltPad2,
+	PB16 / 2: pinPadMapSERCOM5Pad0 | 0,
+	PA20 / 2: pinPadMapSERCOM5Pad2 | pinPadMapSERCOM3AltPad2,
+	PA22 / 2: pinPadMapSERCOM3Pad0 | pinPadMapSERCOM5AltPad0,
+	PA24 / 2: pinPadMapSERCOM3Pad2 | pinPadMapSERCOM5AltPad2,
+
+	// page 23
+	PB22 / 2: 0 | pinPadMapSERCOM5AltPad2,
+	PA30 / 2: 0 | pinPadMapSERCOM1AltPad2,
+	PB30 / 2: 0 | pinPadMapSERCOM5AltPad0,
+	PB00 / 2: 0 | pinPadMapSERCOM5AltPad2,
+	PB02 / 2: 0 | pinPadMapSERCOM5AltPad0,
+}
+
+// PinMappingError is returned by the Configure methods of SERCOM peripherals
+// when a pin can't be used for the given function. Besides the basic error
+// (such as ErrInvalidClockPin), it describes the pad that is needed and the
+// SERCOMs that are actually available on the pin, to help find the correct
+// pins when bringing up a new board.
+type PinMappingError struct {
+	Err    error  // the basic error, such as ErrInvalidClockPin
+	Pin    Pin    // the pin that was passed to Configure
+	Name   string // the function of the pin, such as "SCL"
+	SERCOM uint8  // the SERCOM that was being configured
+	Pads   string // the allowed pads, such as "1" or "1 or 3", or empty if any
+}
+
+// Error returns the error message, for example:
+//
+//     machine: invalid clock pin: SCL pin PA08 must be on SERCOM0 pad 1 (PA08 has SERCOM0 pad 0, SERCOM2-ALT pad 0)
+func (e *PinMappingError) Error() string {
+	msg := e.Err.Error() + ": " + e.Name + " pin " + pinName(e.Pin) + " must be on SERCOM" + string('0'+e.SERCOM)
+	if e.Pads != "" {
+		msg += " pad " + e.Pads
+	}
+	return msg + " (" + describePinMapping(e.Pin) + ")"
+}
+
+// Unwrap returns the basic error, so that errors.Is can be used to compare
+// against errors like ErrInvalidClockPin.
+func (e *PinMappingError) Unwrap() error {
+	return e.Err
+}
+
+// pinMappingError returns a *PinMappingError for the given pin.
+func pinMappingError(err error, name string, pin Pin, sercom uint8, pads string) error {
+	return &PinMappingError{Err: err, Pin: pin, Name: name, SERCOM: sercom, Pads: pads}
+}
+
+// describePinMapping returns a human readable description of the SERCOMs and
+// pads that are available on the given pin, based on pinPadMapping.
+func describePinMapping(pin Pin) string {
+	desc := pinName(pin) + " has "
+	if pin >= Pin(len(pinPadMapping)*2) {
+		return desc + "no SERCOM"
+	}
+	nibbles := pinPadMapping[pin/2]
+	found := false
+	// The upper nibble is for SERCOM, the lower nibble for SERCOM-ALT.
+	for i, nibble := range [2]byte{nibbles >> 4, nibbles & 0xf} {
+		if nibble == 0 {
+			continue
+		}
+		if found {
+			desc += ", "
+		}
+		desc += "SERCOM" + string('0'+(nibble>>1)-1)
+		if i == 1 {
+			desc += "-ALT"
+		}
+		pad := (nibble&1)<<1 | byte(pin&1)
+		desc += " pad " + string('0'+pad)
+		found = true
+	}
+	if !found {
+		return desc + "no SERCOM"
+	}
+	return desc
+}
+
+// pinName returns the name of the pin as used in the datasheet, such as PA08.
+func pinName(pin Pin) string {
+	port := "PA"
+	if pin >= 32 {
+		port = "PB"
+		pin -= 32
+	}
+	return port + string('0'+byte(pin/10)) + string('0'+byte(pin%10))
+}
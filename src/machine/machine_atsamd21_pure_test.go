@@ -0,0 +1,52 @@
+// +build sam,atsamd21 test,!baremetal
+
+package machine
+
+import "testing"
+
+func TestPinMappingError(t *testing.T) {
+	for _, tc := range []struct {
+		err *PinMappingError
+		msg string
+	}{
+		{
+			&PinMappingError{Err: ErrInvalidClockPin, Pin: PA08, Name: "SCL", SERCOM: 0, Pads: "1"},
+			"machine: invalid clock pin: SCL pin PA08 must be on SERCOM0 pad 1 (PA08 has SERCOM0 pad 0, SERCOM2-ALT pad 0)",
+		},
+		{
+			&PinMappingError{Err: ErrInvalidOutputPin, Pin: PA11, Name: "SCK", SERCOM: 1, Pads: "1 or 3"},
+			"machine: invalid output pin: SCK pin PA11 must be on SERCOM1 pad 1 or 3 (PA11 has SERCOM0 pad 3, SERCOM2-ALT pad 3)",
+		},
+		{
+			&PinMappingError{Err: ErrInvalidInputPin, Pin: PB09, Name: "RX", SERCOM: 5},
+			"machine: invalid input pin: RX pin PB09 must be on SERCOM5 (PB09 has SERCOM4-ALT pad 1)",
+		},
+		{
+			&PinMappingError{Err: ErrInvalidDataPin, Pin: PA02, Name: "SDA", SERCOM: 3, Pads: "0"},
+			"machine: invalid data pin: SDA pin PA02 must be on SERCOM3 pad 0 (PA02 has no SERCOM)",
+		},
+	} {
+		if msg := tc.err.Error(); msg != tc.msg {
+			t.Errorf("unexpected error message:\n  got:      %s\n  expected: %s", msg, tc.msg)
+		}
+		if tc.err.Unwrap() != tc.err.Err {
+			t.Errorf("Unwrap of %q doesn't return the basic error", tc.msg)
+		}
+	}
+}
+
+func TestPinName(t *testing.T) {
+	for _, tc := range []struct {
+		pin  Pin
+		name string
+	}{
+		{PA00, "PA00"},
+		{PA31, "PA31"},
+		{PB00, "PB00"},
+		{PB23, "PB23"},
+	} {
+		if name := pinName(tc.pin); name != tc.name {
+			t.Errorf("pinName(%d) = %s, expected %s", tc.pin, name, tc.name)
+		}
+	}
+}
@@ -42,8 +42,18 @@ const (
 	PinPWMF          PinMode = PinTimerAlt
 	PinPWMG          PinMode = PinTCCPDEC
 	PinInputPulldown PinMode = 18
+
+	// PinOutputOpenDrain is an output that only drives the pin low. Setting it
+	// high releases the pin, so it is pulled up by an (external) pull-up
+	// resistor or driven by another device, as used by buses like I2C and
+	// 1-Wire.
+	PinOutputOpenDrain PinMode = 19
 )
 
+// Pins configured as PinOutputOpenDrain, as a bitmask per pin group. These pins
+// are driven by changing their direction instead of their output value.
+var openDrainPins [4]uint32
+
 // Hardware pins
 const (
 	PA00 Pin = 0
@@ -130,6 +140,16 @@ func (p Pin) PortMaskClear() (*uint32, uint32) {
 // Warning: only use this on an output pin!
 func (p Pin) Set(high bool) {
 	group, pin_in_group := p.getPinGrouping()
+	if openDrainPins[group]&(1<<pin_in_group) != 0 {
+		// The output value is always low, switch between input (released)
+		// and output (pulled low).
+		if high {
+			sam.PORT.GROUP[group].DIRCLR.Set(1 << pin_in_group)
+		} else {
+			sam.PORT.GROUP[group].DIRSET.Set(1 << pin_in_group)
+		}
+		return
+	}
 	if high {
 		sam.PORT.GROUP[group].OUTSET.Set(1 << pin_in_group)
 	} else {
@@ -147,13 +167,27 @@ func (p Pin) Get() bool {
 // Warning: only use this on an output pin!
 func (p Pin) Toggle() {
 	group, pin_in_group := p.getPinGrouping()
+	if openDrainPins[group]&(1<<pin_in_group) != 0 {
+		sam.PORT.GROUP[group].DIRTGL.Set(1 << pin_in_group)
+		return
+	}
 	sam.PORT.GROUP[group].OUTTGL.Set(1 << pin_in_group)
 }
 
 // Configure this pin with the given configuration.
 func (p Pin) Configure(config PinConfig) {
 	group, pin_in_group := p.getPinGrouping()
+	openDrainPins[group] &^= 1 << pin_in_group
 	switch config.Mode {
+	case PinOutputOpenDrain:
+		// Start released (high), with the output value fixed at low so that
+		// only the direction needs to be changed afterwards. The input is
+		// enabled to read back the state of the bus.
+		sam.PORT.GROUP[group].DIRCLR.Set(1 << pin_in_group)
+		sam.PORT.GROUP[group].OUTCLR.Set(1 << pin_in_group)
+		p.setPinCfg(sam.PORT_GROUP_PINCFG_INEN)
+		openDrainPins[group] |= 1 << pin_in_group
+
 	case PinOutput:
 		sam.PORT.GROUP[group].DIRSET.Set(1 << pin_in_group)
 		// output is also set to input enable so pin can read back its own value
@@ -211,6 +245,18 @@ func (p Pin) Configure(config PinConfig) {
 		}
 		// enable port config
 		p.setPinCfg(sam.PORT_GROUP_PINCFG_PMUXEN)
+	case PinI2S:
+		if p&1 > 0 {
+			// odd pin, so save the even pins
+			val := p.getPMux() & sam.PORT_GROUP_PMUX_PMUXE_Msk
+			p.setPMux(val | (uint8(PinI2S) << sam.PORT_GROUP_PMUX_PMUXO_Pos))
+		} else {
+			// even pin, so save the odd pins
+			val := p.getPMux() & sam.PORT_GROUP_PMUX_PMUXO_Msk
+			p.setPMux(val | (uint8(PinI2S) << sam.PORT_GROUP_PMUX_PMUXE_Pos))
+		}
+		// enable port config
+		p.setPinCfg(sam.PORT_GROUP_PINCFG_PMUXEN)
 	case PinAnalog:
 		if p&1 > 0 {
 			// odd pin, so save the even pins
@@ -320,8 +366,9 @@ func InitADC() {
 	sam.ADC1.CALIB.Set(uint16((biascomp | biasr2r | biasref) >> 16))
 
 	sam.ADC0.CTRLA.SetBits(sam.ADC_CTRLA_PRESCALER_DIV32 << sam.ADC_CTRLA_PRESCALER_Pos)
-	// adcs[i]->CTRLB.bit.RESSEL = ADC_CTRLB_RESSEL_10BIT_Val;
-	sam.ADC0.CTRLB.SetBits(sam.ADC_CTRLB_RESSEL_10BIT << sam.ADC_CTRLB_RESSEL_Pos)
+	// 12-bit results (adcResolution), like the averaged results of
+	// GetWithSamples.
+	sam.ADC0.CTRLB.Set(sam.ADC_CTRLB_RESSEL_12BIT << sam.ADC_CTRLB_RESSEL_Pos)
 
 	// wait for sync
 	for sam.ADC0.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_CTRLB) {
@@ -351,7 +398,7 @@ func InitADC() {
 
 	// same for ADC1, as for ADC0
 	sam.ADC1.CTRLA.SetBits(sam.ADC_CTRLA_PRESCALER_DIV32 << sam.ADC_CTRLA_PRESCALER_Pos)
-	sam.ADC1.CTRLB.SetBits(sam.ADC_CTRLB_RESSEL_10BIT << sam.ADC_CTRLB_RESSEL_Pos)
+	sam.ADC1.CTRLB.Set(sam.ADC_CTRLB_RESSEL_12BIT << sam.ADC_CTRLB_RESSEL_Pos)
 	for sam.ADC1.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_CTRLB) {
 	}
 	sam.ADC1.SAMPCTRL.Set(5)
@@ -382,6 +429,53 @@ func (a ADC) Configure() {
 
 // Get returns the current value of a ADC pin, in the range 0..0xffff.
 func (a ADC) Get() uint16 {
+	return adcScale(a.read())
+}
+
+// GetWithSamples returns the current value of a ADC pin, in the same range as
+// Get, averaged over the given number of samples. The number of samples must be
+// a power of two between 1 and 1024. Averaging is only configured for this
+// read: the previous configuration is restored afterwards.
+//
+// More samples give a less noisy result, at the cost of a slower conversion.
+func (a ADC) GetWithSamples(samples uint32) uint16 {
+	samplenum, adjres := adcAveraging(samples)
+	if samplenum == 0 {
+		// No averaging, so no need to reconfigure the ADC.
+		return a.Get()
+	}
+	bus := a.getADCBus()
+
+	// Save the current configuration, to restore it afterwards.
+	ctrlb := bus.CTRLB.Get()
+	avgctrl := bus.AVGCTRL.Get()
+
+	// Averaging requires the 16-bit result mode. The accumulated result is
+	// divided by 2^ADJRES (and automatically shifted right for more than 16
+	// samples) to get a 12-bit average, see adcAveraging.
+	bus.CTRLB.Set(ctrlb&^sam.ADC_CTRLB_RESSEL_Msk | sam.ADC_CTRLB_RESSEL_16BIT<<sam.ADC_CTRLB_RESSEL_Pos)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_CTRLB) {
+	}
+	bus.AVGCTRL.Set(samplenum<<sam.ADC_AVGCTRL_SAMPLENUM_Pos | adjres<<sam.ADC_AVGCTRL_ADJRES_Pos)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_AVGCTRL) {
+	}
+
+	val := a.read()
+
+	// Restore the previous configuration.
+	bus.CTRLB.Set(ctrlb)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_CTRLB) {
+	}
+	bus.AVGCTRL.Set(avgctrl)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_AVGCTRL) {
+	}
+
+	// The average has the same resolution as a single conversion.
+	return adcScale(val)
+}
+
+// read does a single conversion on the ADC pin and returns the raw result.
+func (a ADC) read() uint16 {
 	bus := a.getADCBus()
 	ch := a.getADCChannel()
 
@@ -423,7 +517,56 @@ func (a ADC) Get() uint16 {
 	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_ENABLE) {
 	}
 
-	return uint16(val) << 4 // scales from 12 to 16-bit result
+	return uint16(val)
+}
+
+// ErrADCSequenceLength is returned by ReadSequence when the number of results
+// doesn't match the number of pins.
+var ErrADCSequenceLength = errors.New("machine: ADC sequence and results have different lengths")
+
+// ReadSequence reads the given ADC pins one after another and stores the
+// results (in the range 0..0xffff, like Get) in results, which must have the
+// same length as pins. The ADC is only enabled once for the whole sequence, so
+// this is a lot faster than calling Get for every pin.
+func ReadSequence(pins []ADC, results []uint16) error {
+	if len(pins) != len(results) {
+		return ErrADCSequenceLength
+	}
+	if len(pins) == 0 {
+		return nil
+	}
+	bus := sam.ADC0
+
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_ENABLE) {
+	}
+	bus.CTRLA.SetBits(sam.ADC_CTRLA_ENABLE)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_ENABLE) {
+	}
+
+	adcSequence(results, bus.INPUTCTRL.Get(), func(i int) uint8 {
+		return pins[i].getADCChannel()
+	}, func(inputctrl uint16, conversions int) uint16 {
+		// Switching the input only needs a sync, not a new enable cycle.
+		bus.INPUTCTRL.Set(inputctrl)
+		for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_INPUTCTRL) {
+		}
+		var val uint16
+		for ; conversions > 0; conversions-- {
+			bus.SWTRIG.SetBits(sam.ADC_SWTRIG_START)
+			for !bus.INTFLAG.HasBits(sam.ADC_INTFLAG_RESRDY) {
+			}
+			val = uint16(bus.RESULT.Get())
+			bus.INTFLAG.SetBits(sam.ADC_INTFLAG_RESRDY)
+		}
+		return val
+	})
+
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_ENABLE) {
+	}
+	bus.CTRLA.ClearBits(sam.ADC_CTRLA_ENABLE)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_ENABLE) {
+	}
+	return nil
 }
 
 func (a ADC) getADCBus() *sam.ADC_Type {
@@ -485,7 +628,6 @@ var (
 )
 
 const (
-	sampleRate16X  = 16
 	lsbFirst       = 1
 	sercomRXPad0   = 0
 	sercomRXPad1   = 1
@@ -618,13 +760,18 @@ func (uart UART) Configure(config UARTConfig) {
 	}
 }
 
+// Close disables the UART. It can be enabled again with Configure.
+func (uart UART) Close() error {
+	uart.Bus.INTENCLR.Set(sam.SERCOM_USART_INT_INTENCLR_RXC)
+	uart.Bus.CTRLA.ClearBits(sam.SERCOM_USART_INT_CTRLA_ENABLE)
+	for uart.Bus.SYNCBUSY.HasBits(sam.SERCOM_USART_INT_SYNCBUSY_ENABLE) {
+	}
+	return nil
+}
+
 // SetBaudRate sets the communication speed for the UART.
 func (uart UART) SetBaudRate(br uint32) {
-	// Asynchronous fractional mode (Table 24-2 in datasheet)
-	//   BAUD = fref / (sampleRateValue * fbaud)
-	// (multiply by 8, to calculate fractional piece)
-	// uint32_t baudTimes8 = (SystemCoreClock * 8) / (16 * baudrate);
-	baud := (SERCOM_FREQ_REF * 8) / (sampleRate16X * br)
+	baud := uartBaudTimes8(SERCOM_FREQ_REF, br)
 
 	// sercom->USART.BAUD.FRAC.FP   = (baudTimes8 % 8);
 	// sercom->USART.BAUD.FRAC.BAUD = (baudTimes8 / 8);
@@ -632,6 +779,17 @@ func (uart UART) SetBaudRate(br uint32) {
 		((baud / 8) << sam.SERCOM_USART_INT_BAUD_FRAC_MODE_BAUD_Pos)))
 }
 
+// ActualBaudRate returns the communication speed that the UART actually
+// uses, as configured with SetBaudRate. It differs slightly from the requested
+// baud rate because the BAUD register has a resolution of 1/8th of the
+// reference clock period, for example 115385 instead of 115200 (an error of
+// 0.16%). An error of up to about 2% is usually tolerated by receivers.
+func (uart UART) ActualBaudRate() uint32 {
+	reg := uint32(uart.Bus.BAUD.Get())
+	baud := ((reg>>sam.SERCOM_USART_INT_BAUD_FRAC_MODE_BAUD_Pos)&0x1fff)*8 + (reg>>sam.SERCOM_USART_INT_BAUD_FRAC_MODE_FP_Pos)&0x7
+	return uartBaudRate(SERCOM_FREQ_REF, baud)
+}
+
 // WriteByte writes a byte of data to the UART.
 func (uart UART) WriteByte(c byte) error {
 	// wait until ready to receive
@@ -641,6 +799,19 @@ func (uart UART) WriteByte(c byte) error {
 	return nil
 }
 
+// handleInterrupt stores the received byte in the RX buffer.
+//
+// The SERCOM has no receive FIFO, so there is one interrupt per byte. The
+// 32-bit data extension (CTRLC.DATA32B) can deliver four bytes per interrupt,
+// but it is not used: there is no receive timeout or idle line interrupt, so
+// the last one to three bytes of a message would stay in the peripheral until
+// more data arrives, which is only usable when the message length is known in
+// advance (see the LENGTH register).
+func (uart UART) handleInterrupt() {
+	uart.Receive(byte((uart.Bus.DATA.Get() & 0xFF)))
+	uart.Bus.INTFLAG.SetBits(sam.SERCOM_USART_INT_INTFLAG_RXC)
+}
+
 //go:export SERCOM3_0_IRQHandler
 func handleSERCOM3_0() {
 	handleUART1()
@@ -662,9 +833,7 @@ func handleSERCOM3_OTHER() {
 }
 
 func handleUART1() {
-	// should reset IRQ
-	UART1.Receive(byte((UART1.Bus.DATA.Get() & 0xFF)))
-	UART1.Bus.INTFLAG.SetBits(sam.SERCOM_USART_INT_INTFLAG_RXC)
+	UART1.handleInterrupt()
 }
 
 //go:export SERCOM0_0_IRQHandler
@@ -688,9 +857,7 @@ func handleSERCOM0_OTHER() {
 }
 
 func handleUART2() {
-	// should reset IRQ
-	UART2.Receive(byte((UART2.Bus.DATA.Get() & 0xFF)))
-	UART2.Bus.INTFLAG.SetBits(sam.SERCOM_USART_INT_INTFLAG_RXC)
+	UART2.handleInterrupt()
 }
 
 // I2C on the SAMD51.
@@ -935,11 +1102,13 @@ type SPI struct {
 	SCK         Pin
 	MOSI        Pin
 	MISO        Pin
+	SS          Pin // only used in slave mode
 	DOpad       int
 	DIpad       int
 	SCKPinMode  PinMode
 	MOSIPinMode PinMode
 	MISOPinMode PinMode
+	SSPinMode   PinMode
 }
 
 // SPIConfig is used to store config info for SPI.
@@ -1550,6 +1719,8 @@ func handleUSBIRQ() {
 			case usb_CDC_ENDPOINT_IN, usb_CDC_ENDPOINT_ACM:
 				setEPSTATUSCLR(i, sam.USB_DEVICE_ENDPOINT_EPSTATUSCLR_BK1RDY)
 				setEPINTFLAG(i, sam.USB_DEVICE_ENDPOINT_EPINTFLAG_TRCPT1)
+			default:
+				handleUSBEndpoint(i, epFlags)
 			}
 		}
 	}
@@ -1587,7 +1758,20 @@ func initEndpoint(ep, config uint32) {
 		setEPSTATUSCLR(ep, sam.USB_DEVICE_ENDPOINT_EPSTATUSCLR_BK0RDY)
 
 	case usb_ENDPOINT_TYPE_INTERRUPT | usbEndpointOut:
-		// TODO: not really anything, seems like...
+		// set packet size
+		usbEndpointDescriptors[ep].DeviceDescBank[0].PCKSIZE.SetBits(epPacketSize(64) << usb_DEVICE_PCKSIZE_SIZE_Pos)
+
+		// set data buffer address
+		usbEndpointDescriptors[ep].DeviceDescBank[0].ADDR.Set(uint32(uintptr(unsafe.Pointer(&udd_ep_out_cache_buffer[ep]))))
+
+		// set endpoint type
+		setEPCFG(ep, ((usb_ENDPOINT_TYPE_INTERRUPT + 1) << sam.USB_DEVICE_ENDPOINT_EPCFG_EPTYPE0_Pos))
+
+		// set byte count to zero, we have not received anything yet
+		usbEndpointDescriptors[ep].DeviceDescBank[0].PCKSIZE.ClearBits(usb_DEVICE_PCKSIZE_BYTE_COUNT_Mask << usb_DEVICE_PCKSIZE_BYTE_COUNT_Pos)
+
+		// ready for next transfer
+		setEPSTATUSCLR(ep, sam.USB_DEVICE_ENDPOINT_EPSTATUSCLR_BK0RDY)
 
 	case usb_ENDPOINT_TYPE_BULK | usbEndpointIn:
 		// set packet size
@@ -1709,7 +1893,11 @@ func handleStandardSetup(setup usbSetup) bool {
 	case usb_SET_CONFIGURATION:
 		if setup.bmRequestType&usb_REQUEST_RECIPIENT == usb_REQUEST_DEVICE {
 			for i := 1; i < len(endPoints); i++ {
-				initEndpoint(uint32(i), endPoints[i])
+				if i >= usbFirstCustomEndpoint {
+					initUSBEndpoint(uint32(i))
+				} else {
+					initEndpoint(uint32(i), endPoints[i])
+				}
 			}
 
 			usbConfiguration = setup.wValueL
@@ -1917,8 +2105,8 @@ func sendDescriptor(setup usbSetup) {
 // sendConfiguration creates and sends the configuration packet to the host.
 func sendConfiguration(setup usbSetup) {
 	if setup.wLength == 9 {
-		sz := uint16(configDescriptorSize + cdcSize)
-		config := NewConfigDescriptor(sz, 2)
+		sz := uint16(configDescriptorSize + cdcSize + len(usbExtraDescriptors))
+		config := NewConfigDescriptor(sz, 2+usbExtraInterfaces)
 		sendUSBPacket(0, config.Bytes())
 	} else {
 		iad := NewIADDescriptor(0, 2, usb_CDC_COMMUNICATION_INTERFACE_CLASS, usb_CDC_ABSTRACT_CONTROL_MODEL, 0)
@@ -1952,12 +2140,13 @@ func sendConfiguration(setup usbSetup) {
 			out,
 			in)
 
-		sz := uint16(configDescriptorSize + cdcSize)
-		config := NewConfigDescriptor(sz, 2)
+		sz := uint16(configDescriptorSize + cdcSize + len(usbExtraDescriptors))
+		config := NewConfigDescriptor(sz, 2+usbExtraInterfaces)
 
 		buf := make([]byte, 0)
 		buf = append(buf, config.Bytes()...)
 		buf = append(buf, cdc.Bytes()...)
+		buf = append(buf, usbExtraDescriptors...)
 
 		sendUSBPacket(0, buf)
 	}
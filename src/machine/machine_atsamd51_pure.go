@@ -0,0 +1,427 @@
+// +build sam,atsamd51 test,!baremetal
+
+package machine
+
+// This file contains the parts of the atsamd51 support that don't access the
+// hardware. It is also built for tests on the host, so that it can be tested
+// with "tinygo test machine".
+
+import "errors"
+
+// Conversion of the temperature sensor readings, see temperature_atsamd51.go.
+
+// tempCalibration is the factory calibration of the temperature sensor, as
+// stored in the temperature log row. The temperatures are in 0.1°C and the
+// sensor values are 12-bit ADC readings at those temperatures.
+type tempCalibration struct {
+	tl, th   int64 // low and high calibration temperature
+	vpl, vph int64 // PTAT sensor at the low and high temperature
+	vcl, vch int64 // CTAT sensor at the low and high temperature
+}
+
+// readTempCalibration decodes the temperature log row, which is stored as
+// three 32-bit words. See the "NVM Software Calibration Area Mapping" table in
+// the datasheet for the layout.
+func readTempCalibration(log [3]uint32) tempCalibration {
+	tli := int64(log[0] & 0xff)
+	tld := int64(log[0] >> 8 & 0xf)
+	thi := int64(log[0] >> 12 & 0xff)
+	thd := int64(log[0] >> 20 & 0xf)
+	return tempCalibration{
+		tl:  tli*10 + tld,
+		th:  thi*10 + thd,
+		vpl: int64(log[1] >> 8 & 0xfff),
+		vph: int64(log[1] >> 20 & 0xfff),
+		vcl: int64(log[2] & 0xfff),
+		vch: int64(log[2] >> 12 & 0xfff),
+	}
+}
+
+// millicelsius converts the PTAT and CTAT sensor readings to a temperature,
+// using the formula from the temperature sensor section of the ADC chapter of
+// the datasheet. The result doesn't depend on the ADC reference voltage, as
+// long as both readings use the same reference.
+func (cal tempCalibration) millicelsius(tp, tc int64) int32 {
+	num := cal.tl*cal.vph*tc - cal.vpl*cal.th*tc - cal.tl*cal.vch*tp + cal.th*cal.vcl*tp
+	den := cal.vcl*tp - cal.vch*tp - cal.vpl*tc + cal.vph*tc
+	// num/den is in 0.1°C.
+	return int32(num * 100 / den)
+}
+
+// Software CRC32, used by crc_atsamd51.go for small buffers and unaligned data.
+
+// Table for the software CRC32 implementation, which processes 4 bits at a
+// time.
+var crc32Table = [16]uint32{
+	0x00000000, 0x1db71064, 0x3b6e20c8, 0x26d930ac,
+	0x76dc4190, 0x6b6b51f4, 0x4db26158, 0x5005713c,
+	0xedb88320, 0xf00f9344, 0xd6d6a3e8, 0xcb61b38c,
+	0x9b64c2b0, 0x86d3d2d4, 0xa00ae278, 0xbdbdf21c,
+}
+
+// crc32Software updates the CRC state with the given bytes.
+func crc32Software(state uint32, data []byte) uint32 {
+	for _, b := range data {
+		state ^= uint32(b)
+		state = state>>4 ^ crc32Table[state&0xf]
+		state = state>>4 ^ crc32Table[state&0xf]
+	}
+	return state
+}
+
+// Fault configuration of the PWM timers, see pwm_fault_atsamd51.go.
+
+// FaultAction is the way a PWM timer reacts to a fault input, see
+// ConfigureFault.
+type FaultAction uint8
+
+const (
+	// FaultShutdown drives all outputs of the timer low as soon as the fault
+	// input becomes active, and keeps them low until the fault is cleared with
+	// ClearFault. This is the non-recoverable fault of the TCC, meant for
+	// example for overcurrent protection.
+	FaultShutdown FaultAction = iota
+
+	// FaultCycleByCycle halts the timer while the fault input is active, which
+	// disables the outputs until the end of the PWM cycle in which the fault
+	// went away. The timer then resumes by itself. This is the recoverable
+	// fault of the TCC, meant for example for cycle-by-cycle current limiting.
+	FaultCycleByCycle
+)
+
+// Event system IDs of the other TCC event inputs, relative to event input 0.
+const (
+	evsysUserTCCEV1 = 1
+	evsysUserTCCMC0 = 2
+)
+
+// Bits in the TCC registers that configure the fault handling.
+const (
+	tccEvctrlEvact1Fault = 7 << 3 // non-recoverable fault on event 1
+	tccEvctrlEvact1Msk   = 7 << 3
+	tccEvctrlTCEI1       = 1 << 15
+	tccEvctrlMCEI0       = 1 << 16 // recoverable fault A on match/capture event 0
+	tccFctrlSrcEnable    = 1 << 0
+	tccFctrlKeep         = 1 << 3
+	tccFctrlRestart      = 1 << 7
+	tccFctrlHaltHW       = 1 << 8
+	tccDrvctrlNREMsk     = 0xff << 0 // enable the non-recoverable output state
+	tccDrvctrlNRVMsk     = 0xff << 8 // value of the outputs in that state
+)
+
+// faultRegisters returns the event input of the timer (relative to event input
+// 0) that must receive the fault event, and the new values of the EVCTRL,
+// FCTRLA and DRVCTRL registers of the timer for the given fault action. The
+// other bits of EVCTRL and DRVCTRL are kept from their current values.
+func faultRegisters(action FaultAction, evctrl, drvctrl uint32) (user, newEvctrl, fctrla, newDrvctrl uint32) {
+	evctrl &^= tccEvctrlEvact1Msk | tccEvctrlTCEI1 | tccEvctrlMCEI0
+	if action == FaultShutdown {
+		// Non-recoverable fault on event 1, which drives all outputs low.
+		newEvctrl = evctrl | tccEvctrlEvact1Fault | tccEvctrlTCEI1
+		newDrvctrl = drvctrl&^tccDrvctrlNRVMsk | tccDrvctrlNREMsk
+		return evsysUserTCCEV1, newEvctrl, 0, newDrvctrl
+	}
+	// Recoverable fault A on match/capture event 0, which halts the timer
+	// while it is active.
+	fctrla = tccFctrlSrcEnable | tccFctrlKeep | tccFctrlRestart | tccFctrlHaltHW
+	return evsysUserTCCMC0, evctrl | tccEvctrlMCEI0, fctrla, drvctrl &^ tccDrvctrlNREMsk
+}
+
+// Timer settings of one-shot pulses, see pwm_pulse_atsamd51.go.
+
+var (
+	ErrPWMPulseTooShort = errors.New("machine: PWM pulse shorter than the timer resolution")
+	ErrPWMPulseTooLong  = errors.New("machine: PWM pulse too long for the timer")
+)
+
+// tccPrescalers are the clock dividers of the TCC, indexed by the value of the
+// PRESCALER field in CTRLA.
+var tccPrescalers = [...]uint64{1, 2, 4, 8, 16, 64, 256, 1024}
+
+// pulseTicks calculates the prescaler setting and the number of timer ticks
+// (the compare value) for a pulse of the given width in nanoseconds, with a
+// timer clock of the given frequency. It uses the smallest prescaler, for the
+// best resolution, with which the pulse fits in the 16-bit counter.
+func pulseTicks(widthns, frequency uint32) (prescaler, ticks uint32, err error) {
+	for i, div := range tccPrescalers {
+		// Round to the nearest number of ticks.
+		n := (uint64(widthns)*uint64(frequency) + div*1e9/2) / (div * 1e9)
+		if n == 0 {
+			// Only possible with the smallest prescaler, as the ticks get
+			// fewer with larger prescalers.
+			return 0, 0, ErrPWMPulseTooShort
+		}
+		if n <= 0xffff {
+			return uint32(i), uint32(n), nil
+		}
+	}
+	return 0, 0, ErrPWMPulseTooLong
+}
+
+// Brown-out detector configuration, see brownout_atsamd51.go.
+
+var ErrInvalidBrownoutConfig = errors.New("machine: invalid brown-out detector configuration")
+
+// Bits in the SUPC registers, see the SUPC chapter of the datasheet.
+const (
+	supcBod33Enable    = 1 << 1
+	supcBod33ActionPos = 2
+	supcBod33HystPos   = 8
+	supcBod33LevelPos  = 16
+	supcBod33Rdy       = 1 << 0 // in STATUS, INTFLAG and INTENSET
+	supcBod33Det       = 1 << 1 // in STATUS, INTFLAG and INTENSET
+)
+
+// BrownoutAction is what the brown-out detector does when the supply voltage
+// drops below the threshold.
+type BrownoutAction uint8
+
+const (
+	// BrownoutNone only monitors the supply voltage, see Brownout.
+	BrownoutNone BrownoutAction = 0
+
+	// BrownoutReset keeps the chip in reset while the supply voltage is too
+	// low. ResetReason returns ResetBrownout after such a reset.
+	BrownoutReset BrownoutAction = 1
+
+	// BrownoutInterrupt calls BrownoutConfig.Callback (from an interrupt),
+	// for example to finish a flash write or save state before the power is
+	// lost.
+	BrownoutInterrupt BrownoutAction = 2
+)
+
+// BrownoutConfig is the configuration of the brown-out detector of the 3.3V
+// supply (BOD33).
+type BrownoutConfig struct {
+	// Level is the threshold, as the value of the LEVEL field of the BOD33
+	// register. See the BOD33 characteristics in the electrical
+	// characteristics chapter of the datasheet for the matching voltages.
+	// The value is not checked against the minimum voltage of the chip.
+	Level uint8
+
+	// Hysteresis is added to the threshold when the supply voltage rises
+	// again, to avoid toggling around the threshold. It is the value of the
+	// HYST field, between 0 (no hysteresis) and 15.
+	Hysteresis uint8
+
+	Action BrownoutAction
+
+	// Callback is called on a brown-out with BrownoutInterrupt.
+	Callback func()
+}
+
+// bod33Value returns the value of the BOD33 register (with the enable bit
+// cleared) for the given configuration.
+func bod33Value(config BrownoutConfig) (uint32, error) {
+	if config.Hysteresis > 15 || config.Action > BrownoutInterrupt ||
+		(config.Action == BrownoutInterrupt && config.Callback == nil) {
+		return 0, ErrInvalidBrownoutConfig
+	}
+	return uint32(config.Level)<<supcBod33LevelPos |
+		uint32(config.Hysteresis)<<supcBod33HystPos |
+		uint32(config.Action)<<supcBod33ActionPos, nil
+}
+
+// Fields of the NVM user row, see userrow_atsamd51.go.
+
+// UserRow is a copy of the configuration in the NVM user page (the "fuses"),
+// see the NVM user page mapping in the NVMCTRL chapter of the datasheet. The
+// methods decode some well-known fields.
+type UserRow [32]byte
+
+// bits returns the field of the given number of bits that starts at the given
+// bit of the user row.
+func (row *UserRow) bits(pos, width uint) uint32 {
+	word := uint64(0)
+	for i := uint(0); i < 8; i++ {
+		if pos/8+i < uint(len(row)) {
+			word |= uint64(row[pos/8+i]) << (i * 8)
+		}
+	}
+	return uint32(word>>(pos%8)) & (1<<width - 1)
+}
+
+// BootProtection returns the size in bytes of the protected bootloader region
+// at the start of the flash (the BOOTPROT field). It is 0 when the bootloader
+// is not protected.
+func (row *UserRow) BootProtection() uint32 {
+	return (15 - row.bits(26, 4)) * 8192
+}
+
+// Brownout returns the configuration of the 3.3V brown-out detector at reset,
+// and whether it is enabled. See ConfigureBrownout to change it at runtime.
+func (row *UserRow) Brownout() (config BrownoutConfig, enabled bool) {
+	config.Level = uint8(row.bits(1, 8))
+	config.Action = BrownoutAction(row.bits(9, 2))
+	config.Hysteresis = uint8(row.bits(11, 4))
+	return config, row.bits(0, 1) == 0
+}
+
+// SmartEEPROM returns the number of flash blocks reserved for the SmartEEPROM
+// (the SEESBLK field) and the raw page size setting (the SEEPSZ field).
+func (row *UserRow) SmartEEPROM() (blocks, pageSize uint8) {
+	return uint8(row.bits(32, 4)), uint8(row.bits(36, 3))
+}
+
+// WatchdogEnabled returns whether the watchdog is enabled at reset.
+func (row *UserRow) WatchdogEnabled() bool {
+	return row.bits(48, 1) != 0
+}
+
+// WatchdogAlwaysOn returns whether the watchdog is always on, in which case it
+// can't be disabled by software.
+func (row *UserRow) WatchdogAlwaysOn() bool {
+	return row.bits(49, 1) != 0
+}
+
+// WatchdogPeriod returns the raw timeout period setting of the watchdog at
+// reset (the PER field), see the WDT chapter of the datasheet.
+func (row *UserRow) WatchdogPeriod() uint8 {
+	return uint8(row.bits(50, 4))
+}
+
+// RegionLocks returns the lock bits of the 32 flash regions at reset. A
+// cleared bit means that the region is locked.
+func (row *UserRow) RegionLocks() uint32 {
+	return row.bits(64, 32)
+}
+
+// Register values of the I2S configuration, see i2s_atsamd51.go.
+
+var ErrInvalidI2SConfig = errors.New("machine: unsupported I2S configuration")
+
+// Fields in the CLKCTRL registers of the I2S clock units.
+const (
+	i2sClkctrlSlotsizePos = 0
+	i2sClkctrlNbslotsPos  = 2
+	i2sClkctrlFswidthHalf = 1 << 5 // frame sync is high for half a frame
+	i2sClkctrlBitdelayI2S = 1 << 7 // data starts one bit after frame sync
+	i2sClkctrlFsselFSPin  = 1 << 8
+	i2sClkctrlScksckPin   = 1 << 11
+	i2sClkctrlMckdivPos   = 16
+	i2sClkctrlMckdivMax   = 64
+)
+
+// Fields in the TXCTRL and RXCTRL registers of the serializers.
+const (
+	i2sSerctrlSlotadjLeft = 1 << 7
+	i2sSerctrlDatasizePos = 8
+	i2sSerctrlMono        = 1 << 24
+	i2sDatasize32         = 0
+	i2sDatasize24         = 1
+	i2sDatasize16         = 4
+	i2sDatasize8          = 6
+)
+
+// As the I2S master, the bit clock is derived from the 48MHz DFLL, divided by
+// the GCLK generator and by MCKDIV.
+const (
+	i2sClockFrequency      = 48000000
+	i2sGCLKGeneratorDivMax = 255
+)
+
+// i2sRegisters returns the value of the CLKCTRL register of the clock unit,
+// the value of the TXCTRL and RXCTRL registers of the serializers and the
+// division factor of the GCLK generator for the given configuration. The
+// defaults of the configuration must already have been filled in.
+func i2sRegisters(config I2SConfig) (clkctrl, serctrl, gclkDiv uint32, err error) {
+	if config.Mode == I2SModePDM || config.MasterClockOutput {
+		return 0, 0, 0, ErrInvalidI2SConfig
+	}
+
+	// Frames always consist of two slots (left and right), of the same size
+	// as the samples.
+	var slotsize, datasize uint32
+	switch config.DataFormat {
+	case I2SDataFormat8bit:
+		slotsize, datasize = 0, i2sDatasize8
+	case I2SDataFormat16bit:
+		slotsize, datasize = 1, i2sDatasize16
+	case I2SDataFormat24bit:
+		slotsize, datasize = 2, i2sDatasize24
+	case I2SDataFormat32bit:
+		slotsize, datasize = 3, i2sDatasize32
+	default:
+		return 0, 0, 0, ErrInvalidI2SConfig
+	}
+	clkctrl = slotsize<<i2sClkctrlSlotsizePos | 1<<i2sClkctrlNbslotsPos | i2sClkctrlFswidthHalf
+	if config.Standard == I2StandardPhilips {
+		clkctrl |= i2sClkctrlBitdelayI2S
+	}
+	serctrl = datasize << i2sSerctrlDatasizePos
+	if config.Standard != I2SStandardLSB {
+		serctrl |= i2sSerctrlSlotadjLeft
+	}
+	if !config.Stereo {
+		serctrl |= i2sSerctrlMono
+	}
+
+	if config.Mode == I2SModeSlave || config.ClockSource == I2SClockSourceExternal {
+		clkctrl |= i2sClkctrlScksckPin | i2sClkctrlFsselFSPin
+		return clkctrl, serctrl, 1, nil
+	}
+	sck := config.AudioFrequency * 2 * uint32(config.DataFormat)
+	div := (i2sClockFrequency + sck/2) / sck
+	if div == 0 || div > i2sGCLKGeneratorDivMax*i2sClkctrlMckdivMax {
+		return 0, 0, 0, ErrInvalidI2SConfig
+	}
+	mckDiv := (div + i2sGCLKGeneratorDivMax - 1) / i2sGCLKGeneratorDivMax
+	gclkDiv = (div + mckDiv/2) / mckDiv
+	clkctrl |= (mckDiv - 1) << i2sClkctrlMckdivPos
+	return clkctrl, serctrl, gclkDiv, nil
+}
+
+// Scaling and averaging of ADC results, see machine_atsamd51.go.
+
+// adcResolution is the resolution in bits of ADC results, both of single
+// conversions (as configured in CTRLB by InitADC) and of averaged conversions.
+const adcResolution = 12
+
+// adcScale scales a raw ADC result to the range 0..0xffff returned by Get.
+func adcScale(val uint16) uint16 {
+	return val << (16 - adcResolution)
+}
+
+// adcAveraging returns the AVGCTRL SAMPLENUM and ADJRES values for the given
+// number of samples, see the AVGCTRL register description in the datasheet.
+// The result is always a 12-bit value. It panics if the number of samples is
+// not supported.
+func adcAveraging(samples uint32) (samplenum, adjres uint8) {
+	for samplenum = 0; samplenum <= 10; samplenum++ {
+		if samples == 1<<samplenum {
+			adjres = samplenum
+			if adjres > 4 {
+				// The result is automatically shifted right for more than 16
+				// samples.
+				adjres = 4
+			}
+			return
+		}
+	}
+	panic("machine: invalid number of ADC samples")
+}
+
+// Conversions of ReadSequence, see machine_atsamd51.go.
+
+// adcInputctrlMuxposMsk is the MUXPOS field (the positive input) of the
+// INPUTCTRL register of the ADC.
+const adcInputctrlMuxposMsk = 0x1f
+
+// adcSequence does the conversions of ReadSequence, storing the scaled
+// results in order. The channel function returns the ADC channel of the i-th
+// result. The convert function writes the given INPUTCTRL value, which selects
+// the channel and keeps the other fields of inputctrl, does the given number
+// of conversions and returns the result of the last one. The first conversion
+// after enabling the ADC is invalid (see read), so the first channel is
+// converted twice.
+func adcSequence(results []uint16, inputctrl uint16, channel func(i int) uint8, convert func(inputctrl uint16, conversions int) uint16) {
+	inputctrl &^= adcInputctrlMuxposMsk
+	for i := range results {
+		conversions := 1
+		if i == 0 {
+			conversions = 2
+		}
+		val := convert(inputctrl|uint16(channel(i))&adcInputctrlMuxposMsk, conversions)
+		results[i] = adcScale(val)
+	}
+}
@@ -0,0 +1,352 @@
+// +build sam,atsamd51 test,!baremetal
+
+package machine
+
+import "testing"
+
+// Temperature log row with a calibration at 25.3°C and 85.7°C.
+var testTempLog = [3]uint32{0x00755319, 0x6b05a000, 0x007d08c0}
+
+func TestReadTempCalibration(t *testing.T) {
+	cal := readTempCalibration(testTempLog)
+	expected := tempCalibration{
+		tl:  253,
+		th:  857,
+		vpl: 0x5a0,
+		vph: 0x6b0,
+		vcl: 0x8c0,
+		vch: 0x7d0,
+	}
+	if cal != expected {
+		t.Errorf("readTempCalibration: got %+v, expected %+v", cal, expected)
+	}
+}
+
+func TestMillicelsius(t *testing.T) {
+	cal := readTempCalibration(testTempLog)
+	for _, tc := range []struct {
+		tp, tc       int64
+		millicelsius int32
+	}{
+		{0x5a0, 0x8c0, 25300}, // readings at the low calibration temperature
+		{0x6b0, 0x7d0, 85700}, // readings at the high calibration temperature
+		{0x620, 0x850, 53630},
+	} {
+		if result := cal.millicelsius(tc.tp, tc.tc); result != tc.millicelsius {
+			t.Errorf("millicelsius(%#x, %#x) = %d, expected %d", tc.tp, tc.tc, result, tc.millicelsius)
+		}
+	}
+}
+
+func TestCRC32Software(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	for _, tc := range []struct {
+		data []byte
+		crc  uint32
+	}{
+		{nil, 0},
+		{[]byte("123456789"), 0xcbf43926}, // the usual check value
+		{[]byte("The quick brown fox jumps over the lazy dog"), 0x414fa339},
+		{all, 0x29058c73},
+	} {
+		if crc := ^crc32Software(^uint32(0), tc.data); crc != tc.crc {
+			t.Errorf("CRC32 of %q is %#08x, expected %#08x", tc.data, crc, tc.crc)
+		}
+
+		// The state can be updated in parts, as is done for the unaligned
+		// start and end of a buffer.
+		for split := 0; split <= len(tc.data); split++ {
+			state := crc32Software(^uint32(0), tc.data[:split])
+			if crc := ^crc32Software(state, tc.data[split:]); crc != tc.crc {
+				t.Errorf("CRC32 of %q split at %d is %#08x, expected %#08x", tc.data, split, crc, tc.crc)
+			}
+		}
+	}
+}
+
+func TestFaultRegisters(t *testing.T) {
+	for _, tc := range []struct {
+		action     FaultAction
+		evctrl     uint32
+		drvctrl    uint32
+		user       uint32
+		newEvctrl  uint32
+		fctrla     uint32
+		newDrvctrl uint32
+	}{
+		// Switch from a cycle-by-cycle fault to a shutdown. The inverted
+		// outputs and the other event settings must be kept.
+		{FaultShutdown, 0x10001, 0x00ff0300, 1, 0x8039, 0, 0x00ff00ff},
+		// And back again.
+		{FaultCycleByCycle, 0x8039, 0x00ff00ff, 2, 0x10001, 0x189, 0x00ff0000},
+	} {
+		user, evctrl, fctrla, drvctrl := faultRegisters(tc.action, tc.evctrl, tc.drvctrl)
+		if user != tc.user || evctrl != tc.newEvctrl || fctrla != tc.fctrla || drvctrl != tc.newDrvctrl {
+			t.Errorf("faultRegisters(%d, %#x, %#x) = %d, %#x, %#x, %#x, expected %d, %#x, %#x, %#x",
+				tc.action, tc.evctrl, tc.drvctrl, user, evctrl, fctrla, drvctrl,
+				tc.user, tc.newEvctrl, tc.fctrla, tc.newDrvctrl)
+		}
+	}
+}
+
+func TestPulseTicks(t *testing.T) {
+	for _, tc := range []struct {
+		widthns   uint32
+		frequency uint32
+		prescaler uint32
+		ticks     uint32
+		err       error
+	}{
+		{4, 120e6, 0, 0, ErrPWMPulseTooShort}, // less than half a cycle
+		{5, 120e6, 0, 1, nil},
+		{1000, 120e6, 0, 120, nil},
+		{1000, 48e6, 0, 48, nil},
+		{546125, 120e6, 0, 0xffff, nil}, // longest pulse without prescaler
+		{546134, 120e6, 1, 32768, nil},
+		{1000000, 120e6, 1, 60000, nil},
+		{100000000, 120e6, 6, 46875, nil},
+		{559232000, 120e6, 7, 0xffff, nil}, // longest possible pulse
+		{559237000, 120e6, 0, 0, ErrPWMPulseTooLong},
+	} {
+		prescaler, ticks, err := pulseTicks(tc.widthns, tc.frequency)
+		if err != tc.err {
+			t.Errorf("pulseTicks(%d, %d): expected error %v, got %v", tc.widthns, tc.frequency, tc.err, err)
+		} else if prescaler != tc.prescaler || ticks != tc.ticks {
+			t.Errorf("pulseTicks(%d, %d) = %d, %d, expected %d, %d", tc.widthns, tc.frequency, prescaler, ticks, tc.prescaler, tc.ticks)
+		}
+	}
+}
+
+func TestBOD33Value(t *testing.T) {
+	callback := func() {}
+	for _, tc := range []struct {
+		config BrownoutConfig
+		value  uint32
+	}{
+		{BrownoutConfig{}, 0},
+		{BrownoutConfig{Level: 0xff, Action: BrownoutNone}, 0x00ff0000},
+		{BrownoutConfig{Level: 0xd0, Hysteresis: 3, Action: BrownoutReset}, 0x00d00304},
+		{BrownoutConfig{Level: 0x1c, Hysteresis: 15, Action: BrownoutInterrupt, Callback: callback}, 0x001c0f08},
+	} {
+		value, err := bod33Value(tc.config)
+		if err != nil {
+			t.Errorf("bod33Value(%+v): unexpected error: %v", tc.config, err)
+		} else if value != tc.value {
+			t.Errorf("bod33Value(%+v) = %#08x, expected %#08x", tc.config, value, tc.value)
+		}
+		if value&supcBod33Enable != 0 {
+			t.Errorf("bod33Value(%+v) sets the enable bit", tc.config)
+		}
+	}
+}
+
+func TestBOD33ValueInvalid(t *testing.T) {
+	for _, config := range []BrownoutConfig{
+		{Hysteresis: 16},
+		{Action: BrownoutInterrupt + 1},
+		{Action: BrownoutInterrupt}, // without callback
+	} {
+		if _, err := bod33Value(config); err != ErrInvalidBrownoutConfig {
+			t.Errorf("bod33Value(%+v): expected ErrInvalidBrownoutConfig, got %v", config, err)
+		}
+	}
+}
+
+// User row with a different value in each of the decoded fields.
+var testUserRow = UserRow{
+	0x38, 0x12, 0x00, 0x34, 0x21, 0x00, 0x2d, 0x00,
+	0xfe, 0xff, 0xff, 0xff,
+}
+
+func TestUserRowFields(t *testing.T) {
+	row := testUserRow
+	if size := row.BootProtection(); size != 16384 {
+		t.Errorf("BootProtection: got %d, expected 16384", size)
+	}
+	config, enabled := row.Brownout()
+	if !enabled || config.Level != 0x1c || config.Action != BrownoutReset || config.Hysteresis != 2 {
+		t.Errorf("Brownout: got %+v (enabled: %v), expected level 0x1c, reset action and hysteresis 2 (enabled)", config, enabled)
+	}
+	if blocks, pageSize := row.SmartEEPROM(); blocks != 1 || pageSize != 2 {
+		t.Errorf("SmartEEPROM: got %d blocks with page size %d, expected 1 and 2", blocks, pageSize)
+	}
+	if !row.WatchdogEnabled() || row.WatchdogAlwaysOn() || row.WatchdogPeriod() != 0xb {
+		t.Errorf("watchdog: got enabled %v, always on %v, period %#x, expected true, false, 0xb", row.WatchdogEnabled(), row.WatchdogAlwaysOn(), row.WatchdogPeriod())
+	}
+	if locks := row.RegionLocks(); locks != 0xfffffffe {
+		t.Errorf("RegionLocks: got %#08x, expected 0xfffffffe", locks)
+	}
+}
+
+func TestUserRowErased(t *testing.T) {
+	// An erased user row has all bits set.
+	var row UserRow
+	for i := range row {
+		row[i] = 0xff
+	}
+	if size := row.BootProtection(); size != 0 {
+		t.Errorf("BootProtection: got %d, expected 0", size)
+	}
+	if _, enabled := row.Brownout(); enabled {
+		t.Error("Brownout: expected the brown-out detector to be disabled")
+	}
+	if locks := row.RegionLocks(); locks != 0xffffffff {
+		t.Errorf("RegionLocks: got %#08x, expected no locked regions", locks)
+	}
+}
+
+func TestI2SRegisters(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		config  I2SConfig
+		clkctrl uint32
+		serctrl uint32
+		gclkDiv uint32
+		rate    uint32 // resulting sample rate as the master
+	}{
+		{
+			name:    "44.1kHz 16-bit stereo",
+			config:  I2SConfig{AudioFrequency: 44100, DataFormat: I2SDataFormat16bit, Stereo: true},
+			clkctrl: 0xa5,  // 16-bit slots, 2 slots, half-frame sync, 1-bit delay
+			serctrl: 0x480, // 16-bit data, left-adjusted
+			gclkDiv: 34,
+			rate:    44117,
+		},
+		{
+			name:    "48kHz 32-bit stereo",
+			config:  I2SConfig{AudioFrequency: 48000, DataFormat: I2SDataFormat32bit, Stereo: true},
+			clkctrl: 0xa7,
+			serctrl: 0x080,
+			gclkDiv: 16,
+			rate:    46875,
+		},
+		{
+			name:    "8kHz 8-bit mono",
+			config:  I2SConfig{AudioFrequency: 8000, DataFormat: I2SDataFormat8bit},
+			clkctrl: 0x100a4, // MCKDIV divides by 2
+			serctrl: 0x1000680,
+			gclkDiv: 188,
+			rate:    7978,
+		},
+		{
+			name:    "slave 16-bit stereo, MSB justified",
+			config:  I2SConfig{Mode: I2SModeSlave, Standard: I2SStandardMSB, AudioFrequency: 44100, DataFormat: I2SDataFormat16bit, Stereo: true},
+			clkctrl: 0x925, // bit clock and frame sync from the pins
+			serctrl: 0x480,
+			gclkDiv: 1,
+		},
+	} {
+		clkctrl, serctrl, gclkDiv, err := i2sRegisters(tc.config)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if clkctrl != tc.clkctrl || serctrl != tc.serctrl || gclkDiv != tc.gclkDiv {
+			t.Errorf("%s: got CLKCTRL %#x, TXCTRL/RXCTRL %#x, GCLK divider %d, expected %#x, %#x, %d", tc.name, clkctrl, serctrl, gclkDiv, tc.clkctrl, tc.serctrl, tc.gclkDiv)
+		}
+		if tc.rate != 0 {
+			mckDiv := clkctrl>>i2sClkctrlMckdivPos + 1
+			rate := i2sClockFrequency / (gclkDiv * mckDiv) / (2 * uint32(tc.config.DataFormat))
+			if rate != tc.rate {
+				t.Errorf("%s: sample rate is %dHz, expected %dHz", tc.name, rate, tc.rate)
+			}
+		}
+	}
+}
+
+func TestI2SRegistersInvalid(t *testing.T) {
+	for _, config := range []I2SConfig{
+		{Mode: I2SModePDM, AudioFrequency: 48000, DataFormat: I2SDataFormat16bit},
+		{MasterClockOutput: true, AudioFrequency: 48000, DataFormat: I2SDataFormat16bit},
+		{AudioFrequency: 48000, DataFormat: 12},
+		{AudioFrequency: 1, DataFormat: I2SDataFormat16bit}, // bit clock too slow
+	} {
+		if _, _, _, err := i2sRegisters(config); err != ErrInvalidI2SConfig {
+			t.Errorf("i2sRegisters(%+v): expected ErrInvalidI2SConfig, got %v", config, err)
+		}
+	}
+}
+
+func TestADCScale(t *testing.T) {
+	for _, tc := range []struct {
+		val    uint16
+		scaled uint16
+	}{
+		{0, 0},
+		{1, 0x10},
+		{0x800, 0x8000},
+		{0xfff, 0xfff0},
+	} {
+		if scaled := adcScale(tc.val); scaled != tc.scaled {
+			t.Errorf("adcScale(%#x) = %#x, expected %#x", tc.val, scaled, tc.scaled)
+		}
+	}
+}
+
+func TestADCAveraging(t *testing.T) {
+	for _, tc := range []struct {
+		samples   uint32
+		samplenum uint8
+		adjres    uint8
+	}{
+		{1, 0, 0},
+		{2, 1, 1},
+		{16, 4, 4},
+		{32, 5, 4},
+		{1024, 10, 4},
+	} {
+		samplenum, adjres := adcAveraging(tc.samples)
+		if samplenum != tc.samplenum || adjres != tc.adjres {
+			t.Errorf("adcAveraging(%d) = %d, %d, expected %d, %d", tc.samples, samplenum, adjres, tc.samplenum, tc.adjres)
+			continue
+		}
+
+		// Do what the ADC does with the accumulated conversions: shift the
+		// sum right for more than 16 samples, so that it fits in 16 bits, and
+		// then divide it by 2^ADJRES. The average of a constant input must be
+		// scaled like a single conversion of that input.
+		const val = 0xabc
+		sum := tc.samples * val
+		if samplenum > 4 {
+			sum >>= samplenum - 4
+		}
+		if sum > 0xffff {
+			t.Errorf("%d samples: accumulated result %#x doesn't fit in 16 bits", tc.samples, sum)
+		}
+		average := uint16(sum >> adjres)
+		if scaled := adcScale(average); scaled != adcScale(val) {
+			t.Errorf("%d samples: average is scaled to %#x, expected %#x", tc.samples, scaled, adcScale(val))
+		}
+	}
+}
+
+func TestADCSequence(t *testing.T) {
+	channels := []uint8{4, 0, 19, 4}
+	values := map[uint8]uint16{0: 0x123, 4: 0xfff, 19: 0x800}
+	var inputctrls []uint16
+	var conversions []int
+	results := make([]uint16, len(channels))
+	// MUXNEG is set to GND (0x18), MUXPOS to a channel of an earlier read.
+	adcSequence(results, 0x1805, func(i int) uint8 {
+		return channels[i]
+	}, func(inputctrl uint16, n int) uint16 {
+		inputctrls = append(inputctrls, inputctrl)
+		conversions = append(conversions, n)
+		return values[uint8(inputctrl&adcInputctrlMuxposMsk)]
+	})
+
+	for i, ch := range channels {
+		if inputctrls[i] != 0x1800|uint16(ch) {
+			t.Errorf("result %d: INPUTCTRL is %#x, expected %#x", i, inputctrls[i], 0x1800|uint16(ch))
+		}
+		if expected := adcScale(values[ch]); results[i] != expected {
+			t.Errorf("result %d: got %#x, expected %#x", i, results[i], expected)
+		}
+	}
+	if len(conversions) != len(channels) || conversions[0] != 2 || conversions[1] != 1 || conversions[3] != 1 {
+		t.Errorf("unexpected number of conversions per channel: %v", conversions)
+	}
+}
@@ -37,6 +37,12 @@ type UART struct {
 func (uart UART) Configure(config UARTConfig) {
 }
 
+// Close is a dummy implementation. UART has not been implemented for ATtiny
+// devices.
+func (uart UART) Close() error {
+	return nil
+}
+
 // WriteByte is a dummy implementation. UART has not been implemented for ATtiny
 // devices.
 func (uart UART) WriteByte(c byte) error {
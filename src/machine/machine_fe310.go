@@ -67,6 +67,12 @@ func (uart UART) Configure(config UARTConfig) {
 	sifive.UART0.TXCTRL.Set(sifive.UART_TXCTRL_ENABLE)
 }
 
+// Close disables the UART. It can be enabled again with Configure.
+func (uart UART) Close() error {
+	sifive.UART0.TXCTRL.ClearBits(sifive.UART_TXCTRL_ENABLE)
+	return nil
+}
+
 func (uart UART) WriteByte(c byte) {
 	for sifive.UART0.TXDATA.Get()&sifive.UART_TXDATA_FULL != 0 {
 	}
@@ -92,6 +92,16 @@ func (uart UART) Configure(config UARTConfig) {
 	arm.EnableIRQ(nrf.IRQ_UART0)
 }
 
+// Close disables the UART. It can be enabled again with Configure.
+func (uart UART) Close() error {
+	arm.DisableIRQ(nrf.IRQ_UART0)
+	nrf.UART0.INTENCLR.Set(nrf.UART_INTENCLR_RXDRDY_Msk)
+	nrf.UART0.TASKS_STOPTX.Set(1)
+	nrf.UART0.TASKS_STOPRX.Set(1)
+	nrf.UART0.ENABLE.Set(nrf.UART_ENABLE_ENABLE_Disabled)
+	return nil
+}
+
 // SetBaudRate sets the communication speed for the UART.
 func (uart UART) SetBaudRate(br uint32) {
 	// Magic: calculate 'baudrate' register from the input number.
@@ -159,6 +159,13 @@ func (uart UART) Configure(config UARTConfig) {
 	arm.EnableIRQ(uart.IRQVal)
 }
 
+// Close disables the UART. It can be enabled again with Configure.
+func (uart UART) Close() error {
+	arm.DisableIRQ(uart.IRQVal)
+	uart.Bus.CR1.Set(0)
+	return nil
+}
+
 // SetBaudRate sets the communication speed for the UART.
 func (uart UART) SetBaudRate(br uint32) {
 	// Note: PCLK2 (from APB2) used for USART1 and PCLK1 for USART2, 3, 4, 5
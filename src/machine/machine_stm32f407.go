@@ -207,6 +207,13 @@ func (uart UART) Configure(config UARTConfig) {
 	arm.EnableIRQ(stm32.IRQ_USART2)
 }
 
+// Close disables the UART. It can be enabled again with Configure.
+func (uart UART) Close() error {
+	arm.DisableIRQ(stm32.IRQ_USART2)
+	stm32.USART2.CR1.Set(0)
+	return nil
+}
+
 // WriteByte writes a byte of data to the UART.
 func (uart UART) WriteByte(c byte) error {
 	stm32.USART2.DR.Set(uint32(c))
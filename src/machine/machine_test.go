@@ -0,0 +1,55 @@
+package machine
+
+import "testing"
+
+func TestNanosecondsToCycles(t *testing.T) {
+	for _, tc := range []struct {
+		ns        uint32
+		frequency uint32
+		cycles    uint32
+	}{
+		{0, 120e6, 0},
+		{1000, 120e6, 120},
+		{1000, 48e6, 48},
+		{1000, 64e6, 64},
+		{20, 48e6, 0}, // shorter than one cycle
+		{21, 48e6, 1},
+		{1234567, 120e6, 148148},
+		{0xffffffff, 120e6, 515396075}, // would overflow without splitting
+	} {
+		if cycles := nanosecondsToCycles(tc.ns, tc.frequency); cycles != tc.cycles {
+			t.Errorf("nanosecondsToCycles(%d, %d) = %d, expected %d", tc.ns, tc.frequency, cycles, tc.cycles)
+		}
+	}
+}
+
+func TestUARTBaudRate(t *testing.T) {
+	for _, tc := range []struct {
+		fref       uint32
+		br         uint32
+		baudTimes8 uint32
+		actual     uint32
+	}{
+		{48e6, 9600, 2500, 9600},
+		{48e6, 115200, 208, 115385},
+		{48e6, 921600, 26, 923077},
+		{48e6, 3000000, 8, 3000000},
+	} {
+		baudTimes8 := uartBaudTimes8(tc.fref, tc.br)
+		if baudTimes8 != tc.baudTimes8 {
+			t.Errorf("uartBaudTimes8(%d, %d) = %d, expected %d", tc.fref, tc.br, baudTimes8, tc.baudTimes8)
+		}
+		actual := uartBaudRate(tc.fref, baudTimes8)
+		if actual != tc.actual {
+			t.Errorf("uartBaudRate(%d, %d) = %d, expected %d", tc.fref, baudTimes8, actual, tc.actual)
+		}
+		// The fractional baud generator should get within 2% of the
+		// requested baud rate.
+		if diff := int64(actual) - int64(tc.br); diff*50 > int64(tc.br) || -diff*50 > int64(tc.br) {
+			t.Errorf("baud rate %d is too far off from the requested %d", actual, tc.br)
+		}
+	}
+	if actual := uartBaudRate(48e6, 0); actual != 0 {
+		t.Errorf("uartBaudRate of a disabled baud generator is %d, expected 0", actual)
+	}
+}
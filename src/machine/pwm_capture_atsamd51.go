@@ -0,0 +1,123 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"device/sam"
+	"errors"
+)
+
+var ErrPWMNoSignal = errors.New("machine: no PWM signal detected")
+
+// Event system IDs, see the EVSYS chapter of the datasheet.
+const (
+	evsysGenEICExtint0 = 0x12 // first of 16 EIC_EXTINTx event generators
+	evsysUserTC0EVU    = 44   // TC0 event user
+	evsysPathAsync     = 2
+	evsysChannelEVGEN  = 0
+	evsysChannelPATH   = 8
+	pwmCaptureChannel  = 0 // event channel used for PWM capture
+)
+
+// Bits in the TC registers in 32-bit mode.
+const (
+	tcCtrlaSwrst       = 1 << 0
+	tcCtrlaEnable      = 1 << 1
+	tcCtrlaModeCount32 = 2 << 2
+	tcCtrlaCapten0     = 1 << 16
+	tcCtrlaCapten1     = 1 << 17
+	tcEvctrlEvactPWP   = 6 << 0 // pulse width in CC0, period in CC1
+	tcEvctrlTCEI       = 1 << 5
+	tcIntflagMC0       = 1 << 4
+	tcIntflagMC1       = 1 << 5
+	tcSyncbusySwrst    = 1 << 0
+	tcSyncbusyEnable   = 1 << 1
+)
+
+// Peripheral channel of the TC0 and TC1 clocks in GCLK.PCHCTRL.
+const gclkPchctrlTC0TC1 = 9
+
+// MeasurePWM measures the frequency (in Hz) and duty cycle (between 0 and 1)
+// of a PWM signal on the given pin. This can be used for example to read fan
+// tachometers or PWM outputs of sensors.
+//
+// The measurement is done in hardware: the pin generates events through the
+// EIC that are routed by the event system to TC0 (combined with TC1 as 32-bit
+// counter), which captures both the pulse width and the period. This means
+// that TC0 and TC1, event channel 0 and the external interrupt of the pin can't
+// be used for anything else while measuring. The external interrupt of most
+// pins is the pin number modulo 16, see the pinout table in the datasheet.
+//
+// It waits for two full periods and returns ErrPWMNoSignal if no complete
+// period was seen within about a second.
+func MeasurePWM(pin Pin) (freq uint64, duty float32, err error) {
+	extint := uint8(pin) & 0xf
+	configurePWMCapture(pin, extint)
+	defer stopPWMCapture(extint)
+
+	// The first capture may be of an incomplete period, so wait for the second
+	// one. Poll the flags with a timeout. Each loop iteration takes more than
+	// 10 cycles.
+	tc := sam.TC0_COUNT32
+	var pulse, period uint32
+	for i := 0; i < 2; i++ {
+		tc.INTFLAG.Set(tcIntflagMC0 | tcIntflagMC1)
+		timeout := CPUFrequency() / 10
+		for !tc.INTFLAG.HasBits(tcIntflagMC0 | tcIntflagMC1) {
+			timeout--
+			if timeout == 0 {
+				return 0, 0, ErrPWMNoSignal
+			}
+		}
+		pulse = tc.CC[0].Get()
+		period = tc.CC[1].Get()
+	}
+	if period == 0 {
+		return 0, 0, ErrPWMNoSignal
+	}
+
+	// The timer runs at the CPU frequency, from the same clock generator.
+	freq = uint64(CPUFrequency()) / uint64(period)
+	duty = float32(pulse) / float32(period)
+	return freq, duty, nil
+}
+
+// configurePWMCapture sets up the EIC, event system and timer for pulse width
+// and period capture of the given pin.
+func configurePWMCapture(pin Pin, extint uint8) {
+	// Enable the clocks of the peripherals.
+	sam.MCLK.APBAMASK.SetBits(sam.MCLK_APBAMASK_EIC_ | sam.MCLK_APBAMASK_TC0_ | sam.MCLK_APBAMASK_TC1_)
+	sam.MCLK.APBBMASK.SetBits(sam.MCLK_APBBMASK_EVSYS_)
+	sam.GCLK.PCHCTRL[gclkPchctrlTC0TC1].Set((sam.GCLK_PCHCTRL_GEN_GCLK0 << sam.GCLK_PCHCTRL_GEN_Pos) |
+		sam.GCLK_PCHCTRL_CHEN)
+
+	configureEventPin(pin, extint, eicSenseHigh)
+
+	// Route the EIC event to TC0.
+	sam.EVSYS.CHANNEL[pwmCaptureChannel].CHANNEL.Set((evsysGenEICExtint0+uint32(extint))<<evsysChannelEVGEN |
+		evsysPathAsync<<evsysChannelPATH)
+	sam.EVSYS.USER[evsysUserTC0EVU].Set(pwmCaptureChannel + 1)
+
+	// Configure TC0 as 32-bit timer (together with TC1) that captures the
+	// pulse width and period on every event.
+	tc := sam.TC0_COUNT32
+	tc.CTRLA.Set(tcCtrlaSwrst)
+	for tc.SYNCBUSY.HasBits(tcSyncbusySwrst) {
+	}
+	tc.CTRLA.Set(tcCtrlaModeCount32 | tcCtrlaCapten0 | tcCtrlaCapten1)
+	tc.EVCTRL.Set(tcEvctrlEvactPWP | tcEvctrlTCEI)
+	tc.CTRLA.SetBits(tcCtrlaEnable)
+	for tc.SYNCBUSY.HasBits(tcSyncbusyEnable) {
+	}
+}
+
+// stopPWMCapture disables the timer and event routing used by MeasurePWM.
+func stopPWMCapture(extint uint8) {
+	tc := sam.TC0_COUNT32
+	tc.CTRLA.ClearBits(tcCtrlaEnable)
+	for tc.SYNCBUSY.HasBits(tcSyncbusyEnable) {
+	}
+	sam.EVSYS.USER[evsysUserTC0EVU].Set(0)
+	sam.EVSYS.CHANNEL[pwmCaptureChannel].CHANNEL.Set(0)
+	sam.EIC.EVCTRL.ClearBits(1 << extint)
+}
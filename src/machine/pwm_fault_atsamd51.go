@@ -0,0 +1,134 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"device/sam"
+	"errors"
+)
+
+var ErrPWMFaultActive = errors.New("machine: PWM fault input still active")
+
+// First event channel used for faults, one per timer.
+const pwmFaultChannel = 2
+
+// Other bits in the TCC registers used for fault handling.
+const (
+	tccDrvctrlInven   = 16 // first output inversion bit
+	tccStatusFault1In = 1 << 11
+	tccStatusFaultA   = 1 << 12
+	tccStatusFault1   = 1 << 15
+)
+
+// outputIndex returns the number of the waveform output (WO) of the timer that
+// is connected to this pin.
+func (pwm PWM) outputIndex() uint8 {
+	switch pwm.Pin {
+	case PA16, PA14, PA20:
+		return 0
+	case PA17, PA15, PA21:
+		return 1
+	case PA18, PA22:
+		return 2
+	default: // PA19, PA23
+		return 3
+	}
+}
+
+// SetInverting sets whether the output of this PWM pin is inverted. This can be
+// changed at any time, but the timer is briefly stopped to do so.
+func (pwm PWM) SetInverting(inverting bool) error {
+	if pwm.tccIndex() < 0 {
+		return ErrInvalidOutputPin
+	}
+	timer := pwm.getTimer()
+	tccDisable(timer)
+	bit := uint32(1) << (tccDrvctrlInven + pwm.outputIndex())
+	if inverting {
+		timer.DRVCTRL.SetBits(bit)
+	} else {
+		timer.DRVCTRL.ClearBits(bit)
+	}
+	tccEnable(timer)
+	return nil
+}
+
+// ConfigureFault makes the timer of this PWM pin react to a fault signal on the
+// given input pin, which is active while it is high. The reaction happens in
+// hardware, without involving the CPU. As with SetPhase, the fault belongs to
+// the timer and not to the channel: it affects all pins that use the same
+// timer. The pin must have been configured with PWM.Configure before.
+//
+// The input is routed through the EIC and the event system, which means that
+// the external interrupt of the input pin (the pin number modulo 16, see the
+// pinout table in the datasheet) and event channel 2 (TCC0), 3 (TCC1) or 4
+// (TCC2) can't be used for anything else. This includes MeasurePWM on a pin
+// with the same external interrupt.
+func (pwm PWM) ConfigureFault(input Pin, action FaultAction) error {
+	index := pwm.tccIndex()
+	if index < 0 {
+		return ErrInvalidOutputPin
+	}
+	timer := pwm.getTimer()
+	extint := uint8(input) & 0xf
+
+	sam.MCLK.APBAMASK.SetBits(sam.MCLK_APBAMASK_EIC_)
+	sam.MCLK.APBBMASK.SetBits(sam.MCLK_APBBMASK_EVSYS_)
+	configureEventPin(input, extint, eicSenseHigh)
+
+	// Route the EIC event to the timer.
+	users := [...]uint32{evsysUserTCC0EV0, evsysUserTCC1EV0, evsysUserTCC2EV0}
+	channel := uint32(pwmFaultChannel + index)
+	sam.EVSYS.CHANNEL[channel].CHANNEL.Set((evsysGenEICExtint0+uint32(extint))<<evsysChannelEVGEN |
+		evsysPathAsync<<evsysChannelPATH)
+
+	// The fault configuration can only be changed while the timer is disabled.
+	tccDisable(timer)
+	user, evctrl, fctrla, drvctrl := faultRegisters(action, timer.EVCTRL.Get(), timer.DRVCTRL.Get())
+	sam.EVSYS.USER[users[index]+user].Set(channel + 1)
+	timer.FCTRLA.Set(fctrla)
+	timer.DRVCTRL.Set(drvctrl)
+	timer.EVCTRL.Set(evctrl)
+	timer.STATUS.Set(tccStatusFault1 | tccStatusFaultA)
+	tccEnable(timer)
+	return nil
+}
+
+// Faulted returns whether the timer of this PWM pin has detected a fault since
+// the last call to ClearFault.
+func (pwm PWM) Faulted() bool {
+	if pwm.tccIndex() < 0 {
+		return false
+	}
+	return pwm.getTimer().STATUS.HasBits(tccStatusFault1 | tccStatusFaultA)
+}
+
+// ClearFault restores the outputs after a FaultShutdown. It returns
+// ErrPWMFaultActive if the fault input is still active, in which case the
+// outputs stay low.
+func (pwm PWM) ClearFault() error {
+	if pwm.tccIndex() < 0 {
+		return ErrInvalidOutputPin
+	}
+	timer := pwm.getTimer()
+	if timer.STATUS.HasBits(tccStatusFault1In) {
+		return ErrPWMFaultActive
+	}
+	timer.STATUS.Set(tccStatusFault1 | tccStatusFaultA)
+	return nil
+}
+
+// tccDisable disables the timer, to be able to change its enable-protected
+// registers.
+func tccDisable(timer *sam.TCC_Type) {
+	timer.CTRLA.ClearBits(sam.TCC_CTRLA_ENABLE)
+	for timer.SYNCBUSY.HasBits(sam.TCC_SYNCBUSY_ENABLE) {
+	}
+}
+
+// tccEnable enables the timer again after tccDisable.
+func tccEnable(timer *sam.TCC_Type) {
+	timer.CTRLA.SetBits(sam.TCC_CTRLA_ENABLE)
+	for timer.SYNCBUSY.HasBits(sam.TCC_SYNCBUSY_ENABLE) {
+	}
+}
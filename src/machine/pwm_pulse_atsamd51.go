@@ -0,0 +1,70 @@
+// +build sam,atsamd51
+
+package machine
+
+import "device/sam"
+
+// Bits in the TCC registers used for one-shot pulses.
+const (
+	tccCtrlaPrescalerPos = 8
+	tccCtrlaPrescalerMsk = 7 << tccCtrlaPrescalerPos
+	tccCtrlbOneshot      = 1 << 2
+	tccDrvctrlNRV        = 8 // first non-recoverable output value bit
+)
+
+// Pulse outputs a single high pulse of the given width in nanoseconds on this
+// PWM pin. The pulse is timed by the timer in one-shot mode, so it doesn't
+// jitter like a pulse timed in software would, and Pulse returns right after
+// starting it. The pin must have been configured with PWM.Configure before.
+//
+// The width is rounded to the resolution of the timer, which depends on the
+// width: it is one CPU cycle (about 8ns at 120MHz) for pulses up to about
+// 0.5ms, and becomes coarser for longer pulses up to about 0.5s. A width that
+// is shorter than half a CPU cycle returns ErrPWMPulseTooShort.
+//
+// This reconfigures the timer of the pin, so other pins that use the same timer
+// can't be used for PWM anymore. A new call to Pulse waits for the previous
+// pulse on the same timer to finish.
+func (pwm PWM) Pulse(widthns uint32) error {
+	if pwm.tccIndex() < 0 {
+		return ErrInvalidOutputPin
+	}
+	prescaler, ticks, err := pulseTicks(widthns, CPUFrequency())
+	if err != nil {
+		return err
+	}
+	timer := pwm.getTimer()
+
+	// Let a previous pulse finish first.
+	if timer.CTRLBSET.HasBits(tccCtrlbOneshot) {
+		for !timer.STATUS.HasBits(tccStatusStop) {
+		}
+	}
+
+	tccDisable(timer)
+	timer.CTRLA.Set(timer.CTRLA.Get()&^tccCtrlaPrescalerMsk | prescaler<<tccCtrlaPrescalerPos)
+
+	// The output is low when the timer is stopped after the pulse.
+	output := pwm.outputIndex()
+	timer.DRVCTRL.Set(timer.DRVCTRL.Get()&^(1<<(tccDrvctrlNRV+output)) | 1<<output)
+
+	// The output is high from the start of the cycle until the compare match,
+	// after which the cycle ends and the timer stops.
+	timer.PER.Set(ticks)
+	for timer.SYNCBUSY.HasBits(sam.TCC_SYNCBUSY_PER) {
+	}
+	pwm.setChannel(ticks)
+	for timer.SYNCBUSY.HasBits(sam.TCC_SYNCBUSY_CC0) ||
+		timer.SYNCBUSY.HasBits(sam.TCC_SYNCBUSY_CC1) {
+	}
+	timer.COUNT.Set(0)
+	for timer.SYNCBUSY.HasBits(tccSyncbusyCount) {
+	}
+	timer.CTRLBSET.Set(tccCtrlbOneshot)
+	for timer.SYNCBUSY.HasBits(sam.TCC_SYNCBUSY_CTRLB) {
+	}
+
+	// Start the pulse.
+	tccEnable(timer)
+	return nil
+}
@@ -0,0 +1,143 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"device/sam"
+)
+
+// Event system IDs of the TCC event inputs, see the EVSYS chapter of the
+// datasheet. Only event input 0 of each timer is used.
+const (
+	evsysUserTCC0EV0 = 17
+	evsysUserTCC1EV0 = 25
+	evsysUserTCC2EV0 = 31
+	pwmSyncChannel   = 1 // event channel used to start the PWM timers
+)
+
+// Bits in the TCC registers.
+const (
+	tccCtrlbCmdStop      = 2 << 5
+	tccEvctrlEvact0Start = 3 << 0 // start the counter on event 0
+	tccEvctrlTCEI0       = 1 << 14
+	tccStatusStop        = 1 << 1
+	tccSyncbusyCount     = 1 << 4
+)
+
+// Counter values the timers start at in SynchronizePWM, indexed by TCC
+// number.
+var pwmPhase [3]uint32
+
+// tccIndex returns the number of the TCC peripheral used by this PWM pin, or
+// -1 if the pin doesn't support PWM.
+func (pwm PWM) tccIndex() int {
+	switch pwm.getTimer() {
+	case sam.TCC0:
+		return 0
+	case sam.TCC1:
+		return 1
+	case sam.TCC2:
+		return 2
+	default:
+		return -1
+	}
+}
+
+// SetPhase sets the phase offset of the timer used by this PWM pin, in timer
+// ticks. The timer counts from 0 to 0xffff with a prescaler of 256, so an
+// offset of 0x4000 is a quarter period. The offset only takes effect at the
+// next call to SynchronizePWM: the timer then starts counting at the offset
+// instead of at zero, so that it runs ahead of the other timers by that
+// amount.
+//
+// Note that the phase belongs to the timer and not to the channel: pins that
+// share a timer (see the pinout table in the datasheet) always have the same
+// phase.
+func (pwm PWM) SetPhase(offset uint16) error {
+	index := pwm.tccIndex()
+	if index < 0 {
+		return ErrInvalidOutputPin
+	}
+	pwmPhase[index] = uint32(offset)
+	return nil
+}
+
+// SynchronizePWM restarts the timers of the given PWM pins in the same clock
+// cycle, so that their counters are phase-aligned (apart from the offsets set
+// with SetPhase). The pins must have been configured with PWM.Configure
+// before. This is useful for example for interleaved converters or
+// multi-phase motor control.
+//
+// All timers are stopped and their counters set to the phase offset. A single
+// software event on event channel 1 then starts all of them, which means that
+// this event channel and event input 0 of the timers can't be used for
+// anything else. The timers keep running afterwards, and can be synchronized
+// again by calling this function again.
+func SynchronizePWM(pwms ...PWM) error {
+	var timers [len(pwmPhase)]bool
+	for _, pwm := range pwms {
+		index := pwm.tccIndex()
+		if index < 0 {
+			return ErrInvalidOutputPin
+		}
+		timers[index] = true
+	}
+
+	sam.MCLK.APBBMASK.SetBits(sam.MCLK_APBBMASK_EVSYS_)
+
+	// Let the event start the timers. EVCTRL can only be written while the
+	// timer is disabled.
+	users := [...]uint32{evsysUserTCC0EV0, evsysUserTCC1EV0, evsysUserTCC2EV0}
+	for index, used := range timers {
+		if !used {
+			continue
+		}
+		timer := tccTimer(index)
+		timer.CTRLA.ClearBits(sam.TCC_CTRLA_ENABLE)
+		for timer.SYNCBUSY.HasBits(sam.TCC_SYNCBUSY_ENABLE) {
+		}
+		timer.EVCTRL.Set(timer.EVCTRL.Get()&^0x7 | tccEvctrlEvact0Start | tccEvctrlTCEI0)
+		timer.CTRLA.SetBits(sam.TCC_CTRLA_ENABLE)
+		for timer.SYNCBUSY.HasBits(sam.TCC_SYNCBUSY_ENABLE) {
+		}
+
+		// Stop the timer and set the counter to the phase offset.
+		timer.CTRLBSET.Set(tccCtrlbCmdStop)
+		for timer.SYNCBUSY.HasBits(sam.TCC_SYNCBUSY_CTRLB) {
+		}
+		for !timer.STATUS.HasBits(tccStatusStop) {
+		}
+		timer.COUNT.Set(pwmPhase[index])
+		for timer.SYNCBUSY.HasBits(tccSyncbusyCount) {
+		}
+
+		sam.EVSYS.USER[users[index]].Set(pwmSyncChannel + 1)
+	}
+
+	// Use a software event (without generator) to start all timers at once.
+	// The asynchronous path delivers it to all timers in the same cycle.
+	sam.EVSYS.CHANNEL[pwmSyncChannel].CHANNEL.Set(evsysPathAsync << evsysChannelPATH)
+	sam.EVSYS.SWEVT.Set(1 << pwmSyncChannel)
+
+	for index, used := range timers {
+		if !used {
+			continue
+		}
+		timer := tccTimer(index)
+		for timer.STATUS.HasBits(tccStatusStop) {
+		}
+	}
+	return nil
+}
+
+// tccTimer returns the TCC peripheral with the given number.
+func tccTimer(index int) *sam.TCC_Type {
+	switch index {
+	case 0:
+		return sam.TCC0
+	case 1:
+		return sam.TCC1
+	default:
+		return sam.TCC2
+	}
+}
@@ -0,0 +1,90 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"device/sam"
+	"errors"
+	"unsafe"
+)
+
+var ErrSPIDMATooLong = errors.New("machine: SPI DMA transfer too long")
+
+// DMA trigger source of the receive side of SERCOM0. The receive trigger of
+// SERCOMn is dmaTriggerSERCOM0RX+2*n, the transmit trigger follows directly
+// after it.
+const dmaTriggerSERCOM0RX = 0x04
+
+// The byte that is sent while receiving with RxDMA.
+var spiDummyByte byte
+
+// sercomIndex returns the number of the SERCOM peripheral used by this SPI bus.
+// It is derived from the address, as not all chips have all SERCOMs.
+func (spi SPI) sercomIndex() uint8 {
+	switch uintptr(unsafe.Pointer(spi.Bus)) {
+	case 0x40003000:
+		return 0
+	case 0x40003400:
+		return 1
+	case 0x41012000:
+		return 2
+	case 0x41014000:
+		return 3
+	case 0x43000000:
+		return 4
+	case 0x43000400:
+		return 5
+	case 0x43000800:
+		return 6
+	default: // 0x43000C00
+		return 7
+	}
+}
+
+// RxDMA reads len(r) bytes from the SPI bus using DMA, while sending zeroes
+// like Tx(nil, r). This is more efficient than Tx for large reads, for example
+// from a camera or an ADC. It blocks until the transfer has completed.
+//
+// The SERCOM only generates the clock while sending, so this allocates two DMA
+// channels: one that receives the data and one that keeps the transmit
+// register filled with dummy bytes. It returns ErrNoDMAChannel if they are not
+// available.
+func (spi SPI) RxDMA(r []byte) error {
+	if len(r) == 0 {
+		return nil
+	}
+	if len(r) > 0xffff {
+		return ErrSPIDMATooLong
+	}
+
+	rx, err := AllocateDMAChannel()
+	if err != nil {
+		return err
+	}
+	defer rx.Free()
+	tx, err := AllocateDMAChannel()
+	if err != nil {
+		return err
+	}
+	defer tx.Free()
+
+	trigger := dmaTriggerSERCOM0RX + 2*spi.sercomIndex()
+	data := unsafe.Pointer(&spi.Bus.DATA.Reg)
+	rx.Configure(DMAConfig{Trigger: trigger, BeatSize: DMABeatSize8, DstIncrement: true})
+	rx.SetTransfer(data, unsafe.Pointer(&r[0]), uint16(len(r)))
+	tx.Configure(DMAConfig{Trigger: trigger + 1, BeatSize: DMABeatSize8})
+	tx.SetTransfer(unsafe.Pointer(&spiDummyByte), data, uint16(len(r)))
+
+	// Discard any stale received data, so that the first byte received by the
+	// DMAC belongs to this transfer.
+	for spi.Bus.INTFLAG.HasBits(sam.SERCOM_SPIM_INTFLAG_RXC) {
+		spi.Bus.DATA.Get()
+	}
+
+	// The receive channel must be ready before the first byte is sent.
+	rx.Start()
+	tx.Start()
+	for rx.Busy() {
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"device/arm"
+	"device/sam"
+	"errors"
+)
+
+var ErrSPISlaveUnsupported = errors.New("machine: SPI slave mode not supported on this SERCOM")
+
+// Bits in the SERCOM SPI registers that are only used in slave mode, see the
+// SERCOM SPI chapter of the datasheet.
+const (
+	spiCtrlaModeSlave = 2 << 2
+	spiCtrlbPloaden   = 1 << 6 // preload the shift register while SS is high
+	spiCtrlbSSDE      = 1 << 9 // slave select low detection
+	spiIntflagTXC     = 1 << 1
+	spiIntflagRXC     = 1 << 2
+	spiIntflagSSL     = 1 << 3
+	spiIntflagError   = 1 << 7
+	spiStatusBufovf   = 1 << 2
+)
+
+// SPISlaveConfig is the configuration of an SPI bus in slave mode.
+type SPISlaveConfig struct {
+	LSBFirst bool
+	Mode     uint8
+
+	// Preload is the byte that is sent in the first frame after the bus has
+	// been configured.
+	Preload byte
+
+	// Receive is called from an interrupt for every received byte. The byte
+	// it returns is sent to the master in the next frame: the data of a frame
+	// is shifted out at the same time as it is shifted in, so it is too late
+	// to respond in the same frame. The byte returned for the last frame of a
+	// transaction is sent in the first frame of the next transaction. If
+	// Receive is nil, Preload is sent in every frame.
+	Receive func(rx byte) (tx byte)
+
+	// Select is called from an interrupt when the master pulls the slave
+	// select pin low, at the start of a transaction. It is optional.
+	Select func()
+}
+
+// Slave mode configuration of the SERCOM peripherals, indexed by SERCOM
+// number. SERCOM0 and SERCOM3 are missing as their interrupts are used by
+// UART2 and UART1.
+var spiSlaves [6]*SPISlaveConfig
+
+// ConfigureSlave sets up the SPI bus in slave (peripheral) mode, so that
+// another device can act as the master. The transfers are interrupt driven
+// and call config.Receive for every byte.
+//
+// In slave mode, MISO is the data output. Therefore DOpad selects the pad of
+// MISO (and the pads of SCK and SS, which are always PAD1 and PAD2) and DIpad
+// selects the pad of MOSI, which is the other way around compared to master
+// mode. Only spiTXPad0SCK1 and spiTXPad3SCK1 are supported by the SAMD51. As
+// the board definitions put MISO on PAD2, the SPI buses of the boards can't be
+// used as-is: the slave mode needs its own SPI value.
+func (spi SPI) ConfigureSlave(config SPISlaveConfig) error {
+	index := spi.sercomIndex()
+	if index == 0 || index == 3 || int(index) >= len(spiSlaves) {
+		return ErrSPISlaveUnsupported
+	}
+
+	// Check that the pads don't overlap.
+	var doPad int
+	switch spi.DOpad {
+	case spiTXPad0SCK1:
+		doPad = 0
+	case spiTXPad3SCK1:
+		doPad = 3
+	default:
+		return ErrInvalidDataPin
+	}
+	if spi.DIpad == 1 || spi.DIpad == 2 || spi.DIpad == doPad {
+		return ErrInvalidDataPin
+	}
+
+	// Disable SPI port.
+	spi.Bus.INTENCLR.Set(spiIntflagTXC | spiIntflagRXC | spiIntflagSSL | spiIntflagError)
+	spi.Bus.CTRLA.ClearBits(sam.SERCOM_SPIM_CTRLA_ENABLE)
+	for spi.Bus.SYNCBUSY.HasBits(sam.SERCOM_SPIM_SYNCBUSY_ENABLE) {
+	}
+
+	// enable pins
+	if spi.SCKPinMode == 0 {
+		spi.SCKPinMode = PinSERCOMAlt
+	}
+	if spi.MOSIPinMode == 0 {
+		spi.MOSIPinMode = PinSERCOMAlt
+	}
+	if spi.MISOPinMode == 0 {
+		spi.MISOPinMode = PinSERCOMAlt
+	}
+	if spi.SSPinMode == 0 {
+		spi.SSPinMode = PinSERCOMAlt
+	}
+
+	spi.SCK.Configure(PinConfig{Mode: spi.SCKPinMode})
+	spi.MOSI.Configure(PinConfig{Mode: spi.MOSIPinMode})
+	spi.MISO.Configure(PinConfig{Mode: spi.MISOPinMode})
+	spi.SS.Configure(PinConfig{Mode: spi.SSPinMode})
+
+	// reset SERCOM
+	spi.Bus.CTRLA.SetBits(sam.SERCOM_SPIM_CTRLA_SWRST)
+	for spi.Bus.CTRLA.HasBits(sam.SERCOM_SPIM_CTRLA_SWRST) ||
+		spi.Bus.SYNCBUSY.HasBits(sam.SERCOM_SPIM_SYNCBUSY_SWRST) {
+	}
+
+	// set bit transfer order
+	dataOrder := 0
+	if config.LSBFirst {
+		dataOrder = 1
+	}
+
+	// Set SPI slave. The clock polarity and phase are set in the same way as
+	// in master mode.
+	ctrla := uint32(spiCtrlaModeSlave |
+		(spi.DOpad << sam.SERCOM_SPIM_CTRLA_DOPO_Pos) |
+		(spi.DIpad << sam.SERCOM_SPIM_CTRLA_DIPO_Pos) |
+		(dataOrder << sam.SERCOM_SPIM_CTRLA_DORD_Pos))
+	switch config.Mode {
+	case 1:
+		ctrla |= sam.SERCOM_SPIM_CTRLA_CPHA
+	case 2:
+		ctrla |= sam.SERCOM_SPIM_CTRLA_CPOL
+	case 3:
+		ctrla |= sam.SERCOM_SPIM_CTRLA_CPHA | sam.SERCOM_SPIM_CTRLA_CPOL
+	}
+	spi.Bus.CTRLA.Set(ctrla)
+
+	spi.Bus.CTRLB.Set((0 << sam.SERCOM_SPIM_CTRLB_CHSIZE_Pos) | // 8bit char size
+		spiCtrlbPloaden | spiCtrlbSSDE | sam.SERCOM_SPIM_CTRLB_RXEN)
+	for spi.Bus.SYNCBUSY.HasBits(sam.SERCOM_SPIM_SYNCBUSY_CTRLB) {
+	}
+
+	// Enable SPI port.
+	spi.Bus.CTRLA.SetBits(sam.SERCOM_SPIM_CTRLA_ENABLE)
+	for spi.Bus.SYNCBUSY.HasBits(sam.SERCOM_SPIM_SYNCBUSY_ENABLE) {
+	}
+
+	// Preload the first byte, which is moved to the shift register before
+	// the master selects this device.
+	spi.Bus.DATA.Set(uint32(config.Preload))
+
+	spiSlaves[index] = &config
+	spi.Bus.INTFLAG.Set(spiIntflagSSL | spiIntflagError)
+	intenset := uint8(spiIntflagRXC | spiIntflagError)
+	if config.Select != nil {
+		intenset |= spiIntflagSSL
+	}
+	spi.Bus.INTENSET.Set(intenset)
+
+	switch index {
+	case 1:
+		arm.EnableIRQ(sam.IRQ_SERCOM1_0)
+		arm.EnableIRQ(sam.IRQ_SERCOM1_1)
+		arm.EnableIRQ(sam.IRQ_SERCOM1_2)
+		arm.EnableIRQ(sam.IRQ_SERCOM1_OTHER)
+	case 2:
+		arm.EnableIRQ(sam.IRQ_SERCOM2_0)
+		arm.EnableIRQ(sam.IRQ_SERCOM2_1)
+		arm.EnableIRQ(sam.IRQ_SERCOM2_2)
+		arm.EnableIRQ(sam.IRQ_SERCOM2_OTHER)
+	case 4:
+		arm.EnableIRQ(sam.IRQ_SERCOM4_0)
+		arm.EnableIRQ(sam.IRQ_SERCOM4_1)
+		arm.EnableIRQ(sam.IRQ_SERCOM4_2)
+		arm.EnableIRQ(sam.IRQ_SERCOM4_OTHER)
+	case 5:
+		arm.EnableIRQ(sam.IRQ_SERCOM5_0)
+		arm.EnableIRQ(sam.IRQ_SERCOM5_1)
+		arm.EnableIRQ(sam.IRQ_SERCOM5_2)
+		arm.EnableIRQ(sam.IRQ_SERCOM5_OTHER)
+	}
+	return nil
+}
+
+// handleSPISlaveInterrupt handles a slave mode interrupt of the given SERCOM.
+func handleSPISlaveInterrupt(bus *sam.SERCOM_SPIM_Type, index int) {
+	config := spiSlaves[index]
+	if config == nil {
+		return
+	}
+	flags := bus.INTFLAG.Get()
+	if flags&spiIntflagSSL != 0 {
+		bus.INTFLAG.Set(spiIntflagSSL)
+		if config.Select != nil {
+			config.Select()
+		}
+	}
+	if flags&spiIntflagError != 0 {
+		// A byte was received before the previous one was read (buffer
+		// overflow). There is nothing that can be done about the lost byte.
+		bus.STATUS.Set(spiStatusBufovf)
+		bus.INTFLAG.Set(spiIntflagError)
+	}
+	if flags&spiIntflagRXC != 0 {
+		// Reading DATA clears the RXC flag.
+		rx := byte(bus.DATA.Get())
+		tx := config.Preload
+		if config.Receive != nil {
+			tx = config.Receive(rx)
+		}
+		bus.DATA.Set(uint32(tx))
+	}
+}
+
+//go:export SERCOM1_0_IRQHandler
+func handleSERCOM1_0() {
+	handleSPISlaveInterrupt(sam.SERCOM1_SPIM, 1)
+}
+
+//go:export SERCOM1_1_IRQHandler
+func handleSERCOM1_1() {
+	handleSPISlaveInterrupt(sam.SERCOM1_SPIM, 1)
+}
+
+//go:export SERCOM1_2_IRQHandler
+func handleSERCOM1_2() {
+	handleSPISlaveInterrupt(sam.SERCOM1_SPIM, 1)
+}
+
+//go:export SERCOM1_OTHER_IRQHandler
+func handleSERCOM1_OTHER() {
+	handleSPISlaveInterrupt(sam.SERCOM1_SPIM, 1)
+}
+
+//go:export SERCOM2_0_IRQHandler
+func handleSERCOM2_0() {
+	handleSPISlaveInterrupt(sam.SERCOM2_SPIM, 2)
+}
+
+//go:export SERCOM2_1_IRQHandler
+func handleSERCOM2_1() {
+	handleSPISlaveInterrupt(sam.SERCOM2_SPIM, 2)
+}
+
+//go:export SERCOM2_2_IRQHandler
+func handleSERCOM2_2() {
+	handleSPISlaveInterrupt(sam.SERCOM2_SPIM, 2)
+}
+
+//go:export SERCOM2_OTHER_IRQHandler
+func handleSERCOM2_OTHER() {
+	handleSPISlaveInterrupt(sam.SERCOM2_SPIM, 2)
+}
+
+//go:export SERCOM4_0_IRQHandler
+func handleSERCOM4_0() {
+	handleSPISlaveInterrupt(sam.SERCOM4_SPIM, 4)
+}
+
+//go:export SERCOM4_1_IRQHandler
+func handleSERCOM4_1() {
+	handleSPISlaveInterrupt(sam.SERCOM4_SPIM, 4)
+}
+
+//go:export SERCOM4_2_IRQHandler
+func handleSERCOM4_2() {
+	handleSPISlaveInterrupt(sam.SERCOM4_SPIM, 4)
+}
+
+//go:export SERCOM4_OTHER_IRQHandler
+func handleSERCOM4_OTHER() {
+	handleSPISlaveInterrupt(sam.SERCOM4_SPIM, 4)
+}
+
+//go:export SERCOM5_0_IRQHandler
+func handleSERCOM5_0() {
+	handleSPISlaveInterrupt(sam.SERCOM5_SPIM, 5)
+}
+
+//go:export SERCOM5_1_IRQHandler
+func handleSERCOM5_1() {
+	handleSPISlaveInterrupt(sam.SERCOM5_SPIM, 5)
+}
+
+//go:export SERCOM5_2_IRQHandler
+func handleSERCOM5_2() {
+	handleSPISlaveInterrupt(sam.SERCOM5_SPIM, 5)
+}
+
+//go:export SERCOM5_OTHER_IRQHandler
+func handleSERCOM5_OTHER() {
+	handleSPISlaveInterrupt(sam.SERCOM5_SPIM, 5)
+}
@@ -0,0 +1,122 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"device/sam"
+	"errors"
+	"unsafe"
+)
+
+var ErrTemperatureNotCalibrated = errors.New("machine: temperature sensor calibration missing")
+
+// Address of the temperature log row in the NVM software calibration area,
+// which contains the factory calibration of the temperature sensor.
+const tempLogAddr = 0x00800100
+
+// Bits in SUPC.VREF, see the SUPC chapter of the datasheet.
+const (
+	supcVrefTsen     = 1 << 1 // temperature sensor enable
+	supcVrefOndemand = 1 << 7
+)
+
+// ADC inputs of the two temperature sensors, see INPUTCTRL.MUXPOS.
+const (
+	adcMuxposPTAT = 0x1c
+	adcMuxposCTAT = 0x1d
+)
+
+// ReadTemperature returns the temperature of the chip in millicelsius, as
+// measured by the internal temperature sensor and corrected using the factory
+// calibration. InitADC must have been called before, as this uses ADC0. The ADC
+// configuration is restored afterwards.
+//
+// The sensor measures the temperature of the die, which is usually a few
+// degrees warmer than the environment. Even after calibration the result may
+// be off by several degrees: see the electrical characteristics chapter of the
+// datasheet for the exact accuracy. It returns ErrTemperatureNotCalibrated if
+// the calibration is missing (the temperature log row has been erased).
+func ReadTemperature() (millicelsius int32, err error) {
+	var log [3]uint32
+	for i := range log {
+		log[i] = *(*uint32)(unsafe.Pointer(uintptr(tempLogAddr + i*4)))
+	}
+	if log[0] == 0xffffffff || log[1] == 0xffffffff {
+		return 0, ErrTemperatureNotCalibrated
+	}
+	cal := readTempCalibration(log)
+
+	// Both sensors must be read with a 12-bit resolution, as that is what the
+	// calibration values use. Averaging reduces the noise.
+	sam.SUPC.VREF.SetBits(supcVrefTsen | supcVrefOndemand)
+	tp := readTemperatureSensor(adcMuxposPTAT)
+	tc := readTemperatureSensor(adcMuxposCTAT)
+	sam.SUPC.VREF.ClearBits(supcVrefTsen)
+
+	if cal.vcl*tp-cal.vch*tp-cal.vpl*tc+cal.vph*tc == 0 {
+		// The calibration values are invalid.
+		return 0, ErrTemperatureNotCalibrated
+	}
+	return cal.millicelsius(tp, tc), nil
+}
+
+// readTemperatureSensor does a 12-bit conversion (averaged over 16 samples) of
+// the given ADC0 input, using the internal reference.
+func readTemperatureSensor(muxpos uint16) int64 {
+	bus := sam.ADC0
+
+	// Save the current configuration, to restore it afterwards.
+	ctrlb := bus.CTRLB.Get()
+	avgctrl := bus.AVGCTRL.Get()
+	refctrl := bus.REFCTRL.Get()
+	inputctrl := bus.INPUTCTRL.Get()
+
+	bus.CTRLB.Set(ctrlb&^sam.ADC_CTRLB_RESSEL_Msk | sam.ADC_CTRLB_RESSEL_16BIT<<sam.ADC_CTRLB_RESSEL_Pos)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_CTRLB) {
+	}
+	samplenum, adjres := adcAveraging(16)
+	bus.AVGCTRL.Set(samplenum<<sam.ADC_AVGCTRL_SAMPLENUM_Pos | adjres<<sam.ADC_AVGCTRL_ADJRES_Pos)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_AVGCTRL) {
+	}
+	bus.REFCTRL.Set(sam.ADC_REFCTRL_REFSEL_INTREF)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_REFCTRL) {
+	}
+	bus.INPUTCTRL.Set(muxpos<<sam.ADC_INPUTCTRL_MUXPOS_Pos | sam.ADC_INPUTCTRL_MUXNEG_GND<<sam.ADC_INPUTCTRL_MUXNEG_Pos)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_INPUTCTRL) {
+	}
+
+	bus.CTRLA.SetBits(sam.ADC_CTRLA_ENABLE)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_ENABLE) {
+	}
+
+	// The first conversion after changing the reference is invalid, so do
+	// two conversions and only use the second.
+	var val uint16
+	for i := 0; i < 2; i++ {
+		bus.SWTRIG.SetBits(sam.ADC_SWTRIG_START)
+		for !bus.INTFLAG.HasBits(sam.ADC_INTFLAG_RESRDY) {
+		}
+		val = bus.RESULT.Get()
+		bus.INTFLAG.SetBits(sam.ADC_INTFLAG_RESRDY)
+	}
+
+	bus.CTRLA.ClearBits(sam.ADC_CTRLA_ENABLE)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_ENABLE) {
+	}
+
+	// Restore the previous configuration.
+	bus.CTRLB.Set(ctrlb)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_CTRLB) {
+	}
+	bus.AVGCTRL.Set(avgctrl)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_AVGCTRL) {
+	}
+	bus.REFCTRL.Set(refctrl)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_REFCTRL) {
+	}
+	bus.INPUTCTRL.Set(inputctrl)
+	for bus.SYNCBUSY.HasBits(sam.ADC_SYNCBUSY_INPUTCTRL) {
+	}
+
+	return int64(val)
+}
@@ -0,0 +1,100 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"device/arm"
+	"device/sam"
+	"errors"
+)
+
+var ErrInvalidTickerPeriod = errors.New("machine: ticker period out of range")
+
+// Bits in the TC registers used by the ticker, next to the ones in
+// pwm_capture_atsamd51.go.
+const (
+	tcWaveWavegenMFRQ = 1 << 0 // match frequency: the counter wraps at CC0
+	tcSyncbusyCC0     = 1 << 6
+)
+
+// Peripheral channel of the TC2 and TC3 clocks in GCLK.PCHCTRL.
+const gclkPchctrlTC2TC3 = 26
+
+var tickerCallback func()
+
+// StartTicker calls the callback every period nanoseconds, from the interrupt
+// of TC2 (combined with TC3 as 32-bit counter). A time.Ticker sends the time
+// from the RTC interrupt, at the resolution of the RTC (about 30µs), and its
+// ticks are received by a goroutine once the scheduler runs it. Instead, the
+// callback is called directly at precise intervals: the period is exact up to
+// one CPU cycle (about 8ns at 120MHz) and the jitter is only the interrupt
+// latency. The longest possible
+// period is about 35 seconds. Calling StartTicker again replaces the period
+// and callback.
+//
+// The callback runs in interrupt context, which means that it must:
+//   - return quickly, as it blocks the goroutines and lower priority
+//     interrupts while it runs;
+//   - not block, for example by sleeping, receiving from a channel or sending
+//     to a channel that is not ready;
+//   - not allocate heap memory, as the garbage collector can't run in an
+//     interrupt.
+//
+// Variables that are shared with goroutines should be accessed through
+// runtime/volatile, or with interrupts disabled on the goroutine side.
+func StartTicker(periodns uint64, callback func()) error {
+	if callback == nil || periodns > 1<<36 {
+		return ErrInvalidTickerPeriod
+	}
+	ticks := (periodns*uint64(CPUFrequency()) + 1e9/2) / 1e9
+	if ticks == 0 || ticks > 1<<32 {
+		return ErrInvalidTickerPeriod
+	}
+
+	// Enable the clocks of the timers. They run at the CPU frequency, from the
+	// same clock generator.
+	sam.MCLK.APBBMASK.SetBits(sam.MCLK_APBBMASK_TC2_ | sam.MCLK_APBBMASK_TC3_)
+	sam.GCLK.PCHCTRL[gclkPchctrlTC2TC3].Set((sam.GCLK_PCHCTRL_GEN_GCLK0 << sam.GCLK_PCHCTRL_GEN_Pos) |
+		sam.GCLK_PCHCTRL_CHEN)
+
+	tc := sam.TC2_COUNT32
+	tc.INTENCLR.Set(tcIntflagMC0)
+	tickerCallback = callback
+	tc.CTRLA.Set(tcCtrlaSwrst)
+	for tc.SYNCBUSY.HasBits(tcSyncbusySwrst) {
+	}
+	tc.CTRLA.Set(tcCtrlaModeCount32)
+	tc.WAVE.Set(tcWaveWavegenMFRQ)
+
+	// The counter counts from 0 up to and including CC0.
+	tc.CC[0].Set(uint32(ticks - 1))
+	for tc.SYNCBUSY.HasBits(tcSyncbusyCC0) {
+	}
+	tc.INTFLAG.Set(tcIntflagMC0)
+	tc.INTENSET.Set(tcIntflagMC0)
+	arm.EnableIRQ(sam.IRQ_TC2)
+
+	tc.CTRLA.SetBits(tcCtrlaEnable)
+	for tc.SYNCBUSY.HasBits(tcSyncbusyEnable) {
+	}
+	return nil
+}
+
+// StopTicker stops the ticker started with StartTicker. The callback is not
+// called anymore after StopTicker returns.
+func StopTicker() {
+	tc := sam.TC2_COUNT32
+	tc.INTENCLR.Set(tcIntflagMC0)
+	tc.CTRLA.ClearBits(tcCtrlaEnable)
+	for tc.SYNCBUSY.HasBits(tcSyncbusyEnable) {
+	}
+	tickerCallback = nil
+}
+
+//go:export TC2_IRQHandler
+func handleTC2() {
+	sam.TC2_COUNT32.INTFLAG.Set(tcIntflagMC0)
+	if tickerCallback != nil {
+		tickerCallback()
+	}
+}
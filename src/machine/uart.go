@@ -24,7 +24,9 @@ type UARTConfig struct {
 //		UART{Buffer: NewRingBuffer()}
 //
 
-// Read from the RX buffer.
+// Read from the RX buffer. It returns the bytes that are currently available
+// without waiting for more data, which may be none at all. Use UARTStream for
+// blocking reads.
 func (uart UART) Read(data []byte) (n int, err error) {
 	// check if RX buffer is empty
 	size := uart.Buffered()
@@ -0,0 +1,50 @@
+// +build avr nrf sam sifive stm32 test,!baremetal
+
+package machine
+
+// This file is also built for tests on the host, so that UARTStream can be
+// tested with "tinygo test machine" against a loopback UART.
+
+import "runtime"
+
+// uartPort is the part of a UART that is used by UARTStream.
+type uartPort interface {
+	Read(data []byte) (n int, err error)
+	Write(data []byte) (n int, err error)
+	Buffered() int
+	Close() error
+}
+
+// UARTStream wraps a UART to use it as an io.ReadWriteCloser with configurable
+// Read semantics, for example with bufio or a streaming encoding/json decoder.
+// Writes and Close are passed to the UART as-is.
+type UARTStream struct {
+	// UART is the UART to read from and write to, such as UART0.
+	UART uartPort
+
+	// Blocking makes Read wait until at least one byte is available, as
+	// expected by most users of io.Reader. Otherwise, Read returns 0 bytes
+	// without an error if no data has been received.
+	Blocking bool
+}
+
+// Read from the RX buffer. It never waits for more data than a single byte,
+// so it may return less than len(data) bytes.
+func (s UARTStream) Read(data []byte) (n int, err error) {
+	if s.Blocking && len(data) != 0 {
+		for s.UART.Buffered() == 0 {
+			runtime.Gosched()
+		}
+	}
+	return s.UART.Read(data)
+}
+
+// Write data to the UART.
+func (s UARTStream) Write(data []byte) (n int, err error) {
+	return s.UART.Write(data)
+}
+
+// Close disables the UART.
+func (s UARTStream) Close() error {
+	return s.UART.Close()
+}
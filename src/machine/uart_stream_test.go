@@ -0,0 +1,109 @@
+// +build avr nrf sam sifive stm32 test,!baremetal
+
+package machine
+
+import (
+	"bufio"
+	"io"
+	"testing"
+)
+
+// loopbackUART is a UART of which the TX is connected to its own RX.
+type loopbackUART struct {
+	buffer *RingBuffer
+	closed bool
+}
+
+func newLoopbackUART() *loopbackUART {
+	return &loopbackUART{buffer: NewRingBuffer()}
+}
+
+func (uart *loopbackUART) Read(data []byte) (n int, err error) {
+	for n < len(data) {
+		b, ok := uart.buffer.Get()
+		if !ok {
+			break
+		}
+		data[n] = b
+		n++
+	}
+	return n, nil
+}
+
+func (uart *loopbackUART) Write(data []byte) (n int, err error) {
+	for _, b := range data {
+		uart.buffer.Put(b)
+	}
+	return len(data), nil
+}
+
+func (uart *loopbackUART) Buffered() int {
+	return int(uart.buffer.Used())
+}
+
+func (uart *loopbackUART) Close() error {
+	uart.closed = true
+	return nil
+}
+
+func TestUARTStreamPartialRead(t *testing.T) {
+	var stream io.ReadWriteCloser = UARTStream{UART: newLoopbackUART()}
+	if _, err := io.WriteString(stream, "hello world"); err != nil {
+		t.Fatal("could not write:", err)
+	}
+
+	// Read only part of the data.
+	buf := make([]byte, 5)
+	n, err := stream.Read(buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("first read: got %q (%v), expected %q", buf[:n], err, "hello")
+	}
+
+	// Read the rest, which is less than the buffer can hold.
+	buf = make([]byte, 16)
+	n, err = stream.Read(buf)
+	if err != nil || string(buf[:n]) != " world" {
+		t.Errorf("second read: got %q (%v), expected %q", buf[:n], err, " world")
+	}
+
+	// There is no data left, so a non-blocking read returns right away.
+	n, err = stream.Read(buf)
+	if n != 0 || err != nil {
+		t.Errorf("read without data: got %d bytes (%v), expected 0 bytes", n, err)
+	}
+}
+
+func TestUARTStreamBlocking(t *testing.T) {
+	uart := newLoopbackUART()
+	stream := UARTStream{UART: uart, Blocking: true}
+
+	// The data is sent while Read is waiting for it.
+	go io.WriteString(uart, "x")
+	buf := make([]byte, 4)
+	n, err := stream.Read(buf)
+	if err != nil || string(buf[:n]) != "x" {
+		t.Errorf("blocking read: got %q (%v), expected %q", buf[:n], err, "x")
+	}
+
+	// A blocking stream can be used with bufio, which treats 0 bytes without
+	// an error as a broken reader.
+	io.WriteString(stream, "first line\nsecond line\n")
+	r := bufio.NewReader(stream)
+	for _, expected := range []string{"first line\n", "second line\n"} {
+		line, err := r.ReadString('\n')
+		if err != nil || line != expected {
+			t.Errorf("bufio: got %q (%v), expected %q", line, err, expected)
+		}
+	}
+}
+
+func TestUARTStreamClose(t *testing.T) {
+	uart := newLoopbackUART()
+	var stream io.ReadWriteCloser = UARTStream{UART: uart}
+	if err := stream.Close(); err != nil {
+		t.Error("could not close:", err)
+	}
+	if !uart.closed {
+		t.Error("Close was not passed to the UART")
+	}
+}
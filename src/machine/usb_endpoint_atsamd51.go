@@ -0,0 +1,176 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"device/sam"
+	"errors"
+	"unsafe"
+)
+
+var (
+	ErrUSBNoEndpoints    = errors.New("machine: no free USB endpoints")
+	ErrUSBEndpointType   = errors.New("machine: unsupported USB endpoint type")
+	ErrUSBEndpointBusy   = errors.New("machine: USB endpoint busy")
+	ErrUSBPacketTooLarge = errors.New("machine: USB packet too large")
+
+	ErrUSBDescriptorsTooLarge = errors.New("machine: USB interface descriptors too large")
+)
+
+// USBEndpointType is the transfer type of a USB endpoint.
+type USBEndpointType uint8
+
+const (
+	USBEndpointBulk      USBEndpointType = usb_ENDPOINT_TYPE_BULK
+	USBEndpointInterrupt USBEndpointType = usb_ENDPOINT_TYPE_INTERRUPT
+)
+
+// USBEndpointConfig is the configuration of a custom USB endpoint.
+type USBEndpointConfig struct {
+	// In is true for endpoints that send data to the host and false for
+	// endpoints that receive data from the host.
+	In bool
+
+	Type USBEndpointType
+
+	// RxHandler is called from the USB interrupt for every packet received on
+	// an OUT endpoint. The data is only valid until the callback returns.
+	RxHandler func(data []byte)
+
+	// TxHandler is called from the USB interrupt when a packet sent with
+	// USBEndpoint.Send has been transferred to the host.
+	TxHandler func()
+}
+
+// USBEndpoint is a custom USB endpoint, allocated with ConfigureUSBEndpoint.
+// All custom endpoints have a maximum packet size of 64 bytes.
+type USBEndpoint struct {
+	Number uint8
+	In     bool
+}
+
+// Custom endpoints are allocated after the endpoints of the CDC interface.
+const usbFirstCustomEndpoint = usb_CDC_ENDPOINT_IN + 1
+
+var usbEndpointConfigs [len(udd_ep_in_cache_buffer)]USBEndpointConfig
+
+// The configuration descriptor is sent in a single transfer from the buffer of
+// the control endpoint, which leaves this much room for extra descriptors.
+const usbMaxExtraDescriptors = len(udd_ep_in_cache_buffer[0]) - configDescriptorSize - cdcSize
+
+// Extra interface descriptors appended to the configuration descriptor.
+var (
+	usbExtraInterfaces  uint8
+	usbExtraDescriptors []byte
+)
+
+// ConfigureUSBEndpoint allocates a new endpoint next to the endpoints of the
+// USB CDC interface. The endpoint is configured in hardware when the host
+// selects the USB configuration, so this should be called at the start of the
+// program (before the host has enumerated the device) together with
+// SetUSBInterfaceDescriptors to tell the host about the endpoint.
+func ConfigureUSBEndpoint(config USBEndpointConfig) (USBEndpoint, error) {
+	if config.Type != USBEndpointBulk && config.Type != USBEndpointInterrupt {
+		return USBEndpoint{}, ErrUSBEndpointType
+	}
+	ep := len(endPoints)
+	if ep >= len(usbEndpointConfigs) {
+		return USBEndpoint{}, ErrUSBNoEndpoints
+	}
+	direction := uint32(usbEndpointOut)
+	if config.In {
+		direction = usbEndpointIn
+	}
+	usbEndpointConfigs[ep] = config
+	endPoints = append(endPoints, uint32(config.Type)|direction)
+	if usbConfiguration != 0 {
+		// The host has already configured the device, so set up the endpoint
+		// right away.
+		initUSBEndpoint(uint32(ep))
+	}
+	return USBEndpoint{Number: uint8(ep), In: config.In}, nil
+}
+
+// SetUSBInterfaceDescriptors adds the given interface, endpoint and class
+// descriptors to the configuration descriptor sent to the host, after the
+// descriptors of the CDC interface. The interfaces must be numbered starting
+// at 2, as interface 0 and 1 are used by CDC. There is room for 53 bytes of
+// extra descriptors, ErrUSBDescriptorsTooLarge is returned for longer
+// descriptors.
+func SetUSBInterfaceDescriptors(numInterfaces uint8, descriptors []byte) error {
+	if len(descriptors) > usbMaxExtraDescriptors {
+		return ErrUSBDescriptorsTooLarge
+	}
+	usbExtraInterfaces = numInterfaces
+	usbExtraDescriptors = descriptors
+	return nil
+}
+
+// Descriptor returns the endpoint descriptor of this endpoint, to be included
+// in the interface descriptors passed to SetUSBInterfaceDescriptors. The
+// interval is the polling interval for interrupt endpoints in milliseconds.
+func (ep USBEndpoint) Descriptor(interval uint8) EndpointDescriptor {
+	addr := ep.Number | usbEndpointOut
+	if ep.In {
+		addr = ep.Number | usbEndpointIn
+	}
+	return NewEndpointDescriptor(addr, uint8(usbEndpointConfigs[ep.Number].Type), usbEndpointPacketSize, interval)
+}
+
+// Send starts sending a packet of at most 64 bytes to the host on an IN
+// endpoint. It doesn't wait for the transfer to complete, use the TxHandler
+// callback for that. It returns ErrUSBEndpointBusy if the previous packet has
+// not been sent yet.
+func (ep USBEndpoint) Send(data []byte) error {
+	if len(data) > usbEndpointPacketSize {
+		return ErrUSBPacketTooLarge
+	}
+	n := uint32(ep.Number)
+	if getEPSTATUS(n)&sam.USB_DEVICE_ENDPOINT_EPSTATUS_BK1RDY != 0 {
+		return ErrUSBEndpointBusy
+	}
+	copy(udd_ep_in_cache_buffer[n][:], data)
+	desc := &usbEndpointDescriptors[n].DeviceDescBank[1]
+	desc.ADDR.Set(uint32(uintptr(unsafe.Pointer(&udd_ep_in_cache_buffer[n]))))
+	desc.PCKSIZE.ClearBits((usb_DEVICE_PCKSIZE_MULTI_PACKET_SIZE_Mask << usb_DEVICE_PCKSIZE_MULTI_PACKET_SIZE_Pos) |
+		(usb_DEVICE_PCKSIZE_BYTE_COUNT_Mask << usb_DEVICE_PCKSIZE_BYTE_COUNT_Pos))
+	desc.PCKSIZE.SetBits(uint32(len(data)&usb_DEVICE_PCKSIZE_BYTE_COUNT_Mask) << usb_DEVICE_PCKSIZE_BYTE_COUNT_Pos)
+	setEPINTFLAG(n, sam.USB_DEVICE_ENDPOINT_EPINTFLAG_TRCPT1)
+	setEPSTATUSSET(n, sam.USB_DEVICE_ENDPOINT_EPSTATUSSET_BK1RDY)
+	return nil
+}
+
+// initUSBEndpoint configures a custom endpoint in hardware and enables its
+// transfer complete interrupt.
+func initUSBEndpoint(ep uint32) {
+	initEndpoint(ep, endPoints[ep])
+	if usbEndpointConfigs[ep].In {
+		setEPINTENSET(ep, sam.USB_DEVICE_ENDPOINT_EPINTENSET_TRCPT1)
+	} else {
+		setEPINTENSET(ep, sam.USB_DEVICE_ENDPOINT_EPINTENSET_TRCPT0)
+	}
+}
+
+// handleUSBEndpoint handles a transfer complete interrupt of a custom endpoint.
+func handleUSBEndpoint(ep uint32, epFlags uint8) {
+	config := &usbEndpointConfigs[ep]
+	if config.In {
+		setEPINTFLAG(ep, sam.USB_DEVICE_ENDPOINT_EPINTFLAG_TRCPT1)
+		if config.TxHandler != nil {
+			config.TxHandler()
+		}
+		return
+	}
+
+	setEPINTFLAG(ep, epFlags)
+	desc := &usbEndpointDescriptors[ep].DeviceDescBank[0]
+	count := (desc.PCKSIZE.Get() >> usb_DEVICE_PCKSIZE_BYTE_COUNT_Pos) & usb_DEVICE_PCKSIZE_BYTE_COUNT_Mask
+	if config.RxHandler != nil {
+		config.RxHandler(udd_ep_out_cache_buffer[ep][:count])
+	}
+
+	// Prepare the endpoint for the next packet.
+	desc.PCKSIZE.ClearBits(usb_DEVICE_PCKSIZE_BYTE_COUNT_Mask << usb_DEVICE_PCKSIZE_BYTE_COUNT_Pos)
+	desc.PCKSIZE.SetBits(usbEndpointPacketSize << usb_DEVICE_PCKSIZE_MULTI_PACKET_SIZE_Pos)
+	setEPSTATUSCLR(ep, sam.USB_DEVICE_ENDPOINT_EPSTATUSCLR_BK0RDY)
+}
@@ -0,0 +1,27 @@
+// +build sam,atsamd51
+
+package machine
+
+import (
+	"runtime/volatile"
+	"unsafe"
+)
+
+// Address of the NVM user page, of which the first 32 bytes hold the
+// configuration that is loaded at reset.
+const userPageAddr = 0x00804000
+
+// ReadUserRow reads the configuration in the NVM user page. It is read-only:
+// changing the configuration requires erasing and rewriting the user page,
+// which is best done with a programmer or bootloader.
+func ReadUserRow() UserRow {
+	var row UserRow
+	for i := uintptr(0); i < uintptr(len(row)); i += 4 {
+		word := volatile.LoadUint32((*uint32)(unsafe.Pointer(uintptr(userPageAddr) + i)))
+		row[i] = byte(word)
+		row[i+1] = byte(word >> 8)
+		row[i+2] = byte(word >> 16)
+		row[i+3] = byte(word >> 24)
+	}
+	return row
+}
@@ -0,0 +1,80 @@
+// +build sam nrf
+
+package machine
+
+import "device/arm"
+
+// Timing of the WS2812 protocol, in nanoseconds. Every bit takes about 1250ns
+// (800kHz) and starts with a high pulse: a short pulse for a 0 and a long pulse
+// for a 1.
+const (
+	ws2812T0H    = 400
+	ws2812T1H    = 800
+	ws2812Period = 1250
+)
+
+// Number of cycles taken by one iteration of the delay loops in WriteWS2812
+// (subs + taken bne) on Cortex-M0+ and Cortex-M4.
+const ws2812CyclesPerLoop = 3
+
+// WriteWS2812 sends the given data to a chain of WS2812 (NeoPixel) LEDs
+// connected to the given pin, which must already be configured as an output.
+// The data is sent as-is, most LEDs expect 3 bytes per LED in GRB order.
+//
+// The high pulse of each bit must be timed precisely, so it is generated in
+// assembly with a delay loop of which the number of iterations is derived from
+// the CPU frequency. The low part of each bit has a much wider tolerance, as
+// long as it stays well below the reset time (about 5µs), so it is allowed to
+// be stretched slightly by the surrounding Go code. Interrupts are disabled
+// while sending.
+func WriteWS2812(pin Pin, data []byte) {
+	set, maskBits := pin.PortMaskSet()
+	clear, _ := pin.PortMaskClear()
+	t0h, t1h, t0l, t1l := ws2812Loops(CPUFrequency())
+
+	mask := arm.DisableInterrupts()
+	for _, c := range data {
+		for i := 0; i < 8; i++ {
+			high, low := t0h, t0l
+			if c&0x80 != 0 {
+				high, low = t1h, t1l
+			}
+			c <<= 1
+			// The delay loops count down in r4, which is declared as clobbered
+			// together with the condition flags set by subs.
+			arm.AsmFull(`
+				str  {maskBits}, {set}
+				mov  r4, {high}
+			1:
+				subs r4, #1
+				bne  1b
+				str  {maskBits}, {clear}
+				mov  r4, {low}
+			2:
+				subs r4, #1
+				bne  2b
+			`, map[string]interface{}{
+				"maskBits": maskBits,
+				"set":      set,
+				"clear":    clear,
+				"high":     high,
+				"low":      low,
+			}, "r4", "cc")
+		}
+	}
+	arm.EnableInterrupts(mask)
+}
+
+// ws2812Loops returns the number of delay loop iterations for the high and low
+// parts of a 0 bit and a 1 bit, at the given CPU frequency. Every delay takes
+// at least one iteration.
+func ws2812Loops(frequency uint32) (t0h, t1h, t0l, t1l uint32) {
+	loops := func(ns uint32) uint32 {
+		n := (frequency / 1000000) * ns / 1000 / ws2812CyclesPerLoop
+		if n == 0 {
+			n = 1
+		}
+		return n
+	}
+	return loops(ws2812T0H), loops(ws2812T1H), loops(ws2812Period - ws2812T0H), loops(ws2812Period - ws2812T1H)
+}
@@ -3,6 +3,8 @@ package runtime
 // This file contains implementations for the sync/atomic package.
 
 // All implementations assume there are no goroutines, threads or interrupts.
+// With -wasm-threads, the compiler replaces calls to sync/atomic with calls to
+// the atomic operations in targets/wasm_atomics.c instead.
 
 //go:linkname loadUint64 sync/atomic.LoadUint64
 func loadUint64(addr *uint64) uint64 {
@@ -21,6 +21,9 @@ var globalsEndSymbol unsafe.Pointer
 //go:extern _stack_top
 var stackTopSymbol unsafe.Pointer
 
+//go:extern _stack_size
+var stackSizeSymbol unsafe.Pointer
+
 var (
 	heapStart    = uintptr(unsafe.Pointer(&heapStartSymbol))
 	heapEnd      = uintptr(unsafe.Pointer(&heapEndSymbol))
@@ -28,3 +31,9 @@ var (
 	globalsEnd   = uintptr(unsafe.Pointer(&globalsEndSymbol))
 	stackTop     = uintptr(unsafe.Pointer(&stackTopSymbol))
 )
+
+// systemStackBottom returns the lowest address of the system stack, which is
+// placed below _stack_top by the linker script.
+func systemStackBottom() (uintptr, bool) {
+	return stackTop - uintptr(unsafe.Pointer(&stackSizeSymbol)), true
+}
@@ -22,6 +22,10 @@ package runtime
 // the 'comma-ok' value to true.
 // A receive operation on a closed channel is completed by zeroing the data
 // element of the receiving coroutine and setting the 'comma-ok' value to false.
+//
+// Channels may be used from the timer interrupt (see timer.go). Therefore the
+// channel state is only modified with the scheduler locked, which is unlocked
+// again right before a goroutine blocks.
 
 import (
 	"unsafe"
@@ -412,14 +416,18 @@ type chanSelectState struct {
 // This operation will block unless a value is immediately available.
 // May panic if the channel is closed.
 func chanSend(ch *channel, value unsafe.Pointer) {
+	mask := lockScheduler()
 	if ch.trySend(value) {
 		// value immediately sent
+		raceChan(ch)
 		chanDebug(ch)
+		unlockScheduler(mask)
 		return
 	}
 
 	if ch == nil {
 		// A nil channel blocks forever. Do not schedule this goroutine again.
+		unlockScheduler(mask)
 		deadlock()
 	}
 
@@ -433,7 +441,12 @@ func chanSend(ch *channel, value unsafe.Pointer) {
 		t:    sender,
 	}
 	chanDebug(ch)
+	raceChan(ch)
+	saveGoroutineLock(sender)
+	raceSuspend(sender)
+	unlockScheduler(mask)
 	yield()
+	raceChanWakeup(ch)
 	senderState.ptr = nil
 }
 
@@ -442,14 +455,18 @@ func chanSend(ch *channel, value unsafe.Pointer) {
 // The recieved value is copied into the value pointer.
 // Returns the comma-ok value.
 func chanRecv(ch *channel, value unsafe.Pointer) bool {
+	mask := lockScheduler()
 	if rx, ok := ch.tryRecv(value); rx {
 		// value immediately available
+		raceChan(ch)
 		chanDebug(ch)
+		unlockScheduler(mask)
 		return ok
 	}
 
 	if ch == nil {
 		// A nil channel blocks forever. Do not schedule this goroutine again.
+		unlockScheduler(mask)
 		deadlock()
 	}
 
@@ -463,12 +480,45 @@ func chanRecv(ch *channel, value unsafe.Pointer) bool {
 		t:    receiver,
 	}
 	chanDebug(ch)
+	raceChan(ch)
+	saveGoroutineLock(receiver)
+	raceSuspend(receiver)
+	unlockScheduler(mask)
 	yield()
+	raceChanWakeup(ch)
 	ok := receiverState.data == 1
 	receiverState.ptr, receiverState.data = nil, 0
 	return ok
 }
 
+// chanTrySend sends a single value over the channel, without blocking. It is
+// used for a select statement with a single send and a default case. Returns
+// whether the value was sent.
+func chanTrySend(ch *channel, value unsafe.Pointer) bool {
+	mask := lockScheduler()
+	sent := ch.trySend(value)
+	if sent {
+		raceChan(ch)
+		chanDebug(ch)
+	}
+	unlockScheduler(mask)
+	return sent
+}
+
+// chanTryRecv receives a single value over the channel, without blocking. It is
+// used for a select statement with a single receive and a default case. Returns
+// whether a value was received and the comma-ok value.
+func chanTryRecv(ch *channel, value unsafe.Pointer) (bool, bool) {
+	mask := lockScheduler()
+	rx, ok := ch.tryRecv(value)
+	if rx {
+		raceChan(ch)
+		chanDebug(ch)
+	}
+	unlockScheduler(mask)
+	return rx, ok
+}
+
 // chanClose closes the given channel. If this channel has a receiver or is
 // empty, it closes the channel. Else, it panics.
 func chanClose(ch *channel) {
@@ -476,6 +526,7 @@ func chanClose(ch *channel) {
 		// Not allowed by the language spec.
 		runtimePanic("close of nil channel")
 	}
+	mask := lockScheduler()
 	switch ch.state {
 	case chanStateClosed:
 		// Not allowed by the language spec.
@@ -495,19 +546,21 @@ func chanClose(ch *channel) {
 	case chanStateEmpty, chanStateBuf:
 		// Easy case. No available sender or receiver.
 	}
+	raceChan(ch)
 	ch.state = chanStateClosed
 	chanDebug(ch)
+	unlockScheduler(mask)
 }
 
 // chanSelect is the runtime implementation of the select statement. This is
 // perhaps the most complicated statement in the Go spec. It returns the
 // selected index and the 'comma-ok' value.
-//
-// TODO: do this in a round-robin fashion (as specified in the Go spec) instead
-// of picking the first one that can proceed.
 func chanSelect(recvbuf unsafe.Pointer, states []chanSelectState, ops []channelBlockedList) (uintptr, bool) {
+	mask := lockScheduler()
 	if selected, ok := tryChanSelect(recvbuf, states); selected != ^uintptr(0) {
 		// one channel was immediately ready
+		raceChan(states[selected].ch)
+		unlockScheduler(mask)
 		return selected, ok
 	}
 
@@ -520,6 +573,7 @@ func chanSelect(recvbuf unsafe.Pointer, states []chanSelectState, ops []channelB
 			allSelectOps: ops,
 		}
 		v.ch.blocked = &ops[i]
+		raceChan(v.ch)
 		if v.value == nil {
 			// recv
 			switch v.ch.state {
@@ -551,30 +605,58 @@ func chanSelect(recvbuf unsafe.Pointer, states []chanSelectState, ops []channelB
 	getCoroutine().state().data = 1
 
 	// wait for one case to fire
+	saveGoroutineLock(getCoroutine())
+	raceSuspend(getCoroutine())
+	unlockScheduler(mask)
 	yield()
 
 	// figure out which one fired and return the ok value
-	return (uintptr(getCoroutine().state().ptr) - uintptr(unsafe.Pointer(&states[0]))) / unsafe.Sizeof(chanSelectState{}), getCoroutine().state().data != 0
+	selected := (uintptr(getCoroutine().state().ptr) - uintptr(unsafe.Pointer(&states[0]))) / unsafe.Sizeof(chanSelectState{})
+	raceChanWakeup(states[selected].ch)
+	return selected, getCoroutine().state().data != 0
 }
 
 // tryChanSelect is like chanSelect, but it does a non-blocking select operation.
 func tryChanSelect(recvbuf unsafe.Pointer, states []chanSelectState) (uintptr, bool) {
+	// The Go spec requires that a case is picked uniformly at random when
+	// multiple cases can proceed, so that no channel is starved. Therefore the
+	// cases are polled in a random order, which is created with a Fisher-Yates
+	// shuffle. Most select statements only have a few cases, in which case the
+	// order fits in a buffer on the stack.
+	var orderBuf [8]uint16
+	var order []uint16
+	if len(states) <= len(orderBuf) {
+		order = orderBuf[:len(states)]
+	} else {
+		order = make([]uint16, len(states))
+	}
+	for i := range order {
+		j := fastrand() % uint32(i+1)
+		order[i] = order[j]
+		order[j] = uint16(i)
+	}
+
 	// See whether we can receive from one of the channels.
-	for i, state := range states {
+	mask := lockScheduler()
+	for _, i := range order {
+		state := states[i]
 		if state.value == nil {
 			// A receive operation.
 			if rx, ok := state.ch.tryRecv(recvbuf); rx {
 				chanDebug(state.ch)
+				unlockScheduler(mask)
 				return uintptr(i), ok
 			}
 		} else {
 			// A send operation: state.value is not nil.
 			if state.ch.trySend(state.value) {
 				chanDebug(state.ch)
+				unlockScheduler(mask)
 				return uintptr(i), true
 			}
 		}
 	}
+	unlockScheduler(mask)
 
 	return ^uintptr(0), false
 }
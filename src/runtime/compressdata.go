@@ -0,0 +1,65 @@
+// +build cortexm,compressdata
+
+package runtime
+
+// This file implements the decompression of the initial values of global
+// variables at startup, with -compress-data. The compiler (see
+// transform.CompressGlobals) moves large global variables from .data to .bss
+// and stores their initial values compressed in the read-only data instead.
+//
+// The compression is a simple run-length encoding, which is cheap to
+// decompress and works well for the long runs of the same byte that are common
+// in large initialized data. The data is a sequence of control bytes, each
+// followed by some data:
+//
+//   - 0x00-0x7f: copy the next 1-128 bytes (control byte + 1)
+//   - 0x80-0xff: repeat the next byte 3-130 times (control byte - 0x80 + 3)
+
+import "unsafe"
+
+// compressedGlobal is an entry in the table of compressed globals.
+type compressedGlobal struct {
+	dst  unsafe.Pointer
+	size uintptr // decompressed size in bytes
+}
+
+// compressedGlobalsTable describes all compressed globals. The data of each
+// global follows the data of the previous global.
+type compressedGlobalsTable struct {
+	globals *compressedGlobal
+	count   uintptr
+	data    *byte
+}
+
+// The table is created by the compiler, after the program has been optimized.
+//go:extern tinygo_compressedGlobals
+var compressedGlobals compressedGlobalsTable
+
+// decompressGlobals writes the initial values of all compressed globals.
+func decompressGlobals() {
+	src := uintptr(unsafe.Pointer(compressedGlobals.data))
+	for i := uintptr(0); i < compressedGlobals.count; i++ {
+		global := (*compressedGlobal)(unsafe.Pointer(uintptr(unsafe.Pointer(compressedGlobals.globals)) + i*unsafe.Sizeof(compressedGlobal{})))
+		dst := uintptr(global.dst)
+		end := dst + global.size
+		for dst < end {
+			control := uintptr(*(*byte)(unsafe.Pointer(src)))
+			src++
+			if control < 0x80 {
+				// Literal bytes.
+				n := control + 1
+				memcpy(unsafe.Pointer(dst), unsafe.Pointer(src), n)
+				src += n
+				dst += n
+			} else {
+				// Repeated byte.
+				value := *(*byte)(unsafe.Pointer(src))
+				src++
+				for n := control - 0x80 + 3; n != 0; n-- {
+					*(*byte)(unsafe.Pointer(dst)) = value
+					dst++
+				}
+			}
+		}
+	}
+}
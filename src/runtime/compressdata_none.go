@@ -0,0 +1,8 @@
+// +build cortexm,!compressdata
+
+package runtime
+
+// decompressGlobals does nothing: no globals are compressed without
+// -compress-data.
+func decompressGlobals() {
+}
@@ -0,0 +1,27 @@
+package runtime
+
+import (
+	"unsafe"
+)
+
+// Free releases the memory of a heap allocation explicitly, for programs that
+// manage memory manually instead of relying on the garbage collector. This is
+// meant for code that can't tolerate garbage collection pauses, for example
+// hard real-time code running with -gc=leaking. Most programs should not use
+// it.
+//
+// With -gc=leaking, only the most recent allocation can be freed: ptr must be
+// the start of the last allocated object, and freeing anything else does
+// nothing. Note that many operations allocate implicitly (append, string
+// concatenation, closures, interfaces, maps, etc.), so the most recent
+// allocation is not always the object you expect. With the other garbage
+// collectors Free does nothing at the moment.
+//
+// Freeing memory that is still referenced is not detected: the memory is
+// handed out again by the next allocation and the old references will see it
+// being overwritten. Freeing an object twice is not detected either, and may
+// free another object that has been allocated at the same address in between.
+// Use with great care.
+func Free(ptr unsafe.Pointer) {
+	free(ptr)
+}
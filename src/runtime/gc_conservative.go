@@ -21,7 +21,9 @@ package runtime
 //
 // Metadata is stored in a special area at the beginning of the heap, in the
 // area heapStart..poolStart. The actual blocks are stored in
-// poolStart..heapEnd.
+// poolStart..heapEnd. Alternatively, the metadata can be stored in a fixed
+// region outside the heap (see gcMetadataRegion), in which case the pool starts
+// at heapStart.
 //
 // More information:
 // https://github.com/micropython/micropython/wiki/Memory-Manager
@@ -48,9 +50,10 @@ const (
 )
 
 var (
-	poolStart uintptr // the first heap pointer
-	nextAlloc gcBlock // the next block that should be tried by the allocator
-	endBlock  gcBlock // the block just past the end of the available space
+	metadataStart uintptr // the first block state byte
+	poolStart     uintptr // the first heap pointer
+	nextAlloc     gcBlock // the next block that should be tried by the allocator
+	endBlock      gcBlock // the block just past the end of the available space
 )
 
 // zeroSizedAlloc is just a sentinel that gets returned when allocating 0 bytes.
@@ -138,7 +141,7 @@ func (b gcBlock) findNext() gcBlock {
 
 // State returns the current block state.
 func (b gcBlock) state() blockState {
-	stateBytePtr := (*uint8)(unsafe.Pointer(heapStart + uintptr(b/blocksPerStateByte)))
+	stateBytePtr := (*uint8)(unsafe.Pointer(metadataStart + uintptr(b/blocksPerStateByte)))
 	return blockState(*stateBytePtr>>((b%blocksPerStateByte)*2)) % 4
 }
 
@@ -146,7 +149,7 @@ func (b gcBlock) state() blockState {
 // bits than the current state. Allowed transitions: from free to any state and
 // from head to mark.
 func (b gcBlock) setState(newState blockState) {
-	stateBytePtr := (*uint8)(unsafe.Pointer(heapStart + uintptr(b/blocksPerStateByte)))
+	stateBytePtr := (*uint8)(unsafe.Pointer(metadataStart + uintptr(b/blocksPerStateByte)))
 	*stateBytePtr |= uint8(newState << ((b % blocksPerStateByte) * 2))
 	if gcAsserts && b.state() != newState {
 		runtimePanic("gc: setState() was not successful")
@@ -155,7 +158,7 @@ func (b gcBlock) setState(newState blockState) {
 
 // markFree sets the block state to free, no matter what state it was in before.
 func (b gcBlock) markFree() {
-	stateBytePtr := (*uint8)(unsafe.Pointer(heapStart + uintptr(b/blocksPerStateByte)))
+	stateBytePtr := (*uint8)(unsafe.Pointer(metadataStart + uintptr(b/blocksPerStateByte)))
 	*stateBytePtr &^= uint8(blockStateMask << ((b % blocksPerStateByte) * 2))
 	if gcAsserts && b.state() != blockStateFree {
 		runtimePanic("gc: markFree() was not successful")
@@ -169,7 +172,7 @@ func (b gcBlock) unmark() {
 		runtimePanic("gc: unmark() on a block that is not marked")
 	}
 	clearMask := blockStateMask ^ blockStateHead // the bits to clear from the state
-	stateBytePtr := (*uint8)(unsafe.Pointer(heapStart + uintptr(b/blocksPerStateByte)))
+	stateBytePtr := (*uint8)(unsafe.Pointer(metadataStart + uintptr(b/blocksPerStateByte)))
 	*stateBytePtr &^= uint8(clearMask << ((b % blocksPerStateByte) * 2))
 	if gcAsserts && b.state() != blockStateHead {
 		runtimePanic("gc: unmark() was not successful")
@@ -183,13 +186,31 @@ func (b gcBlock) unmark() {
 func init() {
 	totalSize := heapEnd - heapStart
 
-	// Allocate some memory to keep 2 bits of information about every block.
-	metadataSize := totalSize / (blocksPerStateByte * bytesPerBlock)
+	var metadataSize uintptr
+	var metadataEnd uintptr
+	metadataStart, metadataEnd = gcMetadataRegion()
+	if metadataStart == metadataEnd {
+		// Allocate some memory to keep 2 bits of information about every
+		// block.
+		metadataStart = heapStart
+		metadataSize = totalSize / (blocksPerStateByte * bytesPerBlock)
+		poolStart = heapStart + metadataSize
+	} else {
+		// The metadata is stored in a fixed region, so the whole heap can be
+		// used for blocks.
+		metadataSize = metadataEnd - metadataStart
+		poolStart = heapStart
+	}
 
 	// Align the pool.
-	poolStart = (heapStart + metadataSize + (bytesPerBlock - 1)) &^ (bytesPerBlock - 1)
+	poolStart = (poolStart + (bytesPerBlock - 1)) &^ (bytesPerBlock - 1)
 	poolEnd := heapEnd &^ (bytesPerBlock - 1)
 	numBlocks := (poolEnd - poolStart) / bytesPerBlock
+	if numBlocks > metadataSize*blocksPerStateByte {
+		// A fixed metadata region may be too small to describe the entire
+		// heap. Only use the part of the heap it can describe.
+		numBlocks = metadataSize * blocksPerStateByte
+	}
 	endBlock = gcBlock(numBlocks)
 	if gcDebug {
 		println("heapStart:        ", heapStart)
@@ -206,7 +227,7 @@ func init() {
 	}
 
 	// Set all block states to 'free'.
-	memzero(unsafe.Pointer(heapStart), metadataSize)
+	memzero(unsafe.Pointer(metadataStart), metadataSize)
 }
 
 // alloc tries to find some free space on the heap, possibly doing a garbage
@@ -236,7 +257,12 @@ func alloc(size uintptr) unsafe.Pointer {
 				GC()
 			} else {
 				// Even after garbage collection, no free memory could be found.
-				runtimePanic("out of memory")
+				// Give the program a chance to free some memory, and run
+				// another garbage collection cycle if it did.
+				if !callOOMHandler() {
+					runtimePanic("out of memory")
+				}
+				GC()
 			}
 		}
 
@@ -275,6 +301,7 @@ func alloc(size uintptr) unsafe.Pointer {
 			// Return a pointer to this allocation.
 			pointer := thisAlloc.pointer()
 			memzero(pointer, size)
+			raceAlloc(pointer, size)
 			return pointer
 		}
 	}
@@ -296,12 +323,16 @@ func GC() {
 
 	// Sweep phase: free all non-marked objects and unmark marked objects for
 	// the next collection cycle.
-	sweep()
+	freeBlocks := sweep()
 
 	// Show how much has been sweeped, for debugging.
 	if gcDebug {
 		dumpHeap()
 	}
+
+	// Now that the amount of free memory is known, warn the program if it is
+	// running low.
+	checkLowMemory(freeBlocks * bytesPerBlock)
 }
 
 // markRoots reads all pointers from start to end (exclusive) and if they look
@@ -346,20 +377,25 @@ func markRoot(addr, root uintptr) {
 	}
 }
 
-// Sweep goes through all memory and frees unmarked memory.
-func sweep() {
+// Sweep goes through all memory and frees unmarked memory. It returns the
+// number of free blocks afterwards.
+func sweep() (freeBlocks uintptr) {
 	freeCurrentObject := false
 	for block := gcBlock(0); block < endBlock; block++ {
 		switch block.state() {
+		case blockStateFree:
+			freeBlocks++
 		case blockStateHead:
 			// Unmarked head. Free it, including all tail blocks following it.
 			block.markFree()
 			freeCurrentObject = true
+			freeBlocks++
 		case blockStateTail:
 			if freeCurrentObject {
 				// This is a tail object following an unmarked head.
 				// Free it now.
 				block.markFree()
+				freeBlocks++
 			}
 		case blockStateMark:
 			// This is a marked object. The next tail blocks must not be freed,
@@ -369,13 +405,14 @@ func sweep() {
 			freeCurrentObject = false
 		}
 	}
+	return
 }
 
 // looksLikePointer returns whether this could be a pointer. Currently, it
 // simply returns whether it lies anywhere in the heap. Go allows interior
 // pointers so we can't check alignment or anything like that.
 func looksLikePointer(ptr uintptr) bool {
-	return ptr >= poolStart && ptr < heapEnd
+	return ptr >= poolStart && ptr < endBlock.address()
 }
 
 // dumpHeap can be used for debugging purposes. It dumps the state of each heap
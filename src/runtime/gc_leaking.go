@@ -4,7 +4,8 @@ package runtime
 
 // This GC implementation is the simplest useful memory allocator possible: it
 // only allocates memory and never frees it. For some constrained systems, it
-// may be the only memory allocator possible.
+// may be the only memory allocator possible. The only exception is the most
+// recent allocation, which can be freed explicitly with runtime.Free.
 
 import (
 	"unsafe"
@@ -13,6 +14,9 @@ import (
 // Ever-incrementing pointer: no memory is freed.
 var heapptr = heapStart
 
+// Start of the most recent allocation, or 0 if it has been freed already.
+var lastAlloc uintptr
+
 func alloc(size uintptr) unsafe.Pointer {
 	// TODO: this can be optimized by not casting between pointers and ints so
 	// much. And by using platform-native data types (e.g. *uint8 for 8-bit
@@ -27,11 +31,17 @@ func alloc(size uintptr) unsafe.Pointer {
 		ptr := (*uint32)(unsafe.Pointer(addr + i))
 		*ptr = 0
 	}
+	lastAlloc = addr
 	return unsafe.Pointer(addr)
 }
 
 func free(ptr unsafe.Pointer) {
-	// Memory is never freed.
+	// Only the most recent allocation can be freed, by moving the heap pointer
+	// back to where it was before. All other memory is never freed.
+	if ptr != nil && uintptr(ptr) == lastAlloc {
+		heapptr = lastAlloc
+		lastAlloc = 0
+	}
 }
 
 func GC() {
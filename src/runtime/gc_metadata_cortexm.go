@@ -0,0 +1,22 @@
+// +build gc.conservative
+// +build cortexm
+
+package runtime
+
+import (
+	"unsafe"
+)
+
+//go:extern _gc_metadata_start
+var gcMetadataStartSymbol unsafe.Pointer
+
+//go:extern _gc_metadata_end
+var gcMetadataEndSymbol unsafe.Pointer
+
+// gcMetadataRegion returns the region reserved by the linker script for the GC
+// metadata (-gc-metadata-size), so that it can be protected with the MPU. The
+// region is empty if no size was given, in which case the metadata is stored at
+// the start of the heap.
+func gcMetadataRegion() (start, end uintptr) {
+	return uintptr(unsafe.Pointer(&gcMetadataStartSymbol)), uintptr(unsafe.Pointer(&gcMetadataEndSymbol))
+}
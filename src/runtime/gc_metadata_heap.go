@@ -0,0 +1,10 @@
+// +build gc.conservative
+// +build !cortexm
+
+package runtime
+
+// gcMetadataRegion returns an empty region: the GC metadata is always stored at
+// the start of the heap on this target.
+func gcMetadataRegion() (start, end uintptr) {
+	return 0, 0
+}
@@ -0,0 +1,83 @@
+package runtime
+
+// This file implements the out-of-memory handler, which gives the program a
+// chance to free memory before an allocation fails, and the low memory warning
+// which is given earlier.
+
+var (
+	oomHandler   func() bool
+	inOOMHandler bool
+
+	lowMemoryThreshold uintptr
+	lowMemoryCallback  func()
+	lowMemoryWarned    bool // free memory is below the threshold
+	inLowMemory        bool
+)
+
+// SetOOMHandler sets a function that is called when an allocation can't be
+// satisfied, even after a garbage collection cycle. The handler can free memory
+// by dropping references to objects it doesn't need (such as caches) and return
+// true, after which the allocation is retried. It must return false when it
+// can't free any more memory, in which case the program panics with an out of
+// memory error as usual. Passing nil removes the handler.
+//
+// The handler must not allocate memory itself: such allocations cause an out
+// of memory panic instead of calling the handler recursively. The handler is
+// only used by the conservative garbage collector, as the other garbage
+// collectors can't reclaim memory.
+func SetOOMHandler(handler func() bool) {
+	oomHandler = handler
+}
+
+// callOOMHandler calls the out-of-memory handler, if there is one, and returns
+// whether the allocation should be retried.
+func callOOMHandler() bool {
+	if oomHandler == nil || inOOMHandler {
+		// Either there is no handler, or the handler itself tried to allocate
+		// memory that isn't available.
+		return false
+	}
+	inOOMHandler = true
+	retry := oomHandler()
+	inOOMHandler = false
+	return retry
+}
+
+// SetLowMemoryThreshold sets a function that is called when the free heap
+// memory drops below the given number of bytes. This gives the program an early
+// warning, so that it can shed load (for example by closing connections or
+// dropping caches) before it actually runs out of memory. Free memory is only
+// known after a garbage collection cycle, which runs when the heap is full or
+// when GC is called. The callback is called once each time free memory drops
+// below the threshold: it is called again only after free memory has risen
+// above the threshold in a later cycle. Passing a nil callback removes it.
+//
+// Like the out-of-memory handler, the callback must not allocate memory and is
+// only used by the conservative garbage collector. Note that the free memory
+// may be fragmented, so an allocation can still fail above the threshold.
+func SetLowMemoryThreshold(bytes uintptr, callback func()) {
+	lowMemoryThreshold = bytes
+	lowMemoryCallback = callback
+	lowMemoryWarned = false
+}
+
+// checkLowMemory calls the low memory callback if the amount of free memory
+// after a garbage collection cycle has dropped below the threshold.
+func checkLowMemory(freeBytes uintptr) {
+	if lowMemoryCallback == nil || inLowMemory {
+		return
+	}
+	if freeBytes >= lowMemoryThreshold {
+		// Warn again the next time free memory drops below the threshold.
+		lowMemoryWarned = false
+		return
+	}
+	if lowMemoryWarned {
+		// Already warned for this crossing.
+		return
+	}
+	lowMemoryWarned = true
+	inLowMemory = true
+	lowMemoryCallback()
+	inLowMemory = false
+}
@@ -7,6 +7,7 @@ func trap()
 
 // Builtin function panic(msg), used as a compiler intrinsic.
 func _panic(message interface{}) {
+	beginPanic()
 	printstring("panic: ")
 	printitf(message)
 	printnl()
@@ -15,6 +16,7 @@ func _panic(message interface{}) {
 
 // Cause a runtime panic, which is (currently) always a string.
 func runtimePanic(msg string) {
+	beginPanic()
 	printstring("panic: runtime error: ")
 	println(msg)
 	abort()
@@ -50,6 +52,11 @@ func slicePanic() {
 	runtimePanic("slice out of range")
 }
 
+// Panic when trying to shift by a negative amount.
+func negativeShiftPanic() {
+	runtimePanic("negative shift amount")
+}
+
 func blockingPanic() {
 	runtimePanic("trying to do blocking operation in exported function")
 }
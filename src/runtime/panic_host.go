@@ -0,0 +1,84 @@
+// +build wasm,panic.host
+
+package runtime
+
+// This file implements the -panic=host strategy. A panic still traps, as there
+// is no way to unwind the stack, but the panic message is kept so that the host
+// can read it after catching the trap. The module can still be used afterwards
+// if the panicking code didn't leave global data half-modified.
+//
+// The trap doesn't run any code in the module, so the stack pointer isn't
+// restored by the functions that were running. Instead, every exported
+// function has a wrapper that saves the stack pointer at entry (see
+// createExportStackWrapper in the compiler), and abort restores it just before
+// trapping. This assumes the host catches the trap where it called the
+// innermost exported function: otherwise the stack of the exported functions
+// further up isn't reclaimed.
+
+import "unsafe"
+
+// Maximum length of a panic message, longer messages are truncated.
+const panicMessageSize = 256
+
+var (
+	panicking    bool
+	panicMessage [panicMessageSize]byte
+	panicLength  uint32
+)
+
+// The stack pointer at the entry of the innermost exported function that is
+// running, or nil if there is none. It is set by the export wrappers.
+var exportStackPointer unsafe.Pointer
+
+// Implemented in targets/wasm_stack.s.
+//go:export tinygo_setStackPointer
+func setStackPointer(sp unsafe.Pointer)
+
+// resetPanicStack frees the stack used by the exported function that is about
+// to trap, by restoring the stack pointer to its value at the entry of that
+// function. It must only be called right before trapping.
+//go:inline
+func resetPanicStack() {
+	if exportStackPointer != nil {
+		setStackPointer(exportStackPointer)
+	}
+}
+
+// beginPanic starts recording a new panic message, which is written to the
+// output with putchar.
+func beginPanic() {
+	panicking = true
+	panicLength = 0
+}
+
+// recordPanicOutput stores an output character in the panic message, if a panic
+// message is being printed.
+func recordPanicOutput(c byte) {
+	if !panicking || c == '\r' || c == '\n' || panicLength >= panicMessageSize {
+		return
+	}
+	panicMessage[panicLength] = c
+	panicLength++
+}
+
+// panicMessagePtr returns the address of the panic message in linear memory.
+//go:export tinygo_panic_message
+func panicMessagePtr() *byte {
+	return &panicMessage[0]
+}
+
+// panicMessageLen returns the length of the panic message, or 0 if no panic
+// happened since the last call to tinygo_clear_panic.
+//go:export tinygo_panic_message_len
+func panicMessageLen() uint32 {
+	return panicLength
+}
+
+// clearPanic forgets about the last panic. It must be called by the host after
+// reading the message, so that a later trap that isn't a panic won't be
+// reported as one.
+//go:export tinygo_clear_panic
+func clearPanic() {
+	panicking = false
+	panicLength = 0
+}
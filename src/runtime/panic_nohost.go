@@ -0,0 +1,14 @@
+// +build !wasm !panic.host
+
+package runtime
+
+// The -panic=host strategy is not used, so panic messages are only printed.
+
+func beginPanic() {
+}
+
+func recordPanicOutput(c byte) {
+}
+
+func resetPanicStack() {
+}
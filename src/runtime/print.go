@@ -201,6 +201,10 @@ func printnl() {
 	putchar('\n')
 }
 
+// printitf prints the value stored in an interface. Basic types are printed as
+// usual, values that implement the error interface are printed using their
+// Error method (and similarly for String), and all other values are printed as
+// a (typecode:value) pair.
 func printitf(msg interface{}) {
 	switch msg := msg.(type) {
 	case bool:
@@ -287,6 +291,47 @@ func printptr(ptr uintptr) {
 	}
 }
 
+// printhex8 prints n in hexadecimal notation with a 0x prefix and leading
+// zeroes, as used for tinygo.Hex. The same goes for the other widths.
+func printhex8(n uint8) {
+	putchar('0')
+	putchar('x')
+	printhexdigits(uint32(n), 2)
+}
+
+func printhex16(n uint16) {
+	putchar('0')
+	putchar('x')
+	printhexdigits(uint32(n), 4)
+}
+
+func printhex32(n uint32) {
+	putchar('0')
+	putchar('x')
+	printhexdigits(n, 8)
+}
+
+func printhex64(n uint64) {
+	putchar('0')
+	putchar('x')
+	// Avoid 64-bit shifts, which are expensive on small targets.
+	printhexdigits(uint32(n>>32), 8)
+	printhexdigits(uint32(n), 8)
+}
+
+// printhexdigits prints the lowest digits nibbles of n, most significant
+// first.
+func printhexdigits(n uint32, digits int) {
+	for i := digits - 1; i >= 0; i-- {
+		nibble := byte(n>>(uint(i)*4)) & 0xf
+		if nibble < 10 {
+			putchar(nibble + '0')
+		} else {
+			putchar(nibble - 10 + 'a')
+		}
+	}
+}
+
 func printbool(b bool) {
 	if b {
 		printstring("true")
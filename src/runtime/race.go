@@ -0,0 +1,360 @@
+// +build race
+
+package runtime
+
+// This file implements a simple data race detector, enabled with the -race
+// flag. Like the race detector of the standard Go toolchain it detects
+// conflicting memory accesses that are not ordered by a happens-before
+// relation, tracked with vector clocks. It is a lot simpler though, because all
+// goroutines run on a single thread and only switch at known points in the
+// scheduler.
+//
+// The compiler inserts a call to raceRead or raceWrite before every memory
+// access that may be shared between goroutines (see transform.InstrumentRace).
+// The scheduler tells the race detector which goroutine is running, while the
+// go statement, channel operations and sync.Mutex (through internal/race)
+// create happens-before relations between goroutines.
+//
+// Some limitations compared to the standard race detector:
+//   * Memory is tracked per address. Two accesses of different sizes that
+//     partially overlap are not detected as a race.
+//   * Memory accesses inside the runtime are not tracked, so races in map
+//     operations, copy and append are not detected.
+//   * The sync/atomic package doesn't create a happens-before relation.
+//   * Races are reported without stack traces.
+
+import (
+	"unsafe"
+)
+
+// raceGoroutine is the race detector state of a single goroutine.
+type raceGoroutine struct {
+	id    uint32
+	clock []uint32 // vector clock, indexed by goroutine ID
+}
+
+// raceEpoch is the moment a memory access happened: the ID of the goroutine
+// and the value of its own clock at that time.
+type raceEpoch struct {
+	id    uint32
+	clock uint32
+}
+
+// raceShadow is the access history of a single memory address.
+type raceShadow struct {
+	write    raceEpoch   // last write, with ID 0 if there was none
+	reads    []raceEpoch // reads since the last write, at most one per goroutine
+	reported bool        // report a race only once per address
+}
+
+var (
+	raceCurrent    *raceGoroutine           // currently running goroutine
+	raceGoroutines uint32                   // number of goroutines created so far
+	raceTasks      map[*task]*raceGoroutine // goroutines of coroutines that will be resumed
+	raceShadows    map[uintptr]*raceShadow  // access history of memory
+	raceSyncs      map[uintptr][]uint32     // vector clocks released to sync objects
+	raceDisabled   int                      // see RaceDisable
+	raceErrors     int                      // number of races found
+	raceBusy       bool                     // inside raceAccess, to ignore its allocations
+)
+
+// raceGetCurrent returns the goroutine that is currently running, creating the
+// main goroutine on first use.
+func raceGetCurrent() *raceGoroutine {
+	if raceCurrent == nil {
+		raceCurrent = raceNewGoroutine(nil)
+	}
+	return raceCurrent
+}
+
+// raceNewGoroutine creates the race detector state of a new goroutine, which
+// inherits the vector clock of the goroutine that started it (if any).
+func raceNewGoroutine(parent *raceGoroutine) *raceGoroutine {
+	raceGoroutines++
+	g := &raceGoroutine{id: raceGoroutines}
+	if parent != nil {
+		g.clock = append(g.clock, parent.clock...)
+	}
+	g.tick()
+	return g
+}
+
+// tick increments the own clock of this goroutine, so that later memory
+// accesses are not ordered by a preceding release operation.
+func (g *raceGoroutine) tick() {
+	g.clock = raceGrow(g.clock, g.id)
+	g.clock[g.id]++
+}
+
+// epoch returns the current moment in time of this goroutine.
+func (g *raceGoroutine) epoch() raceEpoch {
+	return raceEpoch{g.id, g.clock[g.id]}
+}
+
+// saw returns whether the given epoch happened before the current moment of
+// this goroutine.
+func (g *raceGoroutine) saw(e raceEpoch) bool {
+	return e.id == g.id || (int(e.id) < len(g.clock) && e.clock <= g.clock[e.id])
+}
+
+// raceGrow makes sure the vector clock has an entry for the given goroutine ID.
+func raceGrow(clock []uint32, id uint32) []uint32 {
+	for uint32(len(clock)) <= id {
+		clock = append(clock, 0)
+	}
+	return clock
+}
+
+// raceJoin merges the src vector clock into dst, and returns the result.
+func raceJoin(dst, src []uint32) []uint32 {
+	if len(src) != 0 {
+		dst = raceGrow(dst, uint32(len(src)-1))
+	}
+	for i, clock := range src {
+		if clock > dst[i] {
+			dst[i] = clock
+		}
+	}
+	return dst
+}
+
+// raceRead is called by instrumented code before reading from memory.
+func raceRead(addr unsafe.Pointer) {
+	raceAccess(uintptr(addr), false)
+}
+
+// raceWrite is called by instrumented code before writing to memory.
+func raceWrite(addr unsafe.Pointer) {
+	raceAccess(uintptr(addr), true)
+}
+
+// raceAccess checks a memory access by the current goroutine against the
+// access history of the address, and records it.
+func raceAccess(addr uintptr, write bool) {
+	if raceDisabled != 0 || raceBusy {
+		return
+	}
+	raceBusy = true
+	g := raceGetCurrent()
+	if raceShadows == nil {
+		raceShadows = make(map[uintptr]*raceShadow)
+	}
+	s := raceShadows[addr]
+	if s == nil {
+		s = &raceShadow{}
+		raceShadows[addr] = s
+	}
+
+	if !s.reported {
+		if s.write.id != 0 && !g.saw(s.write) {
+			raceReport(s, addr, write, "write", s.write.id)
+		} else if write {
+			for _, read := range s.reads {
+				if !g.saw(read) {
+					raceReport(s, addr, write, "read", read.id)
+					break
+				}
+			}
+		}
+	}
+
+	if write {
+		s.write = g.epoch()
+		s.reads = s.reads[:0]
+	} else {
+		found := false
+		for i := range s.reads {
+			if s.reads[i].id == g.id {
+				s.reads[i] = g.epoch()
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.reads = append(s.reads, g.epoch())
+		}
+	}
+	raceBusy = false
+}
+
+// raceReport prints a data race between the current goroutine and an earlier
+// access by another goroutine.
+func raceReport(s *raceShadow, addr uintptr, write bool, previous string, previousID uint32) {
+	s.reported = true
+	raceErrors++
+	println("==================")
+	println("WARNING: DATA RACE")
+	if write {
+		print("Write at ")
+	} else {
+		print("Read at ")
+	}
+	printptr(addr)
+	println(" by goroutine", raceCurrent.id)
+	println("Previous", previous, "by goroutine", previousID)
+	println("==================")
+}
+
+// raceAlloc forgets the access history of newly allocated memory, which may
+// have been used by other goroutines before it was freed by the GC.
+func raceAlloc(ptr unsafe.Pointer, size uintptr) {
+	if raceBusy || len(raceShadows) == 0 {
+		return
+	}
+	start := uintptr(ptr)
+	end := start + size
+	if uintptr(len(raceShadows)) < size {
+		for addr := range raceShadows {
+			if addr >= start && addr < end {
+				delete(raceShadows, addr)
+			}
+		}
+	} else {
+		for addr := start; addr < end; addr++ {
+			delete(raceShadows, addr)
+		}
+	}
+}
+
+// raceAcquire makes everything released to the sync object at addr happen
+// before the rest of the current goroutine.
+func raceAcquire(addr uintptr) {
+	if raceDisabled != 0 {
+		return
+	}
+	g := raceGetCurrent()
+	g.clock = raceJoin(g.clock, raceSyncs[addr])
+}
+
+// raceRelease releases everything the current goroutine did so far to the sync
+// object at addr, replacing earlier releases unless merge is set.
+func raceRelease(addr uintptr, merge bool) {
+	if raceDisabled != 0 {
+		return
+	}
+	g := raceGetCurrent()
+	if raceSyncs == nil {
+		raceSyncs = make(map[uintptr][]uint32)
+	}
+	if merge {
+		raceSyncs[addr] = raceJoin(raceSyncs[addr], g.clock)
+	} else {
+		raceSyncs[addr] = append(raceSyncs[addr][:0], g.clock...)
+	}
+	g.tick()
+}
+
+// raceGoStart is called by the go statement right before the new goroutine
+// starts running. It returns the goroutine that was running before, to be
+// passed to raceGoEnd.
+func raceGoStart() unsafe.Pointer {
+	parent := raceGetCurrent()
+	raceCurrent = raceNewGoroutine(parent)
+	parent.tick()
+	return unsafe.Pointer(parent)
+}
+
+// raceGoEnd is called by the go statement when the new goroutine returns or
+// blocks for the first time, to continue with the goroutine that started it.
+func raceGoEnd(prev unsafe.Pointer) {
+	raceCurrent = (*raceGoroutine)(prev)
+}
+
+// raceSuspend is called when the current goroutine is about to block. The
+// given coroutine belongs to the current goroutine when it is resumed.
+func raceSuspend(t *task) {
+	if raceTasks == nil {
+		raceTasks = make(map[*task]*raceGoroutine)
+	}
+	raceTasks[t] = raceGetCurrent()
+}
+
+// raceActivate is called when a coroutine is added to the run queue. This is
+// either a coroutine that blocked before (see raceSuspend) or the caller of a
+// blocking function that just returned, which belongs to the current goroutine.
+func raceActivate(t *task) {
+	if _, ok := raceTasks[t]; !ok {
+		raceSuspend(t)
+	}
+}
+
+// raceResume is called by the scheduler right before resuming a coroutine.
+func raceResume(t *task) {
+	if g, ok := raceTasks[t]; ok {
+		raceCurrent = g
+		delete(raceTasks, t)
+	}
+}
+
+// raceChan is called when the current goroutine sends to, receives from or
+// closes a channel. Channel operations are treated as both an acquire and a
+// release of the channel, which orders them in the order they happened. This
+// is stricter than the Go memory model for buffered channels, so some races
+// between goroutines that communicate over a buffered channel are missed.
+func raceChan(ch *channel) {
+	raceAcquire(uintptr(unsafe.Pointer(ch)))
+	raceRelease(uintptr(unsafe.Pointer(ch)), true)
+}
+
+// raceChanWakeup is called when a goroutine continues after it was blocked on
+// a channel operation, which was completed by another goroutine.
+func raceChanWakeup(ch *channel) {
+	raceAcquire(uintptr(unsafe.Pointer(ch)))
+}
+
+// raceFini is called when the main goroutine returns. Like the standard race
+// detector, it exits with status 66 if races were found.
+func raceFini() {
+	if raceErrors != 0 {
+		println("Found", raceErrors, "data race(s)")
+		exit(66)
+	}
+}
+
+// These functions are used by the internal/race package, which is used by the
+// standard library (including the sync package) to tell the race detector
+// about synchronization that is not visible from memory accesses.
+
+func RaceAcquire(addr unsafe.Pointer) {
+	raceAcquire(uintptr(addr))
+}
+
+func RaceRelease(addr unsafe.Pointer) {
+	raceRelease(uintptr(addr), false)
+}
+
+func RaceReleaseMerge(addr unsafe.Pointer) {
+	raceRelease(uintptr(addr), true)
+}
+
+func RaceDisable() {
+	raceDisabled++
+}
+
+func RaceEnable() {
+	raceDisabled--
+}
+
+func RaceRead(addr unsafe.Pointer) {
+	raceAccess(uintptr(addr), false)
+}
+
+func RaceWrite(addr unsafe.Pointer) {
+	raceAccess(uintptr(addr), true)
+}
+
+func RaceReadRange(addr unsafe.Pointer, len int) {
+	for i := 0; i < len; i++ {
+		raceAccess(uintptr(addr)+uintptr(i), false)
+	}
+}
+
+func RaceWriteRange(addr unsafe.Pointer, len int) {
+	for i := 0; i < len; i++ {
+		raceAccess(uintptr(addr)+uintptr(i), true)
+	}
+}
+
+func RaceErrors() int {
+	return raceErrors
+}
@@ -0,0 +1,24 @@
+// +build !race
+
+package runtime
+
+// Stubs for the hooks of the race detector, which is only included with the
+// -race flag. See race.go.
+
+import (
+	"unsafe"
+)
+
+func raceAlloc(ptr unsafe.Pointer, size uintptr) {}
+
+func raceSuspend(t *task) {}
+
+func raceActivate(t *task) {}
+
+func raceResume(t *task) {}
+
+func raceChan(ch *channel) {}
+
+func raceChanWakeup(ch *channel) {}
+
+func raceFini() {}
@@ -0,0 +1,23 @@
+package runtime
+
+// fastrandState is the state of the pseudo-random number generator used by the
+// runtime. It is seeded on first use.
+var fastrandState uint32
+
+// fastrand returns a pseudo-random number. It is cheap to call but not of high
+// quality, which is fine for the runtime: it is only used to avoid always
+// making the same choice, for example in select statements.
+func fastrand() uint32 {
+	if fastrandState == 0 {
+		// Seed from the scheduler clock. With the deterministic scheduler
+		// this makes the sequence the same on every run.
+		fastrandState = uint32(schedulerTicks()) | 1
+	}
+	// xorshift32, see https://en.wikipedia.org/wiki/Xorshift
+	x := fastrandState
+	x ^= x << 13
+	x ^= x >> 17
+	x ^= x << 5
+	fastrandState = x
+	return x
+}
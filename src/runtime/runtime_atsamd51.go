@@ -13,6 +13,7 @@ type timeUnit int64
 //go:export Reset_Handler
 func main() {
 	preinit()
+	initStackGuard()
 	initAll()
 	callMain()
 	abort()
@@ -213,9 +214,26 @@ func waitForSync() {
 // treat all ticks params coming from runtime as being in microseconds
 const tickMicros = 1000
 
+// The RTC runs at 32.768kHz, so the timer resolution is 1e6/32768 =
+// 30.517578125µs. Conversions between RTC ticks and microseconds are exact
+// (multiplying or dividing by 15625/512) so that rounding errors do not
+// accumulate over a series of short sleeps.
+const (
+	rtcTickNumerator   = 15625 // microseconds per RTC tick: 15625/512
+	rtcTickDenominator = 512
+
+	// Writes to the compare register need to be synchronized to the RTC clock
+	// domain, which takes a few RTC ticks. Deadlines closer than this are
+	// waited for by polling the counter instead of relying on the compare
+	// interrupt, which could otherwise be missed.
+	// For related info for SAMD21, see:
+	// https://community.atmel.com/comment/2507091#comment-2507091
+	rtcMinSleepTicks = 8
+)
+
 var (
-	timestamp        timeUnit // ticks since boottime
-	timerLastCounter uint64
+	rtcTicks       uint64 // RTC ticks since boottime
+	rtcLastCounter uint32 // RTC counter value when rtcTicks was last updated
 )
 
 //go:volatile
@@ -225,60 +243,155 @@ var timerWakeup isrFlag
 
 const asyncScheduler = false
 
+// The timers of time.Timer and time.Ticker are run from the CMP1 compare
+// interrupt of the RTC, see timer.go.
+const timerInterrupts = true
+
+// lockScheduler disables interrupts, so that the timer interrupt doesn't modify
+// the run queue or a channel while it is being modified. It returns the
+// previous interrupt state, which must be passed to unlockScheduler.
+//go:inline
+func lockScheduler() uintptr {
+	return arm.DisableInterrupts()
+}
+
+// unlockScheduler restores the interrupt state from before lockScheduler.
+//go:inline
+func unlockScheduler(mask uintptr) {
+	arm.EnableInterrupts(mask)
+}
+
 // sleepTicks should sleep for d number of microseconds.
 func sleepTicks(d timeUnit) {
-	for d != 0 {
-		ticks() // update timestamp
-		ticks := uint32(d)
-		timerSleep(ticks)
-		d -= timeUnit(ticks)
+	rtcSleep(d, false)
+}
+
+// sleepUntilRunnable is like sleepTicks, except that it returns early once the
+// timer interrupt has made a goroutine runnable. It is used by the scheduler.
+func sleepUntilRunnable(d timeUnit) {
+	rtcSleep(d, true)
+}
+
+// rtcSleep sleeps for d microseconds. If untilRunnable is set, it returns early
+// once the run queue isn't empty anymore.
+func rtcSleep(d timeUnit, untilRunnable bool) {
+	if d <= 0 {
+		return
+	}
+	now, _ := updateRTCTicks()
+	// Round up, so that the sleep is never shorter than requested.
+	deadline := now + (uint64(d)*rtcTickDenominator+rtcTickNumerator-1)/rtcTickNumerator
+	for {
+		if untilRunnable && runqueueFront != nil {
+			return
+		}
+		now, counter := updateRTCTicks()
+		if now >= deadline {
+			return
+		}
+		remaining := deadline - now
+		if remaining > 0xffff0000 {
+			// Do not let the compare value wrap around.
+			remaining = 0xffff0000
+		}
+		if remaining < rtcMinSleepTicks {
+			// Too short to reliably set up a compare interrupt.
+			continue
+		}
+		timerSleep(counter+uint32(remaining), untilRunnable)
 	}
 }
 
 // ticks returns number of microseconds since start.
 func ticks() timeUnit {
-	waitForSync()
+	now, _ := updateRTCTicks()
+	return timeUnit(now * rtcTickNumerator / rtcTickDenominator)
+}
 
-	rtcCounter := (uint64(sam.RTC_MODE0.COUNT.Get()) * 305) / 10 // each counter tick == 30.5us
-	offset := (rtcCounter - timerLastCounter)                    // change since last measurement
-	timerLastCounter = rtcCounter
-	timestamp += timeUnit(offset) // TODO: not precise
-	return timestamp
+// updateRTCTicks reads the RTC counter and updates rtcTicks. It returns the new
+// value of rtcTicks and the counter value it corresponds to. The unsigned
+// subtraction makes sure a wrapping 32-bit counter is handled correctly. The
+// scheduler is locked, as this is also done from the timer interrupt.
+func updateRTCTicks() (uint64, uint32) {
+	mask := lockScheduler()
+	waitForSync()
+	counter := sam.RTC_MODE0.COUNT.Get()
+	rtcTicks += uint64(counter - rtcLastCounter)
+	rtcLastCounter = counter
+	now := rtcTicks
+	unlockScheduler(mask)
+	return now, counter
 }
 
-// ticks are in microseconds
-func timerSleep(ticks uint32) {
+// timerSleep waits (using the wfi instruction) until the RTC counter reaches
+// the given compare value. If untilRunnable is set, it also stops waiting once
+// the run queue isn't empty anymore.
+func timerSleep(compare uint32, untilRunnable bool) {
 	timerWakeup = false
-	if ticks < 260 {
-		// due to delay waiting for the register value to sync, the minimum sleep value
-		// for the SAMD51 is 260us.
-		// For related info for SAMD21, see:
-		// https://community.atmel.com/comment/2507091#comment-2507091
-		ticks = 260
-	}
-
-	// request read of count
-	waitForSync()
 
 	// set compare value
-	cnt := sam.RTC_MODE0.COUNT.Get()
-
-	sam.RTC_MODE0.COMP[0].Set(uint32(cnt) + (ticks * 10 / 305)) // each counter tick == 30.5us
+	sam.RTC_MODE0.COMP[0].Set(compare)
+	for sam.RTC_MODE0.SYNCBUSY.HasBits(sam.RTC_MODE0_SYNCBUSY_COMP0) {
+	}
 
 	// enable IRQ for CMP0 compare
 	sam.RTC_MODE0.INTENSET.SetBits(sam.RTC_MODE0_INTENSET_CMP0)
 
-	for !timerWakeup {
+	for {
+		// Check with interrupts disabled: an interrupt that arrives between
+		// the check and the wfi instruction still wakes up the CPU, and is
+		// handled right after interrupts are enabled again.
+		mask := arm.DisableInterrupts()
+		if bool(timerWakeup) || (untilRunnable && runqueueFront != nil) {
+			arm.EnableInterrupts(mask)
+			return
+		}
 		arm.Asm("wfi")
+		arm.EnableInterrupts(mask)
+	}
+}
+
+// setTimerAlarm sets the CMP1 compare interrupt of the RTC to the given time of
+// the scheduler clock in nanoseconds, at which the interrupt runs the timers
+// that have expired. The scheduler must be locked.
+func setTimerAlarm(when int64) {
+	now, counter := updateRTCTicks()
+	// Round up to whole RTC ticks, so that timers never expire early.
+	var target uint64
+	if when > 0 {
+		us := uint64(when+999) / 1000
+		target = (us*rtcTickDenominator + rtcTickNumerator - 1) / rtcTickNumerator
+	}
+	remaining := uint64(rtcMinSleepTicks)
+	if target > now+rtcMinSleepTicks {
+		remaining = target - now
+	}
+	if remaining > 0xffff0000 {
+		// Do not let the compare value wrap around. The alarm is set again
+		// when the interrupt finds that the timer hasn't expired yet.
+		remaining = 0xffff0000
+	}
+	sam.RTC_MODE0.COMP[1].Set(counter + uint32(remaining))
+	for sam.RTC_MODE0.SYNCBUSY.HasBits(sam.RTC_MODE0_SYNCBUSY_COMP1) {
 	}
+	sam.RTC_MODE0.INTENSET.Set(sam.RTC_MODE0_INTENSET_CMP1)
 }
 
 //go:export RTC_IRQHandler
 func handleRTC() {
-	// disable IRQ for CMP0 compare
-	sam.RTC_MODE0.INTFLAG.SetBits(sam.RTC_MODE0_INTENSET_CMP0)
-
-	timerWakeup = true
+	// Read the flags first: writing a one to a flag clears it, so only the
+	// flags that are handled here are written.
+	flags := sam.RTC_MODE0.INTFLAG.Get()
+	if flags&sam.RTC_MODE0_INTFLAG_CMP0 != 0 {
+		// The end of a sleep, see timerSleep.
+		sam.RTC_MODE0.INTFLAG.Set(sam.RTC_MODE0_INTFLAG_CMP0)
+		timerWakeup = true
+	}
+	if flags&sam.RTC_MODE0_INTFLAG_CMP1 != 0 {
+		// A timer of the time package expired, see setTimerAlarm.
+		sam.RTC_MODE0.INTFLAG.Set(sam.RTC_MODE0_INTFLAG_CMP1)
+		runAlarmTimers()
+	}
 }
 
 func initUSBClock() {
@@ -22,8 +22,18 @@ var _sidata unsafe.Pointer
 //go:extern _edata
 var _edata unsafe.Pointer
 
+//go:extern _sramfunc
+var _sramfunc unsafe.Pointer
+
+//go:extern _siramfunc
+var _siramfunc unsafe.Pointer
+
+//go:extern _eramfunc
+var _eramfunc unsafe.Pointer
+
 func preinit() {
-	// Initialize .bss: zero-initialized global variables.
+	// Initialize .bss: zero-initialized global variables. The .noinit section
+	// after it (//go:noinit globals) is left alone on purpose.
 	ptr := unsafe.Pointer(&_sbss)
 	for ptr != unsafe.Pointer(&_ebss) {
 		*(*uint32)(ptr) = 0
@@ -38,6 +48,20 @@ func preinit() {
 		dst = unsafe.Pointer(uintptr(dst) + 4)
 		src = unsafe.Pointer(uintptr(src) + 4)
 	}
+
+	// Initialize .ramfunc: functions that are executed from RAM.
+	src = unsafe.Pointer(&_siramfunc)
+	dst = unsafe.Pointer(&_sramfunc)
+	for dst != unsafe.Pointer(&_eramfunc) {
+		*(*uint32)(dst) = *(*uint32)(src)
+		dst = unsafe.Pointer(uintptr(dst) + 4)
+		src = unsafe.Pointer(uintptr(src) + 4)
+	}
+
+	// Initialize global variables of which the initial value is stored
+	// compressed (with -compress-data). They are in .bss, so this must happen
+	// after it has been cleared.
+	decompressGlobals()
 }
 
 // calleeSavedRegs is the list of registers that must be saved and restored when
@@ -15,11 +15,25 @@ type timeUnit int64
 
 const tickMicros = 1
 
+// timestamp is the time skipped by sleepTicks. The time that actually passed is
+// measured with the SysTick timer, if the program leaves it to the runtime.
 var timestamp timeUnit
 
+// Number of times the SysTick timer wrapped around.
+var systickOverflows uint32
+
+// Whether the runtime uses the SysTick timer as a clock.
+var systickClock bool
+
+// The default SysTick_Handler in targets/cortex-m-qemu.s. It is replaced when
+// the program defines its own.
+//go:extern tinygo_systick
+var tinygo_systick [0]byte
+
 //go:export Reset_Handler
 func main() {
 	preinit()
+	initSysTick()
 	initAll()
 	callMain()
 	arm.SemihostingCall(arm.SemihostingReportException, arm.SemihostingApplicationExit)
@@ -34,7 +48,38 @@ func sleepTicks(d timeUnit) {
 }
 
 func ticks() timeUnit {
-	return timestamp
+	if !systickClock {
+		return timestamp
+	}
+	for {
+		// Retry when the timer wrapped around while reading it.
+		overflows := volatile.LoadUint32(&systickOverflows)
+		current := arm.SYST.SYST_CVR.Get()
+		if volatile.LoadUint32(&systickOverflows) == overflows {
+			micros := uint64(overflows)<<24 + uint64(arm.SYST_RVR_RELOAD_Msk-current)
+			return timestamp + timeUnit(micros*1000)
+		}
+	}
+}
+
+// initSysTick starts the SysTick timer, to measure the time since startup (for
+// example in benchmarks). It runs from the external reference clock, which is
+// 1MHz in QEMU. The timer is left alone when the program defines its own
+// SysTick_Handler, as the program then uses the timer for something else.
+func initSysTick() {
+	vector := (*[16]uintptr)(unsafe.Pointer(uintptr(arm.SCB.VTOR.Get())))
+	if vector[15]&^1 != uintptr(unsafe.Pointer(&tinygo_systick))&^1 {
+		return
+	}
+	systickClock = true
+	arm.SYST.SYST_RVR.Set(arm.SYST_RVR_RELOAD_Msk)
+	arm.SYST.SYST_CVR.Set(0)
+	arm.SYST.SYST_CSR.Set(arm.SYST_CSR_ENABLE | arm.SYST_CSR_TICKINT)
+}
+
+//go:export tinygo_handleSysTick
+func handleSysTick() {
+	volatile.StoreUint32(&systickOverflows, systickOverflows+1)
 }
 
 // UART0 output register.
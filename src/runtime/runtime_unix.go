@@ -54,10 +54,18 @@ func main() int {
 	// Compiler-generated call to main.main().
 	callMain()
 
+	// Report data races with -race.
+	raceFini()
+
 	// For libc compatibility.
 	return 0
 }
 
+// systemStackBottom returns false, as the size of the system stack is not known.
+func systemStackBottom() (uintptr, bool) {
+	return 0, false
+}
+
 func putchar(c byte) {
 	_putchar(int(c))
 }
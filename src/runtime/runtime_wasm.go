@@ -33,7 +33,14 @@ func cwa_main() {
 	callMain()
 }
 
+// systemStackBottom returns the lowest address of the stack, which is at the
+// start of linear memory as the linker is invoked with --stack-first.
+func systemStackBottom() (uintptr, bool) {
+	return 0, true
+}
+
 func putchar(c byte) {
+	recordPanicOutput(c)
 	resource_write(stdout, &c, 1)
 }
 
@@ -66,6 +73,7 @@ func ticks() timeUnit
 
 // Abort executes the wasm 'unreachable' instruction.
 func abort() {
+	resetPanicStack()
 	trap()
 }
 
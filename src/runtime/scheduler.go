@@ -20,17 +20,21 @@ const schedulerDebug = false
 
 // State of a task. Internally represented as:
 //
-//     {i8* next, i8* ptr, i32/i64 data}
+//     {i8* next, i8* ptr, i32/i64 data, i32/i64 locks}
 type taskState struct {
-	next *task
-	ptr  unsafe.Pointer
-	data uint
+	next  *task
+	ptr   unsafe.Pointer
+	data  uint
+	locks uint // see LockGoroutine
 }
 
 // Queues used by the scheduler.
 //
 // TODO: runqueueFront can be removed by making the run queue a circular linked
 // list. The runqueueBack will simply refer to the front in the 'next' pointer.
+//
+// The run queue may be modified from the timer interrupt (see timer.go), so it
+// must only be modified with the scheduler locked.
 var (
 	runqueueFront      *task
 	runqueueBack       *task
@@ -38,6 +42,12 @@ var (
 	sleepQueueBaseTime timeUnit
 )
 
+// Number of LockGoroutine calls of the running goroutine that haven't been
+// undone by UnlockGoroutine yet. Other goroutines keep this number in the
+// locks field of their task while they're not running: it is saved right
+// before a goroutine blocks and restored by the scheduler when it is resumed.
+var goroutineLocks uint
+
 // Simple logging, for debugging.
 func scheduleLog(msg string) {
 	if schedulerDebug {
@@ -125,7 +135,24 @@ func dropChain(t *task, chain **task, tail ***task) {
 // Pause the current task for a given time.
 //go:linkname sleep time.Sleep
 func sleep(duration int64) {
+	if goroutineLocks != 0 {
+		// Sleep without switching to another goroutine, see LockGoroutine.
+		d := timeUnit(duration / tickMicros)
+		if deterministicScheduler {
+			advanceSchedulerTicks(d)
+		} else if asyncScheduler {
+			// sleepTicks only sets a timeout, so wait in a busy loop.
+			end := ticks() + d
+			for ticks() < end {
+			}
+		} else {
+			sleepTicks(d)
+		}
+		return
+	}
 	addSleepTask(getCoroutine(), duration)
+	saveGoroutineLock(getCoroutine())
+	raceSuspend(getCoroutine())
 	yield()
 }
 
@@ -142,6 +169,7 @@ func activateTask(t *task) {
 		return
 	}
 	scheduleLogTask("  set runnable:", t)
+	raceActivate(t)
 	runqueuePushBack(t)
 }
 
@@ -161,6 +189,7 @@ func runqueuePushBack(t *task) {
 			panic("runtime: runqueuePushBack: expected next task to be nil")
 		}
 	}
+	mask := lockScheduler()
 	if runqueueBack == nil { // empty runqueue
 		runqueueBack = t
 		runqueueFront = t
@@ -169,12 +198,32 @@ func runqueuePushBack(t *task) {
 		lastTaskState.next = t
 		runqueueBack = t
 	}
+	unlockScheduler(mask)
+}
+
+// Add this task to the front of the run queue, so that it runs next.
+func runqueuePushFront(t *task) {
+	if schedulerDebug {
+		scheduleLogTask("  pushing front:", t)
+		if t.state().next != nil {
+			panic("runtime: runqueuePushFront: expected next task to be nil")
+		}
+	}
+	mask := lockScheduler()
+	t.state().next = runqueueFront
+	runqueueFront = t
+	if runqueueBack == nil { // empty runqueue
+		runqueueBack = t
+	}
+	unlockScheduler(mask)
 }
 
 // Get a task from the front of the run queue. Returns nil if there is none.
 func runqueuePopFront() *task {
+	mask := lockScheduler()
 	t := runqueueFront
 	if t == nil {
+		unlockScheduler(mask)
 		return nil
 	}
 	state := t.state()
@@ -184,6 +233,7 @@ func runqueuePopFront() *task {
 		runqueueBack = nil
 	}
 	state.next = nil
+	unlockScheduler(mask)
 	return t
 }
 
@@ -196,7 +246,7 @@ func addSleepTask(t *task, duration int64) {
 		}
 	}
 	t.state().data = uint(duration / tickMicros) // TODO: longer durations
-	now := ticks()
+	now := schedulerTicks()
 	if sleepQueue == nil {
 		scheduleLog("  -> sleep new queue")
 
@@ -230,8 +280,9 @@ func scheduler() {
 	for {
 		scheduleLog("")
 		scheduleLog("  schedule")
-		if sleepQueue != nil {
-			now = ticks()
+		resetCallerFrames()
+		if sleepQueue != nil || timersPending() {
+			now = schedulerTicks()
 		}
 
 		// Add tasks that are done sleeping to the end of the runqueue so they
@@ -246,9 +297,14 @@ func scheduler() {
 			runqueuePushBack(t)
 		}
 
+		// Run the functions of expired timers, which may wake up goroutines.
+		if timerQueue != nil {
+			runTimers(int64(now) * tickMicros)
+		}
+
 		t := runqueuePopFront()
 		if t == nil {
-			if sleepQueue == nil {
+			if sleepQueue == nil && !timersPending() {
 				// No more tasks to execute.
 				// It would be nice if we could detect deadlocks here, because
 				// there might still be functions waiting on each other in a
@@ -256,14 +312,31 @@ func scheduler() {
 				scheduleLog("  no tasks left!")
 				return
 			}
-			timeLeft := timeUnit(sleepQueue.state().data) - (now - sleepQueueBaseTime)
+			var timeLeft timeUnit
+			if sleepQueue != nil {
+				timeLeft = timeUnit(sleepQueue.state().data) - (now - sleepQueueBaseTime)
+			}
+			if timerLeft, ok := timerTicksLeft(now); ok && (sleepQueue == nil || timerLeft < timeLeft) {
+				timeLeft = timerLeft
+			}
 			if schedulerDebug {
 				println("  sleeping...", sleepQueue, uint(timeLeft))
 				for t := sleepQueue; t != nil; t = t.state().next {
 					println("    task sleeping:", t, timeUnit(t.state().data))
 				}
 			}
-			sleepTicks(timeLeft)
+			if deterministicScheduler {
+				// Don't actually sleep, only move the virtual clock forward.
+				advanceSchedulerTicks(timeLeft)
+				continue
+			}
+			if timerInterrupts {
+				// The timer interrupt may make a goroutine runnable while the
+				// scheduler sleeps, which ends the sleep early.
+				sleepUntilRunnable(timeLeft)
+			} else {
+				sleepTicks(timeLeft)
+			}
 			if asyncScheduler {
 				// The sleepTicks function above only sets a timeout at which
 				// point the scheduler will be called again. It does not really
@@ -275,11 +348,55 @@ func scheduler() {
 
 		// Run the given task.
 		scheduleLogTask("  run:", t)
+		goroutineLocks = t.state().locks
+		raceResume(t)
 		t.resume()
 	}
 }
 
 func Gosched() {
+	if goroutineLocks != 0 {
+		// Don't switch to another goroutine, see LockGoroutine.
+		return
+	}
 	runqueuePushBack(getCoroutine())
+	saveGoroutineLock(getCoroutine())
+	raceSuspend(getCoroutine())
 	yield()
 }
+
+// LockGoroutine prevents the scheduler from switching to another goroutine
+// until UnlockGoroutine is called, so that a timing-critical section (like a
+// bit-banged protocol) runs to completion. While locked, Gosched returns
+// immediately and time.Sleep waits without running other goroutines. Calls
+// can be nested: the lock is released by the last UnlockGoroutine call. The
+// lock belongs to the calling goroutine only.
+//
+// Interrupts are not disabled, so interrupt handlers still run. Operations
+// that can't continue without another goroutine, like receiving from an empty
+// channel, still switch to other goroutines: these should be avoided while
+// locked. The lock is kept while the goroutine is blocked and applies again
+// once it continues. With the coroutine scheduler, a goroutine started while
+// locked runs right away until it blocks, as usual. Also note that other
+// goroutines are starved while the lock is held, so it should only be held for
+// a short time.
+func LockGoroutine() {
+	goroutineLocks++
+}
+
+// UnlockGoroutine undoes a call to LockGoroutine. It panics if the goroutine is
+// not locked.
+func UnlockGoroutine() {
+	if goroutineLocks == 0 {
+		runtimePanic("UnlockGoroutine without LockGoroutine")
+	}
+	goroutineLocks--
+}
+
+// saveGoroutineLock stores the LockGoroutine state of the running goroutine in
+// the given task, which continues the goroutine when it is resumed by the
+// scheduler. It must be called right before blocking. With the tasks
+// scheduler, yield also saves it for every goroutine that blocks.
+func saveGoroutineLock(t *task) {
+	t.state().locks = goroutineLocks
+}
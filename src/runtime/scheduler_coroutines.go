@@ -46,6 +46,41 @@ func (t *task) state() *taskState {
 
 func makeGoroutine(uintptr) uintptr
 
+// startGoroutineLock is called by the go statement right before running the new
+// goroutine, which starts out without LockGoroutine lock. It returns the lock
+// state of the goroutine that started it, which is restored with
+// endGoroutineLock once the new goroutine returns or blocks for the first time.
+func startGoroutineLock() uint {
+	locks := goroutineLocks
+	goroutineLocks = 0
+	return locks
+}
+
+// endGoroutineLock is called by the go statement to continue with the
+// goroutine that started the new goroutine, see startGoroutineLock.
+func endGoroutineLock(locks uint) {
+	goroutineLocks = locks
+}
+
+// returnToParent is called by a blocking function right before it returns, to
+// continue with the function that called it. The caller belongs to the same
+// goroutine, so it takes over the LockGoroutine state of the goroutine. While
+// locked, the caller is added to the front of the run queue so that no other
+// goroutine runs in between.
+func returnToParent(t *task) {
+	if t == nil {
+		return
+	}
+	saveGoroutineLock(t)
+	if goroutineLocks == 0 {
+		activateTask(t)
+		return
+	}
+	scheduleLogTask("  set runnable:", t)
+	raceActivate(t)
+	runqueuePushFront(t)
+}
+
 // Compiler stub to get the current goroutine. Calls to this function are
 // removed in the goroutine lowering pass.
 func getCoroutine() *task
@@ -75,6 +110,12 @@ func getSystemStackPointer() uintptr {
 	return getCurrentStackPointer()
 }
 
+// stackBottom returns the lowest address of the system stack, which is shared
+// by all goroutines.
+func stackBottom() (uintptr, bool) {
+	return systemStackBottom()
+}
+
 func fakeCoroutine(dst **task) {
 	*dst = getCoroutine()
 	for {
@@ -0,0 +1,30 @@
+// +build deterministic
+
+package runtime
+
+// This file implements a deterministic scheduler clock, selected with the
+// "deterministic" build tag (-tags=deterministic). It is meant as an aid for
+// testing concurrent code, not for production use.
+//
+// Goroutines are always run in first-in, first-out order, but with a real
+// clock the moment a sleeping goroutine wakes up depends on how long other
+// goroutines take to run. With this clock, time only advances when all
+// goroutines are blocked or sleeping, at which point it jumps to the wakeup
+// time of the first sleeping goroutine. This makes the order in which
+// goroutines run independent of execution speed, so the output of a program
+// is the same on every run.
+//
+// Only the scheduler uses this clock: time.Now still returns the real time.
+
+const deterministicScheduler = true
+
+// Virtual time as seen by the scheduler.
+var schedulerTime timeUnit
+
+func schedulerTicks() timeUnit {
+	return schedulerTime
+}
+
+func advanceSchedulerTicks(d timeUnit) {
+	schedulerTime += d
+}
@@ -0,0 +1,15 @@
+// +build !deterministic
+
+package runtime
+
+// The scheduler uses the real clock of the system, see
+// scheduler_deterministic.go for the alternative.
+
+const deterministicScheduler = false
+
+func schedulerTicks() timeUnit {
+	return ticks()
+}
+
+func advanceSchedulerTicks(d timeUnit) {
+}
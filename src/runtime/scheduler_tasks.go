@@ -13,8 +13,60 @@ const stackCanary = uintptr(uint64(0x670c1333b83bf575) & uint64(^uintptr(0)))
 
 var (
 	currentTask *task // currently running goroutine, or nil
+
+	// Number of goroutines that have been started but have not returned yet,
+	// not counting the main goroutine.
+	numGoroutines uintptr
+
+	// Maximum value of numGoroutines, or 0 for no limit. This is set by the
+	// compiler with the -max-goroutines flag.
+	maxGoroutines uintptr
+
+	// Goroutine that has just returned, of which the stack can be reused once
+	// the scheduler runs again.
+	exitedTask *task
 )
 
+// Number of stacks of exited goroutines that are kept for reuse.
+const stackPoolSize = 4
+
+// stackPool contains stacks of goroutines that have exited, so that they can be
+// reused by new goroutines with the same stack size. This avoids allocating a
+// new stack (and the garbage collection cycles that come with it) for every
+// goroutine in the common case of short-lived workers.
+var stackPool [stackPoolSize]struct {
+	stack unsafe.Pointer
+	size  uintptr
+}
+
+// allocStack returns a stack of the given size, either from the pool or newly
+// allocated. It is always zeroed.
+func allocStack(size uintptr) unsafe.Pointer {
+	for i := range stackPool {
+		if stackPool[i].stack != nil && stackPool[i].size == size {
+			stack := stackPool[i].stack
+			stackPool[i].stack = nil
+			return stack
+		}
+	}
+	return alloc(size)
+}
+
+// freeStack adds the stack of an exited goroutine to the pool, if there is room
+// left. Otherwise it is left to the garbage collector.
+func freeStack(stack unsafe.Pointer, size uintptr) {
+	for i := range stackPool {
+		if stackPool[i].stack == nil {
+			// Clear the stack, so that stale pointers on it don't keep
+			// objects alive and so that it is zeroed like a new allocation.
+			memzero(stack, size)
+			stackPool[i].stack = stack
+			stackPool[i].size = size
+			return
+		}
+	}
+}
+
 // This type points to the bottom of the goroutine stack and contains some state
 // that must be kept with the task. The last field is a canary, which is
 // necessary to make sure that no stack overflow occured when switching tasks.
@@ -48,6 +100,13 @@ func (t *task) resume() {
 	currentTask = t
 	switchToTask(t)
 	currentTask = nil
+	if exitedTask != nil {
+		// The goroutine has returned, so its stack isn't in use anymore.
+		stack := unsafe.Pointer(exitedTask.canaryPtr)
+		size := uintptr(unsafe.Pointer(exitedTask)) + unsafe.Sizeof(task{}) - uintptr(stack)
+		exitedTask = nil
+		freeStack(stack, size)
+	}
 }
 
 // switchToScheduler saves the current state on the stack, saves the current
@@ -75,7 +134,25 @@ var startTask [0]uint8
 // argument. It creates a new goroutine stack, prepares it for execution, and
 // adds it to the runqueue.
 func startGoroutine(fn, args uintptr) {
-	stack := alloc(stackSize)
+	startGoroutineStack(fn, args, stackSize)
+}
+
+// startGoroutineStack is like startGoroutine, but with a custom stack size. It
+// is used to implement tinygo.Go.
+func startGoroutineStack(fn, args, stackSize uintptr) {
+	// Round the stack size up to a multiple of 8, to keep the stack pointer
+	// aligned.
+	stackSize = (stackSize + 7) &^ 7
+	if stackSize < unsafe.Sizeof(task{})+unsafe.Sizeof(uintptr(0)) {
+		runtimePanic("goroutine stack too small")
+	}
+	if maxGoroutines != 0 && numGoroutines >= maxGoroutines {
+		// Fail with a clear message instead of running out of memory later on,
+		// which is likely due to a goroutine leak.
+		runtimePanic("goroutine limit exceeded")
+	}
+	numGoroutines++
+	stack := allocStack(stackSize)
 	t := (*task)(unsafe.Pointer(uintptr(stack) + stackSize - unsafe.Sizeof(task{})))
 
 	// Set up the stack canary, a random number that should be checked when
@@ -94,6 +171,15 @@ func startGoroutine(fn, args uintptr) {
 	runqueuePushBack(t)
 }
 
+// exitTask is called by the startTask function (implemented in assembly) when
+// a goroutine returns. The goroutine is never resumed afterwards.
+//export runtime.exitTask
+func exitTask() {
+	numGoroutines--
+	exitedTask = currentTask
+	yield()
+}
+
 // yield suspends execution of the current goroutine
 // any wakeups must be configured before calling yield
 //export runtime.yield
@@ -103,9 +189,23 @@ func yield() {
 	if *currentTask.canaryPtr != stackCanary {
 		runtimePanic("goroutine stack overflow")
 	}
+	// Keep the LockGoroutine state with the task, whichever way it blocks. It
+	// is restored by the scheduler once the task is resumed.
+	saveGoroutineLock(currentTask)
 	switchToScheduler(currentTask)
 }
 
+// stackBottom returns the lowest usable address of the stack of the current
+// goroutine, which is right above the stack canary. Code that doesn't run in a
+// goroutine (such as main.main in a program without goroutines) runs on the
+// system stack.
+func stackBottom() (uintptr, bool) {
+	if currentTask == nil {
+		return systemStackBottom()
+	}
+	return uintptr(unsafe.Pointer(currentTask.canaryPtr)) + unsafe.Sizeof(stackCanary), true
+}
+
 // getSystemStackPointer returns the current stack pointer of the system stack.
 // This is not necessarily the same as the current stack pointer.
 //export tinygo_getSystemStackPointer
@@ -1,16 +1,135 @@
 package runtime
 
+// Func describes a function, as found by FuncForPC.
 type Func struct {
+	name string
 }
 
+// FuncForPC returns the function that contains the given program counter, as
+// returned by Caller and Callers. This only works with the -caller-table flag,
+// in which case the program counter identifies a call site in the call site
+// table. It returns nil otherwise.
 func FuncForPC(pc uintptr) *Func {
-	return nil
+	site := findCallerSite(pc)
+	if site == nil {
+		return nil
+	}
+	return &Func{name: site.function}
 }
 
+// Name returns the name of the function, like main.foo.
 func (f *Func) Name() string {
-	return ""
+	if f == nil {
+		return ""
+	}
+	return f.name
 }
 
+// callerFrame is kept on the stack by every function (outside the runtime)
+// when compiling with -caller-table. The frames form a linked list, from the
+// frame that called into the runtime (callerTop) to the first function of the
+// goroutine. The compiler stores the call site in site before each call, and
+// makes callerTop point to the frame of the calling function. When a function
+// returns, callerTop is restored to its value at function entry.
+type callerFrame struct {
+	parent *callerFrame
+	site   uintptr // index in callerSites plus one, or 0 if not yet known
+}
+
+// callerSite is an entry in the call site table of the program.
+type callerSite struct {
+	function string
+	file     string
+	line     int
+}
+
+// The innermost caller frame of the running goroutine.
+var callerTop *callerFrame
+
+// The call site table, which is filled in by the compiler with -caller-table.
+var callerSites []callerSite
+
+// resetCallerFrames forgets about the caller frames of the goroutine that ran
+// before. It is called by the scheduler: the next goroutine to run has no
+// frames yet or sets callerTop itself before calling any function.
+//go:inline
+func resetCallerFrames() {
+	callerTop = nil
+}
+
+// findCallerSite returns the call site with the given program counter, or nil
+// if there is no such call site.
+func findCallerSite(pc uintptr) *callerSite {
+	if pc == 0 || pc > uintptr(len(callerSites)) {
+		return nil
+	}
+	return &callerSites[pc-1]
+}
+
+// Caller returns the source location of a function call on the stack: the
+// call to Caller with a skip of 0, the call to the function that called Caller
+// with a skip of 1, and so on.
+//
+// The compiler replaces calls with a constant skip of 0 with the location of
+// the call itself, which is correct even when the calling function is inlined.
+// Other calls need the call site table of the -caller-table flag, which also
+// reports the logical call sites of inlined functions. Without it, they always
+// fail.
 func Caller(skip int) (pc uintptr, file string, line int, ok bool) {
-	return 0, "", 0, false
+	frame := callerTop
+	for ; frame != nil && skip > 0; skip-- {
+		frame = frame.parent
+	}
+	if frame == nil {
+		return 0, "", 0, false
+	}
+	site := findCallerSite(frame.site)
+	if site == nil {
+		return 0, "", 0, false
+	}
+	return frame.site, site.file, site.line, true
+}
+
+// Callers stores the program counters of the call sites on the stack in pc and
+// returns the number of entries written. A skip of 1 starts with the call to
+// Callers, 2 with the call to the function that called Callers, and so on. As
+// the frame of Callers itself can't be recorded, a skip of 0 is the same as a
+// skip of 1. It needs the call site table of the -caller-table flag and always
+// returns 0 without it.
+func Callers(skip int, pc []uintptr) int {
+	frame := callerTop
+	for ; frame != nil && skip > 1; skip-- {
+		frame = frame.parent
+	}
+	n := 0
+	for ; frame != nil && n < len(pc); frame = frame.parent {
+		if frame.site == 0 {
+			// The call site isn't known, for example because the function
+			// only made calls inserted by the compiler so far.
+			continue
+		}
+		pc[n] = frame.site
+		n++
+	}
+	return n
+}
+
+// StackRemaining returns the number of bytes that are left on the stack of the
+// current goroutine before it overflows. Deeply recursive code can use it to
+// bail out before running out of stack space, which is especially useful on
+// microcontrollers where goroutine stacks are small.
+//
+// The stack size is not known on Linux and macOS, where this function always
+// returns ^uintptr(0).
+func StackRemaining() uintptr {
+	bottom, ok := stackBottom()
+	if !ok {
+		return ^uintptr(0)
+	}
+	sp := getCurrentStackPointer()
+	if sp < bottom {
+		// The stack has already overflowed.
+		return 0
+	}
+	return sp - bottom
 }
@@ -0,0 +1,20 @@
+// +build stackprotector
+// +build baremetal wasm
+
+package runtime
+
+// Stack protector support for targets without a libc. The compiler protects
+// functions with a stack canary when the -stack-protector flag is used: a copy
+// of the guard value below is stored on the stack on entry and checked before
+// returning. If it was overwritten, __stack_chk_fail is called.
+
+// The value of the stack canary. It is defined by the compiler with a fixed
+// value, and may be replaced by a random value early at startup on chips with
+// a random number generator.
+//go:extern __stack_chk_guard
+var stackChkGuard uintptr
+
+//go:export __stack_chk_fail
+func stackChkFail() {
+	runtimePanic("stack smashing detected")
+}
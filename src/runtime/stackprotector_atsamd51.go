@@ -0,0 +1,20 @@
+// +build sam,atsamd51,stackprotector
+
+package runtime
+
+import (
+	"device/sam"
+)
+
+// initStackGuard replaces the default stack canary with a random value from
+// the TRNG, so that it can't be predicted by an attacker. It must be called
+// before any protected function is called.
+func initStackGuard() {
+	sam.MCLK.APBCMASK.SetBits(sam.MCLK_APBCMASK_TRNG_)
+	sam.TRNG.CTRLA.SetBits(sam.TRNG_CTRLA_ENABLE)
+	for !sam.TRNG.INTFLAG.HasBits(sam.TRNG_INTFLAG_DATARDY) {
+	}
+	stackChkGuard = uintptr(sam.TRNG.DATA.Get())
+	sam.TRNG.CTRLA.ClearBits(sam.TRNG_CTRLA_ENABLE)
+	sam.MCLK.APBCMASK.ClearBits(sam.MCLK_APBCMASK_TRNG_)
+}
@@ -0,0 +1,7 @@
+// +build sam,atsamd51,!stackprotector
+
+package runtime
+
+// initStackGuard is a no-op, as the stack protector is disabled.
+func initStackGuard() {
+}
@@ -0,0 +1,179 @@
+package runtime
+
+// This file implements the timers of the time package: time.Timer,
+// time.Ticker and time.AfterFunc. Timers are kept in a queue sorted by the
+// moment they expire. The scheduler runs the timer functions between
+// goroutines, so they may be delayed by a goroutine that runs for a long time
+// without blocking.
+//
+// On chips with timer interrupts (see timerInterrupts), the timers of
+// time.Timer and time.Ticker are kept in a separate queue instead, which is run
+// from a hardware compare interrupt. Their function only does a non-blocking
+// send of the current time on the timer channel, so the time is sent at the
+// moment the timer expires, independent of what the goroutines are doing. The
+// run queue and channels are modified from the interrupt in that case, which
+// is why they are protected by lockScheduler. The functions of time.AfterFunc
+// start a new goroutine, which allocates memory, so these are always run by the
+// scheduler.
+//
+// A timer that is still running (such as a time.Ticker that was never stopped)
+// keeps the scheduler running, like a sleeping goroutine would.
+
+// runtimeTimer has the same layout as the runtimeTimer type in the time
+// package (Go 1.11 up to 1.13). The first two fields are reserved for the
+// runtime, they are not used here.
+type runtimeTimer struct {
+	tb     uintptr
+	i      int
+	when   int64
+	period int64
+	f      func(interface{}, uintptr)
+	arg    interface{}
+	seq    uintptr
+}
+
+// timerNode is an entry in the timer queue.
+type timerNode struct {
+	next  *timerNode
+	timer *runtimeTimer
+	when  int64 // expiry time according to the scheduler clock, in nanoseconds
+}
+
+// Queue of timers that are run by the scheduler, sorted by expiry time.
+var timerQueue *timerNode
+
+// Queue of timers that are run from the timer interrupt, sorted by expiry time.
+// It is only used if timerInterrupts is set, and must only be accessed with
+// the scheduler locked.
+var alarmQueue *timerNode
+
+//go:linkname time_runtimeNano time.runtimeNano
+func time_runtimeNano() int64 {
+	return nanotime()
+}
+
+// schedulerNanotime returns the time of the scheduler clock in nanoseconds.
+// It is the same as nanotime, except with the deterministic scheduler.
+func schedulerNanotime() int64 {
+	return int64(schedulerTicks()) * tickMicros
+}
+
+// startTimer adds a timer to the timer queue.
+//go:linkname startTimer time.startTimer
+func startTimer(t *runtimeTimer) {
+	// The expiry time is relative to the clock of the time package, convert
+	// it to the scheduler clock.
+	tn := &timerNode{
+		timer: t,
+		when:  t.when - nanotime() + schedulerNanotime(),
+	}
+	if _, isAfterFunc := t.arg.(func()); timerInterrupts && !deterministicScheduler && !isAfterFunc {
+		// A time.Timer or time.Ticker, which is run from the timer interrupt.
+		mask := lockScheduler()
+		addTimer(&alarmQueue, tn)
+		if alarmQueue == tn {
+			setTimerAlarm(tn.when)
+		}
+		unlockScheduler(mask)
+		return
+	}
+	addTimer(&timerQueue, tn)
+}
+
+// stopTimer removes a timer from the timer queue. It returns whether the timer
+// was still in the queue.
+//go:linkname stopTimer time.stopTimer
+func stopTimer(t *runtimeTimer) bool {
+	// The timer interrupt may still fire for a timer that has been removed
+	// from the alarm queue. It then only sets the alarm for the next timer.
+	mask := lockScheduler()
+	removed := removeTimer(&timerQueue, t) || removeTimer(&alarmQueue, t)
+	unlockScheduler(mask)
+	return removed
+}
+
+// removeTimer removes a timer from the given queue. It returns whether the
+// timer was in the queue.
+func removeTimer(q **timerNode, t *runtimeTimer) bool {
+	for ; *q != nil; q = &(*q).next {
+		if (*q).timer == t {
+			*q = (*q).next
+			return true
+		}
+	}
+	return false
+}
+
+// addTimer inserts a timer node into the given timer queue, after the timers
+// that expire at the same time.
+func addTimer(q **timerNode, tn *timerNode) {
+	for ; *q != nil; q = &(*q).next {
+		if tn.when < (*q).when {
+			break
+		}
+	}
+	tn.next = *q
+	*q = tn
+}
+
+// runTimers runs the functions of all timers in the scheduler queue that have
+// expired at the given time of the scheduler clock (in nanoseconds).
+func runTimers(now int64) {
+	runTimerQueue(&timerQueue, now)
+}
+
+// runAlarmTimers runs the functions of all expired timers in the alarm queue,
+// and sets the alarm for the next one. It is called from the timer interrupt.
+func runAlarmTimers() {
+	runTimerQueue(&alarmQueue, schedulerNanotime())
+	if alarmQueue != nil {
+		setTimerAlarm(alarmQueue.when)
+	}
+}
+
+// runTimerQueue runs the functions of all timers in the given queue that have
+// expired at the given time of the scheduler clock (in nanoseconds).
+func runTimerQueue(q **timerNode, now int64) {
+	for *q != nil && (*q).when <= now {
+		tn := *q
+		*q = tn.next
+		tn.next = nil
+		t := tn.timer
+		if t.period > 0 {
+			// Periodic timers (time.Ticker) expire at a fixed interval from
+			// the previous expiry, so that delays don't accumulate. Like in
+			// the Go runtime, ticks that were missed entirely are dropped.
+			tn.when += t.period * (1 + (now-tn.when)/t.period)
+			addTimer(q, tn)
+		}
+		t.f(t.arg, t.seq)
+	}
+}
+
+// timerTicksLeft returns the number of scheduler ticks until the first timer
+// of either queue expires, rounded up. It returns false if there are no timers.
+func timerTicksLeft(now timeUnit) (timeUnit, bool) {
+	mask := lockScheduler()
+	first := timerQueue
+	if alarmQueue != nil && (first == nil || alarmQueue.when < first.when) {
+		first = alarmQueue
+	}
+	if first == nil {
+		unlockScheduler(mask)
+		return 0, false
+	}
+	left := first.when - int64(now)*tickMicros
+	unlockScheduler(mask)
+	if left <= 0 {
+		return 0, true
+	}
+	return timeUnit((left + tickMicros - 1) / tickMicros), true
+}
+
+// timersPending returns whether there are timers in either queue.
+func timersPending() bool {
+	mask := lockScheduler()
+	pending := timerQueue != nil || alarmQueue != nil
+	unlockScheduler(mask)
+	return pending
+}
@@ -0,0 +1,28 @@
+// +build !sam !atsamd51
+
+package runtime
+
+// All timers of the time package are run by the scheduler on this chip, see
+// timer.go.
+const timerInterrupts = false
+
+// lockScheduler is a no-op, as the scheduler state is never modified from an
+// interrupt without timer interrupts.
+//go:inline
+func lockScheduler() uintptr {
+	return 0
+}
+
+// unlockScheduler is a no-op, see lockScheduler.
+//go:inline
+func unlockScheduler(mask uintptr) {
+}
+
+// setTimerAlarm is never called without timer interrupts.
+func setTimerAlarm(when int64) {
+}
+
+// sleepUntilRunnable is never called without timer interrupts.
+func sleepUntilRunnable(d timeUnit) {
+	sleepTicks(d)
+}
@@ -1,5 +1,10 @@
 package sync
 
+import (
+	"internal/race"
+	"unsafe"
+)
+
 // These mutexes assume there is only one thread of operation: no goroutines,
 // interrupts or anything else.
 
@@ -12,12 +17,20 @@ func (m *Mutex) Lock() {
 		panic("todo: block on locked mutex")
 	}
 	m.locked = true
+	if race.Enabled {
+		race.Acquire(unsafe.Pointer(m))
+	}
 }
 
 func (m *Mutex) Unlock() {
 	if !m.locked {
 		panic("sync: unlock of unlocked Mutex")
 	}
+	if race.Enabled {
+		// Merge instead of replace, so that readers of a RWMutex that unlock
+		// before the last one are included.
+		race.ReleaseMerge(unsafe.Pointer(m))
+	}
 	m.locked = false
 }
 
@@ -37,6 +50,8 @@ func (rw *RWMutex) Unlock() {
 func (rw *RWMutex) RLock() {
 	if rw.readers == 0 {
 		rw.m.Lock()
+	} else if race.Enabled {
+		race.Acquire(unsafe.Pointer(&rw.m))
 	}
 	rw.readers++
 }
@@ -48,5 +63,7 @@ func (rw *RWMutex) RUnlock() {
 	rw.readers--
 	if rw.readers == 0 {
 		rw.m.Unlock()
+	} else if race.Enabled {
+		race.ReleaseMerge(unsafe.Pointer(&rw.m))
 	}
 }
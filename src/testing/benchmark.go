@@ -6,12 +6,158 @@
 
 package testing
 
+import (
+	"fmt"
+	"time"
+)
+
+// benchTime is the approximate run time of each benchmark.
+const benchTime = time.Second
+
 // B is a type passed to Benchmark functions to manage benchmark timing and to
 // specify the number of iterations to run.
-//
-// TODO: Implement benchmarks. This struct allows test files containing
-// benchmarks to compile and run, but will not run the benchmarks themselves.
 type B struct {
 	common
 	N int
+
+	start     time.Time     // time the timer was last started
+	duration  time.Duration // time measured so far
+	timerOn   bool
+	benchFunc func(b *B)
+}
+
+// BenchmarkToCall is a reference to a benchmark that should be called during a
+// test suite run.
+type BenchmarkToCall struct {
+	// Name of the benchmark to call.
+	Name string
+	// Function reference to the benchmark.
+	Func func(*B)
+}
+
+// StartTimer starts timing a test. This function is called automatically
+// before a benchmark starts, but it can also be used to resume timing after
+// a call to StopTimer.
+func (b *B) StartTimer() {
+	if !b.timerOn {
+		b.start = time.Now()
+		b.timerOn = true
+	}
+}
+
+// StopTimer stops timing a test. This can be used to pause the timer
+// while performing complex initialization that you don't
+// want to measure.
+func (b *B) StopTimer() {
+	if b.timerOn {
+		b.duration += time.Since(b.start)
+		b.timerOn = false
+	}
+}
+
+// ResetTimer zeroes the elapsed benchmark time.
+// It does not affect whether the timer is running.
+func (b *B) ResetTimer() {
+	if b.timerOn {
+		b.start = time.Now()
+	}
+	b.duration = 0
+}
+
+// runN runs a single benchmark for the specified number of iterations.
+func (b *B) runN(n int) {
+	b.N = n
+	b.ResetTimer()
+	b.StartTimer()
+	b.benchFunc(b)
+	b.StopTimer()
+}
+
+// launch runs the benchmark with an increasing number of iterations until it
+// takes at least benchTime, and returns the result of the last run.
+func (b *B) launch() BenchmarkResult {
+	n := 1
+	b.runN(n)
+	for !b.failed && b.duration < benchTime && n < 1e9 {
+		last := n
+		// Predict the number of iterations needed to reach benchTime, with
+		// some margin as the prediction is often too low.
+		n = int(benchTime.Nanoseconds())
+		if nsop := b.duration.Nanoseconds() / int64(last); nsop > 0 {
+			n /= int(nsop)
+		}
+		// Run at least one more iteration than last time, and grow at most
+		// 100x at a time.
+		n = max(min(n+n/5, 100*last), last+1)
+		n = roundUp(n)
+		b.runN(n)
+	}
+	return BenchmarkResult{N: b.N, T: b.duration}
+}
+
+func min(x, y int) int {
+	if x > y {
+		return y
+	}
+	return x
+}
+
+func max(x, y int) int {
+	if x < y {
+		return y
+	}
+	return x
+}
+
+// roundDown10 rounds a number down to the nearest power of 10.
+func roundDown10(n int) int {
+	var tens = 0
+	// tens = floor(log_10(n))
+	for n >= 10 {
+		n = n / 10
+		tens++
+	}
+	// result = 10^tens
+	result := 1
+	for i := 0; i < tens; i++ {
+		result *= 10
+	}
+	return result
+}
+
+// roundUp rounds x up to a number of the form [1eX, 2eX, 3eX, 5eX].
+func roundUp(n int) int {
+	base := roundDown10(n)
+	switch {
+	case n <= base:
+		return base
+	case n <= (2 * base):
+		return 2 * base
+	case n <= (3 * base):
+		return 3 * base
+	case n <= (5 * base):
+		return 5 * base
+	default:
+		return 10 * base
+	}
+}
+
+// BenchmarkResult contains the results of a benchmark run.
+type BenchmarkResult struct {
+	N int           // The number of iterations.
+	T time.Duration // The total time taken.
+}
+
+// NsPerOp returns the "ns/op" metric.
+func (r BenchmarkResult) NsPerOp() int64 {
+	if r.N <= 0 {
+		return 0
+	}
+	return r.T.Nanoseconds() / int64(r.N)
+}
+
+// String returns a summary of the benchmark results, in the same format as the
+// standard library.
+func (r BenchmarkResult) String() string {
+	return fmt.Sprintf("%8d\t%10d ns/op", r.N, r.NsPerOp())
 }
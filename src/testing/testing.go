@@ -166,6 +166,10 @@ type TestToCall struct {
 type M struct {
 	// tests is a list of the test names to execute
 	Tests []TestToCall
+
+	// Benchmarks is a list of the benchmarks to run after the tests. Only
+	// benchmarks selected with the -bench flag are included.
+	Benchmarks []BenchmarkToCall
 }
 
 // Run the test suite.
@@ -194,6 +198,25 @@ func (m *M) Run() int {
 		}
 	}
 
+	for _, benchmark := range m.Benchmarks {
+		b := &B{
+			common: common{
+				name:   benchmark.Name,
+				output: &bytes.Buffer{},
+			},
+			benchFunc: benchmark.Func,
+		}
+
+		result := b.launch()
+		if b.failed {
+			fmt.Printf("--- FAIL: %s\n", benchmark.Name)
+			fmt.Println(b.output)
+			failures++
+		} else {
+			fmt.Printf("%s\t%s\n", benchmark.Name, result)
+		}
+	}
+
 	if failures > 0 {
 		fmt.Printf("exit status %d\n", failures)
 		fmt.Println("FAIL")
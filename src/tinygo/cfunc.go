@@ -0,0 +1,32 @@
+package tinygo
+
+import "unsafe"
+
+// CFunc converts the Go func value fn to a C function pointer and a context
+// pointer, so that it can be passed as a callback to C libraries that take a
+// function pointer and a void* context. The returned function pointer has the
+// same parameters as fn followed by a void* parameter for the context, for
+// example:
+//
+//     fnptr, context := tinygo.CFunc(func(a, b C.int) C.int { ... })
+//
+// returns a pointer to a C function like this:
+//
+//     int fnptr(int a, int b, void *context);
+//
+// The parameters and the result of fn must be integers, floats or pointers,
+// and fn can have at most one result. C APIs that pass the context in a
+// different position need a small C wrapper.
+//
+// The context refers to a heap allocated copy of fn, which is only kept alive
+// as long as the context pointer is reachable from Go: the garbage collector
+// doesn't know about pointers stored in C memory. Also, fn must not block as it
+// is called from C.
+//
+// The type of fn must be known at compile time: the compiler replaces direct
+// calls to this function and reports an error if fn is not a func value.
+func CFunc(fn interface{}) (fnptr, context unsafe.Pointer) {
+	// This function body is only used when this function is called
+	// indirectly, in which case the type of fn isn't known.
+	panic("tinygo.CFunc: must be called directly")
+}
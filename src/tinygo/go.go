@@ -0,0 +1,28 @@
+// Package tinygo provides TinyGo specific extensions to the language. The
+// functions in this package are implemented as compiler builtins.
+//
+// The compiler also adds the constants FlashSize and RAMSize to this package,
+// with the memory sizes of the chip from the target specification (or 0 if
+// unknown). The same sizes are available as build tags like flash_gte_256k and
+// ram_gte_32k, one for every power of two up to the size in kilobytes.
+package tinygo
+
+// Go starts fn as a new goroutine, like a go statement, but with a stack of
+// stackSize bytes instead of the default goroutine stack size. This makes it
+// possible to give a few goroutines a large stack without raising the stack
+// size of all goroutines.
+//
+// The stack size is only used by the task-based scheduler. The coroutine-based
+// scheduler doesn't use separate goroutine stacks, so the stack size is ignored
+// there.
+//
+// Using this function is unsafe: there is only a limited check for stack
+// overflows, when the goroutine switches back to the scheduler, so a stack that
+// is too small for fn will corrupt memory before it is detected (if at all).
+// The stack size includes some bookkeeping data of the scheduler.
+func Go(stackSize uintptr, fn func()) {
+	// This function body is only used when this function is called indirectly,
+	// in which case the stack size is ignored. Direct calls are replaced by the
+	// compiler.
+	go fn()
+}
@@ -0,0 +1,13 @@
+package tinygo
+
+// Hex is an integer that is printed in hexadecimal notation by the print and
+// println builtins, for example to print the value of a register without
+// importing fmt:
+//
+//     println("status:", tinygo.Hex(reg.Get()))
+//
+// The value is printed with a 0x prefix and with leading zeroes, as many digits
+// as the size of the integer that was converted to Hex. Constants have no size
+// and are printed as 64-bit value. Signed integers are printed as their two's
+// complement, so int8(-1) is printed as 0xff.
+type Hex uint64
@@ -0,0 +1,17 @@
+package tinygo
+
+import "unsafe"
+
+// Prefetch hints to the CPU that the memory at ptr will be read soon, so that
+// it can be loaded into the data cache ahead of time. This may speed up loops
+// over large amounts of data on chips with a data cache, such as the
+// Cortex-M7.
+//
+// The hint is advisory: it never changes the behavior of the program, and ptr
+// may be invalid or nil as it is never dereferenced. Direct calls are replaced
+// by the compiler with a prefetch instruction on targets that have one, and
+// are removed on other targets (like AVR and WebAssembly).
+func Prefetch(ptr unsafe.Pointer) {
+	// This function body is only used when this function is called indirectly,
+	// in which case no prefetch is done.
+}
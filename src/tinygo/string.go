@@ -0,0 +1,15 @@
+package tinygo
+
+// NoCopyString converts a byte slice to a string without copying the bytes, so
+// that the string points to the backing array of the slice. This avoids the
+// allocation of a regular string(b) conversion, which can be useful in hot
+// paths.
+//
+// Using this function is unsafe: strings are immutable, so b must not be
+// modified anymore while the string (or any string derived from it) is in use.
+func NoCopyString(b []byte) string {
+	// This function body is only used when this function is called indirectly,
+	// in which case the bytes are copied. Direct calls are replaced by the
+	// compiler.
+	return string(b)
+}
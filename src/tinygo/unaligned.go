@@ -0,0 +1,60 @@
+package tinygo
+
+// LoadUnaligned16 reads a little-endian uint16 from the start of b, which does
+// not need to be aligned. Direct calls are replaced by the compiler with a
+// single load on targets that support unaligned memory accesses, and with a
+// byte-by-byte load on other targets. It panics if b is too short.
+func LoadUnaligned16(b []byte) uint16 {
+	// The function bodies in this file are only used when these functions are
+	// called indirectly.
+	_ = b[1] // bounds check
+	return uint16(b[0]) | uint16(b[1])<<8
+}
+
+// LoadUnaligned32 reads a little-endian uint32 from the start of b, see
+// LoadUnaligned16.
+func LoadUnaligned32(b []byte) uint32 {
+	_ = b[3] // bounds check
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+// LoadUnaligned64 reads a little-endian uint64 from the start of b, see
+// LoadUnaligned16.
+func LoadUnaligned64(b []byte) uint64 {
+	_ = b[7] // bounds check
+	return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24 |
+		uint64(b[4])<<32 | uint64(b[5])<<40 | uint64(b[6])<<48 | uint64(b[7])<<56
+}
+
+// StoreUnaligned16 writes v as little-endian uint16 to the start of b, which
+// does not need to be aligned. Like LoadUnaligned16, direct calls are replaced
+// by the compiler. It panics if b is too short.
+func StoreUnaligned16(b []byte, v uint16) {
+	_ = b[1] // bounds check
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+}
+
+// StoreUnaligned32 writes v as little-endian uint32 to the start of b, see
+// StoreUnaligned16.
+func StoreUnaligned32(b []byte, v uint32) {
+	_ = b[3] // bounds check
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+	b[3] = byte(v >> 24)
+}
+
+// StoreUnaligned64 writes v as little-endian uint64 to the start of b, see
+// StoreUnaligned16.
+func StoreUnaligned64(b []byte, v uint64) {
+	_ = b[7] // bounds check
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+	b[3] = byte(v >> 24)
+	b[4] = byte(v >> 32)
+	b[5] = byte(v >> 40)
+	b[6] = byte(v >> 48)
+	b[7] = byte(v >> 56)
+}
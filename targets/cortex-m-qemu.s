@@ -11,6 +11,17 @@ Default_Handler:
     wfe
     b    Default_Handler
 
+// The runtime uses the SysTick timer as a clock. A program may take over the
+// timer by defining its own SysTick_Handler, which replaces this weak one.
+.section .text.tinygo_systick
+.global  tinygo_systick
+.weak    SysTick_Handler
+.type    tinygo_systick, %function
+.type    SysTick_Handler, %function
+tinygo_systick:
+SysTick_Handler:
+    b    tinygo_handleSysTick
+
 // Avoid the need for repeated .weak and .set instructions.
 .macro IRQ handler
     .weak  \handler
@@ -49,4 +60,3 @@ Default_Handler:
     IRQ SVC_Handler
     IRQ DebugMon_Handler
     IRQ PendSV_Handler
-    IRQ SysTick_Handler
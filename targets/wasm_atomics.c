@@ -0,0 +1,48 @@
+// Atomic operations for WebAssembly with a shared memory (-wasm-threads). The
+// compiler lowers calls to the sync/atomic package to calls to these functions,
+// which are compiled with -matomics to the atomic instructions of WebAssembly.
+//
+// The functions use the memory order of sync/atomic, which is sequentially
+// consistent. Add returns the new value, like in Go.
+
+#include <stdint.h>
+
+uint32_t tinygo_atomic_add32(uint32_t *ptr, uint32_t delta) {
+	return __atomic_add_fetch(ptr, delta, __ATOMIC_SEQ_CST);
+}
+
+uint64_t tinygo_atomic_add64(uint64_t *ptr, uint64_t delta) {
+	return __atomic_add_fetch(ptr, delta, __ATOMIC_SEQ_CST);
+}
+
+uint32_t tinygo_atomic_swap32(uint32_t *ptr, uint32_t value) {
+	return __atomic_exchange_n(ptr, value, __ATOMIC_SEQ_CST);
+}
+
+uint64_t tinygo_atomic_swap64(uint64_t *ptr, uint64_t value) {
+	return __atomic_exchange_n(ptr, value, __ATOMIC_SEQ_CST);
+}
+
+uint32_t tinygo_atomic_cas32(uint32_t *ptr, uint32_t old, uint32_t value) {
+	return __atomic_compare_exchange_n(ptr, &old, value, 0, __ATOMIC_SEQ_CST, __ATOMIC_SEQ_CST);
+}
+
+uint32_t tinygo_atomic_cas64(uint64_t *ptr, uint64_t old, uint64_t value) {
+	return __atomic_compare_exchange_n(ptr, &old, value, 0, __ATOMIC_SEQ_CST, __ATOMIC_SEQ_CST);
+}
+
+uint32_t tinygo_atomic_load32(uint32_t *ptr) {
+	return __atomic_load_n(ptr, __ATOMIC_SEQ_CST);
+}
+
+uint64_t tinygo_atomic_load64(uint64_t *ptr) {
+	return __atomic_load_n(ptr, __ATOMIC_SEQ_CST);
+}
+
+void tinygo_atomic_store32(uint32_t *ptr, uint32_t value) {
+	__atomic_store_n(ptr, value, __ATOMIC_SEQ_CST);
+}
+
+void tinygo_atomic_store64(uint64_t *ptr, uint64_t value) {
+	__atomic_store_n(ptr, value, __ATOMIC_SEQ_CST);
+}
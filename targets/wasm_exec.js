@@ -78,7 +78,7 @@
 
 			const mem = () => {
 				// The buffer may change when requesting more memory.
-				return new DataView(this._inst.exports.memory.buffer);
+				return new DataView(this._memory.buffer);
 			}
 
 			const setInt64 = (addr, v) => {
@@ -164,7 +164,7 @@
 			}
 
 			const loadSlice = (array, len, cap) => {
-				return new Uint8Array(this._inst.exports.memory.buffer, array, len);
+				return new Uint8Array(this._memory.buffer, array, len);
 			}
 
 			const loadSliceOfValues = (array, len, cap) => {
@@ -176,7 +176,7 @@
 			}
 
 			const loadString = (ptr, len) => {
-				return decoder.decode(new DataView(this._inst.exports.memory.buffer, ptr, len));
+				return decoder.decode(new DataView(this._memory.buffer, ptr, len));
 			}
 
 			const timeOrigin = Date.now() - performance.now();
@@ -319,6 +319,8 @@
 
 		async run(instance) {
 			this._inst = instance;
+			// Modules built with -wasm-threads import their (shared) memory.
+			this._memory = this._inst.exports.memory || this.importObject.env.memory;
 			this._values = [ // TODO: garbage collection
 				NaN,
 				0,
@@ -326,14 +328,14 @@
 				true,
 				false,
 				global,
-				this._inst.exports.memory,
+				this._memory,
 				this,
 			];
 			this._refs = new Map();
 			this._callbackShutdown = false;
 			this.exited = false;
 
-			const mem = new DataView(this._inst.exports.memory.buffer)
+			const mem = new DataView(this._memory.buffer)
 
 			while (true) {
 				const callbackPromise = new Promise((resolve) => {
@@ -373,6 +375,57 @@
 		}
 	}
 
+	// Returns the limits (in pages) of the memory imported by the given
+	// WebAssembly module, or null if it doesn't import a memory.
+	const importedMemoryLimits = (buf) => {
+		let offset = 8; // skip magic number and version
+		const readByte = () => buf[offset++];
+		const readLEB = () => {
+			let result = 0, shift = 0, b;
+			do {
+				b = readByte();
+				result |= (b & 0x7f) << shift;
+				shift += 7;
+			} while (b & 0x80);
+			return result >>> 0;
+		};
+		const readLimits = () => {
+			const flags = readByte();
+			const initial = readLEB();
+			return { initial: initial, maximum: (flags & 1) ? readLEB() : initial };
+		};
+		while (offset < buf.length) {
+			const id = readByte();
+			const size = readLEB();
+			if (id != 2) { // not the import section
+				offset += size;
+				continue;
+			}
+			for (let count = readLEB(); count > 0; count--) {
+				const moduleLen = readLEB();
+				offset += moduleLen;
+				const fieldLen = readLEB();
+				offset += fieldLen;
+				switch (readByte()) {
+				case 0: // function
+					readLEB();
+					break;
+				case 1: // table
+					readByte();
+					readLimits();
+					break;
+				case 2: // memory
+					return readLimits();
+				case 3: // global
+					offset += 2;
+					break;
+				}
+			}
+			return null;
+		}
+		return null;
+	};
+
 	if (isNodeJS) {
 		if (process.argv.length != 3) {
 			process.stderr.write("usage: go_js_wasm_exec [wasm binary] [arguments]\n");
@@ -380,7 +433,13 @@
 		}
 
 		const go = new Go();
-		WebAssembly.instantiate(fs.readFileSync(process.argv[2]), go.importObject).then((result) => {
+		const buf = fs.readFileSync(process.argv[2]);
+		const limits = importedMemoryLimits(buf);
+		if (limits) {
+			// Built with -wasm-threads, so the host has to provide the memory.
+			go.importObject.env.memory = new WebAssembly.Memory({ initial: limits.initial, maximum: limits.maximum, shared: true });
+		}
+		WebAssembly.instantiate(buf, go.importObject).then((result) => {
 			process.on("exit", (code) => { // Node.js exits if no callback is pending
 				if (code === 0 && !go.exited) {
 					// deadlock, make Go print error and stack traces
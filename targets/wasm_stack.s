@@ -0,0 +1,24 @@
+// Access to the stack pointer of WebAssembly for -panic=host. The stack pointer
+// is the __stack_pointer global, which is created by the linker and can't be
+// accessed from Go. The llvm.stacksave and llvm.stackrestore intrinsics don't
+// help here: they are optimized away in functions without a stack frame, and
+// before a trap.
+
+.globaltype __stack_pointer, i32
+
+.section .text.tinygo_getStackPointer,"",@
+.globl  tinygo_getStackPointer
+.type   tinygo_getStackPointer,@function
+tinygo_getStackPointer:
+    .functype tinygo_getStackPointer () -> (i32)
+    global.get __stack_pointer
+    end_function
+
+.section .text.tinygo_setStackPointer,"",@
+.globl  tinygo_setStackPointer
+.type   tinygo_setStackPointer,@function
+tinygo_setStackPointer:
+    .functype tinygo_setStackPointer (i32) -> ()
+    local.get 0
+    global.set __stack_pointer
+    end_function
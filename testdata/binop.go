@@ -1,5 +1,10 @@
 package main
 
+import (
+	"math"
+	"unsafe"
+)
+
 func main() {
 	println("string equality")
 	println(a == "a")
@@ -61,6 +66,60 @@ func main() {
 	println(c128 != 3+2i)
 	println(c128 != 4+2i)
 	println(c128 != 3+3i)
+
+	println("floats with NaN and Inf")
+	println(nan == nan)
+	println(nan != nan)
+	println(nan < 1, nan <= 1, nan > 1, nan >= 1)
+	println(inf == inf)
+	println(inf != inf)
+	println(inf > 1, -inf < 1)
+
+	println("complex numbers with NaN and Inf")
+	cnan := complex(nan, 0)
+	println(cnan == cnan)
+	println(cnan != cnan)
+	println(complex(0, nan) == complex(0, nan))
+	println(complex(0, nan) != complex(0, nan))
+	println(complex(1, nan) == complex(2, nan))
+	println(complex(1, nan) != complex(2, nan))
+	println(complex(inf, 0) == complex(inf, 0))
+	println(complex(inf, 0) != complex(inf, 0))
+	println(complex(inf, -inf) == complex(inf, inf))
+	println(complex(inf, -inf) != complex(inf, inf))
+	println(complex64(cnan) == complex64(cnan))
+	println(complex64(cnan) != complex64(cnan))
+
+	println("shifts by the integer width")
+	for _, n := range []uint{7, 8, 9} {
+		println("int8:", n, i8<<n, i8>>n, "uint8:", u8<<n, u8>>n)
+	}
+	for _, n := range []uint{15, 16, 17} {
+		println("int16:", n, i16<<n, i16>>n, "uint16:", u16<<n, u16>>n)
+	}
+	for _, n := range []uint{31, 32, 33} {
+		println("int32:", n, i32<<n, i32>>n, "uint32:", u32<<n, u32>>n)
+	}
+	for _, n := range []uint{63, 64, 65} {
+		println("int64:", n, i64<<n, i64>>n, "uint64:", u64<<n, u64>>n)
+	}
+	// The width of these types depends on the target, so only check the
+	// results that are the same everywhere.
+	w := uint(unsafe.Sizeof(i) * 8)
+	for _, n := range []uint{w - 1, w, w + 1} {
+		println("int:", i>>n, "uint:", u>>n, "uintptr:", uint(up>>n))
+	}
+	for _, n := range []uint{w, w + 1} {
+		println("int:", i<<n, "uint:", u<<n, "uintptr:", uint(up<<n))
+	}
+	// Right shifts of a negative value fill with the sign bit, also when
+	// shifting by the width or more.
+	for _, n := range []uint{0, 1, 2} {
+		println("negative:", in8>>(n+6), in32>>(n+30), in64>>(n+62))
+	}
+	// Shift counts with a bigger type than the shifted value must not be
+	// truncated.
+	println("large shift count:", i8>>n16, u8<<n16, i8<<n64, u8>>n64)
 }
 
 var x = true
@@ -75,6 +134,32 @@ var a1 = [2]int{1, 2}
 var c64 = 3 + 2i
 var c128 = 4 + 3i
 
+var (
+	i8  int8    = -1
+	u8  uint8   = math.MaxUint8
+	i16 int16   = -1
+	u16 uint16  = math.MaxUint16
+	i32 int32   = -1
+	u32 uint32  = math.MaxUint32
+	i64 int64   = -1
+	u64 uint64  = math.MaxUint64
+	i   int     = -1
+	u   uint    = ^uint(0)
+	up  uintptr = ^uintptr(0)
+	n16 uint16  = 256
+	n64 uint64  = 1 << 32
+)
+
+// Negative values that are not all ones, to tell sign fill from zero fill.
+var (
+	in8  int8  = -100
+	in32 int32 = -100000
+	in64 int64 = -1000000000000
+)
+
+var nan = math.NaN()
+var inf = math.Inf(1)
+
 type Int int
 
 type Struct1 struct {
@@ -0,0 +1,35 @@
+package main
+
+// This test checks that single bits in a word can be set and cleared
+// atomically, even when an interrupt modifies other bits in the same word.
+
+import "runtime/volatile"
+
+var (
+	word    uint32
+	toggles uint32 // only modified from an interrupt
+)
+
+func main() {
+	startTimer()
+	for i := 0; i < 100000; i++ {
+		setBit(&word, 0)
+		clearBit(&word, 0)
+	}
+	stopTimer()
+
+	value := volatile.LoadUint32(&word)
+	println("bit 0 cleared:", value&1 == 0)
+	println("bit 1 consistent:", (value>>1)&1 == volatile.LoadUint32(&toggles)&1)
+}
+
+// toggle flips bit 1 of the shared word. It is called from a timer interrupt
+// on targets that support it.
+func toggle() {
+	volatile.StoreUint32(&toggles, volatile.LoadUint32(&toggles)+1)
+	if volatile.LoadUint32(&word)&2 != 0 {
+		clearBit(&word, 1)
+	} else {
+		setBit(&word, 1)
+	}
+}
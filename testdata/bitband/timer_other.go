@@ -0,0 +1,20 @@
+// +build !cortexm !qemu
+
+package main
+
+// There are no interrupts on these targets, so the bits can be modified
+// directly.
+
+func setBit(reg *uint32, bit uint8) {
+	*reg |= 1 << bit
+}
+
+func clearBit(reg *uint32, bit uint8) {
+	*reg &^= 1 << bit
+}
+
+func startTimer() {
+}
+
+func stopTimer() {
+}
@@ -0,0 +1,26 @@
+// +build cortexm,qemu
+
+package main
+
+import "device/arm"
+
+func setBit(reg *uint32, bit uint8) {
+	arm.SetBit(reg, bit)
+}
+
+func clearBit(reg *uint32, bit uint8) {
+	arm.ClearBit(reg, bit)
+}
+
+func startTimer() {
+	arm.SetupSystemTimer(1000)
+}
+
+func stopTimer() {
+	arm.SetupSystemTimer(0)
+}
+
+//go:export SysTick_Handler
+func timerHandler() {
+	toggle()
+}
@@ -0,0 +1,14 @@
+package main
+
+// This function has many bounds checks that can't be removed by the
+// optimizer, which must all share a single panic call.
+//
+//go:noinline
+func sum(s []int, a, b, c, d, e, f, g, h int) int {
+	return s[a] + s[b] + s[c] + s[d] + s[e] + s[f] + s[g] + s[h] + len(s[a:b]) + len(s[c:d])
+}
+
+func main() {
+	s := []int{1, 2, 3, 4, 5, 6, 7, 8}
+	println("sum:", sum(s, 0, 1, 2, 3, 4, 5, 6, 7))
+}
@@ -0,0 +1,32 @@
+package main
+
+import "runtime"
+
+func main() {
+	file, line, ok := location()
+	println("location:", base(file), line, ok)
+
+	// location is small enough to be inlined, the result must be the same.
+	for i := 0; i < 2; i++ {
+		file, line, ok = location()
+		println("location in loop:", base(file), line, ok)
+	}
+
+	_, file, line, ok = runtime.Caller(0)
+	println("main:", base(file), line, ok)
+}
+
+func location() (string, int, bool) {
+	_, file, line, ok := runtime.Caller(0)
+	return file, line, ok
+}
+
+// base returns the last element of a slash-separated path.
+func base(path string) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == '/' || path[i] == '\\' {
+			return path[i+1:]
+		}
+	}
+	return path
+}
@@ -0,0 +1,66 @@
+package main
+
+// This program is built with -caller-table, see TestCallerTable. This file is
+// deliberately not called main.go, so that it isn't built without the table by
+// TestCompiler.
+
+import "runtime"
+
+func main() {
+	file, line, ok := where()
+	println("where:", base(file), line, ok)
+
+	outer()
+
+	var pcs [8]uintptr
+	n := callers(pcs[:])
+	println("callers:", n)
+	for _, pc := range pcs[:n] {
+		println(" ", runtime.FuncForPC(pc).Name())
+	}
+
+	// A goroutine has no callers before its first function.
+	done := make(chan bool)
+	go func() {
+		println("goroutine callers:", callers(pcs[:]))
+		done <- true
+	}()
+	<-done
+
+	file, line, ok = where()
+	println("where after goroutine:", base(file), line, ok)
+}
+
+// where returns the location of the call to where. It is small enough to be
+// inlined, which must not change the result.
+func where() (string, int, bool) {
+	_, file, line, ok := runtime.Caller(1)
+	return file, line, ok
+}
+
+//go:noinline
+func outer() {
+	inner()
+}
+
+//go:noinline
+func inner() {
+	for skip := 0; skip < 4; skip++ {
+		_, file, line, ok := runtime.Caller(skip)
+		println("inner:", skip, base(file), line, ok)
+	}
+}
+
+func callers(pcs []uintptr) int {
+	return runtime.Callers(1, pcs)
+}
+
+// base returns the last element of a slash-separated path.
+func base(path string) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == '/' || path[i] == '\\' {
+			return path[i+1:]
+		}
+	}
+	return path
+}
@@ -28,6 +28,12 @@ func (t Thing) Print(arg string) {
 	println("Thing.Print:", t.name, "arg:", arg)
 }
 
+type IntFunc func(int) int
+
+type OtherIntFunc func(int) int
+
+type NameFunc func() string
+
 type Printer interface {
 	Print(string)
 }
@@ -40,6 +46,10 @@ func main() {
 
 	// deferred functions
 	testDefer()
+	testDeferBuiltins()
+
+	// recover returns nil when there is no panic
+	println("recover without panic:", recover() == nil)
 
 	// Take a bound method and use it as a function pointer.
 	// This function pointer needs a context pointer.
@@ -58,6 +68,9 @@ func main() {
 	thingFunctionalArgs1.Print("functional args 1")
 	thingFunctionalArgs2 := NewThing(WithName("named thing"))
 	thingFunctionalArgs2.Print("functional args 2")
+
+	// conversions between function types
+	testFuncTypeConversion(thing)
 }
 
 func runFunc(f func(int), arg int) {
@@ -85,6 +98,50 @@ func testDefer() {
 	println("deferring...")
 }
 
+func testDeferBuiltins() {
+	// The arguments of deferred builtins must be evaluated at the defer
+	// statement, not when the function returns.
+	ch1 := make(chan int)
+	ch2 := make(chan int)
+	m := map[string]int{"a": 1, "b": 2}
+	dst := []int{0, 0}
+	src1 := []int{1, 2}
+	src2 := []int{3, 4}
+	func() {
+		ch := ch1
+		defer close(ch)
+		ch = ch2
+
+		k := "a"
+		defer delete(m, k)
+		k = "b"
+
+		src := src1
+		defer copy(dst, src)
+		src = src2
+
+		n := 1
+		defer println("deferred println:", n)
+		n = 2
+
+		defer recover()
+		println("deferring builtins...")
+	}()
+
+	_, ok := <-ch1
+	println("ch1 closed:", !ok)
+	select {
+	case <-ch2:
+		println("ch2 closed")
+	default:
+		println("ch2 open")
+	}
+	_, a := m["a"]
+	_, b := m["b"]
+	println("map has a:", a, "b:", b)
+	println("copied:", dst[0], dst[1])
+}
+
 func deferred(msg string, i int) {
 	println(msg, i)
 }
@@ -92,3 +149,28 @@ func deferred(msg string, i int) {
 func testBound(f func() string) {
 	println("bound method:", f())
 }
+
+func testFuncTypeConversion(thing *Thing) {
+	// Named function types with the same underlying signature.
+	var double IntFunc = func(n int) int {
+		return n * 2
+	}
+	println("converted func:", OtherIntFunc(double)(21))
+
+	// Unnamed function type.
+	unnamed := (func(int) int)(double)
+	println("converted to unnamed func:", unnamed(4))
+	println("converted from unnamed func:", IntFunc(unnamed)(5))
+
+	// Closures and bound methods have a context, which must be kept.
+	offset := 10
+	var add IntFunc = func(n int) int {
+		return n + offset
+	}
+	println("converted closure:", OtherIntFunc(add)(3))
+	println("converted bound method:", NameFunc(thing.String)())
+
+	// A converted nil function is still nil.
+	var nilFunc IntFunc
+	println("converted nil func:", OtherIntFunc(nilFunc) == nil)
+}
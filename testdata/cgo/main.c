@@ -1,3 +1,4 @@
+#include <stddef.h>
 #include "main.h"
 
 int global = 3;
@@ -19,6 +20,11 @@ joined_t globalUnion;
 int globalUnionSize = sizeof(globalUnion);
 option_t globalOption = optionG;
 bitfield_t globalBitfield = {244, 15, 1, 2, 47, 5};
+packed_t globalPacked = {1, 0x12345678, -3, 5000000000};
+int globalPackedSize = sizeof(packed_t);
+int globalPackedOffsets[4] = {offsetof(packed_t, a), offsetof(packed_t, b), offsetof(packed_t, c), offsetof(packed_t, d)};
+pragma_packed_t globalPragmaPacked = {'x', 2.5};
+int globalPragmaPackedSize = sizeof(pragma_packed_t);
 
 int fortytwo() {
 	return 42;
@@ -32,6 +38,17 @@ int doCallback(int a, int b, binop_t callback) {
 	return callback(a, b);
 }
 
+// Insertion sort, using a comparison function with a context parameter.
+void sortInts(int *values, int len, lessfunc_t less, void *context) {
+	for (int i = 1; i < len; i++) {
+		for (int j = i; j > 0 && less(values[j], values[j-1], context); j--) {
+			int tmp = values[j];
+			values[j] = values[j-1];
+			values[j-1] = tmp;
+		}
+	}
+}
+
 void store(int value, int *ptr) {
 	*ptr = value;
 }
@@ -49,3 +66,11 @@ void unionSetData(short f0, short f1, short f2) {
 	globalUnion.data[1] = 8;
 	globalUnion.data[2] = 1;
 }
+
+int packedGetB(packed_t *p) {
+	return p->b;
+}
+
+int packedNestedSum(packed_nested_t *p) {
+	return p->point.x + p->point.y + p->arr[0] + p->arr[1] + p->arr[2];
+}
@@ -9,7 +9,10 @@ import "C"
 
 import "C"
 
-import "unsafe"
+import (
+	"tinygo"
+	"unsafe"
+)
 
 func main() {
 	println("fortytwo:", C.fortytwo())
@@ -35,6 +38,19 @@ func main() {
 	cb = C.binop_t(C.mul)
 	println("callback 2:", C.doCallback(20, 30, cb))
 
+	// Go closure as C callback
+	compares := 0
+	less, context := tinygo.CFunc(func(a, b C.int) C.int {
+		compares++
+		if a > b { // sort in descending order
+			return 1
+		}
+		return 0
+	})
+	values := [...]C.int{5, 3, 8, 1}
+	C.sortInts(&values[0], C.int(len(values)), C.lessfunc_t(less), context)
+	println("closure callback:", values[0], values[1], values[2], values[3], compares > 0)
+
 	// equivalent types
 	var goInt8 int8 = 5
 	var _ C.int8_t = goInt8
@@ -72,6 +88,27 @@ func main() {
 	C.globalBitfield.set_bitfield_c(0xff)
 	printBitfield(&C.globalBitfield)
 
+	// packed structs
+	println("packed size:", C.int(unsafe.Sizeof(C.globalPacked)) == C.globalPackedSize)
+	println("packed offsets:",
+		C.int(unsafe.Offsetof(C.globalPacked.a)) == C.globalPackedOffsets[0],
+		C.int(unsafe.Offsetof(C.globalPacked.b)) == C.globalPackedOffsets[1],
+		C.int(unsafe.Offsetof(C.globalPacked.c)) == C.globalPackedOffsets[2],
+		C.int(unsafe.Offsetof(C.globalPacked.d)) == C.globalPackedOffsets[3])
+	println("packed fields:", C.globalPacked.a, C.globalPacked.b, C.globalPacked.c, C.globalPacked.d)
+	C.globalPacked.b = 0x7654321
+	println("packed field set:", C.packedGetB(&C.globalPacked))
+	packed := C.packed_t{a: 2, b: 3, c: 4, d: 5}
+	println("packed value:", C.packedGetB(&packed), packed.d)
+	nested := C.packed_nested_t{a: 1}
+	nested.point.x = 2
+	nested.point.y = 3
+	for i := range nested.arr {
+		nested.arr[i] = C.int(i+1) * 10
+	}
+	println("packed nested:", C.packedNestedSum(&nested), nested.point.y, nested.arr[2])
+	println("pragma packed:", C.int(unsafe.Sizeof(C.globalPragmaPacked)) == C.globalPragmaPackedSize, C.globalPragmaPacked.c, C.globalPragmaPacked.f)
+
 	// elaborated type
 	p := C.struct_point2d{x: 3, y: 5}
 	println("struct:", p.x, p.y)
@@ -7,6 +7,8 @@ int add(int a, int b);
 int unusedFunction(void);
 typedef int (*binop_t) (int, int);
 int doCallback(int a, int b, binop_t cb);
+typedef int (*lessfunc_t) (int, int, void *);
+void sortInts(int *values, int len, lessfunc_t less, void *context);
 typedef int * intPointer;
 void store(int value, int *ptr);
 
@@ -112,6 +114,28 @@ typedef struct {
 	// Note that C++ allows bitfields bigger than the underlying type.
 } bitfield_t;
 
+// packed structs, with fields at unaligned offsets
+typedef struct {
+	unsigned char a;
+	int           b;
+	short         c;
+	int64_t       d;
+} __attribute__((packed)) packed_t;
+
+// packed struct with a struct and an array field at unaligned offsets
+typedef struct {
+	unsigned char   a;
+	struct point2d  point;
+	int             arr[3];
+} __attribute__((packed)) packed_nested_t;
+
+#pragma pack(push, 1)
+typedef struct {
+	char  c;
+	float f;
+} pragma_packed_t;
+#pragma pack(pop)
+
 // test globals and datatypes
 extern int global;
 extern int unusedGlobal;
@@ -133,6 +157,13 @@ extern joined_t globalUnion;
 extern int globalUnionSize;
 extern option_t globalOption;
 extern bitfield_t globalBitfield;
+extern packed_t globalPacked;
+extern int globalPackedSize;
+extern int globalPackedOffsets[4];
+extern pragma_packed_t globalPragmaPacked;
+extern int globalPragmaPackedSize;
+int packedGetB(packed_t *p);
+int packedNestedSum(packed_nested_t *p);
 
 // test duplicate definitions
 int add(int a, int b);
@@ -230,6 +230,132 @@ func main() {
 	}
 	wg.wait()
 	println("blocking select sum:", sum)
+
+	// Test non-blocking selects with a single case, as used in polling loops.
+	ch = make(chan int, 1)
+	defaults := 0
+	sum = 0
+	for i := 0; i < 5; i++ {
+		if i == 2 {
+			ch <- 7
+		}
+		select {
+		case v := <-ch:
+			sum += v
+		default:
+			defaults++
+		}
+	}
+	println("polling select sum:", sum, "defaults:", defaults)
+	select {
+	case ch <- 8:
+		println("polling select send")
+	default:
+		println("unreachable: empty buffer")
+	}
+	select {
+	case ch <- 9:
+		println("unreachable: full buffer")
+	default:
+		println("polling select send default")
+	}
+	println("polling select value:", <-ch)
+	close(ch)
+	select {
+	case v, ok := <-ch:
+		println("polling select closed chan:", v, ok)
+	default:
+		println("unreachable: closed chan")
+	}
+
+	// Test that a random case is picked when multiple cases are ready, so that
+	// no channel is starved.
+	fair1 := make(chan int, 1)
+	fair2 := make(chan int, 1)
+	var count1, count2 int
+	for i := 0; i < 100; i++ {
+		if len(fair1) == 0 {
+			fair1 <- 1
+		}
+		if len(fair2) == 0 {
+			fair2 <- 2
+		}
+		select {
+		case <-fair1:
+			count1++
+		case <-fair2:
+			count2++
+		}
+	}
+	println("select fairness:", count1 > 0, count2 > 0, count1+count2)
+
+	// The case must also be picked uniformly when the ready cases are not next
+	// to each other. The nil channel is never ready.
+	var never chan int
+	count1, count2 = 0, 0
+	for i := 0; i < 3000; i++ {
+		if len(fair1) == 0 {
+			fair1 <- 1
+		}
+		if len(fair2) == 0 {
+			fair2 <- 2
+		}
+		select {
+		case <-fair1:
+			count1++
+		case <-never:
+			println("unreachable: nil channel")
+		case <-fair2:
+			count2++
+		}
+	}
+	println("select uniform:", count1 > 1200 && count1 < 1800, count2 > 1200 && count2 < 1800)
+
+	// Test channels of a zero-sized type, which are commonly used for
+	// signalling. No data is copied, but they must still synchronize.
+	sem := make(chan struct{}, 2)
+	done := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		go semaphoreWorker(sem, done)
+	}
+	for i := 0; i < 5; i++ {
+		<-done
+	}
+	println("semaphore max active:", semaphoreMaxActive, "active:", semaphoreActive)
+	quit := make(chan struct{})
+	go func() {
+		time.Sleep(time.Millisecond)
+		close(quit)
+	}()
+	_, ok = <-quit
+	println("recv from closed chan struct{}:", ok)
+	select {
+	case sem <- struct{}{}:
+		println("select send struct{}")
+	default:
+		println("unreachable: empty buffer")
+	}
+	select {
+	case v, ok := <-sem:
+		println("select recv struct{}:", v == struct{}{}, ok)
+	case <-done:
+		println("unreachable: no sender")
+	}
+}
+
+var semaphoreActive, semaphoreMaxActive int
+
+// semaphoreWorker runs while holding one of the slots of the semaphore.
+func semaphoreWorker(sem, done chan struct{}) {
+	sem <- struct{}{}
+	semaphoreActive++
+	if semaphoreActive > semaphoreMaxActive {
+		semaphoreMaxActive = semaphoreActive
+	}
+	time.Sleep(time.Millisecond)
+	semaphoreActive--
+	<-sem
+	done <- struct{}{}
 }
 
 func send(ch chan<- int) {
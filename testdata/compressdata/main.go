@@ -0,0 +1,33 @@
+package main
+
+// Large initialized global variables, which are stored compressed with
+// -compress-data. They are modified below, so they can't be made read-only.
+
+var table = [2048]byte{0: 1, 1: 2, 100: 3, 1000: 4, 2047: 5}
+
+var config = struct {
+	id      uint32
+	enabled bool
+	weights [64]uint16
+}{
+	id:      0x12345678,
+	enabled: true,
+	weights: [64]uint16{0: 1000, 1: 2000, 63: 64000},
+}
+
+// Globals with pointers are never compressed.
+var message = "hello"
+
+func main() {
+	sum := 0
+	for _, b := range table {
+		sum += int(b)
+	}
+	println("table:", table[0], table[1], table[100], table[1000], table[2047], sum)
+	println("config:", config.id, config.enabled, config.weights[0], config.weights[1], config.weights[2], config.weights[63])
+	println("message:", message)
+
+	table[1]++
+	config.weights[2] = 3000
+	println("modified:", table[1], config.weights[2])
+}
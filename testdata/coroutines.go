@@ -1,6 +1,11 @@
 package main
 
-import "time"
+import (
+	"runtime"
+	"sync"
+	"time"
+	"tinygo"
+)
 
 func main() {
 	println("main 1")
@@ -51,6 +56,101 @@ func main() {
 	println("closure go call result:", x)
 
 	time.Sleep(2 * time.Millisecond)
+
+	testMutex()
+	testOnce()
+	testStackSize()
+	testLockGoroutine()
+}
+
+func testMutex() {
+	var m sync.Mutex
+	var count int
+	for i := 0; i < 3; i++ {
+		go func() {
+			time.Sleep(time.Millisecond)
+			m.Lock()
+			count++
+			m.Unlock()
+		}()
+	}
+	time.Sleep(5 * time.Millisecond)
+	m.Lock()
+	println("mutex count:", count)
+	m.Unlock()
+}
+
+func testOnce() {
+	var once sync.Once
+	var calls int
+	for i := 0; i < 3; i++ {
+		go once.Do(func() {
+			calls++
+		})
+	}
+	once.Do(func() {
+		calls++
+	})
+	time.Sleep(2 * time.Millisecond)
+	once.Do(func() {
+		calls++
+	})
+	println("once calls:", calls)
+}
+
+func testStackSize() {
+	tinygo.Go(512, func() {
+		println("small stack goroutine")
+	})
+	tinygo.Go(4096, func() {
+		println("big stack goroutine:", recurse(50))
+	})
+	time.Sleep(2 * time.Millisecond)
+}
+
+func testLockGoroutine() {
+	go func() {
+		// Wait until the other goroutine is locked. With the coroutine
+		// scheduler, a new goroutine runs right away until it blocks.
+		runtime.Gosched()
+		println("goroutine after locked section")
+	}()
+	runtime.LockGoroutine()
+	for i := 0; i < 3; i++ {
+		// Neither call may switch to the other goroutine.
+		runtime.Gosched()
+		time.Sleep(time.Millisecond)
+		println("locked section:", i)
+	}
+	runtime.UnlockGoroutine()
+	time.Sleep(time.Millisecond)
+
+	// The lock only applies to the goroutine that holds it. When it blocks,
+	// other goroutines still switch between each other.
+	ch := make(chan int)
+	for _, name := range []string{"a", "b"} {
+		name := name
+		go func() {
+			for i := 0; i < 2; i++ {
+				println("goroutine", name, i)
+				runtime.Gosched()
+			}
+			if name == "a" {
+				ch <- 1
+			}
+		}()
+	}
+	runtime.LockGoroutine()
+	println("locked receive:", <-ch)
+	runtime.UnlockGoroutine()
+	time.Sleep(time.Millisecond)
+}
+
+func recurse(n int) int {
+	if n == 0 {
+		return 0
+	}
+	return recurse(n-1) + 1
 }
 
 func sub() {
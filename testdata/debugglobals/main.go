@@ -0,0 +1,31 @@
+package main
+
+type point struct {
+	x, y int16
+}
+
+var counter uint32
+
+var origin = point{3, 4}
+
+func main() {
+	for i := 0; i < 3; i++ {
+		increment(&counter)
+	}
+	move(&origin, int16(counter))
+	println("counter:", counter)
+	println("origin:", origin.x, origin.y)
+}
+
+// The globals are passed by pointer, so that they are not optimized into
+// constants or locals and still exist in the binary.
+
+//go:noinline
+func increment(n *uint32) {
+	*n++
+}
+
+//go:noinline
+func move(p *point, dx int16) {
+	p.x += dx
+}
@@ -0,0 +1,37 @@
+package main
+
+// This test is built with -tags=deterministic. With a real clock, the order in
+// which the goroutines wake up would depend on how long the busy goroutine
+// takes to run. With the deterministic scheduler it is always the same.
+
+import "time"
+
+var result uint32
+
+func main() {
+	for i := 1; i <= 3; i++ {
+		go sleeper(i)
+	}
+	go busy()
+	time.Sleep(25 * time.Millisecond)
+	println("main done")
+}
+
+func sleeper(n int) {
+	for i := 0; i < 2; i++ {
+		time.Sleep(time.Duration(n) * 4 * time.Millisecond)
+		println("sleeper", n, "woke up", i)
+	}
+}
+
+func busy() {
+	x := uint32(1)
+	for i := 0; i < 1000000; i++ {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+	}
+	result = x
+	time.Sleep(6 * time.Millisecond)
+	println("busy woke up")
+}
@@ -1,5 +1,7 @@
 package main
 
+import "math"
+
 func main() {
 	// sanity
 	println(3.14159265358979323846)
@@ -68,4 +70,27 @@ func main() {
 	println("complex128 sub:", c128 - 2+6i)
 	println("complex128 mul:", c128 * 2+6i)
 	println("complex128 div:", c128 / 2+6i)
+
+	// conversion of integers and floats to complex numbers: only constants can
+	// be converted directly, other values need the complex builtin
+	n := -7
+	println("int to complex128:", complex128(3), complex(float64(n), 0))
+	println("int to complex64:", complex64(3), complex(float32(n), 0))
+	println("float32 to complex128:", complex128(complex(f32, 0)))
+	println("float64 to complex64:", complex64(complex(f64, 0)))
+	c128 = complex128(2.5)
+	println("real and imag:", real(c128), imag(c128))
+	c64 = complex64(-1.25)
+	println("real and imag:", real(c64), imag(c64))
+
+	// Large integer to float32 conversions must be rounded once, to the
+	// nearest even value. Rounding to float64 first gives a different result
+	// for some of these values. The bits are printed, as println doesn't show
+	// enough digits.
+	for _, n := range []int64{0x1000001, 0x1000003, -0x1000001, 1<<62 + 1<<38 + 1, -(1<<62 + 1<<38 + 1), math.MaxInt64, math.MinInt64} {
+		println("int64 to float32:", n, math.Float32bits(float32(n)))
+	}
+	for _, n := range []uint64{0x1000001, 0x1000003, 1<<63 + 1<<39 + 1, 1<<63 + 1<<39, math.MaxUint64} {
+		println("uint64 to float32:", n, math.Float32bits(float32(n)))
+	}
 }
@@ -1,5 +1,7 @@
 package main
 
+import "runtime"
+
 var xorshift32State uint32 = 1
 
 func xorshift32(x uint32) uint32 {
@@ -17,6 +19,8 @@ func randuint32() uint32 {
 
 func main() {
 	testNonPointerHeap()
+	testOOMHandler()
+	testLowMemory()
 }
 
 var scalarSlices [4][]byte
@@ -57,3 +61,89 @@ func testNonPointerHeap() {
 	}
 	println("ok")
 }
+
+// Enough space to hold a pointer to every kilobyte of the heap.
+var cache [2048]*[1024]byte
+var oomHandlerCalled bool
+
+// dropCache is the out-of-memory handler. It must not allocate.
+func dropCache() bool {
+	if oomHandlerCalled {
+		return false
+	}
+	oomHandlerCalled = true
+	println("out of memory, dropping cache")
+	for i := range cache {
+		cache[i] = nil
+	}
+	return true
+}
+
+func testOOMHandler() {
+	runtime.SetOOMHandler(dropCache)
+
+	// Fill the heap until the handler is called, which frees all previous
+	// allocations so that the allocation that ran out of memory succeeds.
+	for i := 0; i < len(cache) && !oomHandlerCalled; i++ {
+		cache[i] = new([1024]byte)
+	}
+	if oomHandlerCalled {
+		println("allocation succeeded after dropping cache")
+	}
+
+	runtime.SetOOMHandler(nil)
+	for i := range cache {
+		cache[i] = nil
+	}
+}
+
+var lowMemoryWarnings int
+
+// lowMemory is the low memory callback. It must not allocate.
+func lowMemory() {
+	lowMemoryWarnings++
+}
+
+// fillHeap allocates memory until the low memory callback is called. A
+// collection cycle is run after every few allocations, so that the warning is
+// given before the heap is actually full.
+func fillHeap() {
+	warnings := lowMemoryWarnings
+	for i := 0; i < len(cache) && lowMemoryWarnings == warnings; i++ {
+		cache[i] = new([1024]byte)
+		if i%4 == 3 {
+			runtime.GC()
+		}
+	}
+}
+
+func testLowMemory() {
+	runtime.SetLowMemoryThreshold(8*1024, lowMemory)
+
+	// There is plenty of free memory, so no warning is given.
+	runtime.GC()
+	println("low memory warnings at start:", lowMemoryWarnings)
+
+	// The warning is given once when free memory drops below the threshold,
+	// not again while it stays below the threshold.
+	fillHeap()
+	println("low memory warnings after filling the heap:", lowMemoryWarnings)
+	runtime.GC()
+	runtime.GC()
+	println("low memory warnings while low on memory:", lowMemoryWarnings)
+
+	// Free memory rises above the threshold again, after which the next
+	// crossing results in a new warning.
+	for i := range cache {
+		cache[i] = nil
+	}
+	runtime.GC()
+	println("low memory warnings after freeing memory:", lowMemoryWarnings)
+	fillHeap()
+	println("low memory warnings after filling the heap again:", lowMemoryWarnings)
+
+	runtime.SetLowMemoryThreshold(0, nil)
+	for i := range cache {
+		cache[i] = nil
+	}
+}
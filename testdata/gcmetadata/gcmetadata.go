@@ -0,0 +1,46 @@
+package main
+
+import "unsafe"
+
+//go:extern _gc_metadata_start
+var gcMetadataStart [0]byte
+
+//go:extern _gc_metadata_end
+var gcMetadataEnd [0]byte
+
+var keep [16]*[32]byte
+
+func main() {
+	start := uintptr(unsafe.Pointer(&gcMetadataStart))
+	end := uintptr(unsafe.Pointer(&gcMetadataEnd))
+	println("metadata region size:", int(end-start))
+	println("metadata region aligned:", start%32 == 0)
+
+	// Allocate a lot more than fits in the heap, so that the GC has to run a
+	// number of times. Only the last few objects are kept alive.
+	for i := 0; i < 2000; i++ {
+		buf := new([32]byte)
+		buf[0] = byte(i)
+		keep[i%len(keep)] = buf
+	}
+	ok := true
+	for i, buf := range keep {
+		if buf[0] != byte(2000-len(keep)+i) {
+			ok = false
+		}
+		ptr := uintptr(unsafe.Pointer(buf))
+		if ptr >= start && ptr < end {
+			ok = false
+		}
+	}
+	println("live objects intact:", ok)
+
+	// The block states of the live objects must be stored in the region.
+	used := false
+	for ptr := start; ptr < end; ptr++ {
+		if *(*byte)(unsafe.Pointer(ptr)) != 0 {
+			used = true
+		}
+	}
+	println("metadata region used:", used)
+}
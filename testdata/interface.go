@@ -90,6 +90,11 @@ func main() {
 		}
 	}
 
+	// Values that fit in a pointer are stored directly in the interface, check
+	// that they survive a round trip.
+	println("small values:", roundTrip(int8(-3)).(int8), roundTrip(uint16(65535)).(uint16), roundTrip(int32(-100000)).(int32))
+	println("small values:", roundTrip(float32(1.5)).(float32) == 1.5, roundTrip(true).(bool), roundTrip([2]byte{4, 5}).([2]byte)[1], roundTrip(SmallPair{7, 2}).(SmallPair).a)
+
 	// test interface blocking
 	blockDynamic(NonBlocker{})
 	println("non-blocking call on sometimes-blocking interface")
@@ -133,6 +138,13 @@ func printItf(val interface{}) {
 	}
 }
 
+// roundTrip returns its parameter, without letting the compiler see through the
+// conversion to and from an interface.
+//go:noinline
+func roundTrip(x interface{}) interface{} {
+	return x
+}
+
 func nestedSwitch(verb rune, arg interface{}) bool {
 	switch verb {
 	case 'v', 's':
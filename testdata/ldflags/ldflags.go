@@ -0,0 +1,27 @@
+package main
+
+import "github.com/tinygo-org/tinygo/testdata/ldflags/version"
+
+// The values of these globals are set at build time, see TestLDFlags. This
+// file is deliberately not called main.go, so that it isn't built without these
+// values by TestCompiler.
+var (
+	someString string
+	someInt    int
+	someBool   bool
+	someUint8  uint8
+
+	// The value set at build time replaces this constant initializer.
+	someDefault = "default"
+)
+
+func main() {
+	println("string:", someString)
+	println("int:", someInt)
+	println("bool:", someBool)
+	println("uint8:", someUint8)
+	println("default:", someDefault)
+	println("version:", version.Version)
+	println("commit:", version.Commit)
+	println("date:", version.Date)
+}
@@ -0,0 +1,20 @@
+// Package version holds globals of a non-main package that are set at build
+// time in TestLDFlags.
+package version
+
+var (
+	// Version has a constant initializer, which is replaced by the value that
+	// is set at build time.
+	Version = "dev"
+
+	// Commit has no initializer.
+	Commit string
+
+	// Date is initialized by a function call, so the initializer wins like
+	// with the go tool.
+	Date = defaultDate()
+)
+
+func defaultDate() string {
+	return "unknown"
+}
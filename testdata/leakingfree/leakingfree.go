@@ -0,0 +1,30 @@
+package main
+
+// This test is built with -gc=leaking. It allocates far more memory in total
+// than available on the heap, which only works because every allocation is
+// freed again.
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// Global to make sure the buffers are allocated on the heap.
+var buf []byte
+
+func main() {
+	var first *byte
+	sameAddress := true
+	for i := 0; i < 100000; i++ {
+		buf = make([]byte, 1024)
+		buf[i%len(buf)] = byte(i)
+		if first == nil {
+			first = &buf[0]
+		} else if first != &buf[0] {
+			sameAddress = false
+		}
+		runtime.Free(unsafe.Pointer(&buf[0]))
+		buf = nil
+	}
+	println("same address:", sameAddress)
+}
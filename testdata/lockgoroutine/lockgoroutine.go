@@ -0,0 +1,32 @@
+package main
+
+// Block on a channel while holding the LockGoroutine lock. Other goroutines run
+// while the locked goroutine is blocked, but the lock applies again once it
+// continues: Gosched doesn't switch to other goroutines until it is unlocked.
+
+import "runtime"
+
+func main() {
+	ch := make(chan int)
+	go func() {
+		for i := 0; i < 3; i++ {
+			println("goroutine", i)
+			runtime.Gosched()
+		}
+		ch <- 1
+		for i := 3; i < 6; i++ {
+			println("goroutine", i)
+			runtime.Gosched()
+		}
+		ch <- 2
+	}()
+
+	runtime.LockGoroutine()
+	println("received:", <-ch)
+	for i := 0; i < 3; i++ {
+		println("locked", i)
+		runtime.Gosched()
+	}
+	runtime.UnlockGoroutine()
+	println("received:", <-ch)
+}
@@ -0,0 +1,18 @@
+package main
+
+import "unsafe"
+
+type element [1024]byte
+
+func main() {
+	// Slices of large elements work as usual.
+	s := make([]element, 2, 3)
+	println("len:", len(s), "cap:", cap(s))
+
+	// The length of this slice fits in an int, but its size in bytes doesn't
+	// fit in a uintptr. Instead of allocating a backing array with the wrapped
+	// size (zero bytes), make must panic.
+	n := ^uint(0)/uint(unsafe.Sizeof(element{})) + 1
+	s = make([]element, n)
+	println("unreachable:", len(s))
+}
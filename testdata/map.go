@@ -24,6 +24,17 @@ var testMapArrayKey = map[ArrayKey]int{
 }
 var testmapIntInt = map[int]int{1: 1, 2: 4, 3: 9}
 
+type namedKey struct {
+	name string
+	id   int16
+	ok   bool
+}
+
+var testMapStructKey = map[namedKey]int{
+	{"one", 1, true}: 1,
+	{"two", 2, true}: 2,
+}
+
 func main() {
 	m := map[string]int{"answer": 42, "foo": 3}
 	readMap(m, "answer")
@@ -48,6 +59,18 @@ func main() {
 	testMapArrayKey[arrKey] = 5555
 	println(testMapArrayKey[arrKey])
 
+	// struct keys with a string field
+	two := string([]byte{'t', 'w', 'o'}) // not the same pointer as "two"
+	println(testMapStructKey[namedKey{two, 2, true}], testMapStructKey[namedKey{two, 2, false}])
+	testMapStructKey[namedKey{two, 2, true}] = 22
+	testMapStructKey[namedKey{"three", 3, true}] = 3
+	delete(testMapStructKey, namedKey{"one", 1, true})
+	_, ok := testMapStructKey[namedKey{"one", 1, true}]
+	println(len(testMapStructKey), testMapStructKey[namedKey{"two", 2, true}], testMapStructKey[namedKey{"three", 3, true}], ok)
+	arrayStructKey := map[[2]namedKey]string{}
+	arrayStructKey[[2]namedKey{{"a", 1, true}, {"b", 2, false}}] = "ab"
+	println(arrayStructKey[[2]namedKey{{"a", 1, true}, {"b", 2, false}}], len(arrayStructKey[[2]namedKey{{"a", 1, true}, {"b", 2, true}}]))
+
 	// test preallocated map
 	squares := make(map[int]int, 200)
 	testBigMap(squares, 100)
@@ -59,6 +82,22 @@ func main() {
 	squares = make(map[int]int, 20)
 	testBigMap(squares, 40)
 	println("tested growing of a map")
+
+	// test a map with zero-sized values, used as a set
+	set := make(map[int]struct{})
+	for _, n := range []int{3, 1, 4, 1, 5, 9, 2, 6, 5, 3} {
+		set[n] = struct{}{}
+	}
+	delete(set, 9)
+	_, has4 := set[4]
+	_, has9 := set[9]
+	v, has7 := set[7]
+	println("set:", len(set), has4, has9, has7, v == struct{}{})
+	sum := 0
+	for n := range set {
+		sum += n
+	}
+	println("set sum:", sum)
 }
 
 func readMap(m map[string]int, key string) {
@@ -0,0 +1,21 @@
+package main
+
+// The math/bits functions tested here were added in Go 1.12. With Go 1.11, a
+// copy of the Go 1.12 implementation is used instead, see bits_go111.go.
+
+func main() {
+	for _, tc := range []struct{ x, y, carry uint64 }{
+		{0xffffffffffffffff, 0xffffffffffffffff, 0},
+		{0x123456789abcdef0, 0xfedcba9876543210, 1},
+		{1, 2, 1},
+		{5, 3, 0},
+	} {
+		println("x:", tc.x, "y:", tc.y, "carry:", tc.carry)
+		hi, lo := mul64(tc.x, tc.y)
+		println("  mul64:    ", hi, lo)
+		sum, carry := add64(tc.x, tc.y, tc.carry)
+		println("  add64:    ", sum, carry)
+		diff, borrow := sub64(tc.x, tc.y, tc.carry)
+		println("  sub64:    ", diff, borrow)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "runtime"
+
+func main() {
+	// Goroutines that have returned don't count towards the limit.
+	done := make(chan bool)
+	for i := 0; i < 5; i++ {
+		go func() {
+			done <- true
+		}()
+		<-done
+		runtime.Gosched()
+	}
+	println("sequential goroutines ok")
+
+	// Goroutines that are still running do count.
+	block := make(chan bool)
+	for i := 0; i < 3; i++ {
+		go func() {
+			<-block
+		}()
+		println("started goroutine", i)
+	}
+	go func() {
+		<-block
+	}()
+	println("unreachable: goroutine limit not enforced")
+}
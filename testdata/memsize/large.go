@@ -0,0 +1,5 @@
+// +build ram_gte_64k
+
+package main
+
+const largeRAM = true
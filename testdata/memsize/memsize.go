@@ -0,0 +1,15 @@
+package main
+
+import "tinygo"
+
+// The buffer size is picked at compile time based on the amount of RAM.
+const bufferSize = tinygo.RAMSize / 64
+
+var buffer [bufferSize]byte
+
+func main() {
+	println("flash:", tinygo.FlashSize)
+	println("ram:", tinygo.RAMSize)
+	println("buffer:", len(buffer))
+	println("large ram:", largeRAM)
+}
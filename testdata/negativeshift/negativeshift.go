@@ -0,0 +1,20 @@
+package main
+
+// Signed shift counts are allowed since Go 1.13.
+var (
+	x int32 = -100
+	n int   = 31
+)
+
+func main() {
+	// A right shift of a negative value by the width or more fills every bit
+	// with the sign bit. Returning without a panic fails the test.
+	if x>>n != -1 || x>>(n+1) != -1 || x<<(n+1) != 0 {
+		println("wrong shift result")
+		return
+	}
+
+	// A negative shift count must panic.
+	n = -n
+	println("unreachable:", x>>n)
+}
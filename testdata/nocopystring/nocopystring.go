@@ -0,0 +1,18 @@
+package main
+
+// This test is built without a heap (-gc=none), so it fails to link if
+// tinygo.NoCopyString allocates.
+
+import "tinygo"
+
+var buf = []byte("hello")
+
+func main() {
+	s := tinygo.NoCopyString(buf)
+	println(s, len(s))
+	println(s == "hello")
+
+	// The string shares the bytes of the slice.
+	buf[0] = 'j'
+	println(s)
+}
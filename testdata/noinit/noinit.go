@@ -0,0 +1,32 @@
+package main
+
+import "unsafe"
+
+// Kept across a soft reset, for example to count the number of resets.
+//go:noinit
+var persistent [4]uint32
+
+var zeroed [4]uint32
+
+// Start and end of the .bss section, which is cleared at startup.
+
+//go:extern _sbss
+var _sbss [0]byte
+
+//go:extern _ebss
+var _ebss [0]byte
+
+// inBSS returns whether the given pointer points into the .bss section.
+func inBSS(ptr unsafe.Pointer) bool {
+	return uintptr(ptr) >= uintptr(unsafe.Pointer(&_sbss)) && uintptr(ptr) < uintptr(unsafe.Pointer(&_ebss))
+}
+
+func main() {
+	println("noinit global zeroed at startup:", inBSS(unsafe.Pointer(&persistent)))
+	println("normal global zeroed at startup:", inBSS(unsafe.Pointer(&zeroed)))
+
+	// The global must still be usable as a regular variable.
+	persistent[1] = 5
+	zeroed[1] = 3
+	println("values:", persistent[1], zeroed[1])
+}
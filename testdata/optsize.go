@@ -0,0 +1,18 @@
+package main
+
+func main() {
+	values := [4]int{1, 2, 3, 4}
+	println("weighted sum:", weightedSum(&values))
+}
+
+// This loop has a small constant trip count. TestOptSize checks that it is
+// unrolled at -opt=s but not at -opt=z.
+//
+//go:noinline
+func weightedSum(values *[4]int) int {
+	sum := 0
+	for i := 0; i < len(values); i++ {
+		sum += values[i] * (i + 1)
+	}
+	return sum
+}
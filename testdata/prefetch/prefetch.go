@@ -0,0 +1,35 @@
+package main
+
+import (
+	"tinygo"
+	"unsafe"
+)
+
+var data [256]uint32
+
+//go:noinline
+func sum(buf []uint32) uint32 {
+	var total uint32
+	for i := range buf {
+		// Prefetch a bit ahead. The hint may point past the end of the slice,
+		// as it is never dereferenced.
+		tinygo.Prefetch(unsafe.Pointer(uintptr(unsafe.Pointer(&buf[i])) + 64))
+		total += buf[i]
+	}
+	return total
+}
+
+func main() {
+	for i := range data {
+		data[i] = uint32(i)
+	}
+	println("sum:", sum(data[:]))
+
+	// Prefetching a nil pointer is allowed.
+	tinygo.Prefetch(nil)
+
+	// Indirect calls work too, but don't prefetch anything.
+	prefetch := tinygo.Prefetch
+	prefetch(unsafe.Pointer(&data[0]))
+	println("done")
+}
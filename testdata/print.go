@@ -1,5 +1,16 @@
 package main
 
+import "tinygo"
+
+// Globals, so that the conversions to tinygo.Hex are not constant folded.
+var (
+	hex8   uint8  = 0x0f
+	hexNeg int8   = -1
+	hex16  uint16 = 0x1234
+	hex32  uint32 = 0xbeef
+	hex64  uint64 = 0xdeadbeefcafe
+)
+
 func main() {
 	// test basic printing
 	println("hello world!")
@@ -26,6 +37,14 @@ func main() {
 	println(int64(123456789012))
 	println(int64(-123456789012))
 
+	// print integers in hexadecimal
+	println(tinygo.Hex(hex8))
+	println(tinygo.Hex(hexNeg))
+	println(tinygo.Hex(hex16))
+	println(tinygo.Hex(hex32), tinygo.Hex(int32(hexNeg)))
+	println(tinygo.Hex(hex64))
+	println(tinygo.Hex(42))
+
 	// print float64
 	println(3.14)
 
@@ -42,4 +61,30 @@ func main() {
 
 	// print bool
 	println(true, false)
+
+	// print error
+	var err error = &myError{42}
+	println(err)
+	println(error(wrapError{"wrapped", err}))
+}
+
+type myError struct {
+	code int
+}
+
+func (e *myError) Error() string {
+	return "my error"
+}
+
+type wrapError struct {
+	msg string
+	err error
+}
+
+func (e wrapError) Error() string {
+	return e.msg + ": " + e.err.Error()
+}
+
+func (e wrapError) Unwrap() error {
+	return e.err
 }
@@ -0,0 +1,58 @@
+package main
+
+// This program shares memory between goroutines in various ways, but all
+// accesses are properly synchronized. It should run without reports when built
+// with -race.
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	lock    sync.Mutex
+	counter int
+)
+
+// increment updates a counter that is protected by a mutex.
+func increment(done chan bool) {
+	for i := 0; i < 3; i++ {
+		lock.Lock()
+		counter++
+		lock.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+	done <- true
+}
+
+// produce creates a slice and hands it over to the receiver.
+func produce(ch chan []int) {
+	data := []int{1, 2, 3}
+	data[0]++
+	ch <- data
+}
+
+func main() {
+	done := make(chan bool)
+	go increment(done)
+	go increment(done)
+	<-done
+	<-done
+	println("counter:", counter)
+
+	// The channel transfers ownership of the slice.
+	ch := make(chan []int)
+	go produce(ch)
+	data := <-ch
+	data[1] = 20
+	println("data:", data[0], data[1], data[2])
+
+	// Values written before the go statement are visible in the goroutine.
+	value := 5
+	go func() {
+		value++
+		done <- true
+	}()
+	<-done
+	println("value:", value)
+}
@@ -0,0 +1,25 @@
+package main
+
+// This program has a data race: two goroutines increment the same counter
+// without synchronization. It should be reported when built with -race.
+
+import "time"
+
+var counter int
+
+func increment(done chan bool) {
+	for i := 0; i < 3; i++ {
+		counter++
+		time.Sleep(time.Millisecond)
+	}
+	done <- true
+}
+
+func main() {
+	done := make(chan bool)
+	go increment(done)
+	go increment(done)
+	<-done
+	<-done
+	println("counter:", counter)
+}
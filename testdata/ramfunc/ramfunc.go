@@ -0,0 +1,34 @@
+package main
+
+import "unsafe"
+
+//go:ramfunc
+func sumRAM(values []int) int {
+	sum := 0
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+func sumFlash(values []int) int {
+	sum := 0
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+// inRAM returns whether the function pointer of the given func value points
+// into the RAM of the lm3s6965 as emulated by QEMU.
+func inRAM(f func([]int) int) bool {
+	ptr := (*[2]uintptr)(unsafe.Pointer(&f))[1]
+	return ptr >= 0x20000000 && ptr < 0x20010000
+}
+
+func main() {
+	values := []int{1, 2, 3, 4, 5}
+	println("sum:", sumRAM(values), sumFlash(values))
+	println("ramfunc in RAM:", inRAM(sumRAM))
+	println("regular function in RAM:", inRAM(sumFlash))
+}
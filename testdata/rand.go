@@ -0,0 +1,52 @@
+package main
+
+import "math/rand"
+
+// The sequence of a seeded math/rand source must be the same on all targets
+// and match the go tool, so that a simulation on the host can be reproduced on
+// a device and the other way around. All values are printed with a fixed size:
+// rand.Int and rand.Uint64 are avoided as the result of the former depends on
+// the size of int (also with the go tool).
+func main() {
+	r := rand.New(rand.NewSource(42))
+	for i := 0; i < 3; i++ {
+		println("Int63:", r.Int63())
+	}
+	for i := 0; i < 3; i++ {
+		println("Uint32:", r.Uint32())
+	}
+	for i := 0; i < 3; i++ {
+		println("Int31n:", r.Int31n(1000))
+	}
+	for i := 0; i < 3; i++ {
+		println("Int63n:", r.Int63n(1e12))
+	}
+	for i := 0; i < 3; i++ {
+		println("Intn:", r.Intn(100))
+	}
+	for i := 0; i < 3; i++ {
+		// Print the float as an integer, to not depend on float formatting.
+		println("Float64:", int32(r.Float64()*1e6))
+	}
+	print("Perm:")
+	for _, n := range r.Perm(8) {
+		print(" ", n)
+	}
+	println()
+	buf := make([]byte, 6)
+	r.Read(buf)
+	print("Read:")
+	for _, b := range buf {
+		print(" ", b)
+	}
+	println()
+
+	// Reseeding restarts the sequence.
+	r.Seed(42)
+	println("reseed Int63:", r.Int63())
+
+	// The global source behaves like a source with the same seed.
+	rand.Seed(7)
+	r = rand.New(rand.NewSource(7))
+	println("global source:", rand.Int63() == r.Int63(), rand.Int31n(50) == r.Int31n(50))
+}
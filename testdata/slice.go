@@ -9,6 +9,14 @@ var array = [4]int{
 	myUint8(2): 3,
 }
 
+// An overlapping copy in a package initializer, which is evaluated at compile
+// time.
+var overlapInit = func() []int {
+	s := []int{1, 2, 3, 4, 5}
+	copy(s[1:], s[:len(s)-1])
+	return s
+}()
+
 func main() {
 	l := 5
 	foo := []int{1, 2, 4, 5}
@@ -103,6 +111,19 @@ func main() {
 	println("copy foo -> bar:", copy(bar, foo))
 	printslice("bar", bar)
 
+	// copy between overlapping parts of the same array, which must behave
+	// like memmove in both directions
+	overlap := []int{1, 2, 3, 4, 5}
+	copy(overlap[1:], overlap[:len(overlap)-1])
+	printslice("overlap forward", overlap)
+	overlap = []int{1, 2, 3, 4, 5}
+	copy(overlap[:len(overlap)-1], overlap[1:])
+	printslice("overlap backward", overlap)
+	overlapBytes := []byte("abcdef")
+	copy(overlapBytes[2:], overlapBytes)
+	println("overlap bytes:", string(overlapBytes))
+	printslice("overlap init", overlapInit)
+
 	// append
 	var grow []int
 	println("slice is nil?", grow == nil, nil == grow)
@@ -0,0 +1,19 @@
+package main
+
+// Start a lot more goroutines than would fit in memory if every goroutine
+// allocated a new stack. This is run with a GC that never frees memory, so it
+// only works if the stacks of exited goroutines are reused.
+
+func worker(done chan int) {
+	done <- 1
+}
+
+func main() {
+	done := make(chan int)
+	started := 0
+	for i := 0; i < 1000; i++ {
+		go worker(done)
+		started += <-done
+	}
+	println("goroutines started:", started)
+}
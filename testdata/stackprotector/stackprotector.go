@@ -0,0 +1,23 @@
+package main
+
+// This program overflows a buffer on the stack, which must be detected by the
+// stack protector.
+
+import _ "unsafe" // for //go:nobounds
+
+var count = 16
+
+func main() {
+	println("before overflow")
+	overflow(count)
+	println("overflow not detected")
+}
+
+//go:nobounds
+func overflow(n int) {
+	var buf [4]uint32
+	for i := 0; i < n; i++ {
+		buf[i] = 0xdeadbeef
+	}
+	println("buf:", buf[0])
+}
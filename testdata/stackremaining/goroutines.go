@@ -0,0 +1,44 @@
+package main
+
+// Check that runtime.StackRemaining reports less stack space the deeper a
+// goroutine recurses, and that recursive code can use it to stop before the
+// stack overflows. An overflow would be detected by the stack canary on the
+// next channel operation.
+
+import "runtime"
+
+var calls int
+
+// recurse calls itself until less than 128 bytes of stack space are left, like
+// a recursive parser that bails out instead of overflowing the stack. It
+// returns the depth it reached.
+func recurse(depth int, prev uintptr) int {
+	remaining := runtime.StackRemaining()
+	if remaining == 0 {
+		println("no stack space left at depth", depth)
+	} else if remaining >= prev {
+		println("stack space did not decrease at depth", depth)
+	}
+	if remaining < 128 {
+		return depth
+	}
+	maxDepth := recurse(depth+1, remaining)
+	calls++ // not a tail call
+	return maxDepth
+}
+
+func worker(done chan int) {
+	done <- recurse(0, ^uintptr(0))
+}
+
+func main() {
+	// The main goroutine, which has already used some of its stack.
+	depth := recurse(0, ^uintptr(0))
+	println("main goroutine recursed:", depth > 1)
+
+	// A new goroutine, which starts with an empty stack.
+	done := make(chan int)
+	go worker(done)
+	depth = <-done
+	println("new goroutine recursed:", depth > 1)
+}
@@ -0,0 +1,68 @@
+package main
+
+// This test is also built for the itsybitsy-m4 in the smoke tests, and can be
+// flashed to a SAMD51 board to check the RTC based sleep and timers of the
+// runtime on real hardware.
+
+import "time"
+
+func main() {
+	// A series of short sleeps should add up to (at least) the requested time,
+	// without accumulating a large error: on average, a sleep may not take more
+	// than a quarter of the interval longer than requested.
+	const count = 20
+	const interval = 5 * time.Millisecond
+	start := time.Now()
+	for i := 0; i < count; i++ {
+		time.Sleep(interval)
+	}
+	elapsed := time.Since(start)
+	println("slept at least the requested time:", elapsed >= count*interval)
+	println("slept close to the requested time:", elapsed < count*interval*5/4)
+
+	testTimer()
+	testTicker()
+	testAfterFunc()
+}
+
+func testTimer() {
+	timer := time.NewTimer(time.Millisecond)
+	<-timer.C
+	println("timer fired")
+
+	timer = time.NewTimer(time.Hour)
+	println("stopped running timer:", timer.Stop())
+	println("stopped stopped timer:", timer.Stop())
+}
+
+func testTicker() {
+	// A ticker should tick at a fixed interval: the delay of one tick must not
+	// be added to the next ones. Every tick must be within half a period of
+	// the time it was due.
+	const ticks = 10
+	const period = 10 * time.Millisecond
+	start := time.Now()
+	ticker := time.NewTicker(period)
+	var maxJitter time.Duration
+	for i := 1; i <= ticks; i++ {
+		tick := <-ticker.C
+		jitter := tick.Sub(start) - time.Duration(i)*period
+		if jitter < 0 {
+			jitter = -jitter
+		}
+		if jitter > maxJitter {
+			maxJitter = jitter
+		}
+	}
+	ticker.Stop()
+	println("ticker jitter within tolerance:", maxJitter < period/2)
+}
+
+func testAfterFunc() {
+	called := false
+	time.AfterFunc(time.Millisecond, func() {
+		called = true
+	})
+	time.Sleep(10 * time.Millisecond)
+	println("AfterFunc called:", called)
+}
@@ -0,0 +1,24 @@
+package main
+
+import "tinygo"
+
+var buf = [16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+
+func main() {
+	// Read and write at an odd offset, to force unaligned accesses.
+	b := buf[1:]
+	println("load16:", tinygo.LoadUnaligned16(b))
+	println("load32:", tinygo.LoadUnaligned32(b))
+	println("load64:", tinygo.LoadUnaligned64(b))
+
+	tinygo.StoreUnaligned16(b, 0xbeef)
+	println("store16:", buf[1], buf[2])
+	tinygo.StoreUnaligned32(b[2:], 0xdeadbeef)
+	println("store32:", buf[3], buf[4], buf[5], buf[6])
+	tinygo.StoreUnaligned64(b[6:], 0x0123456789abcdef)
+	println("load64 after store:", tinygo.LoadUnaligned64(b[6:]))
+
+	// Indirect calls use the plain Go implementation.
+	load := tinygo.LoadUnaligned32
+	println("indirect:", load(b) == tinygo.LoadUnaligned32(b))
+}
@@ -0,0 +1,29 @@
+package main
+
+// All exported functions in this file have a signature that can't be used from
+// outside the WebAssembly module, so building it must fail.
+
+//go:export lookup
+func lookup(table map[string]int32, key int32) int32 {
+	return table[""] + key
+}
+
+type handler func()
+
+//export callback
+func callback(fn handler) {
+	fn()
+}
+
+//go:export describe
+func describe(n int32) interface{} {
+	return n
+}
+
+//go:export divmod
+func divmod(x, y int32) (int32, int32) {
+	return x / y, x % y
+}
+
+func main() {
+}
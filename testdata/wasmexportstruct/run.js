@@ -0,0 +1,35 @@
+// Instantiates a WebAssembly module and calls exported functions that take and
+// return structs, which are passed through linear memory.
+//
+// usage: node run.js [wasm binary]
+
+"use strict";
+
+const fs = require("fs");
+
+// The rest of the runtime isn't used.
+const module = new WebAssembly.Module(fs.readFileSync(process.argv[2]));
+const imports = {};
+for (const imp of WebAssembly.Module.imports(module)) {
+	if (imp.kind == "function") {
+		imports[imp.module] = imports[imp.module] || {};
+		imports[imp.module][imp.name] = () => 0;
+	}
+}
+const instance = new WebAssembly.Instance(module, imports);
+const ptr = instance.exports.scratch();
+const mem = new DataView(instance.exports.memory.buffer);
+
+// point{3, 4} at ptr+16, the result at ptr.
+mem.setInt32(ptr + 16, 3, true);
+mem.setInt32(ptr + 20, 4, true);
+instance.exports.translate(ptr, ptr + 16, 10, 20);
+console.log("translate:", mem.getInt32(ptr, true), mem.getInt32(ptr + 4, true));
+console.log("unchanged:", mem.getInt32(ptr + 16, true), mem.getInt32(ptr + 20, true));
+console.log("lengthSquared:", instance.exports.lengthSquared(ptr + 16));
+
+// sample{1, 1234567890123} at ptr+32, the result at ptr+48.
+mem.setUint8(ptr + 32, 1);
+mem.setBigInt64(ptr + 40, 1234567890123n, true);
+instance.exports.scale(ptr + 48, ptr + 32, 3);
+console.log("scale:", mem.getUint8(ptr + 48), mem.getBigInt64(ptr + 56, true).toString());
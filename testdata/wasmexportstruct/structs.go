@@ -0,0 +1,46 @@
+package main
+
+// Structs are passed to and from exported functions through linear memory. The
+// host uses the scratch buffer for that, as there is no malloc on wasm.
+
+var scratch [8]uint64
+
+//go:export scratch
+func getScratch() *uint64 {
+	return &scratch[0]
+}
+
+type point struct {
+	x, y int32
+}
+
+// The result is written to a pointer passed as the first parameter, followed by
+// a pointer to p and the other parameters.
+//
+//go:export translate
+func translate(p point, dx, dy int32) point {
+	p.x += dx
+	p.y += dy
+	return p
+}
+
+//go:export lengthSquared
+func lengthSquared(p point) int32 {
+	return p.x*p.x + p.y*p.y
+}
+
+// The fields are aligned as in C, so value is at offset 8.
+type sample struct {
+	flag  uint8
+	value int64
+}
+
+//go:export scale
+func scale(s sample, factor int32) sample {
+	s.flag++
+	s.value *= int64(factor)
+	return s
+}
+
+func main() {
+}
@@ -0,0 +1,33 @@
+package main
+
+// Both functions are imported with the same field name, but from different
+// interfaces.
+
+//go:wasmimport example:calc/arith@0.1.0 add
+func add(a, b int32) int32
+
+//go:wasmimport example:calc/digits@0.1.0 add
+func addDigits(a, b int32) int32
+
+// Floating point parameters and results must be passed as f32 and f64 values.
+
+//go:wasmimport example:calc/float@0.1.0 add
+func addFloat(a, b float64) float64
+
+//go:export calculate
+func calculate(a, b int32) int32 {
+	return add(a, b)*100 + addDigits(a, b)
+}
+
+//go:export calculateFloat
+func calculateFloat(a, b float64) float64 {
+	return addFloat(a, b)
+}
+
+//go:export third
+func third(x float32) float32 {
+	return x / 3
+}
+
+func main() {
+}
@@ -0,0 +1,40 @@
+// Instantiates a WebAssembly module that imports functions from component
+// model style interfaces and calls an exported function that uses them.
+//
+// usage: node run.js [wasm binary]
+
+"use strict";
+
+const fs = require("fs");
+
+const imports = {
+	"example:calc/arith@0.1.0": {
+		add: (a, b) => a + b,
+	},
+	"example:calc/digits@0.1.0": {
+		add: (a, b) => a * 10 + b,
+	},
+	"example:calc/float@0.1.0": {
+		add: (a, b) => a + b,
+	},
+};
+
+// The rest of the runtime isn't used.
+const module = new WebAssembly.Module(fs.readFileSync(process.argv[2]));
+const names = [];
+for (const imp of WebAssembly.Module.imports(module)) {
+	if (imp.module.startsWith("example:")) {
+		names.push(imp.module + " " + imp.name);
+	} else if (imp.kind == "function") {
+		imports[imp.module] = imports[imp.module] || {};
+		imports[imp.module][imp.name] = () => 0;
+	}
+}
+// The order of the imports is not important.
+for (const name of names.sort()) {
+	console.log("import:", name);
+}
+const instance = new WebAssembly.Instance(module, imports);
+console.log("calculate:", instance.exports.calculate(2, 3));
+console.log("calculateFloat:", instance.exports.calculateFloat(0.1, 0.2));
+console.log("third:", instance.exports.third(1));
@@ -0,0 +1,19 @@
+package main
+
+// fib is not exported, but must still be named in the name section.
+//
+//go:noinline
+func fib(n int) int {
+	if n < 2 {
+		return n
+	}
+	return fib(n-1) + fib(n-2)
+}
+
+//go:export calculate
+func calculate(n int32) int32 {
+	return int32(fib(int(n)))
+}
+
+func main() {
+}
@@ -0,0 +1,33 @@
+package main
+
+// This program is built with -panic=host, see run.js.
+
+//go:export divide
+func divide(a, b int32) int32 {
+	if b == 0 {
+		panic("division by zero")
+	}
+	return a / b
+}
+
+// deep panics after using some stack space, to check that the stack is
+// reclaimed after every panic.
+//go:export deep
+func deep(n int32) int32 {
+	var buf [256]byte
+	fill(buf[:], byte(n))
+	if n == 0 {
+		panic("too deep")
+	}
+	return deep(n-1) + int32(buf[n%256])
+}
+
+//go:noinline
+func fill(buf []byte, b byte) {
+	for i := range buf {
+		buf[i] = b
+	}
+}
+
+func main() {
+}
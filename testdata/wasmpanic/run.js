@@ -0,0 +1,60 @@
+// Calls an exported function of a WebAssembly module built with -panic=host
+// that panics. The host catches the trap, reads the panic message and
+// continues to use the module.
+//
+// usage: node run.js [wasm binary]
+
+"use strict";
+
+const fs = require("fs");
+
+const decoder = new TextDecoder("utf-8");
+
+// Only the panic output is needed, the rest of the runtime isn't used.
+const imports = { env: {} };
+const module = new WebAssembly.Module(fs.readFileSync(process.argv[2]));
+for (const imp of WebAssembly.Module.imports(module)) {
+	if (imp.kind == "function") {
+		imports[imp.module] = imports[imp.module] || {};
+		imports[imp.module][imp.name] = () => 0;
+	}
+}
+const instance = new WebAssembly.Instance(module, imports);
+const exports = instance.exports;
+
+// Returns the panic message of the trap and clears it.
+function panicMessage(err) {
+	const len = exports.tinygo_panic_message_len();
+	if (len == 0) {
+		throw err; // not a panic
+	}
+	const ptr = exports.tinygo_panic_message();
+	const msg = decoder.decode(new Uint8Array(exports.memory.buffer, ptr, len));
+	exports.tinygo_clear_panic();
+	return msg;
+}
+
+function call(a, b) {
+	try {
+		console.log("result:", exports.divide(a, b));
+	} catch (err) {
+		console.log("caught:", panicMessage(err));
+	}
+}
+
+call(6, 3);
+call(1, 0);
+call(8, 2);
+
+// Each of these panics uses about 16kB of stack. Without reclaiming the stack
+// after a panic, the stack would overflow long before the end.
+let msg;
+for (let i = 0; i < 1000; i++) {
+	try {
+		exports.deep(64);
+	} catch (err) {
+		msg = panicMessage(err);
+	}
+}
+console.log("caught 1000 times:", msg);
+call(9, 3);
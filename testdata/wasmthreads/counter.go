@@ -0,0 +1,80 @@
+package main
+
+// This program is instantiated by multiple threads at the same time (see
+// run.js). The worker threads update shared counters through sync/atomic,
+// while the main thread runs regular Go code that uses the heap and the stack.
+// Only sync/atomic is thread safe, so the functions called by the workers
+// don't allocate and don't take the address of local variables.
+
+import "sync/atomic"
+
+var (
+	counter   uint32
+	counter64 uint64
+	maximum   uint32
+)
+
+//go:export increment
+func increment(n uint32) {
+	for i := uint32(0); i < n; i++ {
+		atomic.AddUint32(&counter, 1)
+		atomic.AddUint64(&counter64, 1<<32)
+
+		// Keep track of the largest value with a compare-and-swap loop.
+		for {
+			old := atomic.LoadUint32(&maximum)
+			if i <= old || atomic.CompareAndSwapUint32(&maximum, old, i) {
+				break
+			}
+		}
+	}
+}
+
+//go:export count
+func count() uint32 {
+	return atomic.LoadUint32(&counter)
+}
+
+//go:export count64
+func count64() uint32 {
+	// Return the upper half, as the lower half is always zero.
+	return uint32(atomic.LoadUint64(&counter64) >> 32)
+}
+
+//go:export max
+func getMax() uint32 {
+	return atomic.LoadUint32(&maximum)
+}
+
+type node struct {
+	next  *node
+	value uint32
+}
+
+// work is called on the main thread while the workers are running. It
+// allocates a linked list on the heap and uses an array on the stack.
+//go:export work
+func work(n uint32) uint32 {
+	var list *node
+	sum := uint32(0)
+	for i := uint32(0); i < n; i++ {
+		list = &node{next: list, value: i}
+		var buf [16]uint32
+		fill(&buf, i)
+		sum += buf[i%16]
+	}
+	for ; list != nil; list = list.next {
+		sum += list.value
+	}
+	return sum
+}
+
+//go:noinline
+func fill(buf *[16]uint32, seed uint32) {
+	for i := range buf {
+		buf[i] = seed*uint32(i) + 1
+	}
+}
+
+func main() {
+}
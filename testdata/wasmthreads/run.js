@@ -0,0 +1,82 @@
+// Runs a WebAssembly module built with -wasm-threads on multiple threads. Every
+// worker instantiates the module with the same shared memory and updates some
+// counters using an exported function. Meanwhile, the main thread initializes
+// the runtime and runs Go code that uses the heap and the stack. Afterwards
+// the counters and the result of the main thread are printed.
+//
+// usage: node run.js [wasm binary] [memory size in pages]
+
+"use strict";
+
+const fs = require("fs");
+const { Worker, isMainThread, parentPort, workerData } = require("worker_threads");
+
+const threads = 2;
+const iterations = 100000;
+const work = 20000;
+
+// Instantiate the module with the given memory. The runtime only needs
+// io_get_stdout during initialization, the other imports are not used.
+function instantiate(module, memory) {
+	const imports = {};
+	for (const imp of WebAssembly.Module.imports(module)) {
+		imports[imp.module] = imports[imp.module] || {};
+		if (imp.kind == "memory") {
+			imports[imp.module][imp.name] = memory;
+		} else if (imp.kind == "function" && imp.name == "io_get_stdout") {
+			imports[imp.module][imp.name] = () => 1;
+		} else if (imp.kind == "function") {
+			imports[imp.module][imp.name] = () => {
+				throw new Error("not implemented: " + imp.module + "." + imp.name);
+			};
+		}
+	}
+	return new WebAssembly.Instance(module, imports);
+}
+
+if (isMainThread) {
+	const module = new WebAssembly.Module(fs.readFileSync(process.argv[2]));
+	const pages = parseInt(process.argv[3]);
+	const memory = new WebAssembly.Memory({ initial: pages, maximum: pages, shared: true });
+	const instance = instantiate(module, memory);
+
+	// Instantiating a module initializes the memory again, so only initialize
+	// the runtime and start counting once all workers have been instantiated.
+	const workers = [];
+	let ready = 0;
+	let running = threads;
+	let sum = 0;
+	for (let i = 0; i < threads; i++) {
+		const worker = new Worker(__filename, { workerData: { module: module, memory: memory } });
+		worker.on("error", (err) => {
+			throw err;
+		});
+		worker.on("message", () => {
+			ready++;
+			if (ready == threads) {
+				instance.exports._start();
+				for (const w of workers) {
+					w.postMessage("start");
+				}
+				sum = instance.exports.work(work);
+			}
+		});
+		worker.on("exit", () => {
+			running--;
+			if (running == 0) {
+				console.log("counter:", instance.exports.count());
+				console.log("counter64:", instance.exports.count64());
+				console.log("max:", instance.exports.max());
+				console.log("work:", sum >>> 0);
+			}
+		});
+		workers.push(worker);
+	}
+} else {
+	const instance = instantiate(workerData.module, workerData.memory);
+	parentPort.once("message", () => {
+		instance.exports.increment(iterations);
+		parentPort.close();
+	});
+	parentPort.postMessage("ready");
+}
@@ -1,7 +1,65 @@
 package main
+
 func main() {
 	p := []byte{}
 	for len(p) >= 1 {
 		p = p[1:]
 	}
+
+	// Values that fit in a pointer must be stored directly in the interface.
+	// TestZeroAlloc checks that these functions don't allocate.
+	if boxInt(5).(int) != 5 || boxPair(3, 4).(pair).b != 4 {
+		println("interface boxing failed")
+	}
+	logValues(3, true, 'x', point{5, 6})
+}
+
+type pair struct {
+	a, b int16
+}
+
+// A point is two words, so it doesn't fit in an interface and must be boxed.
+type point struct {
+	x, y int
+}
+
+//go:noinline
+func boxInt(n int) interface{} {
+	return n
+}
+
+//go:noinline
+func boxPair(a, b int16) interface{} {
+	return pair{a, b}
+}
+
+// A logging call must not allocate: the backing array of the variadic
+// parameter doesn't escape, and neither does the boxed point, which can be
+// allocated on the stack as well.
+//
+//go:noinline
+func logValues(n int, ok bool, c byte, p point) {
+	log(n, ok, c, p)
+}
+
+//go:noinline
+func log(args ...interface{}) {
+	for i, arg := range args {
+		if i > 0 {
+			print(" ")
+		}
+		switch arg := arg.(type) {
+		case string:
+			print(arg)
+		case int:
+			print(arg)
+		case bool:
+			print(arg)
+		case byte:
+			print(arg)
+		case point:
+			print(arg.x, ",", arg.y)
+		}
+	}
+	println()
 }
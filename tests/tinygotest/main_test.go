@@ -21,5 +21,14 @@ func TestPass(t *testing.T) {
 	t.Log("TestPass passed")
 }
 
-func BenchmarkNotImplemented(b *testing.B) {
+var sink int
+
+func BenchmarkSum(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		sum := 0
+		for j := 0; j < 100; j++ {
+			sum += j
+		}
+		sink = sum
+	}
 }
@@ -3,7 +3,8 @@ package transform
 // This file implements an escape analysis pass. It looks for calls to
 // runtime.alloc and replaces these calls with a stack allocation if the
 // allocated value does not escape. It uses the LLVM nocapture flag for
-// interprocedural escape analysis.
+// interprocedural escape analysis. Pointers stored in another allocation that
+// doesn't escape are tracked further by looking into the called functions.
 
 import (
 	"tinygo.org/x/go-llvm"
@@ -31,6 +32,11 @@ func OptimizeAllocs(mod llvm.Module) {
 	i8ptrType := llvm.PointerType(mod.Context().Int8Type(), 0)
 	builder := mod.Context().NewBuilder()
 
+	// First determine which allocations can be moved to the stack, and only
+	// then change them. The escape analysis of a pointer that is stored in
+	// another allocation looks at that allocation, which must still be a call
+	// to runtime.alloc at that point.
+	var stackAllocs []llvm.Value
 	for _, heapalloc := range getUses(allocator) {
 		if heapalloc.Operand(0).IsAConstant().IsNil() {
 			// Do not allocate variable length arrays on the stack.
@@ -43,23 +49,16 @@ func OptimizeAllocs(mod llvm.Module) {
 			continue
 		}
 
-		// In general the pattern is:
-		//     %0 = call i8* @runtime.alloc(i32 %size)
-		//     %1 = bitcast i8* %0 to type*
-		//     (use %1 only)
-		// But the bitcast might sometimes be dropped when allocating an *i8.
-		// The 'bitcast' variable below is thus usually a bitcast of the
-		// heapalloc but not always.
-		bitcast := heapalloc // instruction that creates the value
-		if uses := getUses(heapalloc); len(uses) == 1 && !uses[0].IsABitCastInst().IsNil() {
-			// getting only bitcast use
-			bitcast = uses[0]
-		}
-
-		if mayEscape(bitcast) {
+		if mayEscape(allocResult(heapalloc)) {
 			continue
 		}
 		// The pointer value does not escape.
+		stackAllocs = append(stackAllocs, heapalloc)
+	}
+
+	for _, heapalloc := range stackAllocs {
+		size := heapalloc.Operand(0).ZExtValue()
+		bitcast := allocResult(heapalloc)
 
 		// Insert alloca in the entry block. Do it here so that mem2reg can
 		// promote it to a SSA value.
@@ -85,9 +84,38 @@ func OptimizeAllocs(mod llvm.Module) {
 	}
 }
 
+// allocResult returns the instruction that creates the value of a call to
+// runtime.alloc: usually a bitcast of the call, but not always.
+func allocResult(heapalloc llvm.Value) llvm.Value {
+	// In general the pattern is:
+	//     %0 = call i8* @runtime.alloc(i32 %size)
+	//     %1 = bitcast i8* %0 to type*
+	//     (use %1 only)
+	// But the bitcast might sometimes be dropped when allocating an *i8, or
+	// the i8* may be used directly (for example, when storing it in an
+	// interface).
+	if uses := getUses(heapalloc); len(uses) == 1 && !uses[0].IsABitCastInst().IsNil() {
+		// getting only bitcast use
+		return uses[0]
+	}
+	return heapalloc
+}
+
+// maxEscapeDepth is the number of nested function calls and stores that are
+// followed when checking whether a pointer escapes.
+const maxEscapeDepth = 3
+
 // mayEscape returns whether the value might escape. It returns true if it might
 // escape, and false if it definitely doesn't. The value must be an instruction.
 func mayEscape(value llvm.Value) bool {
+	return valueMayEscape(value, false, maxEscapeDepth)
+}
+
+// valueMayEscape returns whether the pointer value might escape. If contents is
+// set, the values loaded through the pointer must not escape either. This is
+// checked by looking into the called functions (up to the given depth), as
+// there is no LLVM attribute for it.
+func valueMayEscape(value llvm.Value, contents bool, depth int) bool {
 	uses := getUses(value)
 	for _, use := range uses {
 		if use.IsAInstruction().IsNil() {
@@ -95,29 +123,54 @@ func mayEscape(value llvm.Value) bool {
 		}
 		switch use.InstructionOpcode() {
 		case llvm.GetElementPtr:
-			if mayEscape(use) {
+			if valueMayEscape(use, contents, depth) {
 				return true
 			}
 		case llvm.BitCast:
 			// A bitcast escapes if the casted-to value escapes.
-			if mayEscape(use) {
+			if valueMayEscape(use, contents, depth) {
 				return true
 			}
 		case llvm.Load:
-			// Load does not escape.
+			// Load does not escape, but the loaded value might.
+			if contents && valueMayEscape(use, false, depth) {
+				return true
+			}
 		case llvm.Store:
 			// Store only escapes when the value is stored to, not when the
 			// value is stored into another value.
-			if use.Operand(0) == value {
+			if use.Operand(0) == value && (contents || storeMayEscape(use, depth)) {
 				return true
 			}
 		case llvm.Call:
-			if !hasFlag(use, value, "nocapture") {
+			if contents {
+				if callMayLeakContents(use, value, depth) {
+					return true
+				}
+			} else if !hasFlag(use, value, "nocapture") {
 				return true
 			}
 		case llvm.ICmp:
 			// Comparing pointers don't let the pointer escape.
 			// This is often a compiler-inserted nil check.
+		case llvm.InsertValue:
+			// The pointer is stored in an aggregate (such as an interface), so
+			// it escapes if the aggregate escapes.
+			if valueMayEscape(use, contents, depth) {
+				return true
+			}
+		case llvm.ExtractValue:
+			// Only pointers extracted from an aggregate (such as the value of
+			// an interface) need to be tracked further.
+			if use.Type().TypeKind() == llvm.PointerTypeKind && valueMayEscape(use, contents, depth) {
+				return true
+			}
+		case llvm.PtrToInt:
+			// The pointer is converted to an integer. This is also how small
+			// values stored directly in an interface are read.
+			if intMayEscape(use, contents, depth) {
+				return true
+			}
 		default:
 			// Unknown instruction, might escape.
 			return true
@@ -127,3 +180,79 @@ func mayEscape(value llvm.Value) bool {
 	// Checked all uses, and none let the pointer value escape.
 	return false
 }
+
+// intMayEscape returns whether the pointer converted to the given integer might
+// escape. In Go, an integer (uintptr) doesn't keep the object it points to
+// alive, and it may only be converted back to a pointer within the same
+// expression, like unsafe.Pointer(uintptr(ptr) + offset). Such conversions are
+// tracked as pointers. Storing the integer is treated as an escape, as that is
+// how addresses are passed to hardware (for example, to start a DMA transfer).
+func intMayEscape(value llvm.Value, contents bool, depth int) bool {
+	for _, use := range getUses(value) {
+		if use.IsAInstruction().IsNil() {
+			panic("expected instruction use")
+		}
+		switch use.InstructionOpcode() {
+		case llvm.IntToPtr:
+			if valueMayEscape(use, contents, depth) {
+				return true
+			}
+		case llvm.Add, llvm.Sub, llvm.And, llvm.Or, llvm.Xor, llvm.Trunc, llvm.ZExt, llvm.SExt:
+			if intMayEscape(use, contents, depth) {
+				return true
+			}
+		case llvm.Store:
+			if use.Operand(0) == value {
+				return true
+			}
+		case llvm.InsertValue, llvm.PHI, llvm.Select, llvm.Ret:
+			// The integer might be converted back to a pointer elsewhere.
+			return true
+		}
+	}
+	return false
+}
+
+// storeMayEscape returns whether the value stored by the given store
+// instruction might escape. That is the case unless it is stored in a
+// non-escaping allocation made in the same basic block, from which it is only
+// loaded in ways that don't let it escape either. This makes it possible to
+// allocate for example a value boxed in an interface on the stack, when it is
+// passed in a variadic parameter.
+func storeMayEscape(store llvm.Value, depth int) bool {
+	// Find the allocation the value is stored in.
+	ptr := store.Operand(1)
+	for !ptr.IsAGetElementPtrInst().IsNil() || !ptr.IsABitCastInst().IsNil() {
+		ptr = ptr.Operand(0)
+	}
+	if ptr.IsACallInst().IsNil() || ptr.CalledValue().Name() != "runtime.alloc" {
+		return true
+	}
+
+	// The allocation must be made each time the value is stored. Otherwise,
+	// a stack allocation made in a loop could be stored in the same place
+	// multiple times while the previously stored value is still in use.
+	if ptr.InstructionParent() != store.InstructionParent() || depth == 0 {
+		return true
+	}
+
+	return valueMayEscape(ptr, true, depth-1)
+}
+
+// callMayLeakContents returns whether the called function might let the given
+// pointer or any of the values loaded through it escape, by looking at the
+// function body.
+func callMayLeakContents(call, value llvm.Value, depth int) bool {
+	fn := call.CalledValue()
+	if fn.IsAFunction().IsNil() || fn.IsDeclaration() || depth == 0 {
+		// Not a direct call to a function with a known body, or nested too
+		// deeply.
+		return true
+	}
+	for i := 0; i < fn.ParamsCount(); i++ {
+		if call.Operand(i) == value && valueMayEscape(fn.Param(i), true, depth-1) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package transform
 
 import (
+	"fmt"
 	"math/big"
 
 	"tinygo.org/x/go-llvm"
@@ -257,9 +258,13 @@ func MakeGCStackSlots(mod llvm.Module) bool {
 // bitmap (bit vector) to locate all the pointers in this large global. This
 // bitmap allows the GC to know in advance where exactly all the pointers live
 // in the large globals bundle, to avoid false positives.
-func AddGlobalsBitmap(mod llvm.Module) bool {
+//
+// It returns an error if the pointer layout of a global can't be encoded in
+// the bitmap, for example because a packed struct contains an unaligned
+// pointer. Such a pointer would be missed by the GC.
+func AddGlobalsBitmap(mod llvm.Module) (bool, error) {
 	if mod.NamedGlobal("runtime.trackedGlobalsStart").IsNil() {
-		return false // nothing to do: no GC in use
+		return false, nil // nothing to do: no GC in use
 	}
 
 	ctx := mod.Context()
@@ -275,7 +280,10 @@ func AddGlobalsBitmap(mod llvm.Module) bool {
 			continue
 		}
 		typ := global.Type().ElementType()
-		ptrs := getPointerBitmap(targetData, typ, global.Name())
+		ptrs, err := getPointerBitmap(targetData, typ)
+		if err != nil {
+			return false, fmt.Errorf("precise GC: cannot encode pointer layout of global %s of type %s: %s", global.Name(), typ.String(), err)
+		}
 		if ptrs.BitLen() == 0 {
 			continue
 		}
@@ -318,7 +326,12 @@ func AddGlobalsBitmap(mod llvm.Module) bool {
 	// looks like one.
 	// This code assumes that pointers are self-aligned. For example, that a
 	// 32-bit (4-byte) pointer is also aligned to 4 bytes.
-	bitmapBytes := getPointerBitmap(targetData, globalsBundleType, "globals bundle").Bytes()
+	bitmap, err := getPointerBitmap(targetData, globalsBundleType)
+	if err != nil {
+		// Shouldn't happen, as the layout of each global is already checked.
+		return false, fmt.Errorf("precise GC: cannot encode pointer layout of globals bundle: %s", err)
+	}
+	bitmapBytes := bitmap.Bytes()
 	bitmapValues := make([]llvm.Value, len(bitmapBytes))
 	for i, b := range bitmapBytes {
 		bitmapValues[len(bitmapBytes)-i-1] = llvm.ConstInt(ctx.Int8Type(), uint64(b), false)
@@ -330,48 +343,58 @@ func AddGlobalsBitmap(mod llvm.Module) bool {
 	bitmapNew.SetInitializer(bitmapArray)
 	bitmapNew.SetName("runtime.trackedGlobalsBitmap")
 
-	return true // the IR was changed
+	return true, nil // the IR was changed
 }
 
 // getPointerBitmap scans the given LLVM type for pointers and sets bits in a
 // bigint at the word offset that contains a pointer. This scan is recursive.
-func getPointerBitmap(targetData llvm.TargetData, typ llvm.Type, name string) *big.Int {
+// It returns an error if a pointer can't be represented in the bitmap.
+func getPointerBitmap(targetData llvm.TargetData, typ llvm.Type) (*big.Int, error) {
 	alignment := targetData.PrefTypeAlignment(llvm.PointerType(typ.Context().Int8Type(), 0))
 	switch typ.TypeKind() {
 	case llvm.IntegerTypeKind, llvm.FloatTypeKind, llvm.DoubleTypeKind:
-		return big.NewInt(0)
+		return big.NewInt(0), nil
 	case llvm.PointerTypeKind:
-		return big.NewInt(1)
+		return big.NewInt(1), nil
 	case llvm.StructTypeKind:
 		ptrs := big.NewInt(0)
 		for i, subtyp := range typ.StructElementTypes() {
-			subptrs := getPointerBitmap(targetData, subtyp, name)
+			subptrs, err := getPointerBitmap(targetData, subtyp)
+			if err != nil {
+				return nil, err
+			}
 			if subptrs.BitLen() == 0 {
 				continue
 			}
 			offset := targetData.ElementOffset(typ, i)
 			if offset%uint64(alignment) != 0 {
-				panic("precise GC: global contains unaligned pointer: " + name)
+				return nil, fmt.Errorf("pointer at unaligned offset %d in %s", offset, typ.String())
 			}
 			subptrs.Lsh(subptrs, uint(offset)/uint(alignment))
 			ptrs.Or(ptrs, subptrs)
 		}
-		return ptrs
+		return ptrs, nil
 	case llvm.ArrayTypeKind:
 		subtyp := typ.ElementType()
-		subptrs := getPointerBitmap(targetData, subtyp, name)
+		subptrs, err := getPointerBitmap(targetData, subtyp)
+		if err != nil {
+			return nil, err
+		}
 		ptrs := big.NewInt(0)
 		if subptrs.BitLen() == 0 {
-			return ptrs
+			return ptrs, nil
 		}
 		elementSize := targetData.TypeAllocSize(subtyp)
+		if elementSize%uint64(alignment) != 0 {
+			return nil, fmt.Errorf("array element %s has a size that is not a multiple of the pointer alignment", subtyp.String())
+		}
 		for i := 0; i < typ.ArrayLength(); i++ {
 			ptrs.Lsh(ptrs, uint(elementSize)/uint(alignment))
 			ptrs.Or(ptrs, subptrs)
 		}
-		return ptrs
+		return ptrs, nil
 	default:
-		panic("unknown type kind of global: " + name)
+		return nil, fmt.Errorf("unknown type kind of %s", typ.String())
 	}
 }
 
@@ -1,6 +1,7 @@
 package transform
 
 import (
+	"strings"
 	"testing"
 
 	"tinygo.org/x/go-llvm"
@@ -9,8 +10,40 @@ import (
 func TestAddGlobalsBitmap(t *testing.T) {
 	t.Parallel()
 	testTransform(t, "testdata/gc-globals", func(mod llvm.Module) {
-		AddGlobalsBitmap(mod)
+		_, err := AddGlobalsBitmap(mod)
+		if err != nil {
+			t.Error(err)
+		}
 	})
+	testTransform(t, "testdata/gc-globals-large", func(mod llvm.Module) {
+		_, err := AddGlobalsBitmap(mod)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestAddGlobalsBitmapUnaligned(t *testing.T) {
+	t.Parallel()
+
+	// A global with an unaligned pointer must be diagnosed, instead of being
+	// silently missed by the GC.
+	ctx := llvm.NewContext()
+	buf, err := llvm.NewMemoryBufferFromFile("testdata/gc-globals-unaligned.ll")
+	if err != nil {
+		t.Fatal("could not read file:", err)
+	}
+	mod, err := ctx.ParseIR(buf)
+	if err != nil {
+		t.Fatalf("could not load module:\n%v", err)
+	}
+	_, err = AddGlobalsBitmap(mod)
+	if err == nil {
+		t.Fatal("expected an error for a global with an unaligned pointer")
+	}
+	if !strings.Contains(err.Error(), "globalPacked") || !strings.Contains(err.Error(), "unaligned offset 1") {
+		t.Errorf("unexpected error message: %s", err)
+	}
 }
 
 func TestMakeGCStackSlots(t *testing.T) {
@@ -0,0 +1,279 @@
+package transform
+
+// This file implements passes that reduce the size of globals in the final
+// binary: one that packs small read-only globals together in a single global,
+// to reduce the per-global overhead (alignment padding, symbol and section
+// overhead), and one that stores the initial values of large global variables
+// compressed.
+
+import (
+	"encoding/binary"
+	"strconv"
+
+	"tinygo.org/x/go-llvm"
+)
+
+// maxPackedGlobalSize is the maximum size in bytes of a global that may be
+// packed together with other globals. Larger globals do not benefit much from
+// packing.
+const maxPackedGlobalSize = 32
+
+// PackGlobals merges small internal constant globals with the same alignment
+// into a single constant struct and replaces all references to them with a
+// GEP into this struct. Globals that have been placed explicitly (with a
+// section or with an alignment different from their natural alignment) are
+// left alone. It returns the number of globals that were packed.
+//
+// This pass should be run after the optimizer, as it hides unused globals from
+// the global DCE pass.
+func PackGlobals(mod llvm.Module) int {
+	ctx := mod.Context()
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+
+	// Collect all globals that can be packed, grouped by alignment. Since all
+	// globals in a group have the same alignment and their size is a multiple
+	// of their alignment, there is no padding between them.
+	var alignments []int
+	groups := map[int][]llvm.Value{}
+	for global := mod.FirstGlobal(); !global.IsNil(); global = llvm.NextGlobal(global) {
+		if global.IsDeclaration() || !global.IsGlobalConstant() {
+			continue
+		}
+		if linkage := global.Linkage(); linkage != llvm.InternalLinkage && linkage != llvm.PrivateLinkage {
+			// Externally visible globals must keep their own symbol.
+			continue
+		}
+		if global.Section() != "" {
+			// Explicitly placed in a particular section.
+			continue
+		}
+		typ := global.Type().ElementType()
+		align := targetData.ABITypeAlignment(typ)
+		if global.Alignment() != 0 && global.Alignment() != align {
+			// Explicit alignment (for example, with //go:align).
+			continue
+		}
+		if targetData.TypeAllocSize(typ) > maxPackedGlobalSize {
+			continue
+		}
+		if _, ok := groups[align]; !ok {
+			alignments = append(alignments, align)
+		}
+		groups[align] = append(groups[align], global)
+	}
+
+	// Pack each group in a single global.
+	packed := 0
+	zero := llvm.ConstInt(ctx.Int32Type(), 0, false)
+	for _, align := range alignments {
+		globals := groups[align]
+		if len(globals) < 2 {
+			// Nothing to gain by packing a single global.
+			continue
+		}
+		types := make([]llvm.Type, len(globals))
+		values := make([]llvm.Value, len(globals))
+		for i, global := range globals {
+			types[i] = global.Type().ElementType()
+			values[i] = global.Initializer()
+		}
+		blob := llvm.AddGlobal(mod, ctx.StructType(types, false), "tinygo.packedGlobals."+strconv.Itoa(align))
+		blob.SetInitializer(ctx.ConstStruct(values, false))
+		blob.SetGlobalConstant(true)
+		blob.SetLinkage(llvm.PrivateLinkage)
+		blob.SetUnnamedAddr(true)
+		blob.SetAlignment(align)
+		for i, global := range globals {
+			gep := llvm.ConstInBoundsGEP(blob, []llvm.Value{
+				zero,
+				llvm.ConstInt(ctx.Int32Type(), uint64(i), false),
+			})
+			global.ReplaceAllUsesWith(gep)
+			global.EraseFromParentAsGlobal()
+		}
+		packed += len(globals)
+	}
+	return packed
+}
+
+// minCompressedGlobalSize is the minimum size in bytes of a global variable of
+// which the initial value may be compressed. Smaller globals don't benefit
+// enough to make up for the entry in the table of compressed globals.
+const minCompressedGlobalSize = 64
+
+// CompressGlobals moves large global variables from .data to .bss, and stores
+// their initial values compressed in the read-only table
+// tinygo_compressedGlobals instead, which the runtime decompresses at startup.
+// This reduces the flash size of programs with large initialized data, for a
+// little extra startup time. See src/runtime/compressdata.go for the format.
+// It returns the number of compressed globals.
+//
+// Only globals with a plain initializer (without pointers, floats or constant
+// expressions) are compressed, and only when that saves space. If the runtime
+// doesn't declare tinygo_compressedGlobals, nothing is done.
+//
+// This pass should be run after the optimizer, so that unused globals have
+// already been removed and constant globals are marked as such.
+func CompressGlobals(mod llvm.Module) int {
+	table := mod.NamedGlobal("tinygo_compressedGlobals")
+	if table.IsNil() || !table.IsDeclaration() {
+		return 0
+	}
+	ctx := mod.Context()
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	tableType := table.Type().ElementType()
+	entryType := tableType.StructElementTypes()[0].ElementType()
+	uintptrType := tableType.StructElementTypes()[1]
+	i8ptrType := llvm.PointerType(ctx.Int8Type(), 0)
+
+	var entries []llvm.Value
+	var data []byte
+	for global := mod.FirstGlobal(); !global.IsNil(); global = llvm.NextGlobal(global) {
+		if global.IsDeclaration() || global.IsGlobalConstant() || global == table {
+			continue
+		}
+		if global.Section() != "" {
+			// Explicitly placed in a particular section, such as .noinit.
+			continue
+		}
+		initializer := global.Initializer()
+		if initializer.IsNull() {
+			// Already in .bss.
+			continue
+		}
+		typ := global.Type().ElementType()
+		size := targetData.TypeAllocSize(typ)
+		if size < minCompressedGlobalSize {
+			continue
+		}
+		buf := make([]byte, size)
+		if !constBytes(targetData, initializer, buf) {
+			continue
+		}
+		compressed := compressRLE(buf)
+		if uint64(len(compressed))+targetData.TypeAllocSize(entryType) >= size {
+			// Doesn't compress well enough.
+			continue
+		}
+		data = append(data, compressed...)
+		entries = append(entries, llvm.ConstNamedStruct(entryType, []llvm.Value{
+			llvm.ConstBitCast(global, i8ptrType),
+			llvm.ConstInt(uintptrType, size, false),
+		}))
+		global.SetInitializer(llvm.ConstNull(typ))
+	}
+
+	// Create the table, even if it is empty.
+	globalsPtr := llvm.ConstNull(tableType.StructElementTypes()[0])
+	dataPtr := llvm.ConstNull(i8ptrType)
+	if len(entries) != 0 {
+		globals := llvm.AddGlobal(mod, llvm.ArrayType(entryType, len(entries)), "tinygo_compressedGlobals.globals")
+		globals.SetInitializer(llvm.ConstArray(entryType, entries))
+		globals.SetGlobalConstant(true)
+		globals.SetLinkage(llvm.PrivateLinkage)
+		globalsPtr = llvm.ConstBitCast(globals, globalsPtr.Type())
+		dataValue := ctx.ConstString(string(data), false)
+		dataGlobal := llvm.AddGlobal(mod, dataValue.Type(), "tinygo_compressedGlobals.data")
+		dataGlobal.SetInitializer(dataValue)
+		dataGlobal.SetGlobalConstant(true)
+		dataGlobal.SetLinkage(llvm.PrivateLinkage)
+		dataGlobal.SetUnnamedAddr(true)
+		dataPtr = llvm.ConstBitCast(dataGlobal, i8ptrType)
+	}
+	table.SetInitializer(llvm.ConstNamedStruct(tableType, []llvm.Value{
+		globalsPtr,
+		llvm.ConstInt(uintptrType, uint64(len(entries)), false),
+		dataPtr,
+	}))
+	table.SetGlobalConstant(true)
+	table.SetLinkage(llvm.InternalLinkage)
+	return len(entries)
+}
+
+// constBytes writes the in-memory representation of the given constant to
+// buf, which must be as large as the allocation size of its type. It returns
+// false if the constant can't be represented as plain bytes, for example
+// because it contains a pointer.
+func constBytes(targetData llvm.TargetData, value llvm.Value, buf []byte) bool {
+	if !value.IsAUndefValue().IsNil() || value.IsNull() {
+		// The buffer is already zeroed.
+		return true
+	}
+	typ := value.Type()
+	switch typ.TypeKind() {
+	case llvm.IntegerTypeKind:
+		if value.IsAConstantInt().IsNil() || targetData.TypeStoreSize(typ) > 8 {
+			// Probably a ptrtoint constant expression, or an unusually large
+			// integer.
+			return false
+		}
+		var word [8]byte
+		if targetData.ByteOrder() == llvm.LittleEndian {
+			binary.LittleEndian.PutUint64(word[:], value.ZExtValue())
+			copy(buf, word[:targetData.TypeStoreSize(typ)])
+		} else {
+			binary.BigEndian.PutUint64(word[:], value.ZExtValue())
+			copy(buf, word[8-targetData.TypeStoreSize(typ):])
+		}
+		return true
+	case llvm.ArrayTypeKind:
+		elementSize := targetData.TypeAllocSize(typ.ElementType())
+		for i := 0; i < typ.ArrayLength(); i++ {
+			element := llvm.ConstExtractValue(value, []uint32{uint32(i)})
+			offset := uint64(i) * elementSize
+			if !constBytes(targetData, element, buf[offset:offset+elementSize]) {
+				return false
+			}
+		}
+		return true
+	case llvm.StructTypeKind:
+		for i, elementType := range typ.StructElementTypes() {
+			element := llvm.ConstExtractValue(value, []uint32{uint32(i)})
+			offset := targetData.ElementOffset(typ, i)
+			if !constBytes(targetData, element, buf[offset:offset+targetData.TypeAllocSize(elementType)]) {
+				return false
+			}
+		}
+		return true
+	default:
+		// Pointers, floats, etc.
+		return false
+	}
+}
+
+// compressRLE compresses the given data with the run-length encoding used for
+// compressed globals: a control byte 0x00-0x7f is followed by 1-128 literal
+// bytes, a control byte 0x80-0xff by a byte that is repeated 3-130 times.
+func compressRLE(data []byte) []byte {
+	var out []byte
+	literalStart := 0
+	flushLiterals := func(end int) {
+		for literalStart < end {
+			n := end - literalStart
+			if n > 128 {
+				n = 128
+			}
+			out = append(out, byte(n-1))
+			out = append(out, data[literalStart:literalStart+n]...)
+			literalStart += n
+		}
+	}
+	for i := 0; i < len(data); {
+		run := 1
+		for i+run < len(data) && data[i+run] == data[i] && run < 130 {
+			run++
+		}
+		if run < 3 {
+			i += run
+			continue
+		}
+		flushLiterals(i)
+		out = append(out, byte(run-3+0x80), data[i])
+		i += run
+		literalStart = i
+	}
+	flushLiterals(len(data))
+	return out
+}
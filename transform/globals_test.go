@@ -0,0 +1,29 @@
+package transform
+
+import (
+	"testing"
+
+	"tinygo.org/x/go-llvm"
+)
+
+func TestPackGlobals(t *testing.T) {
+	t.Parallel()
+	testTransform(t, "testdata/globals-pack", func(mod llvm.Module) {
+		// Run packing pass.
+		packed := PackGlobals(mod)
+		if packed != 2 {
+			t.Errorf("expected 2 globals to be packed, got %d", packed)
+		}
+	})
+}
+
+func TestCompressGlobals(t *testing.T) {
+	t.Parallel()
+	testTransform(t, "testdata/globals-compress", func(mod llvm.Module) {
+		// Run compression pass.
+		compressed := CompressGlobals(mod)
+		if compressed != 2 {
+			t.Errorf("expected 2 globals to be compressed, got %d", compressed)
+		}
+	})
+}
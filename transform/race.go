@@ -0,0 +1,102 @@
+package transform
+
+// This file implements the instrumentation for the race detector (-race flag).
+// See src/runtime/race.go for the runtime side.
+
+import (
+	"strings"
+
+	"tinygo.org/x/go-llvm"
+)
+
+// raceIgnoredPackages lists the packages whose memory accesses are not
+// instrumented. The runtime implements the race detector itself, and the sync
+// packages tell the race detector about synchronization explicitly, just like
+// in the standard Go race detector.
+var raceIgnoredPackages = []string{"runtime.", "sync.", "sync/atomic."}
+
+// InstrumentRace inserts a call to runtime.raceRead before every load and a call
+// to runtime.raceWrite before every store that may access memory shared between
+// goroutines. Accesses to stack allocated memory and to constant globals are not
+// instrumented, because they can't race.
+//
+// This pass must run before any optimization pass, so that it sees every memory
+// access in the program and not just those that LLVM didn't optimize away.
+func InstrumentRace(mod llvm.Module) {
+	raceRead := mod.NamedFunction("runtime.raceRead")
+	raceWrite := mod.NamedFunction("runtime.raceWrite")
+	if raceRead.IsNil() || raceWrite.IsNil() {
+		// The race detector is not part of the runtime.
+		return
+	}
+
+	ctx := mod.Context()
+	builder := ctx.NewBuilder()
+	defer builder.Dispose()
+	i8ptrType := llvm.PointerType(ctx.Int8Type(), 0)
+
+	for fn := mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
+		if fn.IsDeclaration() || isRaceIgnored(fn.Name()) {
+			continue
+		}
+		for bb := fn.FirstBasicBlock(); !bb.IsNil(); bb = llvm.NextBasicBlock(bb) {
+			for inst := bb.FirstInstruction(); !inst.IsNil(); inst = llvm.NextInstruction(inst) {
+				var ptr, hook llvm.Value
+				switch {
+				case !inst.IsALoadInst().IsNil():
+					ptr = inst.Operand(0)
+					hook = raceRead
+				case !inst.IsAStoreInst().IsNil():
+					ptr = inst.Operand(1)
+					hook = raceWrite
+				default:
+					continue
+				}
+				if !mayBeShared(ptr) {
+					continue
+				}
+				builder.SetInsertPointBefore(inst)
+				addr := builder.CreateBitCast(ptr, i8ptrType, "")
+				builder.CreateCall(hook, []llvm.Value{addr, llvm.Undef(i8ptrType), llvm.ConstNull(i8ptrType)}, "")
+			}
+		}
+	}
+}
+
+// isRaceIgnored returns whether the function with the given name belongs to one
+// of the packages in raceIgnoredPackages. This includes methods, which have a
+// name like (*sync.Mutex).Lock.
+func isRaceIgnored(name string) bool {
+	name = strings.TrimLeft(name, "(*")
+	for _, prefix := range raceIgnoredPackages {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayBeShared returns whether the memory this pointer points to could also be
+// accessed by another goroutine. It returns false for stack allocations and for
+// constant globals.
+func mayBeShared(ptr llvm.Value) bool {
+	for {
+		switch {
+		case !ptr.IsAGetElementPtrInst().IsNil(), !ptr.IsABitCastInst().IsNil():
+			ptr = ptr.Operand(0)
+		case !ptr.IsAConstantExpr().IsNil():
+			switch ptr.Opcode() {
+			case llvm.GetElementPtr, llvm.BitCast:
+				ptr = ptr.Operand(0)
+			default:
+				return true
+			}
+		case !ptr.IsAAllocaInst().IsNil():
+			return false
+		case !ptr.IsAGlobalVariable().IsNil():
+			return !ptr.IsGlobalConstant()
+		default:
+			return true
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package transform
+
+import (
+	"testing"
+)
+
+func TestInstrumentRace(t *testing.T) {
+	t.Parallel()
+	testTransform(t, "testdata/race", InstrumentRace)
+}
@@ -1,6 +1,8 @@
 target datalayout = "e-m:e-p:32:32-i64:64-v128:64:128-a:0:32-n32-S64"
 target triple = "armv7m-none-eabi"
 
+@escapedPtr = global i8* null
+
 declare nonnull i8* @runtime.alloc(i32)
 
 ; Test allocating a single int (i32) that should be allocated on the stack.
@@ -68,6 +70,111 @@ end:
   ret void
 }
 
+; Store a pointer in another allocation, which is passed to a function that
+; only reads from it. The stored pointer doesn't escape, so it can be
+; allocated on the stack. (The other allocation can't, as the function
+; parameter doesn't have the nocapture flag).
+define void @testStoreInAlloc() {
+  %1 = call i8* @runtime.alloc(i32 8)
+  %2 = bitcast i8* %1 to { i32, i8* }*
+  %3 = call i8* @runtime.alloc(i32 4)
+  %4 = bitcast i8* %3 to i32*
+  store i32 5, i32* %4
+  %5 = insertvalue { i32, i8* } { i32 1, i8* undef }, i8* %3, 1
+  store { i32, i8* } %5, { i32, i8* }* %2
+  %6 = call i32 @readInterface({ i32, i8* }* %2)
+  ret void
+}
+
+; Same as above, but the called function lets the stored pointer escape.
+define void @testStoreInAllocEscaping() {
+  %1 = call i8* @runtime.alloc(i32 8)
+  %2 = bitcast i8* %1 to { i32, i8* }*
+  %3 = call i8* @runtime.alloc(i32 4)
+  %4 = bitcast i8* %3 to i32*
+  store i32 5, i32* %4
+  %5 = insertvalue { i32, i8* } { i32 1, i8* undef }, i8* %3, 1
+  store { i32, i8* } %5, { i32, i8* }* %2
+  call void @escapeInterface({ i32, i8* }* %2)
+  ret void
+}
+
+define i32 @readInterface({ i32, i8* }* %array) {
+  %1 = load { i32, i8* }, { i32, i8* }* %array
+  %2 = extractvalue { i32, i8* } %1, 1
+  %3 = bitcast i8* %2 to i32*
+  %4 = load i32, i32* %3
+  ret i32 %4
+}
+
+define void @escapeInterface({ i32, i8* }* nocapture %array) {
+  %1 = load { i32, i8* }, { i32, i8* }* %array
+  %2 = extractvalue { i32, i8* } %1, 1
+  store i8* %2, i8** @escapedPtr
+  ret void
+}
+
+; Pass a boxed value in a variadic parameter of interfaces, together with an
+; integer that is stored directly in an interface. The called function reads
+; both values, converting the integer back with ptrtoint. Neither the boxed
+; value nor the backing array of the parameter escape.
+define void @testVariadic() {
+  %1 = call i8* @runtime.alloc(i32 16)
+  %2 = bitcast i8* %1 to [2 x { i32, i8* }]*
+  %3 = call i8* @runtime.alloc(i32 8)
+  %4 = bitcast i8* %3 to { i32, i32 }*
+  store { i32, i32 } { i32 3, i32 4 }, { i32, i32 }* %4
+  %5 = insertvalue { i32, i8* } { i32 2, i8* undef }, i8* %3, 1
+  %6 = getelementptr [2 x { i32, i8* }], [2 x { i32, i8* }]* %2, i32 0, i32 0
+  store { i32, i8* } %5, { i32, i8* }* %6
+  %7 = getelementptr [2 x { i32, i8* }], [2 x { i32, i8* }]* %2, i32 0, i32 1
+  store { i32, i8* } { i32 1, i8* inttoptr (i32 5 to i8*) }, { i32, i8* }* %7
+  call void @printInterfaces({ i32, i8* }* %6, i32 2, i32 2)
+  ret void
+}
+
+; Same as above, but the called function converts the boxed value to an
+; integer and back to a pointer, which escapes.
+define void @testVariadicEscaping() {
+  %1 = call i8* @runtime.alloc(i32 8)
+  %2 = bitcast i8* %1 to [1 x { i32, i8* }]*
+  %3 = call i8* @runtime.alloc(i32 8)
+  %4 = bitcast i8* %3 to { i32, i32 }*
+  store { i32, i32 } { i32 3, i32 4 }, { i32, i32 }* %4
+  %5 = insertvalue { i32, i8* } { i32 2, i8* undef }, i8* %3, 1
+  %6 = getelementptr [1 x { i32, i8* }], [1 x { i32, i8* }]* %2, i32 0, i32 0
+  store { i32, i8* } %5, { i32, i8* }* %6
+  call void @escapeInterfaceField({ i32, i8* }* %6, i32 1, i32 1)
+  ret void
+}
+
+define void @printInterfaces({ i32, i8* }* nocapture %args.data, i32 %args.len, i32 %args.cap) {
+  %1 = load { i32, i8* }, { i32, i8* }* %args.data
+  %2 = extractvalue { i32, i8* } %1, 1
+  %3 = bitcast i8* %2 to { i32, i32 }*
+  %4 = load { i32, i32 }, { i32, i32 }* %3
+  %5 = extractvalue { i32, i32 } %4, 1
+  call void @runtime.printint32(i32 %5)
+  %6 = getelementptr { i32, i8* }, { i32, i8* }* %args.data, i32 1
+  %7 = load { i32, i8* }, { i32, i8* }* %6
+  %8 = extractvalue { i32, i8* } %7, 1
+  %9 = ptrtoint i8* %8 to i32
+  call void @runtime.printint32(i32 %9)
+  ret void
+}
+
+define void @escapeInterfaceField({ i32, i8* }* nocapture %args.data, i32 %args.len, i32 %args.cap) {
+  %1 = load { i32, i8* }, { i32, i8* }* %args.data
+  %2 = extractvalue { i32, i8* } %1, 1
+  %3 = ptrtoint i8* %2 to i32
+  %4 = add i32 %3, 4
+  %5 = inttoptr i32 %4 to i8*
+  store i8* %5, i8** @escapedPtr
+  ret void
+}
+
+declare void @runtime.printint32(i32)
+
 declare i32* @escapeIntPtr(i32*)
 
 declare i32* @noescapeIntPtr(i32* nocapture)
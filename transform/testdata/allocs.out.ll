@@ -1,6 +1,8 @@
 target datalayout = "e-m:e-p:32:32-i64:64-v128:64:128-a:0:32-n32-S64"
 target triple = "armv7m-none-eabi"
 
+@escapedPtr = global i8* null
+
 declare nonnull i8* @runtime.alloc(i32)
 
 define void @testInt() {
@@ -64,6 +66,107 @@ end:
   ret void
 }
 
+define void @testStoreInAlloc() {
+  %stackalloc.alloca = alloca [1 x i32]
+  %1 = call i8* @runtime.alloc(i32 8)
+  %2 = bitcast i8* %1 to { i32, i8* }*
+  store [1 x i32] zeroinitializer, [1 x i32]* %stackalloc.alloca
+  %stackalloc = bitcast [1 x i32]* %stackalloc.alloca to i8*
+  %3 = bitcast i8* %stackalloc to i32*
+  store i32 5, i32* %3
+  %4 = insertvalue { i32, i8* } { i32 1, i8* undef }, i8* %stackalloc, 1
+  store { i32, i8* } %4, { i32, i8* }* %2
+  %5 = call i32 @readInterface({ i32, i8* }* %2)
+  ret void
+}
+
+define void @testStoreInAllocEscaping() {
+  %stackalloc.alloca = alloca [2 x i32]
+  store [2 x i32] zeroinitializer, [2 x i32]* %stackalloc.alloca
+  %stackalloc = bitcast [2 x i32]* %stackalloc.alloca to { i32, i8* }*
+  %1 = call i8* @runtime.alloc(i32 4)
+  %2 = bitcast i8* %1 to i32*
+  store i32 5, i32* %2
+  %3 = insertvalue { i32, i8* } { i32 1, i8* undef }, i8* %1, 1
+  store { i32, i8* } %3, { i32, i8* }* %stackalloc
+  call void @escapeInterface({ i32, i8* }* %stackalloc)
+  ret void
+}
+
+define i32 @readInterface({ i32, i8* }* %array) {
+  %1 = load { i32, i8* }, { i32, i8* }* %array
+  %2 = extractvalue { i32, i8* } %1, 1
+  %3 = bitcast i8* %2 to i32*
+  %4 = load i32, i32* %3
+  ret i32 %4
+}
+
+define void @escapeInterface({ i32, i8* }* nocapture %array) {
+  %1 = load { i32, i8* }, { i32, i8* }* %array
+  %2 = extractvalue { i32, i8* } %1, 1
+  store i8* %2, i8** @escapedPtr
+  ret void
+}
+
+define void @testVariadic() {
+  %stackalloc.alloca1 = alloca [4 x i32]
+  %stackalloc.alloca = alloca [2 x i32]
+  store [4 x i32] zeroinitializer, [4 x i32]* %stackalloc.alloca1
+  %stackalloc2 = bitcast [4 x i32]* %stackalloc.alloca1 to [2 x { i32, i8* }]*
+  store [2 x i32] zeroinitializer, [2 x i32]* %stackalloc.alloca
+  %stackalloc = bitcast [2 x i32]* %stackalloc.alloca to i8*
+  %1 = bitcast i8* %stackalloc to { i32, i32 }*
+  store { i32, i32 } { i32 3, i32 4 }, { i32, i32 }* %1
+  %2 = insertvalue { i32, i8* } { i32 2, i8* undef }, i8* %stackalloc, 1
+  %3 = getelementptr [2 x { i32, i8* }], [2 x { i32, i8* }]* %stackalloc2, i32 0, i32 0
+  store { i32, i8* } %2, { i32, i8* }* %3
+  %4 = getelementptr [2 x { i32, i8* }], [2 x { i32, i8* }]* %stackalloc2, i32 0, i32 1
+  store { i32, i8* } { i32 1, i8* inttoptr (i32 5 to i8*) }, { i32, i8* }* %4
+  call void @printInterfaces({ i32, i8* }* %3, i32 2, i32 2)
+  ret void
+}
+
+define void @testVariadicEscaping() {
+  %stackalloc.alloca = alloca [2 x i32]
+  store [2 x i32] zeroinitializer, [2 x i32]* %stackalloc.alloca
+  %stackalloc = bitcast [2 x i32]* %stackalloc.alloca to [1 x { i32, i8* }]*
+  %1 = call i8* @runtime.alloc(i32 8)
+  %2 = bitcast i8* %1 to { i32, i32 }*
+  store { i32, i32 } { i32 3, i32 4 }, { i32, i32 }* %2
+  %3 = insertvalue { i32, i8* } { i32 2, i8* undef }, i8* %1, 1
+  %4 = getelementptr [1 x { i32, i8* }], [1 x { i32, i8* }]* %stackalloc, i32 0, i32 0
+  store { i32, i8* } %3, { i32, i8* }* %4
+  call void @escapeInterfaceField({ i32, i8* }* %4, i32 1, i32 1)
+  ret void
+}
+
+define void @printInterfaces({ i32, i8* }* nocapture %args.data, i32 %args.len, i32 %args.cap) {
+  %1 = load { i32, i8* }, { i32, i8* }* %args.data
+  %2 = extractvalue { i32, i8* } %1, 1
+  %3 = bitcast i8* %2 to { i32, i32 }*
+  %4 = load { i32, i32 }, { i32, i32 }* %3
+  %5 = extractvalue { i32, i32 } %4, 1
+  call void @runtime.printint32(i32 %5)
+  %6 = getelementptr { i32, i8* }, { i32, i8* }* %args.data, i32 1
+  %7 = load { i32, i8* }, { i32, i8* }* %6
+  %8 = extractvalue { i32, i8* } %7, 1
+  %9 = ptrtoint i8* %8 to i32
+  call void @runtime.printint32(i32 %9)
+  ret void
+}
+
+define void @escapeInterfaceField({ i32, i8* }* nocapture %args.data, i32 %args.len, i32 %args.cap) {
+  %1 = load { i32, i8* }, { i32, i8* }* %args.data
+  %2 = extractvalue { i32, i8* } %1, 1
+  %3 = ptrtoint i8* %2 to i32
+  %4 = add i32 %3, 4
+  %5 = inttoptr i32 %4 to i8*
+  store i8* %5, i8** @escapedPtr
+  ret void
+}
+
+declare void @runtime.printint32(i32)
+
 declare i32* @escapeIntPtr(i32*)
 
 declare i32* @noescapeIntPtr(i32* nocapture)
@@ -0,0 +1,15 @@
+target datalayout = "e-m:e-p:32:32-i64:64-n32:64-S128"
+target triple = "wasm32-unknown-unknown-wasm"
+
+; A global with more pointers than fit in a single byte of the bitmap.
+%largeStruct = type { [20 x i8*], i32, i8* }
+
+@globalLarge = global %largeStruct zeroinitializer
+@runtime.trackedGlobalsLength = external global i32
+@runtime.trackedGlobalsBitmap = external global [0 x i8]
+@runtime.trackedGlobalsStart = external global i32
+
+define void @main() {
+  %1 = load %largeStruct, %largeStruct* @globalLarge
+  ret void
+}
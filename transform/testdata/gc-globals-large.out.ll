@@ -0,0 +1,15 @@
+target datalayout = "e-m:e-p:32:32-i64:64-n32:64-S128"
+target triple = "wasm32-unknown-unknown-wasm"
+
+%largeStruct = type { [20 x i8*], i32, i8* }
+
+@runtime.trackedGlobalsLength = global i32 22
+@runtime.trackedGlobalsBitmap = external global [0 x i8]
+@runtime.trackedGlobalsStart = global i32 ptrtoint ({ %largeStruct }* @tinygo.trackedGlobals to i32)
+@tinygo.trackedGlobals = internal unnamed_addr global { %largeStruct } zeroinitializer
+@runtime.trackedGlobalsBitmap.1 = global [3 x i8] c"\FF\FF/"
+
+define void @main() {
+  %1 = load %largeStruct, %largeStruct* getelementptr inbounds ({ %largeStruct }, { %largeStruct }* @tinygo.trackedGlobals, i32 0, i32 0)
+  ret void
+}
@@ -0,0 +1,14 @@
+target datalayout = "e-m:e-p:32:32-i64:64-n32:64-S128"
+target triple = "wasm32-unknown-unknown-wasm"
+
+; The pointer in this packed struct is not aligned, so it can't be represented
+; in the globals bitmap.
+@globalPacked = global <{ i8, i8* }> zeroinitializer
+@runtime.trackedGlobalsLength = external global i32
+@runtime.trackedGlobalsBitmap = external global [0 x i8]
+@runtime.trackedGlobalsStart = external global i32
+
+define void @main() {
+  %1 = load <{ i8, i8* }>, <{ i8, i8* }>* @globalPacked
+  ret void
+}
@@ -0,0 +1,33 @@
+target datalayout = "e-m:e-p:32:32-i64:64-v128:64:128-a:0:32-n32-S64"
+target triple = "armv7m-none-eabi"
+
+%runtime.compressedGlobalsTable = type { %runtime.compressedGlobal*, i32, i8* }
+%runtime.compressedGlobal = type { i8*, i32 }
+
+@tinygo_compressedGlobals = external global %runtime.compressedGlobalsTable
+@main.table = internal global [128 x i8] c"\01\02\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\05"
+@main.config = internal global { i32, [60 x i8] } { i32 258, [60 x i8] zeroinitializer }
+@main.words = internal global [16 x i32] [i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1]
+@main.pointer = internal global { i8*, [60 x i8] } { i8* getelementptr inbounds ([128 x i8], [128 x i8]* @main.table, i32 0, i32 0), [60 x i8] zeroinitializer }
+@main.small = internal global [16 x i8] c"\01\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00"
+@main.constant = internal constant [128 x i8] c"\01\02\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\05"
+@main.zero = internal global [128 x i8] zeroinitializer
+@main.noinit = global [128 x i8] undef, section ".noinit"
+
+declare void @use(i8*)
+
+; Only @main.table and @main.config should be compressed: the others either
+; don't compress well enough, contain a pointer, are too small, are read-only,
+; are already zero or are explicitly placed.
+define void @main() {
+entry:
+  call void @use(i8* getelementptr inbounds ([128 x i8], [128 x i8]* @main.table, i32 0, i32 0))
+  call void @use(i8* bitcast ({ i32, [60 x i8] }* @main.config to i8*))
+  call void @use(i8* bitcast ([16 x i32]* @main.words to i8*))
+  call void @use(i8* bitcast ({ i8*, [60 x i8] }* @main.pointer to i8*))
+  call void @use(i8* getelementptr inbounds ([16 x i8], [16 x i8]* @main.small, i32 0, i32 0))
+  call void @use(i8* getelementptr inbounds ([128 x i8], [128 x i8]* @main.constant, i32 0, i32 0))
+  call void @use(i8* getelementptr inbounds ([128 x i8], [128 x i8]* @main.zero, i32 0, i32 0))
+  call void @use(i8* getelementptr inbounds ([128 x i8], [128 x i8]* @main.noinit, i32 0, i32 0))
+  ret void
+}
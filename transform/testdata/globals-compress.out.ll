@@ -0,0 +1,32 @@
+target datalayout = "e-m:e-p:32:32-i64:64-v128:64:128-a:0:32-n32-S64"
+target triple = "armv7m-none-eabi"
+
+%runtime.compressedGlobalsTable = type { %runtime.compressedGlobal*, i32, i8* }
+%runtime.compressedGlobal = type { i8*, i32 }
+
+@tinygo_compressedGlobals = internal constant %runtime.compressedGlobalsTable { %runtime.compressedGlobal* getelementptr inbounds ([2 x %runtime.compressedGlobal], [2 x %runtime.compressedGlobal]* @tinygo_compressedGlobals.globals, i32 0, i32 0), i32 2, i8* getelementptr inbounds ([12 x i8], [12 x i8]* @tinygo_compressedGlobals.data, i32 0, i32 0) }
+@main.table = internal global [128 x i8] zeroinitializer
+@main.config = internal global { i32, [60 x i8] } zeroinitializer
+@main.words = internal global [16 x i32] [i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1, i32 1]
+@main.pointer = internal global { i8*, [60 x i8] } { i8* getelementptr inbounds ([128 x i8], [128 x i8]* @main.table, i32 0, i32 0), [60 x i8] zeroinitializer }
+@main.small = internal global [16 x i8] c"\01\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00"
+@main.constant = internal constant [128 x i8] c"\01\02\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\00\05"
+@main.zero = internal global [128 x i8] zeroinitializer
+@main.noinit = global [128 x i8] undef, section ".noinit"
+@tinygo_compressedGlobals.globals = private constant [2 x %runtime.compressedGlobal] [%runtime.compressedGlobal { i8* getelementptr inbounds ([128 x i8], [128 x i8]* @main.table, i32 0, i32 0), i32 128 }, %runtime.compressedGlobal { i8* bitcast ({ i32, [60 x i8] }* @main.config to i8*), i32 64 }]
+@tinygo_compressedGlobals.data = private unnamed_addr constant [12 x i8] c"\01\01\02\FA\00\00\05\01\02\01\BB\00"
+
+declare void @use(i8*)
+
+define void @main() {
+entry:
+  call void @use(i8* getelementptr inbounds ([128 x i8], [128 x i8]* @main.table, i32 0, i32 0))
+  call void @use(i8* bitcast ({ i32, [60 x i8] }* @main.config to i8*))
+  call void @use(i8* bitcast ([16 x i32]* @main.words to i8*))
+  call void @use(i8* bitcast ({ i8*, [60 x i8] }* @main.pointer to i8*))
+  call void @use(i8* getelementptr inbounds ([16 x i8], [16 x i8]* @main.small, i32 0, i32 0))
+  call void @use(i8* getelementptr inbounds ([128 x i8], [128 x i8]* @main.constant, i32 0, i32 0))
+  call void @use(i8* getelementptr inbounds ([128 x i8], [128 x i8]* @main.zero, i32 0, i32 0))
+  call void @use(i8* getelementptr inbounds ([128 x i8], [128 x i8]* @main.noinit, i32 0, i32 0))
+  ret void
+}
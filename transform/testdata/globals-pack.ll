@@ -0,0 +1,33 @@
+target datalayout = "e-m:e-i64:64-f80:128-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.a = internal constant i32 1
+@main.b = internal constant i32 2
+@main.byte = internal constant i8 3
+@main.section = internal constant i32 4, section ".rodata.section"
+@main.aligned = internal constant i32 5, align 16
+@main.variable = internal global i32 6
+@main.exported = constant i32 7
+@main.big = internal constant [64 x i8] zeroinitializer
+
+declare void @use(i32*)
+
+declare void @useByte(i8*)
+
+declare void @useBig([64 x i8]*)
+
+; Only @main.a and @main.b should be packed: the others are either the only
+; global with a given alignment, are explicitly placed, are not read-only, are
+; externally visible or are too big.
+define void @main() {
+entry:
+  call void @use(i32* @main.a)
+  call void @use(i32* @main.b)
+  call void @useByte(i8* @main.byte)
+  call void @use(i32* @main.section)
+  call void @use(i32* @main.aligned)
+  call void @use(i32* @main.variable)
+  call void @use(i32* @main.exported)
+  call void @useBig([64 x i8]* @main.big)
+  ret void
+}
@@ -0,0 +1,29 @@
+target datalayout = "e-m:e-i64:64-f80:128-n8:16:32:64-S128"
+target triple = "x86_64--linux"
+
+@main.byte = internal constant i8 3
+@main.section = internal constant i32 4, section ".rodata.section"
+@main.aligned = internal constant i32 5, align 16
+@main.variable = internal global i32 6
+@main.exported = constant i32 7
+@main.big = internal constant [64 x i8] zeroinitializer
+@tinygo.packedGlobals.4 = private unnamed_addr constant { i32, i32 } { i32 1, i32 2 }, align 4
+
+declare void @use(i32*)
+
+declare void @useByte(i8*)
+
+declare void @useBig([64 x i8]*)
+
+define void @main() {
+entry:
+  call void @use(i32* getelementptr inbounds ({ i32, i32 }, { i32, i32 }* @tinygo.packedGlobals.4, i32 0, i32 0))
+  call void @use(i32* getelementptr inbounds ({ i32, i32 }, { i32, i32 }* @tinygo.packedGlobals.4, i32 0, i32 1))
+  call void @useByte(i8* @main.byte)
+  call void @use(i32* @main.section)
+  call void @use(i32* @main.aligned)
+  call void @use(i32* @main.variable)
+  call void @use(i32* @main.exported)
+  call void @useBig([64 x i8]* @main.big)
+  ret void
+}
@@ -0,0 +1,47 @@
+target datalayout = "e-m:e-p:32:32-i64:64-v128:64:128-a:0:32-n32-S64"
+target triple = "armv7m-none-eabi"
+
+%sync.Mutex = type { i1 }
+
+@main.counter = global i32 0
+@main.table = constant [2 x i32] [i32 1, i32 2]
+@runtime.state = global i32 0
+
+declare void @runtime.raceRead(i8*, i8*, i8*)
+
+declare void @runtime.raceWrite(i8*, i8*, i8*)
+
+define void @main.increment(i32* %ptr) {
+  call void @runtime.raceRead(i8* bitcast (i32* @main.counter to i8*), i8* undef, i8* null)
+  %counter = load i32, i32* @main.counter
+  %counter.next = add i32 %counter, 1
+  call void @runtime.raceWrite(i8* bitcast (i32* @main.counter to i8*), i8* undef, i8* null)
+  store i32 %counter.next, i32* @main.counter
+  %field = getelementptr i32, i32* %ptr, i32 1
+  %1 = bitcast i32* %field to i8*
+  call void @runtime.raceWrite(i8* %1, i8* undef, i8* null)
+  store i32 %counter, i32* %field
+  ret void
+}
+
+define i32 @main.local(i32 %index) {
+  %local = alloca [2 x i32]
+  %local.elem = getelementptr [2 x i32], [2 x i32]* %local, i32 0, i32 1
+  store i32 %index, i32* %local.elem
+  %local.cast = bitcast i32* %local.elem to i8*
+  store i8 0, i8* %local.cast
+  %elem = getelementptr [2 x i32], [2 x i32]* @main.table, i32 0, i32 %index
+  %value = load i32, i32* %elem
+  ret i32 %value
+}
+
+define void @runtime.update() {
+  store i32 1, i32* @runtime.state
+  ret void
+}
+
+define void @"(*sync.Mutex).Lock"(%sync.Mutex* %m) {
+  %locked = getelementptr %sync.Mutex, %sync.Mutex* %m, i32 0, i32 0
+  store i1 true, i1* %locked
+  ret void
+}